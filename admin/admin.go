@@ -3,21 +3,25 @@ package admin
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
+	"strings"
 	"time"
 
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
+	"encore.dev/storage/sqldb/sqlerr"
 )
 
 // User represents a user in the system
 type User struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 // UserDetail contains additional user information
@@ -35,21 +39,32 @@ type UserDetail struct {
 }
 
 // AuthResponse is returned after successful authentication
+//
+// When the user has two-factor authentication enabled, Login sets MFARequired and
+// MFAToken instead of the tokens; pass MFAToken to VerifyMFA with a code to finish.
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  *User  `json:"user"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	MFARequired  bool      `json:"mfa_required"`
+	MFAToken     string    `json:"mfa_token,omitempty"`
+	User         *User     `json:"user"`
 }
 
 // LoginParams contains the data needed to authenticate a user
 type LoginParams struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name,omitempty"`
+	UserAgent  string `header:"User-Agent"`
+	IPAddress  string `header:"X-Forwarded-For"`
 }
 
 // ProfileResponse contains the user's profile information
 type ProfileResponse struct {
-	User       *User       `json:"user"`
-	UserDetail *UserDetail `json:"user_detail"`
+	User       *User        `json:"user"`
+	UserDetail *UserDetail  `json:"user_detail"`
+	Roles      []authz.Role `json:"roles"`
 }
 
 // RegisterParams contains the data needed to register a new user
@@ -62,109 +77,233 @@ type RegisterParams struct {
 	ProvinceID *int    `json:"province_id,omitempty"`
 	CityID     *int    `json:"city_id,omitempty"`
 	DistrictID *int    `json:"district_id,omitempty"`
+	DeviceName string  `json:"device_name,omitempty"`
+	UserAgent  string  `header:"User-Agent"`
+	IPAddress  string  `header:"X-Forwarded-For"`
 }
 
 // Register creates a new user account
 //
 //encore:api public method=POST path=/admin/register
 func Register(ctx context.Context, params *RegisterParams) (*AuthResponse, error) {
-	// Hash the password
-	hashedPassword := hashPassword(params.Password)
+	username := strings.TrimSpace(params.Username)
+	email := normalizeEmail(params.Email)
+	fullname := strings.TrimSpace(params.Fullname)
 
-	// Start a transaction
-	tx, err := db.Begin(ctx)
-	if err != nil {
+	// Validate the input
+	v := &validator{}
+	v.checkUsername("username", username)
+	v.checkEmail("email", email)
+	v.checkPassword("password", params.Password, username)
+	v.checkFullname("fullname", fullname)
+	if err := v.checkLocation(ctx, params.ProvinceID, params.DistrictID, params.CityID); err != nil {
+		return nil, err
+	}
+	if err := v.checkUsernameAvailable(ctx, "username", username, 0); err != nil {
+		return nil, err
+	}
+	if err := v.checkEmailAvailable(ctx, "email", email, 0); err != nil {
+		return nil, err
+	}
+	if err := v.err(); err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
 
-	// Insert user
-	var userID int
-	err = tx.QueryRow(ctx, `
-		INSERT INTO users (username, email, password_hash, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
-		RETURNING id
-	`, params.Username, params.Email, hashedPassword).Scan(&userID)
+	// Hash the password
+	hashedPassword, err := hashPassword(params.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	// Insert user details
-	_, err = tx.Exec(ctx, `
-		INSERT INTO user_details (
-			user_id, fullname, address, province_id, city_id, district_id, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
-	`, userID, params.Fullname, params.Address, params.ProvinceID, params.CityID, params.DistrictID)
+	// Start a transaction
+	tx, err := db.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback()
+
+	userID, err := createUser(ctx, tx, &newUser{
+		Username:     username,
+		Email:        email,
+		PasswordHash: hashedPassword,
+		Fullname:     fullname,
+		Address:      params.Address,
+		ProvinceID:   params.ProvinceID,
+		DistrictID:   params.DistrictID,
+		CityID:       params.CityID,
+	})
+	if sqldb.ErrCode(err) == sqlerr.UniqueViolation {
+		// Lost a race with a concurrent registration
+		return nil, &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "username or email address already in use",
+		}
+	} else if err != nil {
+		return nil, err
+	}
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
+	recordUserChange(ctx, actionRegister, userID, nil)
 
 	// Get the created user
 	user := &User{
 		ID:        userID,
-		Username:  params.Username,
-		Email:     params.Email,
+		Username:  username,
+		Email:     email,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
-	// Generate token (in a real app, use JWT or similar)
-	token := generateToken(userID)
+	// Ask the user to confirm their address; they can request another email if this fails
+	if err := sendVerificationEmail(ctx, user.ID, user.Email, purposeVerify); err != nil {
+		rlog.Error("could not send verification email", "user_id", user.ID, "err", err)
+	}
 
-	return &AuthResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	// Start a session
+	return startSession(ctx, user, params.DeviceName, params.IPAddress, params.UserAgent, false)
+}
+
+// newUser is the data a new account is created with
+type newUser struct {
+	Username      string
+	Email         string
+	PasswordHash  string
+	Fullname      string
+	Address       *string
+	ProvinceID    *int
+	DistrictID    *int
+	CityID        *int
+	EmailVerified bool
+}
+
+// createUser inserts a user with their details and returns the new user's ID
+func createUser(ctx context.Context, tx *sqldb.Tx, u *newUser) (int, error) {
+	// Insert user
+	var userID int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO users (username, email, password_hash, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, CASE WHEN $4 THEN NOW() END, NOW(), NOW())
+		RETURNING id
+	`, u.Username, u.Email, u.PasswordHash, u.EmailVerified).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Insert user details
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_details (
+			user_id, fullname, address, province_id, city_id, district_id, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+	`, userID, u.Fullname, u.Address, u.ProvinceID, u.CityID, u.DistrictID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Every new user starts out as a trainee
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_roles (user_id, role, created_at)
+		VALUES ($1, $2, NOW())
+	`, userID, authz.RoleTrainee)
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
 }
 
 // Login authenticates a user
 //
 //encore:api public method=POST path=/admin/login
 func Login(ctx context.Context, params *LoginParams) (*AuthResponse, error) {
+	ip := clientIP(params.IPAddress)
+
+	// Refuse guesses while the username or address is backing off
+	if err := checkLoginThrottle(ctx, params.Username, ip); err != nil {
+		auditLoginAttempt(ctx, params.Username, 0, ip, params.UserAgent, false, loginThrottled)
+		return nil, err
+	}
+
 	// Get user by username
 	var user User
 	var hashedPassword string
+	var suspended, resetRequired bool
 	err := db.QueryRow(ctx, `
-        SELECT id, username, email, password_hash, created_at, updated_at
+        SELECT id, username, email, email_verified_at, password_hash,
+               suspended_at IS NOT NULL, password_reset_required, created_at, updated_at
         FROM users
-        WHERE username = $1
-    `, params.Username).Scan(&user.ID, &user.Username, &user.Email, &hashedPassword, &user.CreatedAt, &user.UpdatedAt)
+        WHERE LOWER(username) = LOWER($1) AND deleted_at IS NULL
+    `, params.Username).Scan(
+		&user.ID, &user.Username, &user.Email, &user.EmailVerifiedAt, &hashedPassword,
+		&suspended, &resetRequired, &user.CreatedAt, &user.UpdatedAt,
+	)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		// Spend the time of a password check so unknown usernames can't be told apart
+		verifyPassword(params.Password, dummyPasswordHash())
+		recordLoginFailure(ctx, params.Username, ip)
+		auditLoginAttempt(ctx, params.Username, 0, ip, params.UserAgent, false, loginInvalidCredentials)
+		return nil, errInvalidCredentials
 	}
 
 	// Verify password
-	if !verifyPassword(params.Password, hashedPassword) {
-		return nil, errors.New("invalid credentials")
+	ok, needsRehash, err := verifyPassword(params.Password, hashedPassword)
+	if err != nil || !ok {
+		recordLoginFailure(ctx, params.Username, ip)
+		auditLoginAttempt(ctx, params.Username, user.ID, ip, params.UserAgent, false, loginInvalidCredentials)
+		return nil, errInvalidCredentials
 	}
+	recordLoginSuccess(ctx, params.Username)
 
-	// Rest of the function remains the same
-	token := generateToken(user.ID)
+	// Only tell the account state to someone who knows the password
+	if suspended {
+		auditLoginAttempt(ctx, params.Username, user.ID, ip, params.UserAgent, false, loginSuspended)
+		return nil, errAccountSuspended
+	}
+	if resetRequired {
+		auditLoginAttempt(ctx, params.Username, user.ID, ip, params.UserAgent, false, loginResetRequired)
+		return nil, errPasswordResetRequired
+	}
 
-	return &AuthResponse{
-		Token: token,
-		User:  &user,
-	}, nil
+	// Upgrade legacy or outdated hashes now that we know the plaintext
+	if needsRehash {
+		if err := rehashPassword(ctx, user.ID, hashedPassword, params.Password); err != nil {
+			rlog.Error("could not upgrade password hash", "user_id", user.ID, "err", err)
+		}
+	}
+
+	// Ask for the second factor if the user enrolled one
+	enabled, err := mfaEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		auditLoginAttempt(ctx, params.Username, user.ID, ip, params.UserAgent, true, loginMFARequired)
+		return startMFAChallenge(ctx, &user, params.DeviceName)
+	}
+
+	// Start a session
+	auditLoginAttempt(ctx, params.Username, user.ID, ip, params.UserAgent, true, loginSucceeded)
+	return startSession(ctx, &user, params.DeviceName, params.IPAddress, params.UserAgent, false)
 }
 
 // GetProfile returns the current user's profile
-
+//
+//encore:api auth method=GET path=/admin/me tag:scope_profile_read tag:scope_profile_write
 func GetProfile(ctx context.Context) (*ProfileResponse, error) {
-	// In a real app, get user ID from context (from JWT or session)
-	userID := 1 // This should come from the authenticated context
+	// Get the user ID of the authenticated caller
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
 
 	// Get user
 	var user User
-	err := db.QueryRow(ctx, `
-        SELECT id, username, email, created_at, updated_at
+	err = db.QueryRow(ctx, `
+        SELECT id, username, email, email_verified_at, created_at, updated_at
         FROM users
         WHERE id = $1
-    `, userID).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+    `, userID).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -172,7 +311,7 @@ func GetProfile(ctx context.Context) (*ProfileResponse, error) {
 	// Get user details
 	var detail UserDetail
 	err = db.QueryRow(ctx, `
-        SELECT id, user_id, fullname, address, postal_code, 
+        SELECT id, user_id, fullname, COALESCE(address, ''), COALESCE(postal_code, ''),
                province_id, city_id, district_id, created_at, updated_at
         FROM user_details
         WHERE user_id = $1
@@ -180,32 +319,39 @@ func GetProfile(ctx context.Context) (*ProfileResponse, error) {
 		&detail.ID, &detail.UserID, &detail.Fullname, &detail.Address, &detail.PostalCode,
 		&detail.ProvinceID, &detail.CityID, &detail.DistrictID, &detail.CreatedAt, &detail.UpdatedAt,
 	)
-	if err != nil {
+	if errors.Is(err, sqldb.ErrNoRows) {
 		// User details might not exist yet
 		detail = UserDetail{UserID: userID}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Get roles
+	roles, err := loadRoles(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ProfileResponse{
 		User:       &user,
 		UserDetail: &detail,
+		Roles:      roles,
 	}, nil
 }
 
-// Helper function to hash password
-func hashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
-}
-
-// Helper function to verify password
-func verifyPassword(password, hashedPassword string) bool {
-	return hashPassword(password) == hashedPassword
-}
-
-// Helper function to generate token (in a real app, use JWT)
-func generateToken(userID int) string {
-	// This is a simplified example. In production, use a proper JWT implementation
-	return "generated-jwt-token-for-user-" + string(userID)
+// Helper function to replace a user's password hash with a freshly computed one.
+// The old hash is part of the condition so a concurrent password change wins.
+func rehashPassword(ctx context.Context, userID int, oldHash, password string) error {
+	newHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `
+        UPDATE users
+        SET password_hash = $1, updated_at = NOW()
+        WHERE id = $2 AND password_hash = $3
+    `, newHash, userID, oldHash)
+	return err
 }
 
 // Define the database connection
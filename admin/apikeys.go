@@ -0,0 +1,390 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+const (
+	// apiKeyPrefix starts every API key so it can be told apart from an access token
+	apiKeyPrefix = "fit_"
+
+	// apiKeyDisplayLength is how much of a key is kept to recognize it in lists
+	apiKeyDisplayLength = 12
+
+	apiKeyNameMaxLength = 100
+	maxAPIKeysPerOwner  = 25
+
+	// apiKeyUsageInterval is how often last_used_at is written for a busy key
+	apiKeyUsageInterval = time.Minute
+)
+
+const (
+	actionCreateAPIKey = "api_key.create"
+	actionRevokeAPIKey = "api_key.revoke"
+
+	auditEntityAPIKey = "api_key"
+)
+
+var errAPIKeyNotFound = &errs.Error{
+	Code:    errs.NotFound,
+	Message: "api key not found",
+}
+
+// APIKey describes an API key without its secret
+type APIKey struct {
+	ID           int           `json:"id"`
+	Name         string        `json:"name"`
+	Prefix       string        `json:"prefix"`
+	Scopes       []authz.Scope `json:"scopes"`
+	OwnerUserID  *int          `json:"owner_user_id,omitempty"`
+	CreatedBy    *int          `json:"created_by,omitempty"`
+	ExpiresAt    *time.Time    `json:"expires_at,omitempty"`
+	LastUsedAt   *time.Time    `json:"last_used_at,omitempty"`
+	LastUsedIP   *string       `json:"last_used_ip,omitempty"`
+	RevokedAt    *time.Time    `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Organization bool          `json:"organization"`
+}
+
+// APIKeysResponse lists API keys, newest first
+type APIKeysResponse struct {
+	APIKeys []*APIKey `json:"api_keys"`
+}
+
+// CreateAPIKeyParams contains the data needed to create an API key.
+// A key without ExpiresAt is valid until it is revoked.
+type CreateAPIKeyParams struct {
+	Name      string        `json:"name"`
+	Scopes    []authz.Scope `json:"scopes"`
+	ExpiresAt *time.Time    `json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKey contains a new API key. The key itself is only ever returned here.
+type CreatedAPIKey struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
+
+// CreateAPIKey creates a personal API key that acts as the current user,
+// limited to the given scopes
+//
+//encore:api auth method=POST path=/admin/api-keys
+func CreateAPIKey(ctx context.Context, params *CreateAPIKeyParams) (*CreatedAPIKey, error) {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	return createAPIKey(ctx, &userID, userID, params)
+}
+
+// MyAPIKeys returns the personal API keys of the current user, including revoked and expired ones
+//
+//encore:api auth method=GET path=/admin/api-keys
+func MyAPIKeys(ctx context.Context) (*APIKeysResponse, error) {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := listAPIKeys(ctx, &userID)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeysResponse{APIKeys: keys}, nil
+}
+
+// RevokeAPIKey revokes a personal API key of the current user
+//
+//encore:api auth method=DELETE path=/admin/api-keys/:id
+func RevokeAPIKey(ctx context.Context, id int) error {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return err
+	}
+	return revokeAPIKey(ctx, id, &userID)
+}
+
+// CreateOrgAPIKey creates an organization API key, such as one for a gym kiosk.
+// It doesn't act as any user and survives the administrator who created it.
+//
+//encore:api auth method=POST path=/admin/org/api-keys tag:admin
+func CreateOrgAPIKey(ctx context.Context, params *CreateAPIKeyParams) (*CreatedAPIKey, error) {
+	callerID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	return createAPIKey(ctx, nil, callerID, params)
+}
+
+// ListOrgAPIKeys returns the organization API keys, including revoked and expired ones
+//
+//encore:api auth method=GET path=/admin/org/api-keys tag:admin
+func ListOrgAPIKeys(ctx context.Context) (*APIKeysResponse, error) {
+	keys, err := listAPIKeys(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &APIKeysResponse{APIKeys: keys}, nil
+}
+
+// RevokeOrgAPIKey revokes an organization API key
+//
+//encore:api auth method=DELETE path=/admin/org/api-keys/:id tag:admin
+func RevokeOrgAPIKey(ctx context.Context, id int) error {
+	return revokeAPIKey(ctx, id, nil)
+}
+
+// createAPIKey validates and stores a new key. A nil owner creates an organization key.
+func createAPIKey(ctx context.Context, ownerID *int, createdBy int, params *CreateAPIKeyParams) (*CreatedAPIKey, error) {
+	// Validate the input
+	v := &validator{}
+	name := strings.TrimSpace(params.Name)
+	switch n := utf8.RuneCountInString(name); {
+	case n == 0:
+		v.add("name", ViolationRequired, "name is required")
+	case n > apiKeyNameMaxLength:
+		v.add("name", ViolationTooLong, fmt.Sprintf("name must be at most %d characters", apiKeyNameMaxLength))
+	}
+	scopes := make([]authz.Scope, 0, len(params.Scopes))
+	for _, s := range params.Scopes {
+		if !s.Valid() {
+			v.add("scopes", ViolationInvalidFormat, fmt.Sprintf("unknown scope %q", s))
+		} else if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(params.Scopes) == 0 {
+		v.add("scopes", ViolationRequired, "at least one scope is required")
+	}
+	if params.ExpiresAt != nil && !params.ExpiresAt.After(time.Now()) {
+		v.add("expires_at", ViolationInvalidFormat, "expiry must be in the future")
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Keys pile up unnoticed, so cap the active ones per owner
+	var active int
+	err = tx.QueryRow(ctx, `
+        SELECT COUNT(*)
+        FROM api_keys
+        WHERE owner_user_id IS NOT DISTINCT FROM $1
+          AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+    `, ownerID).Scan(&active)
+	if err != nil {
+		return nil, err
+	}
+	if active >= maxAPIKeysPerOwner {
+		return nil, &errs.Error{
+			Code:    errs.ResourceExhausted,
+			Message: fmt.Sprintf("at most %d active api keys are allowed; revoke one first", maxAPIKeysPerOwner),
+		}
+	}
+
+	secret, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + secret
+
+	row := tx.QueryRow(ctx, `
+        INSERT INTO api_keys (owner_user_id, created_by, name, prefix, key_hash, scopes, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+        RETURNING id, name, prefix, scopes, owner_user_id, created_by, expires_at, last_used_at, last_used_ip, revoked_at, created_at
+    `, ownerID, createdBy, name, key[:apiKeyDisplayLength], hashOpaqueToken(key), scopeStrings(scopes), params.ExpiresAt)
+	apiKey, err := scanAPIKey(row)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     actionCreateAPIKey,
+		EntityType: auditEntityAPIKey,
+		EntityID:   strconv.Itoa(apiKey.ID),
+		After:      apiKey,
+	})
+	return &CreatedAPIKey{Key: key, APIKey: apiKey}, nil
+}
+
+// listAPIKeys returns the keys of an owner, or the organization keys for a nil owner
+func listAPIKeys(ctx context.Context, ownerID *int) ([]*APIKey, error) {
+	rows, err := db.Query(ctx, `
+        SELECT id, name, prefix, scopes, owner_user_id, created_by, expires_at, last_used_at, last_used_ip, revoked_at, created_at
+        FROM api_keys
+        WHERE owner_user_id IS NOT DISTINCT FROM $1
+        ORDER BY created_at DESC, id DESC
+    `, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// revokeAPIKey revokes a key of an owner, or an organization key for a nil owner
+func revokeAPIKey(ctx context.Context, id int, ownerID *int) error {
+	before, err := scanAPIKey(db.QueryRow(ctx, `
+        SELECT id, name, prefix, scopes, owner_user_id, created_by, expires_at, last_used_at, last_used_ip, revoked_at, created_at
+        FROM api_keys
+        WHERE id = $1 AND owner_user_id IS NOT DISTINCT FROM $2
+    `, id, ownerID))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return errAPIKeyNotFound
+	} else if err != nil {
+		return err
+	}
+	if before.RevokedAt != nil {
+		return nil
+	}
+
+	after, err := scanAPIKey(db.QueryRow(ctx, `
+        UPDATE api_keys
+        SET revoked_at = NOW()
+        WHERE id = $1 AND revoked_at IS NULL
+        RETURNING id, name, prefix, scopes, owner_user_id, created_by, expires_at, last_used_at, last_used_ip, revoked_at, created_at
+    `, id))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		// Revoked concurrently
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     actionRevokeAPIKey,
+		EntityType: auditEntityAPIKey,
+		EntityID:   strconv.Itoa(id),
+		Before:     before,
+		After:      after,
+	})
+	return nil
+}
+
+// authenticateAPIKey checks an API key presented to the auth handler and returns the
+// auth data of its requests. Personal keys get the current roles of their owner.
+func authenticateAPIKey(ctx context.Context, key, ip string) (*authz.AuthData, error) {
+	errInvalidKey := &errs.Error{
+		Code:    errs.Unauthenticated,
+		Message: "invalid api key",
+	}
+
+	var (
+		keyID         int
+		ownerID       *int
+		scopes        []string
+		emailVerified bool
+		ownerActive   bool
+	)
+	err := db.QueryRow(ctx, `
+        SELECT k.id, k.owner_user_id, k.scopes,
+               u.email_verified_at IS NOT NULL,
+               COALESCE(u.suspended_at IS NULL AND u.deleted_at IS NULL, k.owner_user_id IS NULL)
+        FROM api_keys k
+        LEFT JOIN users u ON u.id = k.owner_user_id
+        WHERE k.key_hash = $1 AND k.revoked_at IS NULL
+          AND (k.expires_at IS NULL OR k.expires_at > NOW())
+    `, hashOpaqueToken(key)).Scan(&keyID, &ownerID, &scopes, &emailVerified, &ownerActive)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errInvalidKey
+	} else if err != nil {
+		return nil, err
+	}
+	if !ownerActive {
+		return nil, errInvalidKey
+	}
+
+	data := &authz.AuthData{
+		APIKeyID:      keyID,
+		EmailVerified: emailVerified,
+		ClientIP:      ip,
+	}
+	for _, s := range scopes {
+		data.Scopes = append(data.Scopes, authz.Scope(s))
+	}
+	if ownerID != nil {
+		data.UserID = *ownerID
+		if data.Roles, err = loadRoles(ctx, *ownerID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Busy keys only record their use once per interval
+	_, err = db.Exec(ctx, `
+        UPDATE api_keys
+        SET last_used_at = NOW(), last_used_ip = $2
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)
+    `, keyID, ip, time.Now().Add(-apiKeyUsageInterval))
+	if err != nil {
+		rlog.Error("could not record api key use", "api_key_id", keyID, "err", err)
+	}
+	return data, nil
+}
+
+// scanAPIKey reads a key selected with the columns used throughout this file
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var k APIKey
+	var scopes []string
+	err := row.Scan(
+		&k.ID,
+		&k.Name,
+		&k.Prefix,
+		&scopes,
+		&k.OwnerUserID,
+		&k.CreatedBy,
+		&k.ExpiresAt,
+		&k.LastUsedAt,
+		&k.LastUsedIP,
+		&k.RevokedAt,
+		&k.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	k.Scopes = make([]authz.Scope, len(scopes))
+	for i, s := range scopes {
+		k.Scopes[i] = authz.Scope(s)
+	}
+	k.Organization = k.OwnerUserID == nil
+	return &k, nil
+}
+
+func scopeStrings(scopes []authz.Scope) []string {
+	out := make([]string, len(scopes))
+	for i, s := range scopes {
+		out[i] = string(s)
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"encore.app/authz"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+// AuthParams are the parts of an incoming request the auth handler reads
+type AuthParams struct {
+	Authorization string `header:"Authorization"`
+	ForwardedFor  string `header:"X-Forwarded-For"`
+}
+
+// AuthHandler validates the bearer token of incoming requests, which is either an
+// access token or an API key. The user ID is available through auth.UserID() and
+// the roles through auth.Data(), see authz.CurrentCaller.
+//
+//encore:authhandler
+func AuthHandler(ctx context.Context, params *AuthParams) (auth.UID, *authz.AuthData, error) {
+	token, ok := strings.CutPrefix(params.Authorization, "Bearer ")
+	if !ok {
+		return "", nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "invalid token",
+		}
+	}
+
+	if strings.HasPrefix(token, apiKeyPrefix) {
+		data, err := authenticateAPIKey(ctx, token, clientIP(params.ForwardedFor))
+		if err != nil {
+			return "", nil, err
+		}
+		// Organization keys get a user ID that no user has
+		uid := auth.UID("apikey:" + strconv.Itoa(data.APIKeyID))
+		if data.UserID != 0 {
+			uid = auth.UID(strconv.Itoa(data.UserID))
+		}
+		return uid, data, nil
+	}
+
+	claims, err := parseToken(token)
+	if err != nil {
+		return "", nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "invalid token",
+		}
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return "", nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "invalid token",
+		}
+	}
+
+	return auth.UID(claims.Subject), &authz.AuthData{
+		UserID:        userID,
+		Roles:         claims.Roles,
+		EmailVerified: claims.EmailVerified,
+		MFAVerified:   claims.MFAVerified,
+		SessionID:     claims.SessionID,
+		ClientIP:      clientIP(params.ForwardedFor),
+	}, nil
+}
+
+// CurrentUserID returns the ID of the authenticated user making the current request
+func CurrentUserID() (int, error) {
+	uid, ok := auth.UserID()
+	if !ok {
+		return 0, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "not authenticated",
+		}
+	}
+	userID, err := strconv.Atoi(string(uid))
+	if err != nil {
+		if strings.HasPrefix(string(uid), "apikey:") {
+			return 0, &errs.Error{
+				Code:    errs.PermissionDenied,
+				Message: "organization api keys can't act as a user",
+			}
+		}
+		return 0, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "not authenticated",
+		}
+	}
+	return userID, nil
+}
+
+// currentAuthData returns the authentication data of the current request
+func currentAuthData() (*authz.AuthData, error) {
+	data, ok := auth.Data().(*authz.AuthData)
+	if !ok || data == nil {
+		return nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "not authenticated",
+		}
+	}
+	return data, nil
+}
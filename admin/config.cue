@@ -0,0 +1,24 @@
+// Trainers see clients' health data, so they must prove they own their
+// email address before using trainer features. Local development skips the check.
+RequireVerifiedEmailForTrainers: #Meta.Environment.Cloud != "local"
+
+// Trainers and admins must sign in with TOTP outside local development.
+RequireMFAForPrivilegedRoles: #Meta.Environment.Cloud != "local"
+
+// Requests reach the app through a single proxy that appends the client
+// address to X-Forwarded-For. Raise this when another proxy is put in front.
+TrustedProxyHops: 1
+
+// Identity providers for "sign in with ...". Local development signs in
+// through the mock issuer started with `go run ./cmd/mock-oidc`.
+OIDCProviders: *[] | [...]
+
+if #Meta.Environment.Cloud == "local" {
+	OIDCProviders: [{
+		Name:        "mock"
+		Issuer:      "http://localhost:9500"
+		ClientID:    "fitness-local"
+		Scopes:      ["openid", "email", "profile"]
+		RedirectURL: "http://localhost:3000/auth/callback"
+	}]
+}
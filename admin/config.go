@@ -0,0 +1,39 @@
+package admin
+
+import "encore.dev/config"
+
+// Config is the configuration of the admin service, see config.cue
+type Config struct {
+	// RequireVerifiedEmailForTrainers blocks endpoints tagged "trainer"
+	// until the caller has verified their email address.
+	RequireVerifiedEmailForTrainers config.Bool
+
+	// RequireMFAForPrivilegedRoles blocks endpoints tagged "trainer" or "admin"
+	// unless the caller's session was started with a second factor.
+	RequireMFAForPrivilegedRoles config.Bool
+
+	// TrustedProxyHops is the number of proxies in front of the app that
+	// append the address of their peer to X-Forwarded-For. Entries left of
+	// those are set by the client and are never used as its address.
+	TrustedProxyHops config.Int
+
+	// OIDCProviders are the identity providers users can sign in with
+	OIDCProviders []OIDCProvider
+}
+
+// OIDCProvider is an OpenID Connect provider registered for this app.
+// Its client secret, if it has one, is in the OIDCClientSecrets secret.
+type OIDCProvider struct {
+	// Name identifies the provider in API paths and in user_identities
+	Name string
+
+	Issuer   string
+	ClientID string
+	Scopes   []string
+
+	// RedirectURL is the frontend page that receives the code and state
+	// and passes them to FinishOIDCLogin
+	RedirectURL string
+}
+
+var cfg = config.Load[*Config]()
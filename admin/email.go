@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"context"
+	"sync"
+
+	"encore.app/mail"
+)
+
+var (
+	mailerOnce sync.Once
+	mailer     mail.EmailSender
+	mailerErr  error
+)
+
+// emailSender returns the sender configured by the MailURL secret
+func emailSender() (mail.EmailSender, error) {
+	mailerOnce.Do(func() {
+		mailer, mailerErr = mail.NewSenderFromURL(secrets.MailURL)
+	})
+	return mailer, mailerErr
+}
+
+// sendEmail sends a plain text email through the configured sender
+func sendEmail(ctx context.Context, to, subject, body string) error {
+	sender, err := emailSender()
+	if err != nil {
+		return err
+	}
+	return sender.Send(ctx, mail.Message{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	})
+}
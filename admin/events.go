@@ -0,0 +1,188 @@
+package admin
+
+import (
+	"context"
+	"time"
+
+	"encore.app/authz"
+	"encore.dev/pubsub"
+	"encore.dev/rlog"
+)
+
+const (
+	defaultSnapshotBatch = 500
+	maxSnapshotBatch     = 5000
+)
+
+// UserSnapshot is the part of a user other services may keep a copy of.
+// Copies should only be replaced by snapshots with a later Version.
+type UserSnapshot struct {
+	ID        int          `json:"id"`
+	Username  string       `json:"username"`
+	Fullname  string       `json:"fullname"`
+	Roles     []authz.Role `json:"roles"`
+	Status    UserStatus   `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+
+	// Version is the database time the snapshot was read at
+	Version time.Time `json:"version"`
+}
+
+// UserCreated is published when a user registers
+type UserCreated struct {
+	User *UserSnapshot `json:"user"`
+}
+
+// UserUpdated is published when a user or their roles change. Backfills publish
+// it for every user.
+type UserUpdated struct {
+	User *UserSnapshot `json:"user"`
+}
+
+// UserDeleted is published when a user is deleted or erased. The snapshot has
+// status DELETED and, after an erasure, the anonymized username.
+type UserDeleted struct {
+	User *UserSnapshot `json:"user"`
+}
+
+// The admin service owns the users. Other services follow these topics to keep
+// a read model of them.
+var (
+	UserCreatedEvents = pubsub.NewTopic[*UserCreated]("user-created", pubsub.TopicConfig{
+		DeliveryGuarantee: pubsub.AtLeastOnce,
+	})
+	UserUpdatedEvents = pubsub.NewTopic[*UserUpdated]("user-updated", pubsub.TopicConfig{
+		DeliveryGuarantee: pubsub.AtLeastOnce,
+	})
+	UserDeletedEvents = pubsub.NewTopic[*UserDeleted]("user-deleted", pubsub.TopicConfig{
+		DeliveryGuarantee: pubsub.AtLeastOnce,
+	})
+)
+
+// PublishUserSnapshotsParams selects a batch of users by ID
+type PublishUserSnapshotsParams struct {
+	AfterID int `json:"after_id"`
+	Limit   int `json:"limit,omitempty"`
+}
+
+// PublishUserSnapshotsResponse reports a published batch. Pass NextAfterID
+// as AfterID to continue until Done.
+type PublishUserSnapshotsResponse struct {
+	Published   int  `json:"published"`
+	NextAfterID int  `json:"next_after_id"`
+	Done        bool `json:"done"`
+}
+
+// PublishUserSnapshots publishes the current state of a batch of users, so read
+// models that missed events or started empty catch up. cmd/backfill-users calls it
+// until every user is published.
+//
+//encore:api auth method=POST path=/admin/users/publish-snapshots tag:admin
+func PublishUserSnapshots(ctx context.Context, params *PublishUserSnapshotsParams) (*PublishUserSnapshotsResponse, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultSnapshotBatch
+	}
+	if limit > maxSnapshotBatch {
+		limit = maxSnapshotBatch
+	}
+
+	rows, err := db.Query(ctx, `
+        SELECT id
+        FROM users
+        WHERE id > $1
+        ORDER BY id
+        LIMIT $2
+    `, params.AfterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resp := &PublishUserSnapshotsResponse{NextAfterID: params.AfterID, Done: len(ids) < limit}
+	for _, id := range ids {
+		snapshot, err := userSnapshot(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot.Status == UserStatusDeleted {
+			_, err = UserDeletedEvents.Publish(ctx, &UserDeleted{User: snapshot})
+		} else {
+			_, err = UserUpdatedEvents.Publish(ctx, &UserUpdated{User: snapshot})
+		}
+		if err != nil {
+			return nil, err
+		}
+		resp.Published++
+		resp.NextAfterID = id
+	}
+	rlog.Info("published user snapshots", "count", resp.Published, "next_after_id", resp.NextAfterID)
+	return resp, nil
+}
+
+// publishUserChange publishes the state of a user after a change. A lost event
+// leaves read models behind until the next change or backfill, so failures are
+// logged rather than failing the committed change.
+func publishUserChange(ctx context.Context, action string, userID int) {
+	snapshot, err := userSnapshot(ctx, userID)
+	if err != nil {
+		rlog.Error("could not load user for publishing", "user_id", userID, "err", err)
+		return
+	}
+
+	switch {
+	case snapshot.Status == UserStatusDeleted:
+		_, err = UserDeletedEvents.Publish(ctx, &UserDeleted{User: snapshot})
+	case action == actionRegister:
+		_, err = UserCreatedEvents.Publish(ctx, &UserCreated{User: snapshot})
+	default:
+		_, err = UserUpdatedEvents.Publish(ctx, &UserUpdated{User: snapshot})
+	}
+	if err != nil {
+		rlog.Error("could not publish user change", "user_id", userID, "action", action, "err", err)
+	}
+}
+
+// userSnapshot reads the shared state of a user
+func userSnapshot(ctx context.Context, userID int) (*UserSnapshot, error) {
+	var s UserSnapshot
+	var roles []string
+	var suspended, deleted bool
+	err := db.QueryRow(ctx, `
+        SELECT u.id, u.username, COALESCE(d.fullname, ''),
+               ARRAY(SELECT role FROM user_roles WHERE user_id = u.id ORDER BY role),
+               u.suspended_at IS NOT NULL, u.deleted_at IS NOT NULL, u.created_at, clock_timestamp()
+        FROM users u
+        LEFT JOIN user_details d ON d.user_id = u.id
+        WHERE u.id = $1
+    `, userID).Scan(&s.ID, &s.Username, &s.Fullname, &roles, &suspended, &deleted, &s.CreatedAt, &s.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Roles = make([]authz.Role, len(roles))
+	for i, r := range roles {
+		s.Roles[i] = authz.Role(r)
+	}
+	switch {
+	case deleted:
+		s.Status = UserStatusDeleted
+	case suspended:
+		s.Status = UserStatusSuspended
+	default:
+		s.Status = UserStatusActive
+	}
+	return &s, nil
+}
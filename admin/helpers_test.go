@@ -0,0 +1,36 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"encore.app/authz/authztest"
+)
+
+// testPassword is the password of every user created by createTestUser
+const testPassword = "correct horse battery staple"
+
+// createTestUser inserts a user with a verified email address and a unique
+// username, and returns its ID and username
+func createTestUser(t *testing.T, ctx context.Context) (int, string) {
+	t.Helper()
+	hash, err := hashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	username := fmt.Sprintf("testuser%d", authztest.NewUserID())
+	var id int
+	err = db.QueryRow(ctx, `
+		INSERT INTO users (username, email, password_hash, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW(), NOW())
+		RETURNING id
+	`, username, username+"@example.com", hash).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, username
+}
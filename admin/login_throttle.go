@@ -0,0 +1,182 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.app/lockout"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// Reasons recorded in the login_attempts table
+const (
+	loginSucceeded          = "success"
+	loginMFARequired        = "mfa_required"
+	loginInvalidCredentials = "invalid_credentials"
+	loginThrottled          = "throttled"
+	loginSuspended          = "suspended"
+	loginResetRequired      = "password_reset_required"
+)
+
+var (
+	// loginCounters keeps the failure counters of Login
+	loginCounters lockout.Store = lockout.NewPostgresStore(db)
+
+	// usernamePolicy slows down guessing the password of one account
+	usernamePolicy = lockout.Policy{
+		FreeFailures:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        30 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+
+	// ipPolicy slows down a single client trying many accounts
+	ipPolicy = lockout.Policy{
+		FreeFailures:    20,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    100,
+		LockoutDuration: time.Hour,
+		Window:          time.Hour,
+	}
+)
+
+// UnlockUser clears the failed login attempts of a user, lifting a lockout
+//
+//encore:api auth method=POST path=/admin/users/:id/unlock tag:admin
+func UnlockUser(ctx context.Context, id int) error {
+	callerID, err := CurrentUserID()
+	if err != nil {
+		return err
+	}
+
+	var username string
+	err = db.QueryRow(ctx, `
+        SELECT username
+        FROM users
+        WHERE id = $1
+    `, id).Scan(&username)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return errUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := loginCounters.Reset(ctx, usernameCounterKey(username)); err != nil {
+		return err
+	}
+	if err := recordAdminAction(ctx, db, callerID, actionUnlockUser, id, nil); err != nil {
+		return err
+	}
+
+	// The failure counters are not part of the user, so there is nothing to compare
+	audit.Record(ctx, audit.Change{
+		Action:     actionUnlockUser,
+		EntityType: auditEntityUser,
+		EntityID:   strconv.Itoa(id),
+	})
+	return nil
+}
+
+// checkLoginThrottle returns an error if logins to the username or from the IP address are blocked
+func checkLoginThrottle(ctx context.Context, username, ip string) error {
+	now := time.Now()
+
+	c, err := loginCounters.Get(ctx, usernameCounterKey(username))
+	if err != nil {
+		return err
+	}
+	if wait := usernamePolicy.BlockedFor(c, now); wait > 0 {
+		if usernamePolicy.Locked(c) {
+			return throttleError("account temporarily locked after too many failed login attempts", wait)
+		}
+		return throttleError("too many failed login attempts", wait)
+	}
+
+	// Requests without a client address are only throttled by username, as
+	// one counter shared by all of them would let anyone lock the others out
+	if ip == "" {
+		return nil
+	}
+	c, err = loginCounters.Get(ctx, ipCounterKey(ip))
+	if err != nil {
+		return err
+	}
+	if wait := ipPolicy.BlockedFor(c, now); wait > 0 {
+		return throttleError("too many failed login attempts", wait)
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login against the username and, when it is
+// known, the IP address
+func recordLoginFailure(ctx context.Context, username, ip string) {
+	now := time.Now()
+	if _, err := loginCounters.RecordFailure(ctx, usernameCounterKey(username), now, usernamePolicy.Window); err != nil {
+		rlog.Error("could not record failed login", "username", username, "err", err)
+	}
+	if ip == "" {
+		return
+	}
+	if _, err := loginCounters.RecordFailure(ctx, ipCounterKey(ip), now, ipPolicy.Window); err != nil {
+		rlog.Error("could not record failed login", "ip_address", ip, "err", err)
+	}
+}
+
+// recordLoginSuccess clears the failures of the username.
+// The IP counter is left to expire so a client cannot reset it by logging in to its own account.
+func recordLoginSuccess(ctx context.Context, username string) {
+	if err := loginCounters.Reset(ctx, usernameCounterKey(username)); err != nil {
+		rlog.Error("could not reset failed logins", "username", username, "err", err)
+	}
+}
+
+// auditLoginAttempt adds a row to the login_attempts table. userID is 0 for unknown users.
+func auditLoginAttempt(ctx context.Context, username string, userID int, ip, userAgent string, success bool, reason string) {
+	var uid *int
+	if userID != 0 {
+		uid = &userID
+	}
+	_, err := db.Exec(ctx, `
+        INSERT INTO login_attempts (username, user_id, ip_address, user_agent, success, reason, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW())
+    `, username, uid, ip, userAgent, success, reason)
+	if err != nil {
+		rlog.Error("could not audit login attempt", "username", username, "err", err)
+	}
+}
+
+// throttleError reports a blocked login and when it can be retried
+func throttleError(msg string, wait time.Duration) error {
+	return &errs.Error{
+		Code:    errs.ResourceExhausted,
+		Message: fmt.Sprintf("%s, try again in %s", msg, (wait + time.Second - 1).Truncate(time.Second)),
+	}
+}
+
+// callerIP returns the client address the auth handler recorded for the current request
+func callerIP() string {
+	if data, ok := auth.Data().(*authz.AuthData); ok && data != nil {
+		return data.ClientIP
+	}
+	return ""
+}
+
+func usernameCounterKey(username string) string {
+	return "username:" + strings.ToLower(username)
+}
+
+func ipCounterKey(ip string) string {
+	return "ip:" + ip
+}
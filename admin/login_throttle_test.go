@@ -0,0 +1,209 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"encore.app/authz"
+	"encore.app/authz/authztest"
+	"encore.app/lockout"
+	"encore.dev/beta/errs"
+	"encore.dev/et"
+)
+
+// useMemoryCounters replaces the login counters with an empty in-memory store for one test
+func useMemoryCounters(t *testing.T) *lockout.MemoryStore {
+	store := lockout.NewMemoryStore()
+	prev := loginCounters
+	loginCounters = store
+	t.Cleanup(func() { loginCounters = prev })
+	return store
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	ctx := context.Background()
+	useMemoryCounters(t)
+
+	for range usernamePolicy.FreeFailures {
+		recordLoginFailure(ctx, "alice", "203.0.113.1")
+		if err := checkLoginThrottle(ctx, "alice", "203.0.113.1"); err != nil {
+			t.Fatalf("throttled within the free failures: %v", err)
+		}
+	}
+
+	recordLoginFailure(ctx, "alice", "203.0.113.1")
+	err := checkLoginThrottle(ctx, "alice", "203.0.113.1")
+	if errs.Code(err) != errs.ResourceExhausted {
+		t.Fatalf("got %v after the free failures, want ResourceExhausted", err)
+	}
+	if strings.Contains(err.Error(), "locked") {
+		t.Errorf("got %q, want a delay rather than a lockout", err)
+	}
+
+	// Usernames are counted case-insensitively, other usernames are not affected
+	if err := checkLoginThrottle(ctx, "ALICE", "198.51.100.1"); errs.Code(err) != errs.ResourceExhausted {
+		t.Errorf("got %v for the upper-cased username, want ResourceExhausted", err)
+	}
+	if err := checkLoginThrottle(ctx, "bob", "198.51.100.1"); err != nil {
+		t.Errorf("got %v for another username, want nil", err)
+	}
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	ctx := context.Background()
+	store := useMemoryCounters(t)
+
+	for range usernamePolicy.LockoutAfter {
+		recordLoginFailure(ctx, "alice", "203.0.113.1")
+	}
+
+	err := checkLoginThrottle(ctx, "alice", "198.51.100.1")
+	if errs.Code(err) != errs.ResourceExhausted || !strings.Contains(err.Error(), "locked") {
+		t.Fatalf("got %v after %d failures, want a lockout", err, usernamePolicy.LockoutAfter)
+	}
+
+	// The lockout lasts its full duration rather than the backoff delay
+	c, err := store.Get(ctx, usernameCounterKey("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait := usernamePolicy.BlockedFor(c, time.Now()); wait < usernamePolicy.LockoutDuration-time.Minute {
+		t.Errorf("locked for %s, want about %s", wait, usernamePolicy.LockoutDuration)
+	}
+}
+
+func TestLoginThrottleIPCounterSurvivesSuccess(t *testing.T) {
+	ctx := context.Background()
+	store := useMemoryCounters(t)
+
+	const ip = "203.0.113.1"
+	for range ipPolicy.FreeFailures + 1 {
+		recordLoginFailure(ctx, "alice", ip)
+	}
+	recordLoginSuccess(ctx, "alice")
+
+	c, err := store.Get(ctx, usernameCounterKey("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Failures != 0 {
+		t.Errorf("username counter has %d failures after a success, want 0", c.Failures)
+	}
+
+	c, err = store.Get(ctx, ipCounterKey(ip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Failures != ipPolicy.FreeFailures+1 {
+		t.Errorf("IP counter has %d failures after a success, want %d", c.Failures, ipPolicy.FreeFailures+1)
+	}
+
+	// The IP stays throttled for every username
+	if err := checkLoginThrottle(ctx, "bob", ip); errs.Code(err) != errs.ResourceExhausted {
+		t.Errorf("got %v for another username from the IP, want ResourceExhausted", err)
+	}
+}
+
+func TestLoginThrottleMissingIP(t *testing.T) {
+	ctx := context.Background()
+	store := useMemoryCounters(t)
+
+	// Requests without X-Forwarded-For have no client address
+	ip := clientIP("")
+	if ip != "" {
+		t.Fatalf("clientIP(\"\") = %q, want \"\"", ip)
+	}
+
+	// Enough failures to lock out an IP address, spread over usernames
+	for i := range ipPolicy.LockoutAfter {
+		recordLoginFailure(ctx, fmt.Sprintf("user%d", i), ip)
+	}
+
+	// Other clients without an address are not blocked
+	if err := checkLoginThrottle(ctx, "alice", ip); err != nil {
+		t.Errorf("got %v for another client without an address, want nil", err)
+	}
+	c, err := store.Get(ctx, ipCounterKey(ip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Failures != 0 {
+		t.Errorf("counted %d failures without an address, want 0", c.Failures)
+	}
+
+	// The username counter still applies
+	for range usernamePolicy.LockoutAfter {
+		recordLoginFailure(ctx, "bob", ip)
+	}
+	if err := checkLoginThrottle(ctx, "bob", ip); errs.Code(err) != errs.ResourceExhausted {
+		t.Errorf("got %v for a locked username without an address, want ResourceExhausted", err)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		hops         int
+		forwardedFor string
+		want         string
+	}{
+		{1, "", ""},
+		{1, "203.0.113.1", "203.0.113.1"},
+		{1, "198.51.100.7, 203.0.113.1", "203.0.113.1"},
+		{1, "spoofed,  203.0.113.1 ", "203.0.113.1"},
+		{2, "198.51.100.7, 203.0.113.1, 10.0.0.1", "203.0.113.1"},
+		{2, "203.0.113.1", ""},
+		{0, "203.0.113.1", ""},
+	}
+	for _, tt := range tests {
+		et.SetCfg(cfg.TrustedProxyHops, tt.hops)
+		if got := clientIP(tt.forwardedFor); got != tt.want {
+			t.Errorf("clientIP(%q) with %d hops = %q, want %q", tt.forwardedFor, tt.hops, got, tt.want)
+		}
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	ctx := context.Background()
+	useMemoryCounters(t)
+
+	adminID, _ := createTestUser(t, ctx)
+	userID, username := createTestUser(t, ctx)
+	authztest.AuthenticateAs(adminID, authz.RoleAdmin)
+
+	for range usernamePolicy.LockoutAfter {
+		recordLoginFailure(ctx, username, "203.0.113.1")
+	}
+	if err := checkLoginThrottle(ctx, username, "198.51.100.1"); err == nil {
+		t.Fatal("user is not locked out")
+	}
+
+	if err := UnlockUser(ctx, userID); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkLoginThrottle(ctx, username, "198.51.100.1"); err != nil {
+		t.Errorf("got %v after unlocking, want nil", err)
+	}
+
+	var action string
+	err := db.QueryRow(ctx, `
+        SELECT action
+        FROM admin_actions
+        WHERE actor_id = $1 AND target_user_id = $2
+    `, adminID, userID).Scan(&action)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != actionUnlockUser {
+		t.Errorf("recorded action %q, want %q", action, actionUnlockUser)
+	}
+
+	if err := UnlockUser(ctx, -1); !errors.Is(err, errUserNotFound) {
+		t.Errorf("got %v for an unknown user, want errUserNotFound", err)
+	}
+}
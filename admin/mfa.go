@@ -0,0 +1,424 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+const (
+	// mfaChallengeTTL is how long the second login step can be completed after the first
+	mfaChallengeTTL = 5 * time.Minute
+
+	// mfaMaxAttempts is how many wrong codes a challenge accepts before it is discarded
+	mfaMaxAttempts = 5
+
+	// recoveryCodeCount is how many recovery codes are issued at a time
+	recoveryCodeCount = 10
+)
+
+var (
+	errInvalidMFACode = &errs.Error{
+		Code:    errs.Unauthenticated,
+		Message: "invalid code",
+	}
+	errMFARequired = &errs.Error{
+		Code:    errs.PermissionDenied,
+		Message: "two-factor authentication required",
+	}
+)
+
+// MFAEnrollment contains what an authenticator app needs to generate codes
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// MFACodeParams contains a code from the user's authenticator app
+type MFACodeParams struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodesResponse contains single-use recovery codes. They are only ever shown once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// DisableMFAParams contains the data needed to turn off two-factor authentication
+type DisableMFAParams struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// VerifyMFAParams contains the data needed to complete a login that requires a second factor
+type VerifyMFAParams struct {
+	MFAToken  string `json:"mfa_token"`
+	Code      string `json:"code"`
+	UserAgent string `header:"User-Agent"`
+	IPAddress string `header:"X-Forwarded-For"`
+}
+
+// EnrollMFA starts TOTP enrollment for the current user.
+// Enrollment takes effect once a code is confirmed through ConfirmMFA.
+//
+//encore:api auth method=POST path=/admin/mfa/enroll
+func EnrollMFA(ctx context.Context) (*MFAEnrollment, error) {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	var username string
+	err = db.QueryRow(ctx, `
+        SELECT username
+        FROM users
+        WHERE id = $1
+    `, userID).Scan(&username)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace a pending enrollment but never an active one
+	res, err := db.Exec(ctx, `
+        INSERT INTO user_mfa (user_id, totp_secret, created_at, updated_at)
+        VALUES ($1, $2, NOW(), NOW())
+        ON CONFLICT (user_id) DO UPDATE
+        SET totp_secret = EXCLUDED.totp_secret, last_used_step = 0, updated_at = NOW()
+        WHERE user_mfa.enabled_at IS NULL
+    `, userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() == 0 {
+		return nil, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "two-factor authentication is already enabled",
+		}
+	}
+
+	return &MFAEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totpURI(secret, username),
+	}, nil
+}
+
+// ConfirmMFA enables two-factor authentication once the user proves their app
+// generates valid codes, and returns the user's recovery codes
+//
+//encore:api auth method=POST path=/admin/mfa/confirm
+func ConfirmMFA(ctx context.Context, params *MFACodeParams) (*RecoveryCodesResponse, error) {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	var secret string
+	var enabledAt *time.Time
+	err = db.QueryRow(ctx, `
+        SELECT totp_secret, enabled_at
+        FROM user_mfa
+        WHERE user_id = $1
+    `, userID).Scan(&secret, &enabledAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "two-factor authentication enrollment not started",
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if enabledAt != nil {
+		return nil, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "two-factor authentication is already enabled",
+		}
+	}
+
+	step, ok := validateTOTP(secret, params.Code, time.Now(), 0)
+	if !ok {
+		return nil, errInvalidMFACode
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := managedUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(ctx, `
+        UPDATE user_mfa
+        SET enabled_at = NOW(), last_used_step = $1, updated_at = NOW()
+        WHERE user_id = $2
+    `, step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at)
+            VALUES ($1, $2, NOW())
+        `, userID, hashOpaqueToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	recordUserChange(ctx, actionEnableMFA, userID, before)
+
+	return &RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableMFA turns off two-factor authentication for the current user
+//
+//encore:api auth method=POST path=/admin/mfa/disable
+func DisableMFA(ctx context.Context, params *DisableMFAParams) error {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return err
+	}
+
+	if err := confirmPassword(ctx, userID, params.Password); err != nil {
+		return err
+	}
+
+	ok, err := verifySecondFactor(ctx, userID, params.Code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidMFACode
+	}
+
+	before, err := managedUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	recordUserChange(ctx, actionDisableMFA, userID, before)
+	return nil
+}
+
+// VerifyMFA completes a login that returned mfa_required, using an authenticator
+// code or one of the recovery codes
+//
+//encore:api public method=POST path=/admin/mfa/verify
+func VerifyMFA(ctx context.Context, params *VerifyMFAParams) (*AuthResponse, error) {
+	// Look up the challenge
+	var (
+		challengeID int64
+		userID      int
+		deviceName  string
+	)
+	err := db.QueryRow(ctx, `
+        SELECT id, user_id, device_name
+        FROM mfa_challenges
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND attempts < $2
+    `, hashOpaqueToken(params.MFAToken), mfaMaxAttempts).Scan(&challengeID, &userID, &deviceName)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, &errs.Error{
+			Code:    errs.Unauthenticated,
+			Message: "invalid or expired mfa token",
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	ok, err := verifySecondFactor(ctx, userID, params.Code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		_, err := db.Exec(ctx, `
+            UPDATE mfa_challenges
+            SET attempts = attempts + 1
+            WHERE id = $1
+        `, challengeID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errInvalidMFACode
+	}
+
+	// Each challenge completes one login
+	res, err := db.Exec(ctx, `
+        UPDATE mfa_challenges
+        SET used_at = NOW()
+        WHERE id = $1 AND used_at IS NULL
+    `, challengeID)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() != 1 {
+		return nil, errInvalidMFACode
+	}
+
+	// Get the user; the account may have been suspended since the password step
+	var user User
+	err = db.QueryRow(ctx, `
+        SELECT id, username, email, email_verified_at, created_at, updated_at
+        FROM users
+        WHERE id = $1 AND suspended_at IS NULL AND deleted_at IS NULL
+    `, userID).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errAccountSuspended
+	} else if err != nil {
+		return nil, err
+	}
+
+	return startSession(ctx, &user, deviceName, params.IPAddress, params.UserAgent, true)
+}
+
+// mfaEnabled reports whether a user has completed TOTP enrollment
+func mfaEnabled(ctx context.Context, userID int) (bool, error) {
+	var enabled bool
+	err := db.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL
+        )
+    `, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// startMFAChallenge answers a successful password check of a user with two-factor
+// authentication enabled. No session is started until VerifyMFA succeeds.
+func startMFAChallenge(ctx context.Context, user *User, deviceName string) (*AuthResponse, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(ctx, `
+        INSERT INTO mfa_challenges (user_id, token_hash, device_name, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, NOW())
+    `, user.ID, hashOpaqueToken(token), deviceName, time.Now().Add(mfaChallengeTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		User:        user,
+	}, nil
+}
+
+// verifySecondFactor checks a TOTP code, falling back to the user's unused recovery codes.
+// Accepted codes cannot be used again.
+func verifySecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+	var secret string
+	var lastUsedStep int64
+	err := db.QueryRow(ctx, `
+        SELECT totp_secret, last_used_step
+        FROM user_mfa
+        WHERE user_id = $1 AND enabled_at IS NOT NULL
+    `, userID).Scan(&secret, &lastUsedStep)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if step, ok := validateTOTP(secret, code, time.Now(), lastUsedStep); ok {
+		// The condition makes concurrent use of the same code fail
+		res, err := db.Exec(ctx, `
+            UPDATE user_mfa
+            SET last_used_step = $1, updated_at = NOW()
+            WHERE user_id = $2 AND last_used_step < $1
+        `, step, userID)
+		if err != nil {
+			return false, err
+		}
+		return res.RowsAffected() == 1, nil
+	}
+
+	res, err := db.Exec(ctx, `
+        UPDATE mfa_recovery_codes
+        SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+    `, userID, hashOpaqueToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// recoveryCodeAlphabet leaves out characters that are easily confused
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// newRecoveryCodes returns a fresh set of recovery codes formatted as xxxxx-xxxxx
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := range codes {
+		var b strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteByte(recoveryCodeAlphabet[n.Int64()])
+		}
+		codes[i] = b.String()
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode makes recovery codes match regardless of case, dashes and spaces
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
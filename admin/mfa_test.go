@@ -0,0 +1,58 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"encore.app/authz"
+	"encore.app/authz/authztest"
+)
+
+func TestRecoveryCodesAreSingleUse(t *testing.T) {
+	ctx := context.Background()
+	userID, _ := createTestUser(t, ctx)
+	authztest.AuthenticateAs(userID, authz.RoleTrainee)
+
+	enrollment, err := EnrollMFA(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totpCode(enrollment.Secret, time.Now().Unix()/int64(totpPeriod.Seconds()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ConfirmMFA(ctx, &MFACodeParams{Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(resp.RecoveryCodes), recoveryCodeCount)
+	}
+
+	// The code that confirmed the enrollment can't be used again
+	if ok, err := verifySecondFactor(ctx, userID, code); err != nil || ok {
+		t.Errorf("got %v, %v for the confirmation code, want it rejected", ok, err)
+	}
+
+	// Recovery codes match regardless of case and dashes, once each
+	recovery := resp.RecoveryCodes[0]
+	if ok, err := verifySecondFactor(ctx, userID, strings.ToUpper(strings.ReplaceAll(recovery, "-", ""))); err != nil || !ok {
+		t.Fatalf("got %v, %v for a recovery code, want it accepted", ok, err)
+	}
+	if ok, err := verifySecondFactor(ctx, userID, recovery); err != nil || ok {
+		t.Errorf("got %v, %v for a used recovery code, want it rejected", ok, err)
+	}
+	if ok, err := verifySecondFactor(ctx, userID, resp.RecoveryCodes[1]); err != nil || !ok {
+		t.Errorf("got %v, %v for another recovery code, want it accepted", ok, err)
+	}
+
+	// Another user's codes don't work
+	otherID, _ := createTestUser(t, ctx)
+	if ok, err := verifySecondFactor(ctx, otherID, resp.RecoveryCodes[2]); err != nil || ok {
+		t.Errorf("got %v, %v for another user's recovery code, want it rejected", ok, err)
+	}
+}
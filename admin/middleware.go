@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"encore.app/authz"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/middleware"
+)
+
+// RequireAPIKeyScope limits requests made with an API key to the endpoints opened to
+// one of its scopes with a tag such as "scope_workouts_write" (see authz.Scope.Tag),
+// and to endpoints tagged "api_keys". Calls between services are checked too, since
+// they carry the key's auth data.
+//
+//encore:middleware global target=all
+func RequireAPIKeyScope(req middleware.Request, next middleware.Next) middleware.Response {
+	data, ok := auth.Data().(*authz.AuthData)
+	if !ok || data == nil || data.APIKeyID == 0 {
+		return next(req)
+	}
+
+	api := req.Data().API
+	if api != nil {
+		if api.Tags.Has(authz.TagAPIKeys) {
+			return next(req)
+		}
+		for _, scope := range data.Scopes {
+			if api.Tags.Has(scope.Tag()) {
+				return next(req)
+			}
+		}
+	}
+	return middleware.Response{Err: &errs.Error{
+		Code:    errs.PermissionDenied,
+		Message: "the api key does not allow this endpoint",
+	}}
+}
+
+// RequireAdmin rejects calls to endpoints tagged "admin" unless the caller is an administrator.
+// Depending on the configuration the session must have been started with a second factor.
+//
+//encore:middleware global target=tag:admin
+func RequireAdmin(req middleware.Request, next middleware.Next) middleware.Response {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return middleware.Response{Err: err}
+	}
+	if !caller.IsAdmin() {
+		return middleware.Response{Err: authz.ErrPermissionDenied}
+	}
+	if cfg.RequireMFAForPrivilegedRoles() && !caller.MFAVerified {
+		return middleware.Response{Err: errMFARequired}
+	}
+	return next(req)
+}
+
+// RequireTrainer rejects calls to endpoints tagged "trainer" unless the caller is a trainer or administrator.
+// Depending on the configuration the caller's email must be verified and the
+// session started with a second factor as well.
+//
+//encore:middleware global target=tag:trainer
+func RequireTrainer(req middleware.Request, next middleware.Next) middleware.Response {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return middleware.Response{Err: err}
+	}
+	if !caller.IsTrainer() {
+		return middleware.Response{Err: authz.ErrPermissionDenied}
+	}
+	if cfg.RequireVerifiedEmailForTrainers() && !caller.EmailVerified {
+		return middleware.Response{Err: errEmailNotVerified}
+	}
+	if cfg.RequireMFAForPrivilegedRoles() && !caller.MFAVerified {
+		return middleware.Response{Err: errMFARequired}
+	}
+	return next(req)
+}
@@ -0,0 +1,18 @@
+ALTER TABLE users
+    ADD COLUMN suspended_at TIMESTAMPTZ,
+    ADD COLUMN suspension_reason TEXT,
+    ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Who did what to which account through the admin console
+CREATE TABLE admin_actions (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id BIGINT NOT NULL REFERENCES users(id),
+    action VARCHAR(64) NOT NULL,
+    target_user_id BIGINT NOT NULL REFERENCES users(id),
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_admin_actions_target_user_id ON admin_actions(target_user_id, created_at);
+CREATE INDEX idx_admin_actions_actor_id ON admin_actions(actor_id, created_at);
@@ -0,0 +1,18 @@
+-- Keys for scripts and devices that can't log in interactively.
+-- Personal keys act as their owner; organization keys have no owner.
+CREATE TABLE api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    owner_user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    created_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip VARCHAR(64),
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_owner_user_id ON api_keys(owner_user_id);
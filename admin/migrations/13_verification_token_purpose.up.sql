@@ -0,0 +1,9 @@
+-- Whether a token verifies the current address or confirms an email change,
+-- so sending one kind doesn't invalidate the other
+ALTER TABLE email_verification_tokens
+    ADD COLUMN purpose VARCHAR(20) NOT NULL DEFAULT 'VERIFY' CHECK (purpose IN ('VERIFY', 'CHANGE_EMAIL'));
+
+UPDATE email_verification_tokens t
+SET purpose = 'CHANGE_EMAIL'
+FROM users u
+WHERE u.id = t.user_id AND LOWER(u.email) <> LOWER(t.email);
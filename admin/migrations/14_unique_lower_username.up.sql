@@ -0,0 +1,11 @@
+-- Login matches usernames ignoring case, so they must be unique ignoring case.
+-- Accounts whose username only differs in case from an older account's get
+-- their ID appended; the oldest account keeps the name.
+UPDATE users u
+SET username = u.username || '-' || u.id, updated_at = NOW()
+WHERE EXISTS (
+    SELECT 1 FROM users o
+    WHERE LOWER(o.username) = LOWER(u.username) AND o.id < u.id
+);
+
+CREATE UNIQUE INDEX idx_users_username_lower ON users (LOWER(username));
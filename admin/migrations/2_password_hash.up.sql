@@ -0,0 +1,3 @@
+-- Passwords are only ever stored as hashes (argon2id PHC strings, or legacy
+-- bcrypt/SHA-256 hashes that are upgraded on the next login)
+ALTER TABLE users DROP COLUMN password;
@@ -0,0 +1,14 @@
+CREATE TABLE user_roles (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('ADMIN', 'TRAINER', 'TRAINEE')),
+    granted_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, role)
+);
+
+CREATE INDEX idx_user_roles_user_id ON user_roles(user_id);
+
+-- Every existing user registered as a trainee
+INSERT INTO user_roles (user_id, role)
+SELECT id, 'TRAINEE' FROM users;
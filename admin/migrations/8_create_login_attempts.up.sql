@@ -0,0 +1,21 @@
+-- Every login attempt, kept for auditing
+CREATE TABLE login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_login_attempts_username ON login_attempts(username, created_at);
+CREATE INDEX idx_login_attempts_ip_address ON login_attempts(ip_address, created_at);
+
+-- Failure counters of lockout.PostgresStore, keyed by username and by IP address
+CREATE TABLE lockout_counters (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL
+);
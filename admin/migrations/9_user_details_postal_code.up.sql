@@ -0,0 +1,17 @@
+ALTER TABLE user_details ADD COLUMN postal_code VARCHAR(20);
+
+-- Each user has at most one row of details. Of users that already have
+-- several, only the most recently updated row is kept.
+DELETE FROM user_details
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (
+            PARTITION BY user_id
+            ORDER BY updated_at DESC NULLS LAST, created_at DESC NULLS LAST, id DESC
+        ) AS rank
+        FROM user_details
+    ) ranked
+    WHERE rank > 1
+);
+
+CREATE UNIQUE INDEX idx_user_details_user_id ON user_details(user_id);
@@ -0,0 +1,615 @@
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"encore.app/audit"
+	"encore.app/oidc"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"encore.dev/storage/sqldb/sqlerr"
+)
+
+// oidcLoginTTL is how long a user has to come back from the provider
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	errInvalidOIDCState = &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: "invalid or expired sign in request",
+	}
+	errOIDCFailed = &errs.Error{
+		Code:    errs.Unauthenticated,
+		Message: "sign in with the provider failed",
+	}
+
+	// errUsernameTaken makes createOIDCUser try another username
+	errUsernameTaken = errors.New("username taken")
+)
+
+// usernameInvalidChars matches what may not appear in a username
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// Identity is an account at an external provider that a user signs in with
+type Identity struct {
+	ID          int        `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// IdentitiesResponse contains the linked identities of the current user
+type IdentitiesResponse struct {
+	Identities []*Identity `json:"identities"`
+}
+
+// OIDCProvidersResponse lists the providers users can sign in with
+type OIDCProvidersResponse struct {
+	Providers []string `json:"providers"`
+}
+
+// OIDCStartResponse contains the provider page to send the user to
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// FinishOIDCLoginParams contains what the provider sent back to the redirect URL
+type FinishOIDCLoginParams struct {
+	State      string `json:"state"`
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `header:"User-Agent"`
+	IPAddress  string `header:"X-Forwarded-For"`
+}
+
+// ListOIDCProviders returns the names of the configured identity providers
+//
+//encore:api public method=GET path=/admin/oidc/providers
+func ListOIDCProviders(ctx context.Context) (*OIDCProvidersResponse, error) {
+	resp := &OIDCProvidersResponse{Providers: []string{}}
+	for _, p := range cfg.OIDCProviders {
+		resp.Providers = append(resp.Providers, p.Name)
+	}
+	return resp, nil
+}
+
+// StartOIDCLogin begins signing in with an identity provider. The user is sent
+// to the returned URL and comes back to the provider's redirect URL.
+//
+//encore:api public method=POST path=/admin/oidc/start/:provider
+func StartOIDCLogin(ctx context.Context, provider string) (*OIDCStartResponse, error) {
+	return startOIDC(ctx, provider, nil)
+}
+
+// LinkOIDCProvider begins linking an identity provider to the current user.
+// Finishing it signs the user in with the linked identity.
+//
+//encore:api auth method=POST path=/admin/oidc/link/:provider
+func LinkOIDCProvider(ctx context.Context, provider string) (*OIDCStartResponse, error) {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	return startOIDC(ctx, provider, &userID)
+}
+
+// FinishOIDCLogin completes a sign in started by StartOIDCLogin or LinkOIDCProvider.
+// A provider account that is not linked yet is linked to the user with the same
+// verified email address, or a new user is created for it.
+//
+//encore:api public method=POST path=/admin/oidc/callback
+func FinishOIDCLogin(ctx context.Context, params *FinishOIDCLoginParams) (*AuthResponse, error) {
+	ip := clientIP(params.IPAddress)
+
+	// Consume the sign in request so the state can't be replayed
+	var (
+		providerName, verifier, nonce string
+		linkUserID                    *int
+	)
+	err := db.QueryRow(ctx, `
+        UPDATE oidc_login_requests
+        SET used_at = NOW()
+        WHERE state_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING provider, code_verifier, nonce, link_user_id
+    `, hashOpaqueToken(params.State)).Scan(&providerName, &verifier, &nonce, &linkUserID)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errInvalidOIDCState
+	} else if err != nil {
+		return nil, err
+	}
+
+	provider, err := oidcProvider(ctx, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exchange the code and verify who the provider says the user is
+	tokens, err := provider.Exchange(ctx, params.Code, verifier)
+	if err != nil {
+		rlog.Warn("oidc code exchange failed", "provider", providerName, "err", err)
+		return nil, errOIDCFailed
+	}
+	claims, err := provider.Verify(ctx, tokens.IDToken, nonce)
+	if err != nil {
+		rlog.Warn("oidc id token rejected", "provider", providerName, "err", err)
+		return nil, errOIDCFailed
+	}
+
+	var userID int
+	if linkUserID != nil {
+		userID = *linkUserID
+		if err := linkIdentity(ctx, userID, providerName, claims); err != nil {
+			return nil, err
+		}
+	} else {
+		userID, err = resolveIdentity(ctx, providerName, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get the user the identity belongs to
+	var user User
+	var suspended, deleted, resetRequired bool
+	err = db.QueryRow(ctx, `
+        SELECT id, username, email, email_verified_at,
+               suspended_at IS NOT NULL, deleted_at IS NOT NULL, password_reset_required, created_at, updated_at
+        FROM users
+        WHERE id = $1
+    `, userID).Scan(
+		&user.ID, &user.Username, &user.Email, &user.EmailVerifiedAt,
+		&suspended, &deleted, &resetRequired, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if deleted {
+		auditLoginAttempt(ctx, user.Username, user.ID, ip, params.UserAgent, false, loginInvalidCredentials)
+		return nil, errOIDCFailed
+	}
+	if suspended {
+		auditLoginAttempt(ctx, user.Username, user.ID, ip, params.UserAgent, false, loginSuspended)
+		return nil, errAccountSuspended
+	}
+	if resetRequired {
+		auditLoginAttempt(ctx, user.Username, user.ID, ip, params.UserAgent, false, loginResetRequired)
+		return nil, errPasswordResetRequired
+	}
+
+	_, err = db.Exec(ctx, `
+        UPDATE user_identities
+        SET last_login_at = NOW()
+        WHERE provider = $1 AND subject = $2
+    `, providerName, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ask for the second factor if the user enrolled one
+	enabled, err := mfaEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		auditLoginAttempt(ctx, user.Username, user.ID, ip, params.UserAgent, true, loginMFARequired)
+		return startMFAChallenge(ctx, &user, params.DeviceName)
+	}
+
+	// Start a session
+	auditLoginAttempt(ctx, user.Username, user.ID, ip, params.UserAgent, true, loginSucceeded)
+	return startSession(ctx, &user, params.DeviceName, params.IPAddress, params.UserAgent, false)
+}
+
+// MyIdentities returns the identity providers linked to the current user
+//
+//encore:api auth method=GET path=/admin/identities
+func MyIdentities(ctx context.Context) (*IdentitiesResponse, error) {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	identities, err := userIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &IdentitiesResponse{Identities: identities}, nil
+}
+
+// UnlinkIdentity removes a linked identity provider from the current user.
+// The last identity of a user without a password can't be removed.
+//
+//encore:api auth method=DELETE path=/admin/identities/:id
+func UnlinkIdentity(ctx context.Context, id int) error {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the user so two unlinks can't remove the last two identities
+	var hasPassword bool
+	err = tx.QueryRow(ctx, `
+        SELECT password_hash <> ''
+        FROM users
+        WHERE id = $1
+        FOR UPDATE
+    `, userID).Scan(&hasPassword)
+	if err != nil {
+		return err
+	}
+
+	var identity Identity
+	err = tx.QueryRow(ctx, `
+        DELETE FROM user_identities
+        WHERE id = $1 AND user_id = $2
+        RETURNING id, provider, email, created_at, last_login_at
+    `, id, userID).Scan(&identity.ID, &identity.Provider, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return &errs.Error{
+			Code:    errs.NotFound,
+			Message: "identity not found",
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if !hasPassword {
+		var remaining int
+		err = tx.QueryRow(ctx, `
+            SELECT COUNT(*) FROM user_identities WHERE user_id = $1
+        `, userID).Scan(&remaining)
+		if err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "set a password before removing your last sign in provider",
+			}
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	recordIdentityChange(ctx, actionUnlinkIdentity, userID, &identity, nil)
+	return nil
+}
+
+// startOIDC stores a sign in request and returns the provider's authorization URL
+func startOIDC(ctx context.Context, name string, linkUserID *int) (*OIDCStartResponse, error) {
+	provider, err := oidcProvider(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := oidc.NewState()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(ctx, `
+        INSERT INTO oidc_login_requests (state_hash, provider, code_verifier, nonce, link_user_id, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW())
+    `, hashOpaqueToken(state), name, verifier, nonce, linkUserID, time.Now().Add(oidcLoginTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCStartResponse{
+		AuthorizationURL: provider.AuthCodeURL(state, nonce, oidc.Challenge(verifier)),
+	}, nil
+}
+
+// linkIdentity links a provider account to a user. Linking an account that is
+// already linked to the same user only refreshes it.
+func linkIdentity(ctx context.Context, userID int, provider string, claims *oidc.Claims) error {
+	var identity Identity
+	var ownerID int
+	err := db.QueryRow(ctx, `
+        INSERT INTO user_identities (user_id, provider, subject, email, created_at)
+        VALUES ($1, $2, $3, $4, NOW())
+        ON CONFLICT (provider, subject) DO UPDATE
+        SET email = EXCLUDED.email
+        RETURNING id, user_id, provider, email, created_at, last_login_at
+    `, userID, provider, claims.Subject, normalizeEmail(claims.Email)).Scan(
+		&identity.ID, &ownerID, &identity.Provider, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt,
+	)
+	if err != nil {
+		return err
+	}
+	if ownerID != userID {
+		return &errs.Error{
+			Code:    errs.AlreadyExists,
+			Message: "this account is already linked to another user",
+		}
+	}
+	recordIdentityChange(ctx, actionLinkIdentity, userID, nil, &identity)
+	return nil
+}
+
+// resolveIdentity returns the user a provider account signs in as. Unknown accounts
+// are linked to the user with the same email address if both sides verified it, or
+// get a new user.
+func resolveIdentity(ctx context.Context, provider string, claims *oidc.Claims) (int, error) {
+	var userID int
+	err := db.QueryRow(ctx, `
+        SELECT user_id
+        FROM user_identities
+        WHERE provider = $1 AND subject = $2
+    `, provider, claims.Subject).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	} else if !errors.Is(err, sqldb.ErrNoRows) {
+		return 0, err
+	}
+
+	email := normalizeEmail(claims.Email)
+	v := &validator{}
+	v.checkEmail("email", email)
+	if v.err() != nil {
+		return 0, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "the provider did not share a valid email address",
+		}
+	}
+
+	// Link to an existing account with the same address
+	var verified bool
+	err = db.QueryRow(ctx, `
+        SELECT id, email_verified_at IS NOT NULL
+        FROM users
+        WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL
+    `, email).Scan(&userID, &verified)
+	if err == nil {
+		// Either side could have handed out an address it doesn't own
+		if !claims.EmailVerified || !verified {
+			return 0, &errs.Error{
+				Code:    errs.FailedPrecondition,
+				Message: "an account with this email address already exists; sign in with your password and link the provider from your account",
+			}
+		}
+		if err := linkIdentity(ctx, userID, provider, claims); err != nil {
+			return 0, err
+		}
+		return userID, nil
+	} else if !errors.Is(err, sqldb.ErrNoRows) {
+		return 0, err
+	}
+
+	return createOIDCUser(ctx, provider, claims, email)
+}
+
+// createOIDCUser registers a new user for a provider account. The user has no
+// password until they reset it.
+func createOIDCUser(ctx context.Context, provider string, claims *oidc.Claims, email string) (int, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = usernameBase(base)
+
+	fullname := strings.TrimSpace(claims.Name)
+	if fullname == "" {
+		fullname = base
+	}
+	if utf8.RuneCountInString(fullname) > fullnameMaxLength {
+		fullname = string([]rune(fullname)[:fullnameMaxLength])
+	}
+
+	for attempt := 0; ; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(10000))
+			if err != nil {
+				return 0, err
+			}
+			username = fmt.Sprintf("%s-%04d", base, suffix.Int64())
+		}
+
+		userID, err := insertOIDCUser(ctx, provider, claims, username, email, fullname)
+		// A unique violation is most likely the username; the address was checked above
+		taken := errors.Is(err, errUsernameTaken) || sqldb.ErrCode(err) == sqlerr.UniqueViolation
+		if taken && attempt < 5 {
+			continue
+		} else if taken {
+			return 0, &errs.Error{
+				Code:    errs.AlreadyExists,
+				Message: "could not create an account for this provider account",
+			}
+		} else if err != nil {
+			return 0, err
+		}
+
+		recordUserChange(ctx, actionRegister, userID, nil)
+		return userID, nil
+	}
+}
+
+// insertOIDCUser creates a user together with their first identity
+func insertOIDCUser(ctx context.Context, provider string, claims *oidc.Claims, username, email, fullname string) (int, error) {
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	err = tx.QueryRow(ctx, `
+        SELECT EXISTS (SELECT 1 FROM users WHERE LOWER(username) = LOWER($1))
+    `, username).Scan(&taken)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, errUsernameTaken
+	}
+
+	userID, err := createUser(ctx, tx, &newUser{
+		Username:      username,
+		Email:         email,
+		Fullname:      fullname,
+		EmailVerified: claims.EmailVerified,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO user_identities (user_id, provider, subject, email, created_at)
+        VALUES ($1, $2, $3, $4, NOW())
+    `, userID, provider, claims.Subject, email)
+	if err != nil {
+		return 0, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// usernameBase turns a provider's username or email local part into a valid username
+func usernameBase(s string) string {
+	s = usernameInvalidChars.ReplaceAllString(s, "")
+	s = strings.TrimLeft(s, "_.-")
+	// Leave room for the suffix added when the name is taken
+	if len(s) > usernameMaxLength-5 {
+		s = s[:usernameMaxLength-5]
+	}
+	for len(s) < usernameMinLength {
+		s += "user"
+	}
+	return s
+}
+
+// userIdentities returns the identities linked to a user
+func userIdentities(ctx context.Context, userID int) ([]*Identity, error) {
+	rows, err := db.Query(ctx, `
+        SELECT id, provider, email, created_at, last_login_at
+        FROM user_identities
+        WHERE user_id = $1
+        ORDER BY created_at
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.ID, &i.Provider, &i.Email, &i.CreatedAt, &i.LastLoginAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, &i)
+	}
+	return identities, rows.Err()
+}
+
+// recordIdentityChange writes a link or unlink to the audit log
+func recordIdentityChange(ctx context.Context, action string, userID int, before, after *Identity) {
+	change := audit.Change{
+		Action:     action,
+		EntityType: auditEntityUser,
+		EntityID:   strconv.Itoa(userID),
+		Before:     before,
+		After:      after,
+	}
+	if _, err := CurrentUserID(); err != nil {
+		change.ActorID = userID
+	}
+	audit.Record(ctx, change)
+}
+
+var (
+	oidcMu        sync.Mutex
+	oidcProviders = map[string]*oidc.Provider{}
+
+	oidcSecretsOnce sync.Once
+	oidcSecrets     map[string]string
+	oidcSecretsErr  error
+)
+
+// oidcProvider returns a configured provider, reading its discovery document on
+// first use. Failed discoveries are retried on the next call.
+func oidcProvider(ctx context.Context, name string) (*oidc.Provider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if p, ok := oidcProviders[name]; ok {
+		return p, nil
+	}
+
+	var pc *OIDCProvider
+	for i := range cfg.OIDCProviders {
+		if cfg.OIDCProviders[i].Name == name {
+			pc = &cfg.OIDCProviders[i]
+		}
+	}
+	if pc == nil {
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: "unknown sign in provider",
+		}
+	}
+
+	oidcSecretsOnce.Do(func() {
+		oidcSecrets = map[string]string{}
+		if secrets.OIDCClientSecrets != "" {
+			if err := json.Unmarshal([]byte(secrets.OIDCClientSecrets), &oidcSecrets); err != nil {
+				oidcSecretsErr = fmt.Errorf("parse OIDCClientSecrets: %w", err)
+			}
+		}
+	})
+	if oidcSecretsErr != nil {
+		return nil, oidcSecretsErr
+	}
+
+	p, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       pc.Issuer,
+		ClientID:     pc.ClientID,
+		ClientSecret: oidcSecrets[name],
+		Scopes:       pc.Scopes,
+		RedirectURL:  pc.RedirectURL,
+	}, nil)
+	if err != nil {
+		rlog.Error("oidc discovery failed", "provider", name, "err", err)
+		return nil, &errs.Error{
+			Code:    errs.Unavailable,
+			Message: "sign in provider is unavailable",
+		}
+	}
+	oidcProviders[name] = p
+	return p, nil
+}
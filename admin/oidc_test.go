@@ -0,0 +1,269 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"encore.app/authz"
+	"encore.app/authz/authztest"
+	"encore.app/oidc"
+	"encore.app/oidc/oidctest"
+	"encore.dev/beta/errs"
+)
+
+// testProvider is the name the mock issuer is registered under
+const testProvider = "oidctest"
+
+// useMockIssuer registers a mock issuer signing in user as testProvider
+func useMockIssuer(t *testing.T, user oidctest.User) *oidctest.Issuer {
+	t.Helper()
+	issuer := oidctest.NewServer(user)
+	t.Cleanup(issuer.Close)
+
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:      issuer.URL,
+		ClientID:    "fitness-test",
+		Scopes:      []string{"email", "profile"},
+		RedirectURL: "http://localhost:3000/auth/callback",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oidcMu.Lock()
+	oidcProviders[testProvider] = p
+	oidcMu.Unlock()
+	t.Cleanup(func() {
+		oidcMu.Lock()
+		delete(oidcProviders, testProvider)
+		oidcMu.Unlock()
+	})
+	return issuer
+}
+
+// providerUser returns a provider account with a unique subject and email address
+func providerUser(verified bool) oidctest.User {
+	n := authztest.NewUserID()
+	return oidctest.User{
+		Subject:       fmt.Sprintf("oidctest|%d", n),
+		Email:         fmt.Sprintf("provider%d@example.com", n),
+		EmailVerified: verified,
+		Name:          "Provider User",
+	}
+}
+
+// authorizeOIDC sends the user to the authorization URL and returns what the
+// provider passes back to the redirect URL
+func authorizeOIDC(t *testing.T, start *OIDCStartResponse) *FinishOIDCLoginParams {
+	t.Helper()
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(start.AuthorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization returned %s, want a redirect", resp.Status)
+	}
+
+	redirect, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &FinishOIDCLoginParams{
+		State:      redirect.Query().Get("state"),
+		Code:       redirect.Query().Get("code"),
+		DeviceName: "test",
+		UserAgent:  "oidc-test",
+		IPAddress:  "203.0.113.1",
+	}
+}
+
+// startOIDCLogin starts a sign in with the mock issuer and returns the callback parameters
+func startOIDCLogin(t *testing.T, ctx context.Context) *FinishOIDCLoginParams {
+	t.Helper()
+	start, err := StartOIDCLogin(ctx, testProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authorizeOIDC(t, start)
+}
+
+// identityOwner returns the user a provider account is linked to
+func identityOwner(t *testing.T, ctx context.Context, subject string) int {
+	t.Helper()
+	var userID int
+	err := db.QueryRow(ctx, `
+        SELECT user_id
+        FROM user_identities
+        WHERE provider = $1 AND subject = $2
+    `, testProvider, subject).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+func TestOIDCLoginCreatesUser(t *testing.T) {
+	ctx := context.Background()
+	user := providerUser(true)
+	useMockIssuer(t, user)
+
+	resp, err := FinishOIDCLogin(ctx, startOIDCLogin(t, ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Token == "" || resp.User == nil {
+		t.Fatalf("got %+v, want a session", resp)
+	}
+	if resp.User.Email != user.Email || resp.User.EmailVerifiedAt == nil {
+		t.Errorf("got user %+v, want the verified address %s", resp.User, user.Email)
+	}
+	if owner := identityOwner(t, ctx, user.Subject); owner != resp.User.ID {
+		t.Errorf("identity belongs to user %d, want %d", owner, resp.User.ID)
+	}
+
+	// Signing in again finds the same user
+	again, err := FinishOIDCLogin(ctx, startOIDCLogin(t, ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.User.ID != resp.User.ID {
+		t.Errorf("second sign in is user %d, want %d", again.User.ID, resp.User.ID)
+	}
+}
+
+func TestOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	userID, username := createTestUser(t, ctx)
+	user := providerUser(true)
+	user.Email = username + "@example.com"
+	useMockIssuer(t, user)
+
+	resp, err := FinishOIDCLogin(ctx, startOIDCLogin(t, ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.User.ID != userID {
+		t.Errorf("signed in as user %d, want the existing user %d", resp.User.ID, userID)
+	}
+	if owner := identityOwner(t, ctx, user.Subject); owner != userID {
+		t.Errorf("identity belongs to user %d, want %d", owner, userID)
+	}
+}
+
+func TestOIDCLoginUnverifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	_, username := createTestUser(t, ctx)
+	user := providerUser(false)
+	user.Email = username + "@example.com"
+	useMockIssuer(t, user)
+
+	_, err := FinishOIDCLogin(ctx, startOIDCLogin(t, ctx))
+	if errs.Code(err) != errs.FailedPrecondition {
+		t.Fatalf("got %v for an address the provider did not verify, want FailedPrecondition", err)
+	}
+
+	var linked bool
+	err = db.QueryRow(ctx, `
+        SELECT EXISTS (SELECT 1 FROM user_identities WHERE provider = $1 AND subject = $2)
+    `, testProvider, user.Subject).Scan(&linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked {
+		t.Error("linked an identity with an unverified address")
+	}
+}
+
+func TestOIDCLinkProvider(t *testing.T) {
+	ctx := context.Background()
+	userID, _ := createTestUser(t, ctx)
+	user := providerUser(true)
+	useMockIssuer(t, user)
+	authztest.AuthenticateAs(userID, authz.RoleTrainee)
+
+	start, err := LinkOIDCProvider(ctx, testProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := FinishOIDCLogin(ctx, authorizeOIDC(t, start))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.User.ID != userID {
+		t.Errorf("signed in as user %d, want %d", resp.User.ID, userID)
+	}
+	if owner := identityOwner(t, ctx, user.Subject); owner != userID {
+		t.Errorf("identity belongs to user %d, want %d", owner, userID)
+	}
+}
+
+func TestOIDCLoginBadState(t *testing.T) {
+	ctx := context.Background()
+	useMockIssuer(t, providerUser(true))
+
+	params := startOIDCLogin(t, ctx)
+	good := params.State
+	params.State = "not-the-state"
+	if _, err := FinishOIDCLogin(ctx, params); !errors.Is(err, errInvalidOIDCState) {
+		t.Errorf("got %v for an unknown state, want errInvalidOIDCState", err)
+	}
+
+	params.State = good
+	if _, err := FinishOIDCLogin(ctx, params); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FinishOIDCLogin(ctx, params); !errors.Is(err, errInvalidOIDCState) {
+		t.Errorf("got %v for a replayed state, want errInvalidOIDCState", err)
+	}
+}
+
+func TestOIDCLoginVerifierMismatch(t *testing.T) {
+	ctx := context.Background()
+	useMockIssuer(t, providerUser(true))
+
+	params := startOIDCLogin(t, ctx)
+	other, err := oidc.NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperLoginRequest(t, ctx, params.State, "code_verifier", other)
+
+	if _, err := FinishOIDCLogin(ctx, params); !errors.Is(err, errOIDCFailed) {
+		t.Errorf("got %v for another PKCE verifier, want errOIDCFailed", err)
+	}
+}
+
+func TestOIDCLoginNonceMismatch(t *testing.T) {
+	ctx := context.Background()
+	useMockIssuer(t, providerUser(true))
+
+	params := startOIDCLogin(t, ctx)
+	tamperLoginRequest(t, ctx, params.State, "nonce", "another-nonce")
+
+	if _, err := FinishOIDCLogin(ctx, params); !errors.Is(err, errOIDCFailed) {
+		t.Errorf("got %v for another nonce, want errOIDCFailed", err)
+	}
+}
+
+// tamperLoginRequest overwrites a column of the stored sign in request
+func tamperLoginRequest(t *testing.T, ctx context.Context, state, column, value string) {
+	t.Helper()
+	_, err := db.Exec(ctx, `
+        UPDATE oidc_login_requests
+        SET `+column+` = $1
+        WHERE state_hash = $2
+    `, value, hashOpaqueToken(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
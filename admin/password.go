@@ -0,0 +1,148 @@
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2Params are the argon2id cost parameters used for new password hashes
+type argon2Params struct {
+	Memory      uint32 // in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// defaultArgon2Params follow the OWASP recommendation for argon2id
+var defaultArgon2Params = argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var errInvalidHash = errors.New("invalid password hash")
+
+// hashPassword hashes a password with argon2id and returns it as a PHC string:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func hashPassword(password string) (string, error) {
+	p := defaultArgon2Params
+
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// dummyPasswordHash returns an argon2id hash of a random password, to verify
+// against when there is no user, so that takes as long as a real check
+var dummyPasswordHash = sync.OnceValue(func() string {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		panic(err)
+	}
+	hash, err := hashPassword(base64.RawStdEncoding.EncodeToString(password))
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// verifyPassword checks a password against a stored hash.
+// Besides argon2id it accepts bcrypt hashes and the unsalted SHA-256 hex digests
+// written by earlier versions. needsRehash reports whether the stored hash
+// should be replaced with one produced by hashPassword.
+func verifyPassword(password, hashedPassword string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		return verifyArgon2id(password, hashedPassword)
+
+	case strings.HasPrefix(hashedPassword, "$2a$"),
+		strings.HasPrefix(hashedPassword, "$2b$"),
+		strings.HasPrefix(hashedPassword, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+
+	case isLegacySHA256(hashedPassword):
+		sum := sha256.Sum256([]byte(password))
+		expected, _ := hex.DecodeString(hashedPassword)
+		return subtle.ConstantTimeCompare(sum[:], expected) == 1, true, nil
+
+	default:
+		return false, false, errInvalidHash
+	}
+}
+
+// verifyArgon2id checks a password against an argon2id PHC string
+func verifyArgon2id(password, encoded string) (ok bool, needsRehash bool, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, errInvalidHash
+	}
+	if version != argon2.Version {
+		return false, false, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return false, false, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errInvalidHash
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, errInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(expected))
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, expected) != 1 {
+		return false, false, nil
+	}
+	return true, p != defaultArgon2Params, nil
+}
+
+// isLegacySHA256 reports whether a stored hash is a hex encoded SHA-256 digest
+func isLegacySHA256(hashedPassword string) bool {
+	if len(hashedPassword) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	_, err := hex.DecodeString(hashedPassword)
+	return err == nil
+}
@@ -0,0 +1,174 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// passwordResetTTL is how long a password reset token can be used
+const passwordResetTTL = time.Hour
+
+var errInvalidResetToken = &errs.Error{
+	Code:    errs.InvalidArgument,
+	Message: "invalid or expired reset token",
+}
+
+// RequestPasswordResetParams contains the email of the account to recover
+type RequestPasswordResetParams struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordParams contains the data needed to set a new password
+type ResetPasswordParams struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// RequestPasswordReset emails a single-use password reset token to the account's address.
+// It succeeds whether or not the address belongs to an account, so it cannot be
+// used to find out which addresses are registered.
+//
+//encore:api public method=POST path=/admin/password/reset-request
+func RequestPasswordReset(ctx context.Context, params *RequestPasswordResetParams) error {
+	// Get user by email
+	var userID int
+	var email string
+	err := db.QueryRow(ctx, `
+        SELECT id, email
+        FROM users
+        WHERE LOWER(email) = LOWER($1) AND deleted_at IS NULL
+    `, params.Email).Scan(&userID, &email)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return sendPasswordReset(ctx, userID, email, "Someone asked to reset the password of your account. "+
+		"If this wasn't you, you can ignore this email.")
+}
+
+// sendPasswordReset emails a new password reset token to a user, explaining why with intro.
+// Earlier tokens of the user stop working.
+func sendPasswordReset(ctx context.Context, userID int, email, intro string) error {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Only the most recently requested token is valid
+	_, err = tx.Exec(ctx, `
+        UPDATE password_reset_tokens
+        SET used_at = NOW()
+        WHERE user_id = $1 AND used_at IS NULL
+    `, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, NOW())
+    `, userID, hashOpaqueToken(token), time.Now().Add(passwordResetTTL))
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%s\n\n"+
+		"Use this code to choose a new password within the next hour:\n\n%s\n", intro, token)
+	if err := sendEmail(ctx, email, "Reset your password", body); err != nil {
+		rlog.Error("could not send password reset email", "user_id", userID, "err", err)
+		return err
+	}
+	return nil
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset.
+// All existing sessions of the user are ended.
+//
+//encore:api public method=POST path=/admin/password/reset
+func ResetPassword(ctx context.Context, params *ResetPasswordParams) error {
+	v := &validator{}
+	v.checkPassword("new_password", params.NewPassword, "")
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(params.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Consume the token
+	var userID int
+	err = tx.QueryRow(ctx, `
+        UPDATE password_reset_tokens
+        SET used_at = NOW()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id
+    `, hashOpaqueToken(params.Token)).Scan(&userID)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return errInvalidResetToken
+	} else if err != nil {
+		return err
+	}
+
+	// The transaction has not changed the user yet
+	before, err := managedUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Set the new password
+	_, err = tx.Exec(ctx, `
+        UPDATE users
+        SET password_hash = $1, password_reset_required = FALSE, updated_at = NOW()
+        WHERE id = $2
+    `, hashedPassword, userID)
+	if err != nil {
+		return err
+	}
+
+	// End all sessions, they may belong to whoever knew the old password
+	_, err = tx.Exec(ctx, `
+        UPDATE sessions
+        SET revoked_at = NOW(), updated_at = NOW()
+        WHERE user_id = $1 AND revoked_at IS NULL
+    `, userID)
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	recordUserChange(ctx, actionResetPassword, userID, before)
+	return nil
+}
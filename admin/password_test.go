@@ -0,0 +1,156 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+	"encore.dev/storage/sqldb/sqlerr"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	const password = "correct horse battery staple"
+
+	argon, err := hashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cheapArgon := hashWithParams(t, password, argon2Params{Memory: 19456, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+
+	bcrypted, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(password))
+
+	tests := []struct {
+		name        string
+		hash        string
+		needsRehash bool
+	}{
+		{"argon2id", argon, false},
+		{"argon2id with outdated parameters", cheapArgon, true},
+		{"bcrypt $2a$", string(bcrypted), true},
+		{"bcrypt $2b$", "$2b$" + string(bcrypted[4:]), true},
+		{"bcrypt $2y$", "$2y$" + string(bcrypted[4:]), true},
+		{"SHA-256", hex.EncodeToString(sum[:]), true},
+		{"upper case SHA-256", strings.ToUpper(hex.EncodeToString(sum[:])), true},
+	}
+	for _, tt := range tests {
+		ok, needsRehash, err := verifyPassword(password, tt.hash)
+		if err != nil || !ok || needsRehash != tt.needsRehash {
+			t.Errorf("%s: got %v, %v, %v, want true, %v, nil", tt.name, ok, needsRehash, err, tt.needsRehash)
+		}
+		ok, needsRehash, err = verifyPassword("wrong password", tt.hash)
+		if err != nil || ok || needsRehash {
+			t.Errorf("%s: got %v, %v, %v for a wrong password, want false, false, nil", tt.name, ok, needsRehash, err)
+		}
+	}
+
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=65536,t=3,p=2$c2FsdA$aGFzaA",
+		"$argon2id$v=16$m=65536,t=3,p=2$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=65536$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=65536,t=3,p=2$not base64!$aGFzaA",
+		"$2a$10$tooshort",
+		hex.EncodeToString(sum[:31]),
+	} {
+		if ok, _, err := verifyPassword(password, hash); ok || err == nil {
+			t.Errorf("got %v, %v for the malformed hash %q, want an error", ok, err, hash)
+		}
+	}
+}
+
+func TestLoginUpgradesLegacyHash(t *testing.T) {
+	ctx := context.Background()
+	useMemoryCounters(t)
+	useTokenKeys(t, "test-secret", "")
+
+	bcrypted, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(testPassword))
+
+	for name, legacy := range map[string]string{
+		"bcrypt":  string(bcrypted),
+		"SHA-256": hex.EncodeToString(sum[:]),
+	} {
+		userID, username := createTestUser(t, ctx)
+		if _, err := db.Exec(ctx, `UPDATE users SET password_hash = $1 WHERE id = $2`, legacy, userID); err != nil {
+			t.Fatal(err)
+		}
+
+		// Usernames are matched ignoring case
+		resp, err := Login(ctx, &LoginParams{Username: strings.ToUpper(username), Password: testPassword})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if resp.User.ID != userID || resp.Token == "" {
+			t.Errorf("%s: got %+v, want a session of user %d", name, resp, userID)
+		}
+
+		var stored string
+		if err := db.QueryRow(ctx, `SELECT password_hash FROM users WHERE id = $1`, userID).Scan(&stored); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(stored, "$argon2id$v=19$m=65536,t=3,p=2$") {
+			t.Errorf("%s: stored %q after the login, want an argon2id PHC string", name, stored)
+		}
+		if ok, needsRehash, err := verifyPassword(testPassword, stored); !ok || needsRehash || err != nil {
+			t.Errorf("%s: got %v, %v, %v verifying the upgraded hash", name, ok, needsRehash, err)
+		}
+	}
+}
+
+func TestLoginInvalidCredentials(t *testing.T) {
+	ctx := context.Background()
+	useMemoryCounters(t)
+	_, username := createTestUser(t, ctx)
+
+	for _, params := range []*LoginParams{
+		{Username: username, Password: "wrong password"},
+		{Username: username + "-unknown", Password: testPassword},
+	} {
+		_, err := Login(ctx, params)
+		if errs.Code(err) != errs.Unauthenticated || err.Error() != errInvalidCredentials.Error() {
+			t.Errorf("got %v logging in as %q, want Unauthenticated", err, params.Username)
+		}
+	}
+}
+
+func TestUsernameUniqueIgnoringCase(t *testing.T) {
+	ctx := context.Background()
+	_, username := createTestUser(t, ctx)
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO users (username, email, password_hash, created_at, updated_at)
+		VALUES ($1, $2, 'x', NOW(), NOW())
+	`, strings.ToUpper(username), username+"-other@example.com")
+	if sqldb.ErrCode(err) != sqlerr.UniqueViolation {
+		t.Errorf("got %v storing %q next to %q, want a unique violation", err, strings.ToUpper(username), username)
+	}
+}
+
+// hashWithParams hashes a password like hashPassword with other parameters
+func hashWithParams(t *testing.T, password string, p argon2Params) string {
+	t.Helper()
+	prev := defaultArgon2Params
+	defaultArgon2Params = p
+	defer func() { defaultArgon2Params = prev }()
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
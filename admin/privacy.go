@@ -0,0 +1,224 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"encore.app/audit"
+	"encore.app/authz"
+)
+
+// actionEraseUser is recorded in the audit log when a user's personal data is erased
+const actionEraseUser = "user.erase"
+
+// LoginAttempt is a recorded login attempt
+type LoginAttempt struct {
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserDataExport is everything the admin service stores about a user
+type UserDataExport struct {
+	User          *User           `json:"user"`
+	UserDetail    *UserDetail     `json:"user_detail"`
+	Roles         []authz.Role    `json:"roles"`
+	MFAEnabled    bool            `json:"mfa_enabled"`
+	Sessions      []*Session      `json:"sessions"`
+	LoginAttempts []*LoginAttempt `json:"login_attempts"`
+	Identities    []*Identity     `json:"identities"`
+	APIKeys       []*APIKey       `json:"api_keys"`
+}
+
+// CheckPasswordParams contains a password to check
+type CheckPasswordParams struct {
+	Password string `json:"password"`
+}
+
+// ExportUserData collects the personal data of a user for a data export
+//
+//encore:api private method=GET path=/admin/users/:id/export
+func ExportUserData(ctx context.Context, id int) (*UserDataExport, error) {
+	u, err := managedUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	export := &UserDataExport{
+		User:       u.User,
+		UserDetail: u.UserDetail,
+		Roles:      u.Roles,
+		MFAEnabled: u.MFAEnabled,
+	}
+
+	// Every session, including ended ones
+	rows, err := db.Query(ctx, `
+        SELECT family_id, device_name, ip_address, user_agent, started_at, last_seen_at, expires_at
+        FROM sessions
+        WHERE user_id = $1
+        ORDER BY started_at
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	export.Sessions = []*Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(
+			&s.ID,
+			&s.DeviceName,
+			&s.IPAddress,
+			&s.UserAgent,
+			&s.StartedAt,
+			&s.LastSeenAt,
+			&s.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		export.Sessions = append(export.Sessions, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Failed attempts before the user existed are only known by username
+	rows, err = db.Query(ctx, `
+        SELECT ip_address, user_agent, success, reason, created_at
+        FROM login_attempts
+        WHERE user_id = $1 OR LOWER(username) = LOWER($2)
+        ORDER BY created_at
+    `, id, u.User.Username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	export.LoginAttempts = []*LoginAttempt{}
+	for rows.Next() {
+		var a LoginAttempt
+		if err := rows.Scan(&a.IPAddress, &a.UserAgent, &a.Success, &a.Reason, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		export.LoginAttempts = append(export.LoginAttempts, &a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	export.Identities, err = userIdentities(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	export.APIKeys, err = listAPIKeys(ctx, &id)
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// CheckPassword checks the password of a user before another service makes a sensitive change
+//
+//encore:api private method=POST path=/admin/users/:id/check-password
+func CheckPassword(ctx context.Context, id int, params *CheckPasswordParams) error {
+	return confirmPassword(ctx, id, params.Password)
+}
+
+// EraseUser removes the personal data of a user. The users row is kept, anonymized and
+// marked deleted, so records that refer to it, such as admin actions, stay intact.
+//
+//encore:api private method=POST path=/admin/users/:id/erase
+func EraseUser(ctx context.Context, id int) error {
+	u, err := managedUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	username := u.User.Username
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{
+		"user_details",
+		"user_roles",
+		"sessions",
+		"password_reset_tokens",
+		"email_verification_tokens",
+		"mfa_challenges",
+		"mfa_recovery_codes",
+		"user_mfa",
+		"user_identities",
+	} {
+		// The table names come from the fixed list above
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s WHERE user_id = $1`, table), id); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+        DELETE FROM oidc_login_requests
+        WHERE link_user_id = $1
+    `, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+        DELETE FROM api_keys
+        WHERE owner_user_id = $1
+    `, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+        DELETE FROM login_attempts
+        WHERE user_id = $1 OR LOWER(username) = LOWER($2)
+    `, id, username)
+	if err != nil {
+		return err
+	}
+
+	// Free the username and email address and make the password unusable
+	_, err = tx.Exec(ctx, `
+        UPDATE users
+        SET username = 'deleted-' || id,
+            email = 'deleted-' || id || '@deleted.invalid',
+            password_hash = '',
+            email_verified_at = NULL,
+            suspension_reason = NULL,
+            password_reset_required = FALSE,
+            deleted_at = COALESCE(deleted_at, NOW()),
+            updated_at = NOW()
+        WHERE id = $1
+    `, id)
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := loginCounters.Reset(ctx, usernameCounterKey(username)); err != nil {
+		return err
+	}
+	// A snapshot would keep the erased data in the audit log
+	audit.Record(ctx, audit.Change{
+		Action:     actionEraseUser,
+		EntityType: auditEntityUser,
+		EntityID:   strconv.Itoa(id),
+	})
+	publishUserChange(ctx, actionEraseUser, id)
+	return nil
+}
@@ -0,0 +1,206 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+	"encore.dev/storage/sqldb/sqlerr"
+)
+
+const (
+	addressMaxLength    = 1000
+	postalCodeMaxLength = 20
+)
+
+var postalCodePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9 -]*$`)
+
+// LocationParams sets the province, district and city of an address.
+// Leaving out an ID clears it.
+type LocationParams struct {
+	ProvinceID *int `json:"province_id,omitempty"`
+	DistrictID *int `json:"district_id,omitempty"`
+	CityID     *int `json:"city_id,omitempty"`
+}
+
+// UpdateProfileParams contains the profile fields to change.
+// Fields that are left out keep their current value.
+type UpdateProfileParams struct {
+	Fullname   *string         `json:"fullname,omitempty"`
+	Address    *string         `json:"address,omitempty"`
+	PostalCode *string         `json:"postal_code,omitempty"`
+	Location   *LocationParams `json:"location,omitempty"`
+}
+
+// ChangeUsernameParams contains the data needed to change the current user's username
+type ChangeUsernameParams struct {
+	NewUsername string `json:"new_username"`
+	Password    string `json:"password"`
+}
+
+// UpdateMyProfile changes the personal details of the current user
+//
+//encore:api auth method=POST path=/admin/me/profile tag:scope_profile_write
+func UpdateMyProfile(ctx context.Context, params *UpdateProfileParams) (*ProfileResponse, error) {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the input
+	v := &validator{}
+	var fullname, address, postalCode *string
+	if params.Fullname != nil {
+		s := strings.TrimSpace(*params.Fullname)
+		v.checkFullname("fullname", s)
+		fullname = &s
+	}
+	if params.Address != nil {
+		s := strings.TrimSpace(*params.Address)
+		if utf8.RuneCountInString(s) > addressMaxLength {
+			v.add("address", ViolationTooLong, fmt.Sprintf("address must be at most %d characters", addressMaxLength))
+		}
+		address = &s
+	}
+	if params.PostalCode != nil {
+		s := strings.TrimSpace(*params.PostalCode)
+		v.checkPostalCode("postal_code", s)
+		postalCode = &s
+	}
+	if loc := params.Location; loc != nil {
+		if err := v.checkLocation(ctx, loc.ProvinceID, loc.DistrictID, loc.CityID); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	before, err := managedUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A location replaces all three IDs, so leaving one out clears it
+	setLocation := params.Location != nil
+	loc := params.Location
+	if loc == nil {
+		loc = &LocationParams{}
+	}
+
+	// Users registered before details existed get a row; empty strings clear a field
+	_, err = db.Exec(ctx, `
+        INSERT INTO user_details (
+            user_id, fullname, address, postal_code, province_id, district_id, city_id, created_at, updated_at
+        )
+        SELECT id, COALESCE($2, username), NULLIF($3, ''), NULLIF($4, ''),
+               $6::SMALLINT, $7::INTEGER, $8::INTEGER, NOW(), NOW()
+        FROM users
+        WHERE id = $1
+        ON CONFLICT (user_id) DO UPDATE
+        SET fullname = COALESCE($2, user_details.fullname),
+            address = CASE WHEN $3::TEXT IS NULL THEN user_details.address ELSE NULLIF($3, '') END,
+            postal_code = CASE WHEN $4::TEXT IS NULL THEN user_details.postal_code ELSE NULLIF($4, '') END,
+            province_id = CASE WHEN $5 THEN $6::SMALLINT ELSE user_details.province_id END,
+            district_id = CASE WHEN $5 THEN $7::INTEGER ELSE user_details.district_id END,
+            city_id = CASE WHEN $5 THEN $8::INTEGER ELSE user_details.city_id END,
+            updated_at = NOW()
+    `, userID, fullname, address, postalCode, setLocation, loc.ProvinceID, loc.DistrictID, loc.CityID)
+	if err != nil {
+		return nil, err
+	}
+	recordUserChange(ctx, actionUpdateProfile, userID, before)
+
+	return GetProfile(ctx)
+}
+
+// ChangeUsername changes the current user's username. The new name is used for
+// logging in from now on; existing sessions stay valid.
+//
+//encore:api auth method=POST path=/admin/username/change
+func ChangeUsername(ctx context.Context, params *ChangeUsernameParams) (*User, error) {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := confirmPassword(ctx, userID, params.Password); err != nil {
+		return nil, err
+	}
+
+	newUsername := strings.TrimSpace(params.NewUsername)
+	v := &validator{}
+	v.checkUsername("new_username", newUsername)
+	if err := v.checkUsernameAvailable(ctx, "new_username", newUsername, userID); err != nil {
+		return nil, err
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	before, err := managedUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	err = db.QueryRow(ctx, `
+        UPDATE users
+        SET username = $1, updated_at = NOW()
+        WHERE id = $2
+        RETURNING id, username, email, email_verified_at, created_at, updated_at
+    `, newUsername, userID).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
+	if sqldb.ErrCode(err) == sqlerr.UniqueViolation {
+		return nil, fieldError("new_username", ViolationAlreadyTaken, "username is already taken")
+	} else if err != nil {
+		return nil, err
+	}
+	recordUserChange(ctx, actionChangeUsername, userID, before)
+
+	return &user, nil
+}
+
+// confirmPassword checks the current password of a user before a sensitive change.
+// Wrong passwords count against the login throttle of the username, so a stolen
+// session can't be used to guess the password faster than Login allows.
+func confirmPassword(ctx context.Context, userID int, password string) error {
+	var username, hashedPassword string
+	err := db.QueryRow(ctx, `
+        SELECT username, password_hash
+        FROM users
+        WHERE id = $1
+    `, userID).Scan(&username, &hashedPassword)
+	if err != nil {
+		return err
+	}
+
+	ip := callerIP()
+	if err := checkLoginThrottle(ctx, username, ip); err != nil {
+		return err
+	}
+	ok, _, err := verifyPassword(password, hashedPassword)
+	if err != nil || !ok {
+		recordLoginFailure(ctx, username, ip)
+		return &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "invalid credentials",
+		}
+	}
+	recordLoginSuccess(ctx, username)
+	return nil
+}
+
+// checkPostalCode validates a postal code. An empty code clears it.
+func (v *validator) checkPostalCode(field, postalCode string) {
+	switch {
+	case postalCode == "":
+	case len(postalCode) > postalCodeMaxLength:
+		v.add(field, ViolationTooLong, fmt.Sprintf("postal code must be at most %d characters", postalCodeMaxLength))
+	case !postalCodePattern.MatchString(postalCode):
+		v.add(field, ViolationInvalidFormat, "postal code may only contain letters, digits, spaces and '-'")
+	}
+}
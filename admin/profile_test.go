@@ -0,0 +1,38 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"context"
+	"testing"
+
+	"encore.app/authz"
+	"encore.app/authz/authztest"
+	"encore.dev/beta/errs"
+)
+
+func TestConfirmPasswordThrottled(t *testing.T) {
+	ctx := context.Background()
+	useMemoryCounters(t)
+
+	userID, username := createTestUser(t, ctx)
+	authztest.AuthenticateAs(userID, authz.RoleTrainee)
+
+	if err := confirmPassword(ctx, userID, testPassword); err != nil {
+		t.Fatalf("got %v for the right password, want nil", err)
+	}
+
+	for range usernamePolicy.FreeFailures + 1 {
+		if err := confirmPassword(ctx, userID, "wrong password"); errs.Code(err) != errs.PermissionDenied {
+			t.Fatalf("got %v for a wrong password, want PermissionDenied", err)
+		}
+	}
+
+	// The right password is refused as well while the username backs off
+	if err := confirmPassword(ctx, userID, testPassword); errs.Code(err) != errs.ResourceExhausted {
+		t.Errorf("got %v while throttled, want ResourceExhausted", err)
+	}
+	if err := checkLoginThrottle(ctx, username, "198.51.100.1"); errs.Code(err) != errs.ResourceExhausted {
+		t.Errorf("got %v from the login throttle, want ResourceExhausted", err)
+	}
+}
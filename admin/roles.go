@@ -0,0 +1,158 @@
+package admin
+
+import (
+	"context"
+
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+	"encore.dev/storage/sqldb/sqlerr"
+)
+
+// RoleParams contains the role to grant to a user
+type RoleParams struct {
+	Role authz.Role `json:"role"`
+}
+
+// RolesResponse contains the roles a user holds
+type RolesResponse struct {
+	Roles []authz.Role `json:"roles"`
+}
+
+// GrantRole grants a role to a user.
+// The new role is part of the user's tokens from their next login or token refresh.
+//
+//encore:api auth method=POST path=/admin/users/:id/roles tag:admin
+func GrantRole(ctx context.Context, id int, params *RoleParams) (*RolesResponse, error) {
+	if !params.Role.Valid() {
+		return nil, &errs.Error{
+			Code:    errs.InvalidArgument,
+			Message: "unknown role",
+		}
+	}
+
+	callerID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := managedUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(ctx, `
+        INSERT INTO user_roles (user_id, role, granted_by, created_at)
+        VALUES ($1, $2, $3, NOW())
+        ON CONFLICT (user_id, role) DO NOTHING
+    `, id, params.Role, callerID)
+	if sqldb.ErrCode(err) == sqlerr.ForeignKeyViolation {
+		return nil, errUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	granted := res.RowsAffected() > 0
+	if granted {
+		details := map[string]interface{}{"role": params.Role}
+		if err := recordAdminAction(ctx, tx, callerID, actionGrantRole, id, details); err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if granted {
+		recordUserChange(ctx, actionGrantRole, id, before)
+	}
+
+	return userRoles(ctx, id)
+}
+
+// RevokeRole removes a role from a user
+//
+//encore:api auth method=DELETE path=/admin/users/:id/roles/:role tag:admin
+func RevokeRole(ctx context.Context, id int, role string) (*RolesResponse, error) {
+	callerID, err := CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := managedUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(ctx, `
+        DELETE FROM user_roles
+        WHERE user_id = $1 AND role = $2
+    `, id, role)
+	if err != nil {
+		return nil, err
+	}
+	revoked := res.RowsAffected() > 0
+	if revoked {
+		details := map[string]interface{}{"role": role}
+		if err := recordAdminAction(ctx, tx, callerID, actionRevokeRole, id, details); err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if revoked {
+		recordUserChange(ctx, actionRevokeRole, id, before)
+	}
+
+	return userRoles(ctx, id)
+}
+
+// userRoles returns the roles of a user
+func userRoles(ctx context.Context, userID int) (*RolesResponse, error) {
+	roles, err := loadRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &RolesResponse{Roles: roles}, nil
+}
+
+// loadRoles returns the roles held by a user
+func loadRoles(ctx context.Context, userID int) ([]authz.Role, error) {
+	rows, err := db.Query(ctx, `
+        SELECT role
+        FROM user_roles
+        WHERE user_id = $1
+        ORDER BY role
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []authz.Role{}
+	for rows.Next() {
+		var role authz.Role
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
@@ -0,0 +1,312 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+	"github.com/google/uuid"
+)
+
+// refreshTokenTTL is how long a refresh token can be exchanged for a new access token.
+// Every refresh issues a new refresh token, so active sessions slide forward.
+const refreshTokenTTL = 30 * 24 * time.Hour
+
+var errInvalidRefreshToken = &errs.Error{
+	Code:    errs.Unauthenticated,
+	Message: "invalid refresh token",
+}
+
+// Session represents a logged in device of a user
+type Session struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+	StartedAt  time.Time `json:"started_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// SessionsResponse contains the active sessions of the current user
+type SessionsResponse struct {
+	Sessions []*Session `json:"sessions"`
+}
+
+// RefreshParams contains the data needed to refresh an access token
+type RefreshParams struct {
+	RefreshToken string `json:"refresh_token"`
+	UserAgent    string `header:"User-Agent"`
+	IPAddress    string `header:"X-Forwarded-For"`
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh token.
+// Presenting a refresh token that was already exchanged revokes the whole session.
+//
+//encore:api public method=POST path=/admin/token/refresh
+func RefreshToken(ctx context.Context, params *RefreshParams) (*AuthResponse, error) {
+	// Look up the refresh token
+	var (
+		sessionID  int64
+		userID     int
+		familyID   string
+		deviceName string
+		mfa        bool
+		startedAt  time.Time
+		expiresAt  time.Time
+		rotatedAt  *time.Time
+		revokedAt  *time.Time
+	)
+	err := db.QueryRow(ctx, `
+        SELECT id, user_id, family_id, device_name, mfa_verified, started_at, expires_at, rotated_at, revoked_at
+        FROM sessions
+        WHERE refresh_token_hash = $1
+    `, hashOpaqueToken(params.RefreshToken)).Scan(
+		&sessionID, &userID, &familyID, &deviceName, &mfa, &startedAt, &expiresAt, &rotatedAt, &revokedAt,
+	)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	if revokedAt != nil || time.Now().After(expiresAt) {
+		return nil, errInvalidRefreshToken
+	}
+
+	// A rotated token being presented again means it leaked
+	if rotatedAt != nil {
+		return nil, revokeReusedFamily(ctx, userID, familyID)
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Rotate the presented token; losing a concurrent rotation counts as reuse
+	res, err := tx.Exec(ctx, `
+        UPDATE sessions
+        SET rotated_at = NOW(), updated_at = NOW()
+        WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+    `, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() != 1 {
+		tx.Rollback()
+		return nil, revokeReusedFamily(ctx, userID, familyID)
+	}
+
+	// Issue the next token of the family
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	newExpiresAt := time.Now().Add(refreshTokenTTL)
+	_, err = tx.Exec(ctx, `
+        INSERT INTO sessions (
+            user_id, family_id, refresh_token_hash, device_name, ip_address, user_agent, mfa_verified,
+            started_at, last_seen_at, expires_at, created_at, updated_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), $9, NOW(), NOW())
+    `, userID, familyID, hashOpaqueToken(refreshToken), deviceName,
+		clientIP(params.IPAddress), params.UserAgent, mfa, startedAt, newExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the user; suspended and deleted accounts cannot refresh
+	var user User
+	err = tx.QueryRow(ctx, `
+        SELECT id, username, email, email_verified_at, created_at, updated_at
+        FROM users
+        WHERE id = $1 AND suspended_at IS NULL AND deleted_at IS NULL
+    `, userID).Scan(&user.ID, &user.Username, &user.Email, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// Pick up role and verification changes made since the last refresh
+	roles, err := loadRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(&user, roles, familyID, mfa)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(accessTokenTTL),
+		User:         &user,
+	}, nil
+}
+
+// Logout ends the session the current access token belongs to
+//
+//encore:api auth method=POST path=/admin/logout
+func Logout(ctx context.Context) error {
+	data, err := currentAuthData()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(ctx, `
+        UPDATE sessions
+        SET revoked_at = NOW(), updated_at = NOW()
+        WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL
+    `, data.UserID, data.SessionID)
+	return err
+}
+
+// LogoutAllDevices ends every session of the current user
+//
+//encore:api auth method=POST path=/admin/logout/all
+func LogoutAllDevices(ctx context.Context) error {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return err
+	}
+	return revokeAllSessions(ctx, userID)
+}
+
+// MySessions lists the active sessions of the current user
+//
+//encore:api auth method=GET path=/admin/sessions
+func MySessions(ctx context.Context) (*SessionsResponse, error) {
+	data, err := currentAuthData()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the newest token of each family is live
+	rows, err := db.Query(ctx, `
+        SELECT family_id, device_name, ip_address, user_agent, started_at, last_seen_at, expires_at
+        FROM sessions
+        WHERE user_id = $1 AND rotated_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+        ORDER BY last_seen_at DESC
+    `, data.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(
+			&s.ID,
+			&s.DeviceName,
+			&s.IPAddress,
+			&s.UserAgent,
+			&s.StartedAt,
+			&s.LastSeenAt,
+			&s.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		s.Current = s.ID == data.SessionID
+		sessions = append(sessions, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &SessionsResponse{Sessions: sessions}, nil
+}
+
+// startSession starts a new session for a user and issues its first access and refresh token.
+// mfaVerified records whether the user passed a second factor when the session started.
+func startSession(ctx context.Context, user *User, deviceName, ipAddress, userAgent string, mfaVerified bool) (*AuthResponse, error) {
+	refreshToken, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	familyID := uuid.NewString()
+	_, err = db.Exec(ctx, `
+        INSERT INTO sessions (
+            user_id, family_id, refresh_token_hash, device_name, ip_address, user_agent, mfa_verified,
+            started_at, last_seen_at, expires_at, created_at, updated_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW(), $8, NOW(), NOW())
+    `, user.ID, familyID, hashOpaqueToken(refreshToken), deviceName,
+		clientIP(ipAddress), userAgent, mfaVerified, time.Now().Add(refreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := loadRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(user, roles, familyID, mfaVerified)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    time.Now().Add(accessTokenTTL),
+		User:         user,
+	}, nil
+}
+
+// revokeReusedFamily revokes every token of a session after refresh token reuse
+// and returns the error to report to the caller
+func revokeReusedFamily(ctx context.Context, userID int, familyID string) error {
+	rlog.Warn("refresh token reuse detected, revoking session", "user_id", userID, "session", familyID)
+
+	_, err := db.Exec(ctx, `
+        UPDATE sessions
+        SET revoked_at = NOW(), updated_at = NOW()
+        WHERE family_id = $1 AND revoked_at IS NULL
+    `, familyID)
+	if err != nil {
+		return err
+	}
+	return errInvalidRefreshToken
+}
+
+// revokeAllSessions revokes every session of a user
+func revokeAllSessions(ctx context.Context, userID int) error {
+	_, err := db.Exec(ctx, `
+        UPDATE sessions
+        SET revoked_at = NOW(), updated_at = NOW()
+        WHERE user_id = $1 AND revoked_at IS NULL
+    `, userID)
+	return err
+}
+
+// clientIP returns the client address from an X-Forwarded-For value: the entry
+// added by the outermost trusted proxy. Entries left of it can be forged by the
+// client, so it returns "" when the value has fewer entries than trusted proxies.
+func clientIP(forwardedFor string) string {
+	hops := cfg.TrustedProxyHops()
+	if forwardedFor == "" || hops < 1 {
+		return ""
+	}
+	entries := strings.Split(forwardedFor, ",")
+	if len(entries) < hops {
+		return ""
+	}
+	return strings.TrimSpace(entries[len(entries)-hops])
+}
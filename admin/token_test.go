@@ -0,0 +1,275 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"encore.app/authz"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testRSAKey is a generated key with its PEM encoded halves
+type testRSAKey struct {
+	key        *rsa.PrivateKey
+	privatePEM string
+	publicPEM  string
+}
+
+func newTestRSAKey(t *testing.T) *testRSAKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRSAKey{
+		key:        key,
+		privatePEM: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv})),
+		publicPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+	}
+}
+
+// keySetJSON encodes a JWTRSAKeys secret signing with the private half of
+// active and verifying with the public halves of retired
+func keySetJSON(t *testing.T, activeKid string, active *testRSAKey, retired map[string]*testRSAKey) string {
+	t.Helper()
+	type key struct {
+		Kid        string `json:"kid"`
+		PrivateKey string `json:"private_key,omitempty"`
+		PublicKey  string `json:"public_key,omitempty"`
+	}
+	keys := []key{{Kid: activeKid, PrivateKey: active.privatePEM}}
+	for kid, k := range retired {
+		keys = append(keys, key{Kid: kid, PublicKey: k.publicPEM})
+	}
+	b, err := json.Marshal(map[string]any{"active": activeKid, "keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// useTokenKeys configures the signing keys for one test. An empty rsaKeys
+// signs with HS256 only.
+func useTokenKeys(t *testing.T, hmacSecret, rsaKeys string) {
+	prevSecret, prevRSA := secrets.JWTSecret, secrets.JWTRSAKeys
+	t.Cleanup(func() {
+		secrets.JWTSecret, secrets.JWTRSAKeys = prevSecret, prevRSA
+		rsaKeysOnce = sync.Once{}
+	})
+	secrets.JWTSecret, secrets.JWTRSAKeys = hmacSecret, rsaKeys
+	rsaKeysOnce = sync.Once{}
+}
+
+// testTokenUser is the user tokens are issued to in these tests
+func testTokenUser() *User {
+	now := time.Now()
+	return &User{ID: 42, Username: "alice", EmailVerifiedAt: &now}
+}
+
+func TestParseRSAKeySet(t *testing.T) {
+	active, retired := newTestRSAKey(t), newTestRSAKey(t)
+
+	ks, err := parseRSAKeySet(keySetJSON(t, "2026-10", active, map[string]*testRSAKey{"2026-04": retired}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.signing == nil || !ks.signing.Equal(active.key) {
+		t.Errorf("signing key is not the active key")
+	}
+	if len(ks.public) != 2 || !ks.public["2026-10"].Equal(&active.key.PublicKey) || !ks.public["2026-04"].Equal(&retired.key.PublicKey) {
+		t.Errorf("got public keys %v, want the active and the retired key", ks.public)
+	}
+
+	// Without keys RS256 is not configured
+	for _, raw := range []string{"", "{}", `{"keys": []}`} {
+		if ks, err := parseRSAKeySet(raw); ks != nil || err != nil {
+			t.Errorf("got %v, %v for %q, want nil, nil", ks, err, raw)
+		}
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"invalid JSON", `{"keys": [`},
+		{"key without kid", `{"keys": [{"public_key": ` + quote(t, retired.publicPEM) + `}]}`},
+		{"key without key material", `{"keys": [{"kid": "a"}]}`},
+		{"invalid private key", `{"active": "a", "keys": [{"kid": "a", "private_key": "not a key"}]}`},
+		{"invalid public key", `{"keys": [{"kid": "a", "public_key": "not a key"}]}`},
+		{"active key without private key", `{"active": "a", "keys": [{"kid": "a", "public_key": ` + quote(t, retired.publicPEM) + `}]}`},
+		{"unknown active key", `{"active": "b", "keys": [{"kid": "a", "private_key": ` + quote(t, active.privatePEM) + `}]}`},
+	}
+	for _, tt := range tests {
+		if _, err := parseRSAKeySet(tt.raw); err == nil {
+			t.Errorf("%s: got no error", tt.name)
+		}
+	}
+}
+
+func TestTokenHS256(t *testing.T) {
+	useTokenKeys(t, "test-secret", "")
+
+	token, err := generateToken(testTokenUser(), []authz.Role{authz.RoleTrainer}, "session-1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := parseToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" || claims.Issuer != tokenIssuer || claims.SessionID != "session-1" {
+		t.Errorf("got subject %q, issuer %q and session %q", claims.Subject, claims.Issuer, claims.SessionID)
+	}
+	if !slices.Equal(claims.Roles, []authz.Role{authz.RoleTrainer}) || !claims.EmailVerified || !claims.MFAVerified {
+		t.Errorf("got claims %+v, want a verified trainer with a second factor", claims)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != accessTokenTTL {
+		t.Errorf("token lives %s, want %s", ttl, accessTokenTTL)
+	}
+	if alg := tokenHeader(t, token)["alg"]; alg != "HS256" {
+		t.Errorf("signed with %v, want HS256", alg)
+	}
+}
+
+func TestTokenRS256Rotation(t *testing.T) {
+	oldKey, newKey := newTestRSAKey(t), newTestRSAKey(t)
+	useTokenKeys(t, "test-secret", keySetJSON(t, "2026-04", oldKey, nil))
+
+	oldToken, err := generateToken(testTokenUser(), nil, "session-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := tokenHeader(t, oldToken); h["alg"] != "RS256" || h["kid"] != "2026-04" {
+		t.Errorf("got header %v, want RS256 with kid 2026-04", h)
+	}
+
+	// After a rotation new tokens use the new key and old ones still verify
+	useTokenKeys(t, "test-secret", keySetJSON(t, "2026-10", newKey, map[string]*testRSAKey{"2026-04": oldKey}))
+	newToken, err := generateToken(testTokenUser(), nil, "session-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := tokenHeader(t, newToken)["kid"]; kid != "2026-10" {
+		t.Errorf("signed with kid %v, want 2026-10", kid)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := parseToken(token); err != nil {
+			t.Errorf("got %v, want the token to verify", err)
+		}
+	}
+
+	// Once the old key is removed its tokens are rejected
+	useTokenKeys(t, "test-secret", keySetJSON(t, "2026-10", newKey, nil))
+	if _, err := parseToken(oldToken); err == nil {
+		t.Error("token of a removed key verified")
+	}
+	if _, err := parseToken(newToken); err != nil {
+		t.Errorf("got %v, want the token of the active key to verify", err)
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	rsaKey, otherKey := newTestRSAKey(t), newTestRSAKey(t)
+	useTokenKeys(t, "test-secret", keySetJSON(t, "a", rsaKey, nil))
+
+	now := time.Now()
+	valid := func() *tokenClaims {
+		return &tokenClaims{RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   "42",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		}}
+	}
+	sign := func(method jwt.SigningMethod, claims *tokenClaims, kid string, key any) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	expired := valid()
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+	notYetValid := valid()
+	notYetValid.NotBefore = jwt.NewNumericDate(now.Add(time.Hour))
+	otherIssuer := valid()
+	otherIssuer.Issuer = "someone-else"
+	noExpiry := valid()
+	noExpiry.ExpiresAt = nil
+
+	good := sign(jwt.SigningMethodHS256, valid(), "", []byte("test-secret"))
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", sign(jwt.SigningMethodHS256, expired, "", []byte("test-secret"))},
+		{"not yet valid", sign(jwt.SigningMethodHS256, notYetValid, "", []byte("test-secret"))},
+		{"other issuer", sign(jwt.SigningMethodHS256, otherIssuer, "", []byte("test-secret"))},
+		{"no expiry", sign(jwt.SigningMethodHS256, noExpiry, "", []byte("test-secret"))},
+		{"wrong secret", sign(jwt.SigningMethodHS256, valid(), "", []byte("other-secret"))},
+		{"HS512", sign(jwt.SigningMethodHS512, valid(), "", []byte("test-secret"))},
+		{"RS512", sign(jwt.SigningMethodRS512, valid(), "a", rsaKey.key)},
+		{"none", sign(jwt.SigningMethodNone, valid(), "", jwt.UnsafeAllowNoneSignatureType)},
+		{"unknown kid", sign(jwt.SigningMethodRS256, valid(), "b", rsaKey.key)},
+		{"no kid", sign(jwt.SigningMethodRS256, valid(), "", rsaKey.key)},
+		{"other RSA key", sign(jwt.SigningMethodRS256, valid(), "a", otherKey.key)},
+		{"tampered", good[:len(good)-4] + "AAAA"},
+		{"malformed", "not.a.token"},
+	}
+	for _, tt := range tests {
+		if _, err := parseToken(tt.token); err == nil {
+			t.Errorf("%s: token verified", tt.name)
+		}
+	}
+	if _, err := parseToken(good); err != nil {
+		t.Errorf("got %v for a valid token", err)
+	}
+
+	// RS256 tokens are rejected when no key set is configured
+	useTokenKeys(t, "test-secret", "")
+	if _, err := parseToken(sign(jwt.SigningMethodRS256, valid(), "a", rsaKey.key)); err == nil {
+		t.Error("RS256 token verified without a key set")
+	}
+}
+
+// tokenHeader decodes the header of a token without verifying it
+func tokenHeader(t *testing.T, token string) map[string]any {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &tokenClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Header
+}
+
+// quote encodes s as a JSON string
+func quote(t *testing.T, s string) string {
+	t.Helper()
+	b, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,97 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed of RFC 6238 Appendix B, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// The appendix lists 8 digit codes; a 6 digit code is their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := totpCode(rfc6238Secret, tt.unix/int64(totpPeriod.Seconds()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("got %s at %d, want %s", got, tt.unix, tt.want)
+		}
+
+		// Secrets are accepted in lower case too
+		if got, _ := totpCode(strings.ToLower(rfc6238Secret), tt.unix/int64(totpPeriod.Seconds())); got != tt.want {
+			t.Errorf("got %s at %d for the lower case secret, want %s", got, tt.unix, tt.want)
+		}
+	}
+
+	if _, err := totpCode("not base32!", 1); err == nil {
+		t.Error("got no error for an invalid secret")
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	step := at.Unix() / 30
+
+	tests := []struct {
+		name         string
+		code         string
+		t            time.Time
+		lastUsedStep int64
+		wantStep     int64
+		ok           bool
+	}{
+		{"current step", "050471", at, 0, step, true},
+		{"with a space", "050 471", at, 0, step, true},
+		{"one step late", "050471", at.Add(totpPeriod), 0, step, true},
+		{"one step early", "050471", at.Add(-totpPeriod), 0, step, true},
+		{"two steps late", "050471", at.Add(2 * totpPeriod), 0, 0, false},
+		{"replayed", "050471", at, step, 0, false},
+		{"after a later code", "050471", at, step + 1, 0, false},
+		{"wrong code", "123456", at, 0, 0, false},
+		{"too short", "05047", at, 0, 0, false},
+		{"too long", "0504711", at, 0, 0, false},
+	}
+	for _, tt := range tests {
+		gotStep, ok := validateTOTP(rfc6238Secret, tt.code, tt.t, tt.lastUsedStep)
+		if ok != tt.ok || gotStep != tt.wantStep {
+			t.Errorf("%s: got step %d and %v, want %d and %v", tt.name, gotStep, ok, tt.wantStep, tt.ok)
+		}
+	}
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("got code %q, want a new xxxxx-xxxxx code", code)
+		}
+		seen[code] = true
+	}
+
+	if got := normalizeRecoveryCode(" ABCDE-fghjk "); got != "abcdefghjk" {
+		t.Errorf("got %q, want the code without case, dashes and spaces", got)
+	}
+}
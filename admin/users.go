@@ -0,0 +1,496 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// auditEntityUser is the entity type of users in the audit log
+const auditEntityUser = "user"
+
+var (
+	errInvalidCredentials = &errs.Error{
+		Code:    errs.Unauthenticated,
+		Message: "invalid credentials",
+	}
+	errAccountSuspended = &errs.Error{
+		Code:    errs.PermissionDenied,
+		Message: "account suspended",
+	}
+	errPasswordResetRequired = &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: "a password reset is required, check your email for a reset code",
+	}
+	errUserNotFound = &errs.Error{
+		Code:    errs.NotFound,
+		Message: "user not found",
+	}
+	errOwnAccount = &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: "administrators cannot perform this action on their own account",
+	}
+)
+
+// Actions recorded in the audit log. Those taken by administrators are
+// recorded in the admin_actions table as well.
+const (
+	actionRegister           = "user.register"
+	actionUpdateProfile      = "user.update_profile"
+	actionChangeUsername     = "user.change_username"
+	actionRequestEmailChange = "user.request_email_change"
+	actionVerifyEmail        = "user.verify_email"
+	actionResetPassword      = "user.reset_password"
+	actionEnableMFA          = "user.enable_mfa"
+	actionDisableMFA         = "user.disable_mfa"
+
+	actionSuspendUser        = "user.suspend"
+	actionReactivateUser     = "user.reactivate"
+	actionForcePasswordReset = "user.force_password_reset"
+	actionDeleteUser         = "user.delete"
+	actionUnlockUser         = "user.unlock"
+	actionGrantRole          = "role.grant"
+	actionRevokeRole         = "role.revoke"
+	actionLinkIdentity       = "user.link_identity"
+	actionUnlinkIdentity     = "user.unlink_identity"
+)
+
+// UserStatus is the state of an account
+type UserStatus string
+
+const (
+	UserStatusActive    UserStatus = "ACTIVE"
+	UserStatusSuspended UserStatus = "SUSPENDED"
+	UserStatusDeleted   UserStatus = "DELETED"
+)
+
+// UserSortField is a field users can be sorted by
+type UserSortField string
+
+const (
+	UserSortCreatedAt UserSortField = "CREATED_AT"
+	UserSortUsername  UserSortField = "USERNAME"
+	UserSortEmail     UserSortField = "EMAIL"
+)
+
+// userSortColumns maps sort fields to the columns they order by
+var userSortColumns = map[UserSortField]string{
+	UserSortCreatedAt: "u.created_at",
+	UserSortUsername:  "LOWER(u.username)",
+	UserSortEmail:     "LOWER(u.email)",
+}
+
+// ListUsersParams filters, sorts and pages the user list. Every filter is optional.
+type ListUsersParams struct {
+	// Search matches part of the username, email or full name
+	Search        string      `json:"search,omitempty"`
+	Role          *authz.Role `json:"role,omitempty"`
+	CreatedAfter  *time.Time  `json:"created_after,omitempty"`
+	CreatedBefore *time.Time  `json:"created_before,omitempty"`
+	Verified      *bool       `json:"verified,omitempty"`
+
+	// Status defaults to every account that is not deleted
+	Status *UserStatus `json:"status,omitempty"`
+
+	SortBy   UserSortField `json:"sort_by,omitempty"`
+	SortDesc bool          `json:"sort_desc,omitempty"`
+
+	// Page starts at 1
+	Page     int `json:"page,omitempty"`
+	PageSize int `json:"page_size,omitempty"`
+}
+
+// ManagedUser is a user as seen by administrators
+type ManagedUser struct {
+	User                  *User        `json:"user"`
+	UserDetail            *UserDetail  `json:"user_detail"`
+	Roles                 []authz.Role `json:"roles"`
+	Status                UserStatus   `json:"status"`
+	SuspendedAt           *time.Time   `json:"suspended_at,omitempty"`
+	SuspensionReason      string       `json:"suspension_reason,omitempty"`
+	DeletedAt             *time.Time   `json:"deleted_at,omitempty"`
+	PasswordResetRequired bool         `json:"password_reset_required"`
+	MFAEnabled            bool         `json:"mfa_enabled"`
+}
+
+// UserPage is one page of the user list
+type UserPage struct {
+	Users    []*ManagedUser `json:"users"`
+	Total    int            `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+}
+
+// SuspendUserParams contains the reason for a suspension
+type SuspendUserParams struct {
+	Reason string `json:"reason"`
+}
+
+// managedUserQuery selects the columns scanned by scanManagedUser
+const managedUserQuery = `
+    SELECT u.id, u.username, u.email, u.email_verified_at, u.created_at, u.updated_at,
+           u.suspended_at, COALESCE(u.suspension_reason, ''), u.deleted_at, u.password_reset_required,
+           COALESCE(d.id, 0), COALESCE(d.fullname, ''), COALESCE(d.address, ''), COALESCE(d.postal_code, ''),
+           d.province_id, d.district_id, d.city_id,
+           COALESCE(d.created_at, u.created_at), COALESCE(d.updated_at, u.updated_at),
+           ARRAY(SELECT r.role FROM user_roles r WHERE r.user_id = u.id ORDER BY r.role),
+           EXISTS (SELECT 1 FROM user_mfa m WHERE m.user_id = u.id AND m.enabled_at IS NOT NULL)
+    FROM users u
+    LEFT JOIN user_details d ON d.user_id = u.id
+`
+
+// userFilter is the WHERE clause applying ListUsersParams
+const userFilter = `
+    WHERE ($1 = '' OR u.username ILIKE $1 OR u.email ILIKE $1 OR d.fullname ILIKE $1)
+      AND ($2::TEXT IS NULL OR EXISTS (SELECT 1 FROM user_roles r WHERE r.user_id = u.id AND r.role = $2))
+      AND ($3::TIMESTAMPTZ IS NULL OR u.created_at >= $3)
+      AND ($4::TIMESTAMPTZ IS NULL OR u.created_at < $4)
+      AND ($5::BOOLEAN IS NULL OR (u.email_verified_at IS NOT NULL) = $5)
+      AND CASE $6::TEXT
+            WHEN 'ACTIVE' THEN u.suspended_at IS NULL AND u.deleted_at IS NULL
+            WHEN 'SUSPENDED' THEN u.suspended_at IS NOT NULL AND u.deleted_at IS NULL
+            WHEN 'DELETED' THEN u.deleted_at IS NOT NULL
+            ELSE u.deleted_at IS NULL
+          END
+`
+
+// ListUsers searches users with filters, sorting and pagination
+//
+//encore:api auth method=POST path=/admin/search/users tag:admin
+func ListUsers(ctx context.Context, params *ListUsersParams) (*UserPage, error) {
+	sortBy := params.SortBy
+	if sortBy == "" {
+		sortBy = UserSortCreatedAt
+	}
+	column, ok := userSortColumns[sortBy]
+	if !ok {
+		return nil, fieldError("sort_by", ViolationInvalidFormat, "unknown sort field")
+	}
+	direction := "ASC"
+	if params.SortDesc {
+		direction = "DESC"
+	}
+
+	page := max(params.Page, 1)
+	pageSize := params.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultUserPageSize
+	}
+	pageSize = min(pageSize, maxUserPageSize)
+
+	var search string
+	if s := strings.TrimSpace(params.Search); s != "" {
+		search = "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+	}
+	var role, status *string
+	if params.Role != nil {
+		r := string(*params.Role)
+		role = &r
+	}
+	if params.Status != nil {
+		s := string(*params.Status)
+		status = &s
+	}
+	args := []interface{}{search, role, params.CreatedAfter, params.CreatedBefore, params.Verified, status}
+
+	// Count all matches for the page count
+	var total int
+	err := db.QueryRow(ctx, `
+        SELECT COUNT(*)
+        FROM users u
+        LEFT JOIN user_details d ON d.user_id = u.id
+    `+userFilter, args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	// The column and direction come from fixed lists, never from the caller
+	rows, err := db.Query(ctx, managedUserQuery+userFilter+fmt.Sprintf(`
+        ORDER BY %s %s, u.id %s
+        LIMIT $7 OFFSET $8
+    `, column, direction, direction), append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*ManagedUser{}
+	for rows.Next() {
+		u, err := scanManagedUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &UserPage{
+		Users:    users,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// GetUser returns a user with their details, including deleted users
+//
+//encore:api auth method=GET path=/admin/users/:id tag:admin
+func GetUser(ctx context.Context, id int) (*ManagedUser, error) {
+	return managedUser(ctx, id)
+}
+
+// managedUser loads a user with their details, roles and account state
+func managedUser(ctx context.Context, id int) (*ManagedUser, error) {
+	u, err := scanManagedUser(db.QueryRow(ctx, managedUserQuery+`
+        WHERE u.id = $1
+    `, id))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errUserNotFound
+	}
+	return u, err
+}
+
+// SuspendUser blocks a user from logging in and ends their sessions.
+// Access tokens that were already issued stay valid until they expire.
+//
+//encore:api auth method=POST path=/admin/users/:id/suspend tag:admin
+func SuspendUser(ctx context.Context, id int, params *SuspendUserParams) (*ManagedUser, error) {
+	err := changeUserState(ctx, id, actionSuspendUser, map[string]interface{}{"reason": params.Reason}, true, `
+        UPDATE users
+        SET suspended_at = NOW(), suspension_reason = NULLIF($2, ''), updated_at = NOW()
+        WHERE id = $1 AND suspended_at IS NULL AND deleted_at IS NULL
+    `, id, strings.TrimSpace(params.Reason))
+	if err != nil {
+		return nil, err
+	}
+	return GetUser(ctx, id)
+}
+
+// ReactivateUser lifts the suspension of a user
+//
+//encore:api auth method=POST path=/admin/users/:id/reactivate tag:admin
+func ReactivateUser(ctx context.Context, id int) (*ManagedUser, error) {
+	err := changeUserState(ctx, id, actionReactivateUser, nil, false, `
+        UPDATE users
+        SET suspended_at = NULL, suspension_reason = NULL, updated_at = NOW()
+        WHERE id = $1 AND suspended_at IS NOT NULL AND deleted_at IS NULL
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	return GetUser(ctx, id)
+}
+
+// ForcePasswordReset ends a user's sessions and emails them a reset code.
+// The user cannot log in until they have chosen a new password.
+//
+//encore:api auth method=POST path=/admin/users/:id/force-password-reset tag:admin
+func ForcePasswordReset(ctx context.Context, id int) error {
+	err := changeUserState(ctx, id, actionForcePasswordReset, nil, true, `
+        UPDATE users
+        SET password_reset_required = TRUE, updated_at = NOW()
+        WHERE id = $1 AND deleted_at IS NULL
+    `, id)
+	if err != nil {
+		return err
+	}
+
+	var email string
+	err = db.QueryRow(ctx, `SELECT email FROM users WHERE id = $1`, id).Scan(&email)
+	if err != nil {
+		return err
+	}
+	return sendPasswordReset(ctx, id, email, "An administrator has asked you to choose a new password for your account.")
+}
+
+// DeleteUser soft-deletes a user. The account can no longer be used, but its
+// data and its username and email address are kept.
+//
+//encore:api auth method=DELETE path=/admin/users/:id tag:admin
+func DeleteUser(ctx context.Context, id int) error {
+	return changeUserState(ctx, id, actionDeleteUser, nil, true, `
+        UPDATE users
+        SET deleted_at = NOW(), updated_at = NOW()
+        WHERE id = $1 AND deleted_at IS NULL
+    `, id)
+}
+
+// changeUserState applies an administrative update to another user's account, optionally
+// ends their sessions, and records the action in one transaction.
+// The update must affect exactly the row of user id, which is the first argument.
+func changeUserState(ctx context.Context, id int, action string, details map[string]interface{},
+	endSessions bool, update string, args ...interface{}) error {
+	actorID, err := CurrentUserID()
+	if err != nil {
+		return err
+	}
+	if id == actorID {
+		return errOwnAccount
+	}
+
+	before, err := managedUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(ctx, update, args...)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		tx.Rollback()
+		return userStateConflict(ctx, id)
+	}
+
+	if endSessions {
+		_, err = tx.Exec(ctx, `
+            UPDATE sessions
+            SET revoked_at = NOW(), updated_at = NOW()
+            WHERE user_id = $1 AND revoked_at IS NULL
+        `, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := recordAdminAction(ctx, tx, actorID, action, id, details); err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	recordUserChange(ctx, action, id, before)
+	return nil
+}
+
+// userStateConflict explains why an administrative update did not apply to a user
+func userStateConflict(ctx context.Context, id int) error {
+	var exists bool
+	err := db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errUserNotFound
+	}
+	return &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: "the user is not in a state that allows this action",
+	}
+}
+
+// execer is implemented by both the database and transactions
+type execer interface {
+	Exec(ctx context.Context, query string, args ...interface{}) (sqldb.ExecResult, error)
+}
+
+// recordAdminAction records that the current administrator acted on a user
+func recordAdminAction(ctx context.Context, q execer, actorID int, action string, targetUserID int, details map[string]interface{}) error {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	data, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(ctx, `
+        INSERT INTO admin_actions (actor_id, action, target_user_id, details, created_at)
+        VALUES ($1, $2, $3, $4, NOW())
+    `, actorID, action, targetUserID, data)
+	if err != nil {
+		return err
+	}
+
+	rlog.Info("admin action", "actor_id", actorID, "action", action, "target_user_id", targetUserID)
+	return nil
+}
+
+// recordUserChange records a change to a user in the audit log and publishes it to the
+// user topics. before is the user as loaded by managedUser ahead of the change, or nil
+// if the change created the user. Changes made without authentication, such as a
+// registration, are attributed to the user.
+func recordUserChange(ctx context.Context, action string, userID int, before *ManagedUser) {
+	change := audit.Change{
+		Action:     action,
+		EntityType: auditEntityUser,
+		EntityID:   strconv.Itoa(userID),
+		Before:     before,
+	}
+	if _, err := CurrentUserID(); err != nil {
+		change.ActorID = userID
+	}
+
+	after, err := managedUser(ctx, userID)
+	if err != nil {
+		rlog.Error("could not load user for the audit log", "user_id", userID, "err", err)
+	} else {
+		change.After = after
+	}
+	audit.Record(ctx, change)
+	publishUserChange(ctx, action, userID)
+}
+
+// scanManagedUser scans a row selected with managedUserQuery
+func scanManagedUser(row interface{ Scan(...interface{}) error }) (*ManagedUser, error) {
+	var (
+		u      = ManagedUser{User: &User{}, UserDetail: &UserDetail{}}
+		detail = u.UserDetail
+		roles  []string
+	)
+	err := row.Scan(
+		&u.User.ID, &u.User.Username, &u.User.Email, &u.User.EmailVerifiedAt, &u.User.CreatedAt, &u.User.UpdatedAt,
+		&u.SuspendedAt, &u.SuspensionReason, &u.DeletedAt, &u.PasswordResetRequired,
+		&detail.ID, &detail.Fullname, &detail.Address, &detail.PostalCode,
+		&detail.ProvinceID, &detail.DistrictID, &detail.CityID,
+		&detail.CreatedAt, &detail.UpdatedAt,
+		&roles,
+		&u.MFAEnabled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	detail.UserID = u.User.ID
+
+	u.Roles = make([]authz.Role, len(roles))
+	for i, r := range roles {
+		u.Roles[i] = authz.Role(r)
+	}
+
+	switch {
+	case u.DeletedAt != nil:
+		u.Status = UserStatusDeleted
+	case u.SuspendedAt != nil:
+		u.Status = UserStatusSuspended
+	default:
+		u.Status = UserStatusActive
+	}
+	return &u, nil
+}
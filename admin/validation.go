@@ -0,0 +1,273 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"encore.app/geo"
+	"encore.dev/beta/errs"
+)
+
+// Codes describing why a field was rejected
+const (
+	ViolationRequired        = "REQUIRED"
+	ViolationInvalidEmail    = "INVALID_EMAIL"
+	ViolationInvalidFormat   = "INVALID_FORMAT"
+	ViolationTooShort        = "TOO_SHORT"
+	ViolationTooLong         = "TOO_LONG"
+	ViolationWeakPassword    = "WEAK_PASSWORD"
+	ViolationAlreadyTaken    = "ALREADY_TAKEN"
+	ViolationNotFound        = "NOT_FOUND"
+	ViolationInvalidLocation = "INVALID_LOCATION"
+)
+
+const (
+	usernameMinLength = 3
+	usernameMaxLength = 30
+	passwordMinLength = 10
+	passwordMaxLength = 128
+	emailMaxLength    = 254
+	fullnameMaxLength = 255
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// FieldViolation describes why one input field was rejected
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationDetails lists the rejected fields of a request.
+// It is attached to errors with code InvalidArgument or AlreadyExists.
+type ValidationDetails struct {
+	Violations []FieldViolation `json:"violations"`
+}
+
+func (ValidationDetails) ErrDetails() {}
+
+// validator collects the violations found while checking a request
+type validator struct {
+	violations []FieldViolation
+}
+
+// add records a violation unless the field already has one
+func (v *validator) add(field, code, message string) {
+	for _, fv := range v.violations {
+		if fv.Field == field {
+			return
+		}
+	}
+	v.violations = append(v.violations, FieldViolation{Field: field, Code: code, Message: message})
+}
+
+// valid reports whether a field has no violations so far
+func (v *validator) valid(field string) bool {
+	for _, fv := range v.violations {
+		if fv.Field == field {
+			return false
+		}
+	}
+	return true
+}
+
+// err returns the collected violations as an error, or nil if there are none
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+
+	code := errs.InvalidArgument
+	if len(v.violations) == 1 && v.violations[0].Code == ViolationAlreadyTaken {
+		code = errs.AlreadyExists
+	}
+	return &errs.Error{
+		Code:    code,
+		Message: v.violations[0].Message,
+		Details: ValidationDetails{Violations: v.violations},
+	}
+}
+
+// fieldError returns an error rejecting a single field
+func fieldError(field, code, message string) error {
+	v := &validator{}
+	v.add(field, code, message)
+	return v.err()
+}
+
+// normalizeEmail trims an email address and lowercases its domain
+func normalizeEmail(email string) string {
+	email = strings.TrimSpace(email)
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		email = email[:at] + strings.ToLower(email[at:])
+	}
+	return email
+}
+
+// checkEmail validates a normalized email address
+func (v *validator) checkEmail(field, email string) {
+	if email == "" {
+		v.add(field, ViolationRequired, "email is required")
+		return
+	}
+	if len(email) > emailMaxLength {
+		v.add(field, ViolationTooLong, fmt.Sprintf("email must be at most %d characters", emailMaxLength))
+		return
+	}
+
+	// Only a bare address is accepted, not "Name <address>"
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		v.add(field, ViolationInvalidEmail, "email is not a valid email address")
+		return
+	}
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		v.add(field, ViolationInvalidEmail, "email is not a valid email address")
+	}
+}
+
+// checkUsername validates a username
+func (v *validator) checkUsername(field, username string) {
+	switch n := utf8.RuneCountInString(username); {
+	case n == 0:
+		v.add(field, ViolationRequired, "username is required")
+	case n < usernameMinLength:
+		v.add(field, ViolationTooShort, fmt.Sprintf("username must be at least %d characters", usernameMinLength))
+	case n > usernameMaxLength:
+		v.add(field, ViolationTooLong, fmt.Sprintf("username must be at most %d characters", usernameMaxLength))
+	case !usernamePattern.MatchString(username):
+		v.add(field, ViolationInvalidFormat,
+			"username may only contain letters, digits, '_', '.' and '-' and must start with a letter or digit")
+	}
+}
+
+// checkPassword applies the password policy. The password may not contain the username.
+func (v *validator) checkPassword(field, password, username string) {
+	switch n := utf8.RuneCountInString(password); {
+	case n == 0:
+		v.add(field, ViolationRequired, "password is required")
+		return
+	case n < passwordMinLength:
+		v.add(field, ViolationTooShort, fmt.Sprintf("password must be at least %d characters", passwordMinLength))
+		return
+	case n > passwordMaxLength:
+		v.add(field, ViolationTooLong, fmt.Sprintf("password must be at most %d characters", passwordMaxLength))
+		return
+	}
+
+	var letter, other bool
+	for _, r := range password {
+		if unicode.IsLetter(r) {
+			letter = true
+		} else if !unicode.IsSpace(r) {
+			other = true
+		}
+	}
+	if !letter || !other {
+		v.add(field, ViolationWeakPassword, "password must contain letters and at least one digit or symbol")
+		return
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		v.add(field, ViolationWeakPassword, "password must not contain the username")
+	}
+}
+
+// checkFullname validates a display name
+func (v *validator) checkFullname(field, fullname string) {
+	switch n := utf8.RuneCountInString(fullname); {
+	case n == 0:
+		v.add(field, ViolationRequired, "fullname is required")
+	case n > fullnameMaxLength:
+		v.add(field, ViolationTooLong, fmt.Sprintf("fullname must be at most %d characters", fullnameMaxLength))
+	}
+}
+
+// checkLocation validates the geographic IDs of an address. Each ID must exist, a district
+// requires its province and a city its district, and each must belong to its parent.
+func (v *validator) checkLocation(ctx context.Context, provinceID, districtID, cityID *int) error {
+	if provinceID == nil && districtID == nil && cityID == nil {
+		return nil
+	}
+	if cityID != nil && districtID == nil {
+		v.add("district_id", ViolationRequired, "district is required when a city is given")
+	}
+	if districtID != nil && provinceID == nil {
+		v.add("province_id", ViolationRequired, "province is required when a district is given")
+	}
+
+	params := &geo.LookupParams{}
+	if provinceID != nil {
+		params.ProvinceIDs = []int{*provinceID}
+	}
+	if districtID != nil {
+		params.DistrictIDs = []int{*districtID}
+	}
+	if cityID != nil {
+		params.CityIDs = []int{*cityID}
+	}
+	found, err := geo.Lookup(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	if provinceID != nil && len(found.Provinces) == 0 {
+		v.add("province_id", ViolationNotFound, "province does not exist")
+	}
+	if districtID != nil {
+		if len(found.Districts) == 0 {
+			v.add("district_id", ViolationNotFound, "district does not exist")
+		} else if provinceID != nil && found.Districts[0].ProvinceID != *provinceID {
+			v.add("district_id", ViolationInvalidLocation, "district is not in the given province")
+		}
+	}
+	if cityID != nil {
+		if len(found.Cities) == 0 {
+			v.add("city_id", ViolationNotFound, "city does not exist")
+		} else if districtID != nil && found.Cities[0].DistrictID != *districtID {
+			v.add("city_id", ViolationInvalidLocation, "city is not in the given district")
+		}
+	}
+	return nil
+}
+
+// checkUsernameAvailable rejects a username that is taken, ignoring case
+func (v *validator) checkUsernameAvailable(ctx context.Context, field, username string, exceptUserID int) error {
+	if !v.valid(field) {
+		return nil
+	}
+	var exists bool
+	err := db.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM users WHERE LOWER(username) = LOWER($1) AND id <> $2
+        )
+    `, username, exceptUserID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		v.add(field, ViolationAlreadyTaken, "username is already taken")
+	}
+	return nil
+}
+
+// checkEmailAvailable rejects an email address that belongs to another user
+func (v *validator) checkEmailAvailable(ctx context.Context, field, email string, exceptUserID int) error {
+	if !v.valid(field) {
+		return nil
+	}
+	taken, err := emailInUse(ctx, email, exceptUserID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		v.add(field, ViolationAlreadyTaken, "email address already in use")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+//go:build encore_app
+
+package admin
+
+import (
+	"strings"
+	"testing"
+)
+
+// violationCode returns the code of the violation of a field, or "" if it was accepted
+func violationCode(v *validator, field string) string {
+	for _, fv := range v.violations {
+		if fv.Field == field {
+			return fv.Code
+		}
+	}
+	return ""
+}
+
+func TestCheckEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"alice@example.com", ""},
+		{"alice.smith+gym@mail.example.co.uk", ""},
+		{"", ViolationRequired},
+		{strings.Repeat("a", 243) + "@example.com", ViolationTooLong},
+		{"alice", ViolationInvalidEmail},
+		{"alice@", ViolationInvalidEmail},
+		{"@example.com", ViolationInvalidEmail},
+		{"alice@localhost", ViolationInvalidEmail},
+		{"alice@.example.com", ViolationInvalidEmail},
+		{"alice@example.com.", ViolationInvalidEmail},
+		{"Alice <alice@example.com>", ViolationInvalidEmail},
+		{"alice@example.com, bob@example.com", ViolationInvalidEmail},
+	}
+	for _, tt := range tests {
+		v := &validator{}
+		v.checkEmail("email", tt.email)
+		if got := violationCode(v, "email"); got != tt.want {
+			t.Errorf("got %q for %q, want %q", got, tt.email, tt.want)
+		}
+	}
+
+	if got := normalizeEmail("  Alice@Example.COM "); got != "Alice@example.com" {
+		t.Errorf("got %q, want the domain lowercased and the address trimmed", got)
+	}
+}
+
+func TestCheckUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{"alice", ""},
+		{"a1_b.c-d", ""},
+		{"9lives", ""},
+		{strings.Repeat("a", usernameMaxLength), ""},
+		{"", ViolationRequired},
+		{"al", ViolationTooShort},
+		{strings.Repeat("a", usernameMaxLength+1), ViolationTooLong},
+		{"_alice", ViolationInvalidFormat},
+		{".alice", ViolationInvalidFormat},
+		{"alice smith", ViolationInvalidFormat},
+		{"alice@home", ViolationInvalidFormat},
+		{"älice", ViolationInvalidFormat},
+	}
+	for _, tt := range tests {
+		v := &validator{}
+		v.checkUsername("username", tt.username)
+		if got := violationCode(v, "username"); got != tt.want {
+			t.Errorf("got %q for %q, want %q", got, tt.username, tt.want)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		password, username string
+		want               string
+	}{
+		{"correct horse battery 1", "alice", ""},
+		{"p@sswordpassword", "alice", ""},
+		{"", "alice", ViolationRequired},
+		{"short1!", "alice", ViolationTooShort},
+		{strings.Repeat("a1", passwordMaxLength/2) + "a", "alice", ViolationTooLong},
+		{"onlylettershere", "alice", ViolationWeakPassword},
+		{"1234567890123", "alice", ViolationWeakPassword},
+		{"letters and spaces", "alice", ViolationWeakPassword},
+		{"my name is Alice 1", "alice", ViolationWeakPassword},
+		{"my name is alice 1", "", ""},
+	}
+	for _, tt := range tests {
+		v := &validator{}
+		v.checkPassword("password", tt.password, tt.username)
+		if got := violationCode(v, "password"); got != tt.want {
+			t.Errorf("got %q for %q of %q, want %q", got, tt.password, tt.username, tt.want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"encore.app/audit"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+	"encore.dev/storage/sqldb/sqlerr"
+)
+
+const (
+	// emailVerificationTTL is how long an emailed verification token can be used
+	emailVerificationTTL = 24 * time.Hour
+
+	// verificationResendCooldown is the minimum time between two verification emails
+	verificationResendCooldown = time.Minute
+)
+
+// tokenPurpose is what an email verification token confirms
+type tokenPurpose string
+
+const (
+	// purposeVerify tokens confirm the user's current address
+	purposeVerify tokenPurpose = "VERIFY"
+	// purposeChangeEmail tokens confirm a new address, which takes effect when they are used
+	purposeChangeEmail tokenPurpose = "CHANGE_EMAIL"
+)
+
+var (
+	errEmailNotVerified = &errs.Error{
+		Code:    errs.PermissionDenied,
+		Message: "email address not verified",
+	}
+	errInvalidVerificationToken = &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: "invalid or expired verification token",
+	}
+	errEmailTaken = &errs.Error{
+		Code:    errs.AlreadyExists,
+		Message: "email address already in use",
+		Details: ValidationDetails{Violations: []FieldViolation{
+			{Field: "email", Code: ViolationAlreadyTaken, Message: "email address already in use"},
+		}},
+	}
+)
+
+// VerifyEmailParams contains a token from a verification email
+type VerifyEmailParams struct {
+	Token string `json:"token"`
+}
+
+// ChangeEmailParams contains the data needed to change the current user's email address
+type ChangeEmailParams struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+// VerifyEmail confirms an email address using a token from a verification email.
+// For an email change this is the point where the new address takes effect.
+// The verified state is part of the user's tokens from their next token refresh.
+//
+//encore:api public method=POST path=/admin/email/verify
+func VerifyEmail(ctx context.Context, params *VerifyEmailParams) error {
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Consume the token
+	var userID int
+	var email string
+	var purpose string
+	err = tx.QueryRow(ctx, `
+        UPDATE email_verification_tokens
+        SET used_at = NOW()
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id, email, purpose
+    `, hashOpaqueToken(params.Token)).Scan(&userID, &email, &purpose)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return errInvalidVerificationToken
+	} else if err != nil {
+		return err
+	}
+
+	// The transaction has not changed the user yet
+	before, err := managedUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Apply the address; a plain verification only holds while the address is unchanged
+	res, err := tx.Exec(ctx, `
+        UPDATE users
+        SET email = $1, email_verified_at = NOW(), updated_at = NOW()
+        WHERE id = $2 AND ($3 = 'CHANGE_EMAIL' OR LOWER(email) = LOWER($1))
+    `, email, userID, purpose)
+	if sqldb.ErrCode(err) == sqlerr.UniqueViolation {
+		return errEmailTaken
+	} else if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return errInvalidVerificationToken
+	}
+
+	// Tokens sent before the address changed no longer apply
+	if tokenPurpose(purpose) == purposeChangeEmail {
+		_, err = tx.Exec(ctx, `
+            UPDATE email_verification_tokens
+            SET used_at = NOW()
+            WHERE user_id = $1 AND used_at IS NULL
+        `, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	recordUserChange(ctx, actionVerifyEmail, userID, before)
+	return nil
+}
+
+// ResendVerificationEmail sends a new verification email to the current user
+//
+//encore:api auth method=POST path=/admin/email/verify/resend
+func ResendVerificationEmail(ctx context.Context) error {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return err
+	}
+
+	var email string
+	var verifiedAt *time.Time
+	err = db.QueryRow(ctx, `
+        SELECT email, email_verified_at
+        FROM users
+        WHERE id = $1
+    `, userID).Scan(&email, &verifiedAt)
+	if err != nil {
+		return err
+	}
+	if verifiedAt != nil {
+		return &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "email address already verified",
+		}
+	}
+
+	return sendVerificationEmail(ctx, userID, email, purposeVerify)
+}
+
+// ChangeEmail starts changing the current user's email address.
+// The new address is applied once it is confirmed through VerifyEmail.
+//
+//encore:api auth method=POST path=/admin/email/change
+func ChangeEmail(ctx context.Context, params *ChangeEmailParams) error {
+	userID, err := CurrentUserID()
+	if err != nil {
+		return err
+	}
+
+	// Changing where password resets go requires the current password
+	if err := confirmPassword(ctx, userID, params.Password); err != nil {
+		return err
+	}
+
+	newEmail := normalizeEmail(params.NewEmail)
+	v := &validator{}
+	v.checkEmail("new_email", newEmail)
+	if err := v.checkEmailAvailable(ctx, "new_email", newEmail, userID); err != nil {
+		return err
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	if err := sendVerificationEmail(ctx, userID, newEmail, purposeChangeEmail); err != nil {
+		return err
+	}
+
+	// The address itself changes once it is verified
+	audit.Record(ctx, audit.Change{
+		Action:     actionRequestEmailChange,
+		EntityType: auditEntityUser,
+		EntityID:   strconv.Itoa(userID),
+		After:      map[string]string{"pending_email": newEmail},
+	})
+	return nil
+}
+
+// sendVerificationEmail emails a token confirming that the user owns the given address.
+// Earlier unused tokens of the user with the same purpose stop working.
+func sendVerificationEmail(ctx context.Context, userID int, email string, purpose tokenPurpose) error {
+	// Rate limit resends
+	var lastSent *time.Time
+	err := db.QueryRow(ctx, `
+        SELECT MAX(created_at)
+        FROM email_verification_tokens
+        WHERE user_id = $1
+    `, userID).Scan(&lastSent)
+	if err != nil {
+		return err
+	}
+	if lastSent != nil && time.Since(*lastSent) < verificationResendCooldown {
+		return &errs.Error{
+			Code:    errs.ResourceExhausted,
+			Message: "a verification email was sent recently, please wait before requesting another",
+		}
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(ctx, `
+        UPDATE email_verification_tokens
+        SET used_at = NOW()
+        WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+    `, userID, string(purpose))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO email_verification_tokens (user_id, email, purpose, token_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, NOW())
+    `, userID, email, string(purpose), hashOpaqueToken(token), time.Now().Add(emailVerificationTTL))
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Please confirm your email address with this code:\n\n%s\n\n"+
+		"The code is valid for 24 hours.\n", token)
+	return sendEmail(ctx, email, "Confirm your email address", body)
+}
+
+// emailInUse reports whether an address belongs to a user other than exceptUserID
+func emailInUse(ctx context.Context, email string, exceptUserID int) (bool, error) {
+	var exists bool
+	err := db.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM users WHERE LOWER(email) = LOWER($1) AND id <> $2
+        )
+    `, email, exceptUserID).Scan(&exists)
+	return exists, err
+}
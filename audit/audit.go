@@ -0,0 +1,200 @@
+// Package audit records who changed what. Services describe each change with Record;
+// the events are published on a topic and stored in an append-only table.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"encore.app/authz"
+	"encore.dev"
+	"encore.dev/beta/auth"
+	"encore.dev/pubsub"
+	"encore.dev/rlog"
+	"github.com/google/uuid"
+)
+
+// Event is one recorded change
+type Event struct {
+	ID         string `json:"id"`
+	ActorID    *int   `json:"actor_id,omitempty"`
+	Action     string `json:"action"`
+	EntityType string `json:"entity_type"`
+	EntityID   string `json:"entity_id"`
+	Service    string `json:"service"`
+
+	// Before and After hold the fields that changed, flattened to dotted paths.
+	// Before is null when an entity was created and After when it was deleted.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+
+	RequestID  string    `json:"request_id"`
+	IP         string    `json:"ip"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// Events carries every recorded change to the subscriber that stores it
+var Events = pubsub.NewTopic[*Event]("audit-events", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+// Change describes a change to record
+type Change struct {
+	Action     string
+	EntityType string
+	EntityID   string
+
+	// Before and After are snapshots of the entity. Either may be nil.
+	Before any
+	After  any
+
+	// ActorID defaults to the authenticated user
+	ActorID int
+
+	// IP defaults to the client of the current request
+	IP string
+}
+
+// Record publishes a change. It is called after the change was committed, so a
+// failure to publish is logged rather than returned.
+func Record(ctx context.Context, c Change) {
+	event, err := newEvent(c)
+	if err == nil {
+		_, err = Events.Publish(ctx, event)
+	}
+	if err != nil {
+		rlog.Error("could not record audit event", "action", c.Action,
+			"entity_type", c.EntityType, "entity_id", c.EntityID, "err", err)
+	}
+}
+
+// newEvent builds the event for a change in the current request
+func newEvent(c Change) (*Event, error) {
+	before, after, err := diff(c.Before, c.After)
+	if err != nil {
+		return nil, err
+	}
+
+	event := &Event{
+		ID:         uuid.NewString(),
+		Action:     c.Action,
+		EntityType: c.EntityType,
+		EntityID:   c.EntityID,
+		Before:     before,
+		After:      after,
+		IP:         c.IP,
+		OccurredAt: time.Now(),
+	}
+
+	if c.ActorID != 0 {
+		event.ActorID = &c.ActorID
+	} else if caller, err := authz.CurrentCaller(); err == nil {
+		event.ActorID = &caller.UserID
+	}
+
+	// The trace ID is shared by every service taking part in a request
+	if req := encore.CurrentRequest(); req != nil {
+		event.Service = req.Service
+		if req.Trace != nil {
+			event.RequestID = req.Trace.TraceID
+		}
+		if event.IP == "" {
+			event.IP = firstIP(req.Headers.Get("X-Forwarded-For"))
+		}
+	}
+
+	// Calls made by other services carry the client address in the auth data
+	if data, ok := auth.Data().(*authz.AuthData); ok && data != nil && event.IP == "" {
+		event.IP = data.ClientIP
+	}
+	return event, nil
+}
+
+// firstIP returns the client address from an X-Forwarded-For header
+func firstIP(forwardedFor string) string {
+	ip, _, _ := strings.Cut(forwardedFor, ",")
+	return strings.TrimSpace(ip)
+}
+
+// diff returns the fields of two snapshots that differ. Timestamps of the
+// last update are left out since they change with every write.
+func diff(before, after any) (json.RawMessage, json.RawMessage, error) {
+	b, err := flatten(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := flatten(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changedBefore := map[string]any{}
+	changedAfter := map[string]any{}
+	for key, value := range b {
+		if other, ok := a[key]; !ok || !reflect.DeepEqual(value, other) {
+			changedBefore[key] = value
+		}
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || !reflect.DeepEqual(value, other) {
+			changedAfter[key] = value
+		}
+	}
+
+	beforeJSON, err := marshalChanges(b, changedBefore)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterJSON, err := marshalChanges(a, changedAfter)
+	if err != nil {
+		return nil, nil, err
+	}
+	return beforeJSON, afterJSON, nil
+}
+
+// marshalChanges encodes the changed fields of a snapshot, or null if there was no snapshot
+func marshalChanges(snapshot, changed map[string]any) (json.RawMessage, error) {
+	if snapshot == nil {
+		return nil, nil
+	}
+	return json.Marshal(changed)
+}
+
+// flatten converts a snapshot to a map from dotted field paths to JSON values
+func flatten(snapshot any) (map[string]any, error) {
+	if snapshot == nil || reflect.ValueOf(snapshot).Kind() == reflect.Pointer && reflect.ValueOf(snapshot).IsNil() {
+		return nil, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]any{}
+	var walk func(prefix string, v any)
+	walk = func(prefix string, v any) {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fields[prefix] = v
+			return
+		}
+		for key, child := range obj {
+			if key == "updated_at" {
+				continue
+			}
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			walk(key, child)
+		}
+	}
+	walk("", value)
+	return fields, nil
+}
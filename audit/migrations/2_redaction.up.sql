@@ -0,0 +1,20 @@
+-- Erasing a user's personal data removes the snapshots of their events.
+-- Everything else about an event stays as it was recorded.
+ALTER TABLE audit_events ADD COLUMN redacted_at TIMESTAMPTZ;
+
+CREATE OR REPLACE FUNCTION reject_audit_event_change() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND OLD.redacted_at IS NULL AND NEW.redacted_at IS NOT NULL
+        AND NEW.before IS NULL AND NEW.after IS NULL
+        AND (NEW.id, NEW.actor_id, NEW.action, NEW.entity_type, NEW.entity_id, NEW.service,
+             NEW.request_id, NEW.ip_address, NEW.occurred_at, NEW.recorded_at)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.actor_id, OLD.action, OLD.entity_type, OLD.entity_id, OLD.service,
+             OLD.request_id, OLD.ip_address, OLD.occurred_at, OLD.recorded_at)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// ListParams filters and pages the audit log. Every filter is optional.
+type ListParams struct {
+	ActorID    *int       `json:"actor_id,omitempty"`
+	Action     string     `json:"action,omitempty"`
+	EntityType string     `json:"entity_type,omitempty"`
+	EntityID   string     `json:"entity_id,omitempty"`
+	RequestID  string     `json:"request_id,omitempty"`
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+
+	// Page starts at 1
+	Page     int `json:"page,omitempty"`
+	PageSize int `json:"page_size,omitempty"`
+}
+
+// EventPage is one page of the audit log, newest first
+type EventPage struct {
+	Events   []*Event `json:"events"`
+	Total    int      `json:"total"`
+	Page     int      `json:"page"`
+	PageSize int      `json:"page_size"`
+}
+
+// eventFilter is the WHERE clause applying ListParams
+const eventFilter = `
+    WHERE ($1::BIGINT IS NULL OR actor_id = $1)
+      AND ($2 = '' OR action = $2)
+      AND ($3 = '' OR entity_type = $3)
+      AND ($4 = '' OR entity_id = $4)
+      AND ($5 = '' OR request_id = $5)
+      AND ($6::TIMESTAMPTZ IS NULL OR occurred_at >= $6)
+      AND ($7::TIMESTAMPTZ IS NULL OR occurred_at < $7)
+`
+
+// List searches the audit log
+//
+//encore:api auth method=POST path=/audit/search tag:admin
+func List(ctx context.Context, params *ListParams) (*EventPage, error) {
+	page := max(params.Page, 1)
+	pageSize := params.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	pageSize = min(pageSize, maxPageSize)
+
+	args := []interface{}{params.ActorID, params.Action, params.EntityType, params.EntityID,
+		params.RequestID, params.From, params.To}
+
+	// Count all matches for the page count
+	var total int
+	err := db.QueryRow(ctx, `SELECT COUNT(*) FROM audit_events`+eventFilter, args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+        SELECT id::TEXT, actor_id, action, entity_type, entity_id, service,
+               COALESCE(before::TEXT, ''), COALESCE(after::TEXT, ''), request_id, ip_address, occurred_at
+        FROM audit_events
+    `+eventFilter+`
+        ORDER BY occurred_at DESC, id
+        LIMIT $8 OFFSET $9
+    `, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		var (
+			e             Event
+			before, after string
+		)
+		if err := rows.Scan(
+			&e.ID,
+			&e.ActorID,
+			&e.Action,
+			&e.EntityType,
+			&e.EntityID,
+			&e.Service,
+			&before,
+			&after,
+			&e.RequestID,
+			&e.IP,
+			&e.OccurredAt,
+		); err != nil {
+			return nil, err
+		}
+		if before != "" {
+			e.Before = []byte(before)
+		}
+		if after != "" {
+			e.After = []byte(after)
+		}
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &EventPage{
+		Events:   events,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
@@ -0,0 +1,26 @@
+package audit
+
+import (
+	"context"
+	"strconv"
+)
+
+// RedactParams selects the events of a user whose snapshots are removed
+type RedactParams struct {
+	UserID int `json:"user_id"`
+}
+
+// Redact removes the before and after snapshots of the events about a user and
+// of the changes they made, as part of erasing their personal data. The events
+// themselves are kept.
+//
+//encore:api private method=POST path=/audit/redact
+func Redact(ctx context.Context, params *RedactParams) error {
+	_, err := db.Exec(ctx, `
+        UPDATE audit_events
+        SET before = NULL, after = NULL, redacted_at = NOW()
+        WHERE redacted_at IS NULL
+          AND ((entity_type = 'user' AND entity_id = $1) OR actor_id = $2)
+    `, strconv.Itoa(params.UserID), params.UserID)
+	return err
+}
@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"context"
+
+	"encore.dev/pubsub"
+	"encore.dev/storage/sqldb"
+)
+
+// Stores every published event. Redelivered events are recorded once.
+var _ = pubsub.NewSubscription(Events, "store-audit-event", pubsub.SubscriptionConfig[*Event]{
+	Handler: store,
+})
+
+// store inserts an event into the append-only audit table
+func store(ctx context.Context, event *Event) error {
+	_, err := db.Exec(ctx, `
+        INSERT INTO audit_events (
+            id, actor_id, action, entity_type, entity_id, service,
+            before, after, request_id, ip_address, occurred_at
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        ON CONFLICT (id) DO NOTHING
+    `, event.ID, event.ActorID, event.Action, event.EntityType, event.EntityID, event.Service,
+		nullJSON(event.Before), nullJSON(event.After), event.RequestID, event.IP, event.OccurredAt)
+	return err
+}
+
+// nullJSON stores an absent snapshot as NULL
+func nullJSON(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+// Define the database connection
+var db = sqldb.Named("audit")
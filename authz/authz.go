@@ -0,0 +1,162 @@
+// Package authz provides role based access control shared by all services.
+package authz
+
+import (
+	"slices"
+	"strconv"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+// Role is a role a user can hold
+type Role string
+
+const (
+	RoleAdmin   Role = "ADMIN"
+	RoleTrainer Role = "TRAINER"
+	RoleTrainee Role = "TRAINEE"
+)
+
+// Roles lists every known role
+var Roles = []Role{RoleAdmin, RoleTrainer, RoleTrainee}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	return slices.Contains(Roles, r)
+}
+
+// Permission is an action a role allows
+type Permission string
+
+const (
+	PermManageUsers      Permission = "users:manage"
+	PermManageRoles      Permission = "roles:manage"
+	PermViewAllTrainees  Permission = "trainees:view_all"
+	PermCoachTrainees    Permission = "trainees:coach"
+	PermAuthorWorkouts   Permission = "workouts:author"
+	PermAssignWorkouts   Permission = "workouts:assign"
+	PermTrackOwnProgress Permission = "progress:track_own"
+)
+
+// rolePermissions maps each role to the permissions it grants
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermManageUsers,
+		PermManageRoles,
+		PermViewAllTrainees,
+		PermAuthorWorkouts,
+		PermAssignWorkouts,
+	},
+	RoleTrainer: {
+		PermCoachTrainees,
+		PermAuthorWorkouts,
+		PermAssignWorkouts,
+	},
+	RoleTrainee: {
+		PermTrackOwnProgress,
+	},
+}
+
+// AuthData is the authentication data attached to every authenticated request
+type AuthData struct {
+	UserID        int    `json:"user_id"`
+	Roles         []Role `json:"roles"`
+	EmailVerified bool   `json:"email_verified"`
+	MFAVerified   bool   `json:"mfa_verified"`
+	SessionID     string `json:"session_id"`
+
+	// ClientIP is the address the request came from. Calls between
+	// services carry the auth data along, so the address stays known.
+	ClientIP string `json:"client_ip,omitempty"`
+
+	// APIKeyID is set for requests authenticated with an API key, which may
+	// only use its Scopes. Organization keys have no UserID.
+	APIKeyID int     `json:"api_key_id,omitempty"`
+	Scopes   []Scope `json:"scopes,omitempty"`
+}
+
+// Caller is the authenticated user making a request
+type Caller struct {
+	UserID        int
+	Roles         []Role
+	EmailVerified bool
+	MFAVerified   bool
+	APIKeyID      int
+	Scopes        []Scope
+}
+
+// CurrentCaller returns the authenticated user making the current request
+func CurrentCaller() (*Caller, error) {
+	uid, ok := auth.UserID()
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	data, _ := auth.Data().(*AuthData)
+
+	// Organization API keys don't act as a user
+	if data != nil && data.APIKeyID != 0 && data.UserID == 0 {
+		return &Caller{APIKeyID: data.APIKeyID, Scopes: data.Scopes}, nil
+	}
+
+	userID, err := strconv.Atoi(string(uid))
+	if err != nil {
+		return nil, ErrUnauthenticated
+	}
+
+	caller := &Caller{UserID: userID}
+	if data != nil {
+		caller.Roles = data.Roles
+		caller.EmailVerified = data.EmailVerified
+		caller.MFAVerified = data.MFAVerified
+		caller.APIKeyID = data.APIKeyID
+		caller.Scopes = data.Scopes
+	}
+	return caller, nil
+}
+
+// HasRole reports whether the caller holds the given role
+func (c *Caller) HasRole(role Role) bool {
+	return slices.Contains(c.Roles, role)
+}
+
+// Can reports whether any of the caller's roles grants the given permission
+func (c *Caller) Can(perm Permission) bool {
+	for _, role := range c.Roles {
+		if slices.Contains(rolePermissions[role], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the caller is an administrator
+func (c *Caller) IsAdmin() bool {
+	return c.HasRole(RoleAdmin)
+}
+
+// IsTrainer reports whether the caller may use trainer features.
+// Administrators may use them too.
+func (c *Caller) IsTrainer() bool {
+	return c.HasRole(RoleTrainer) || c.IsAdmin()
+}
+
+// Errors returned by the checks in this package
+var (
+	ErrUnauthenticated = &errs.Error{
+		Code:    errs.Unauthenticated,
+		Message: "not authenticated",
+	}
+	ErrPermissionDenied = &errs.Error{
+		Code:    errs.PermissionDenied,
+		Message: "permission denied",
+	}
+)
+
+// Require returns ErrPermissionDenied unless the caller has the given permission
+func (c *Caller) Require(perm Permission) error {
+	if !c.Can(perm) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Package authztest lets tests of the services run as a signed in user
+package authztest
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+
+	"encore.app/authz"
+	"encore.dev/beta/auth"
+	"encore.dev/et"
+)
+
+// nextUserID hands out user IDs beyond the 32 bit range, so ID columns are
+// exercised with BIGINT values. It starts at a random point so test binaries
+// sharing a database don't hand out the same IDs.
+var nextUserID atomic.Int64
+
+func init() {
+	nextUserID.Store(1<<32 + rand.Int64N(1<<40))
+}
+
+// NewUserID returns a user ID no other caller in the test binary got
+func NewUserID() int {
+	return int(nextUserID.Add(1))
+}
+
+// AuthenticateAs makes the rest of the test run as the given user, with a
+// verified email address and a session started with a second factor
+func AuthenticateAs(userID int, roles ...authz.Role) {
+	et.OverrideAuthInfo(auth.UID(strconv.Itoa(userID)), &authz.AuthData{
+		UserID:        userID,
+		Roles:         roles,
+		EmailVerified: true,
+		MFAVerified:   true,
+	})
+}
@@ -0,0 +1,55 @@
+package authz
+
+import (
+	"slices"
+	"strings"
+)
+
+// Scope limits what an API key may do. Requests made with a session carry
+// every scope; their roles alone decide what they may do.
+type Scope string
+
+const (
+	ScopeProfileRead    Scope = "profile:read"
+	ScopeProfileWrite   Scope = "profile:write"
+	ScopeWorkoutsRead   Scope = "workouts:read"
+	ScopeWorkoutsWrite  Scope = "workouts:write"
+	ScopeNutritionRead  Scope = "nutrition:read"
+	ScopeNutritionWrite Scope = "nutrition:write"
+	ScopeMetricsRead    Scope = "metrics:read"
+	ScopeMetricsWrite   Scope = "metrics:write"
+)
+
+// Scopes lists every known scope
+var Scopes = []Scope{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeWorkoutsRead,
+	ScopeWorkoutsWrite,
+	ScopeNutritionRead,
+	ScopeNutritionWrite,
+	ScopeMetricsRead,
+	ScopeMetricsWrite,
+}
+
+// TagAPIKeys marks endpoints every API key may call, whatever its scopes
+const TagAPIKeys = "api_keys"
+
+// Valid reports whether s is a known scope
+func (s Scope) Valid() bool {
+	return slices.Contains(Scopes, s)
+}
+
+// Tag returns the endpoint tag that opens an endpoint to API keys with this
+// scope, e.g. "scope_workouts_write" for workouts:write
+func (s Scope) Tag() string {
+	return "scope_" + strings.ReplaceAll(string(s), ":", "_")
+}
+
+// HasScope reports whether the caller may use the given scope
+func (c *Caller) HasScope(scope Scope) bool {
+	if c.APIKeyID == 0 {
+		return true
+	}
+	return slices.Contains(c.Scopes, scope)
+}
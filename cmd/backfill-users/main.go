@@ -0,0 +1,92 @@
+// Command backfill-users republishes every user on the admin service's user topics,
+// so read models such as the trainee service's user_projections catch up with users
+// created before they existed or with events they missed.
+//
+//	go run ./cmd/backfill-users -url http://localhost:4000 -token "$ADMIN_TOKEN"
+//
+// The token must belong to an administrator. Running it again is harmless: read
+// models ignore snapshots that are not newer than what they have.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type batchRequest struct {
+	AfterID int `json:"after_id"`
+	Limit   int `json:"limit"`
+}
+
+type batchResponse struct {
+	Published   int  `json:"published"`
+	NextAfterID int  `json:"next_after_id"`
+	Done        bool `json:"done"`
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:4000", "base URL of the API")
+	token := flag.String("token", "", "access token of an administrator")
+	batch := flag.Int("batch", 500, "users per request")
+	after := flag.Int("after", 0, "resume after this user ID")
+	flag.Parse()
+
+	if *token == "" {
+		log.Fatal("-token is required")
+	}
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	endpoint := strings.TrimSuffix(*baseURL, "/") + "/admin/users/publish-snapshots"
+	req := batchRequest{AfterID: *after, Limit: *batch}
+	total := 0
+	for {
+		resp, err := publishBatch(client, endpoint, *token, req)
+		if err != nil {
+			log.Fatalf("after user %d: %v", req.AfterID, err)
+		}
+		total += resp.Published
+		log.Printf("published %d users, up to ID %d", total, resp.NextAfterID)
+		if resp.Done {
+			break
+		}
+		req.AfterID = resp.NextAfterID
+	}
+	log.Printf("done, published %d users", total)
+}
+
+// publishBatch asks the admin service to publish one batch of users
+func publishBatch(client *http.Client, endpoint, token string, body batchRequest) (*batchResponse, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var out batchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,33 @@
+// Command mock-oidc runs a mock OpenID Connect issuer for local development.
+// The admin service's local configuration has a "mock" provider pointing at it.
+//
+//	go run ./cmd/mock-oidc -addr localhost:9500
+//
+// Every sign-in is approved as the user given by the flags. Add
+// login_hint=someone@example.com to the authorization URL to sign in as someone else.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"encore.app/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9500", "address to listen on")
+	subject := flag.String("sub", "mock-user-1", "subject of the signed in user")
+	email := flag.String("email", "trainee@example.com", "email address of the signed in user")
+	name := flag.String("name", "Mock Trainee", "name of the signed in user")
+	flag.Parse()
+
+	issuer := oidctest.NewHandler("http://"+*addr, oidctest.User{
+		Subject:       *subject,
+		Email:         *email,
+		EmailVerified: true,
+		Name:          *name,
+	})
+	log.Printf("mock OIDC issuer listening on %s", issuer.URL)
+	log.Fatal(http.ListenAndServe(*addr, issuer))
+}
@@ -0,0 +1,206 @@
+// Package geo provides the provinces, districts and cities that addresses refer to.
+package geo
+
+import (
+	"context"
+
+	"encore.dev/storage/sqldb"
+)
+
+// Province is the top level of the address hierarchy
+type Province struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// District is part of a province
+type District struct {
+	ID         int    `json:"id"`
+	ProvinceID int    `json:"province_id"`
+	Name       string `json:"name"`
+}
+
+// City is part of a district
+type City struct {
+	ID         int    `json:"id"`
+	DistrictID int    `json:"district_id"`
+	Name       string `json:"name"`
+}
+
+// ProvincesResponse contains a list of provinces
+type ProvincesResponse struct {
+	Provinces []*Province `json:"provinces"`
+}
+
+// DistrictsResponse contains a list of districts
+type DistrictsResponse struct {
+	Districts []*District `json:"districts"`
+}
+
+// CitiesResponse contains a list of cities
+type CitiesResponse struct {
+	Cities []*City `json:"cities"`
+}
+
+// LookupParams contains the IDs to look up. Any of the lists may be empty.
+type LookupParams struct {
+	ProvinceIDs []int `json:"province_ids"`
+	DistrictIDs []int `json:"district_ids"`
+	CityIDs     []int `json:"city_ids"`
+}
+
+// LookupResponse contains the entries found for a lookup. Unknown IDs are left out.
+type LookupResponse struct {
+	Provinces []*Province `json:"provinces"`
+	Districts []*District `json:"districts"`
+	Cities    []*City     `json:"cities"`
+}
+
+// ListProvinces returns all provinces ordered by name
+//
+//encore:api public method=GET path=/geo/provinces tag:api_keys
+func ListProvinces(ctx context.Context) (*ProvincesResponse, error) {
+	provinces, err := queryProvinces(ctx, `
+        SELECT id, name
+        FROM provinces
+        ORDER BY name
+    `)
+	if err != nil {
+		return nil, err
+	}
+	return &ProvincesResponse{Provinces: provinces}, nil
+}
+
+// ListDistricts returns the districts of a province ordered by name
+//
+//encore:api public method=GET path=/geo/provinces/:id/districts tag:api_keys
+func ListDistricts(ctx context.Context, id int) (*DistrictsResponse, error) {
+	districts, err := queryDistricts(ctx, `
+        SELECT id, province_id, name
+        FROM districts
+        WHERE province_id = $1
+        ORDER BY name
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	return &DistrictsResponse{Districts: districts}, nil
+}
+
+// ListCities returns the cities of a district ordered by name
+//
+//encore:api public method=GET path=/geo/districts/:id/cities tag:api_keys
+func ListCities(ctx context.Context, id int) (*CitiesResponse, error) {
+	cities, err := queryCities(ctx, `
+        SELECT id, district_id, name
+        FROM cities
+        WHERE district_id = $1
+        ORDER BY name
+    `, id)
+	if err != nil {
+		return nil, err
+	}
+	return &CitiesResponse{Cities: cities}, nil
+}
+
+// Lookup returns provinces, districts and cities by ID in one call
+//
+//encore:api private method=POST path=/geo/lookup tag:api_keys
+func Lookup(ctx context.Context, params *LookupParams) (*LookupResponse, error) {
+	resp := &LookupResponse{
+		Provinces: []*Province{},
+		Districts: []*District{},
+		Cities:    []*City{},
+	}
+
+	var err error
+	if len(params.ProvinceIDs) > 0 {
+		resp.Provinces, err = queryProvinces(ctx, `
+            SELECT id, name
+            FROM provinces
+            WHERE id = ANY($1)
+        `, params.ProvinceIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(params.DistrictIDs) > 0 {
+		resp.Districts, err = queryDistricts(ctx, `
+            SELECT id, province_id, name
+            FROM districts
+            WHERE id = ANY($1)
+        `, params.DistrictIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(params.CityIDs) > 0 {
+		resp.Cities, err = queryCities(ctx, `
+            SELECT id, district_id, name
+            FROM cities
+            WHERE id = ANY($1)
+        `, params.CityIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+func queryProvinces(ctx context.Context, query string, args ...interface{}) ([]*Province, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	provinces := []*Province{}
+	for rows.Next() {
+		var p Province
+		if err := rows.Scan(&p.ID, &p.Name); err != nil {
+			return nil, err
+		}
+		provinces = append(provinces, &p)
+	}
+	return provinces, rows.Err()
+}
+
+func queryDistricts(ctx context.Context, query string, args ...interface{}) ([]*District, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	districts := []*District{}
+	for rows.Next() {
+		var d District
+		if err := rows.Scan(&d.ID, &d.ProvinceID, &d.Name); err != nil {
+			return nil, err
+		}
+		districts = append(districts, &d)
+	}
+	return districts, rows.Err()
+}
+
+func queryCities(ctx context.Context, query string, args ...interface{}) ([]*City, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cities := []*City{}
+	for rows.Next() {
+		var c City
+		if err := rows.Scan(&c.ID, &c.DistrictID, &c.Name); err != nil {
+			return nil, err
+		}
+		cities = append(cities, &c)
+	}
+	return cities, rows.Err()
+}
+
+// Define the database connection
+var db = sqldb.Named("geo")
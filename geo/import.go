@@ -0,0 +1,166 @@
+package geo
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"encore.dev/beta/errs"
+)
+
+// importColumns is the header an import CSV must start with. Each row names a city
+// together with its district and province; the district and city columns may be left
+// empty to import a province or district on its own.
+var importColumns = []string{"province_id", "province", "district_id", "district", "city_id", "city"}
+
+// ImportParams contains reference data in CSV form
+type ImportParams struct {
+	CSV string `json:"csv"`
+}
+
+// ImportResponse reports how many entries an import created or updated
+type ImportResponse struct {
+	Provinces int `json:"provinces"`
+	Districts int `json:"districts"`
+	Cities    int `json:"cities"`
+}
+
+// Import creates or updates provinces, districts and cities from CSV seed data.
+// Entries that are not in the data are kept.
+//
+//encore:api auth method=POST path=/geo/import tag:admin
+func Import(ctx context.Context, params *ImportParams) (*ImportResponse, error) {
+	return importCSV(ctx, strings.NewReader(params.CSV))
+}
+
+// importCSV upserts every entry of the CSV in a single transaction
+func importCSV(ctx context.Context, r io.Reader) (*ImportResponse, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(importColumns)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, importError(1, "missing header")
+	} else if err != nil {
+		return nil, importError(1, err.Error())
+	}
+	for i, col := range importColumns {
+		if strings.TrimSpace(header[i]) != col {
+			return nil, importError(1, "header must be "+strings.Join(importColumns, ","))
+		}
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	provinces := map[int]bool{}
+	districts := map[int]bool{}
+	cities := map[int]bool{}
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, importError(line, err.Error())
+		}
+
+		provinceID, err := parseID(record[0], true)
+		if err != nil {
+			return nil, importError(line, "province_id: "+err.Error())
+		}
+		districtID, err := parseID(record[2], false)
+		if err != nil {
+			return nil, importError(line, "district_id: "+err.Error())
+		}
+		cityID, err := parseID(record[4], false)
+		if err != nil {
+			return nil, importError(line, "city_id: "+err.Error())
+		}
+		if cityID != 0 && districtID == 0 {
+			return nil, importError(line, "a city needs a district")
+		}
+
+		if !provinces[provinceID] {
+			_, err = tx.Exec(ctx, `
+                INSERT INTO provinces (id, name, created_at, updated_at)
+                VALUES ($1, $2, NOW(), NOW())
+                ON CONFLICT (id) DO UPDATE
+                SET name = EXCLUDED.name, updated_at = NOW()
+            `, provinceID, strings.TrimSpace(record[1]))
+			if err != nil {
+				return nil, err
+			}
+			provinces[provinceID] = true
+		}
+
+		if districtID != 0 && !districts[districtID] {
+			_, err = tx.Exec(ctx, `
+                INSERT INTO districts (id, province_id, name, created_at, updated_at)
+                VALUES ($1, $2, $3, NOW(), NOW())
+                ON CONFLICT (id) DO UPDATE
+                SET province_id = EXCLUDED.province_id, name = EXCLUDED.name, updated_at = NOW()
+            `, districtID, provinceID, strings.TrimSpace(record[3]))
+			if err != nil {
+				return nil, err
+			}
+			districts[districtID] = true
+		}
+
+		if cityID != 0 && !cities[cityID] {
+			_, err = tx.Exec(ctx, `
+                INSERT INTO cities (id, district_id, name, created_at, updated_at)
+                VALUES ($1, $2, $3, NOW(), NOW())
+                ON CONFLICT (id) DO UPDATE
+                SET district_id = EXCLUDED.district_id, name = EXCLUDED.name, updated_at = NOW()
+            `, cityID, districtID, strings.TrimSpace(record[5]))
+			if err != nil {
+				return nil, err
+			}
+			cities[cityID] = true
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &ImportResponse{
+		Provinces: len(provinces),
+		Districts: len(districts),
+		Cities:    len(cities),
+	}, nil
+}
+
+// parseID parses a positive ID. Empty values are 0 unless required.
+func parseID(value string, required bool) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		if required {
+			return 0, errors.New("required")
+		}
+		return 0, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id %q", value)
+	}
+	return id, nil
+}
+
+// importError reports a problem with the CSV data at a line
+func importError(line int, msg string) error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: fmt.Sprintf("line %d: %s", line, msg),
+	}
+}
@@ -9,10 +9,82 @@ import (
 	"time"
 
 	"encore.app/admin"
+	"encore.app/authz"
+	"encore.app/geo"
 	"encore.app/graphql/generated"
 	"encore.app/graphql/model"
 )
 
+// Scopes is the resolver for the scopes field.
+func (r *aPIKeyResolver) Scopes(ctx context.Context, obj *admin.APIKey) ([]string, error) {
+	scopes := make([]string, len(obj.Scopes))
+	for i, s := range obj.Scopes {
+		scopes[i] = string(s)
+	}
+	return scopes, nil
+}
+
+// ExpiresAt is the resolver for the expires_at field.
+func (r *aPIKeyResolver) ExpiresAt(ctx context.Context, obj *admin.APIKey) (*string, error) {
+	return optionalTime(obj.ExpiresAt), nil
+}
+
+// LastUsedAt is the resolver for the last_used_at field.
+func (r *aPIKeyResolver) LastUsedAt(ctx context.Context, obj *admin.APIKey) (*string, error) {
+	return optionalTime(obj.LastUsedAt), nil
+}
+
+// RevokedAt is the resolver for the revoked_at field.
+func (r *aPIKeyResolver) RevokedAt(ctx context.Context, obj *admin.APIKey) (*string, error) {
+	return optionalTime(obj.RevokedAt), nil
+}
+
+// CreatedAt is the resolver for the created_at field.
+func (r *aPIKeyResolver) CreatedAt(ctx context.Context, obj *admin.APIKey) (string, error) {
+	return obj.CreatedAt.Format(time.RFC3339), nil
+}
+
+// ExpiresAt is the resolver for the expires_at field.
+func (r *authResponseResolver) ExpiresAt(ctx context.Context, obj *admin.AuthResponse) (string, error) {
+	// No tokens are issued while a second factor is pending
+	if obj.ExpiresAt.IsZero() {
+		return "", nil
+	}
+	return obj.ExpiresAt.Format(time.RFC3339), nil
+}
+
+// CreatedAt is the resolver for the created_at field.
+func (r *identityResolver) CreatedAt(ctx context.Context, obj *admin.Identity) (string, error) {
+	return obj.CreatedAt.Format(time.RFC3339), nil
+}
+
+// LastLoginAt is the resolver for the last_login_at field.
+func (r *identityResolver) LastLoginAt(ctx context.Context, obj *admin.Identity) (*string, error) {
+	if obj == nil || obj.LastLoginAt == nil {
+		return nil, nil
+	}
+	formatted := obj.LastLoginAt.Format(time.RFC3339)
+	return &formatted, nil
+}
+
+// SuspendedAt is the resolver for the suspended_at field.
+func (r *managedUserResolver) SuspendedAt(ctx context.Context, obj *admin.ManagedUser) (*string, error) {
+	if obj == nil || obj.SuspendedAt == nil {
+		return nil, nil
+	}
+	formatted := obj.SuspendedAt.Format(time.RFC3339)
+	return &formatted, nil
+}
+
+// DeletedAt is the resolver for the deleted_at field.
+func (r *managedUserResolver) DeletedAt(ctx context.Context, obj *admin.ManagedUser) (*string, error) {
+	if obj == nil || obj.DeletedAt == nil {
+		return nil, nil
+	}
+	formatted := obj.DeletedAt.Format(time.RFC3339)
+	return &formatted, nil
+}
+
 // Register is the resolver for the register field.
 func (r *mutationResolver) Register(ctx context.Context, user model.UserRegisterRequest) (*admin.AuthResponse, error) {
 	// Convert GraphQL input to service input
@@ -26,18 +98,331 @@ func (r *mutationResolver) Register(ctx context.Context, user model.UserRegister
 		CityID:     user.CityID,
 		DistrictID: user.DistrictID,
 	}
+	if user.DeviceName != nil {
+		params.DeviceName = *user.DeviceName
+	}
+	client := clientInfoFromContext(ctx)
+	params.IPAddress = client.IPAddress
+	params.UserAgent = client.UserAgent
 
 	// Call the admin service
 	return admin.Register(ctx, params)
 }
 
 // Login is the resolver for the login field.
-func (r *mutationResolver) Login(ctx context.Context, username string, password string) (*admin.AuthResponse, error) {
+func (r *mutationResolver) Login(ctx context.Context, username string, password string, deviceName *string) (*admin.AuthResponse, error) {
+	client := clientInfoFromContext(ctx)
+	params := &admin.LoginParams{
+		Username:  username,
+		Password:  password,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	}
+	if deviceName != nil {
+		params.DeviceName = *deviceName
+	}
+
+	// Call the admin service
+	return admin.Login(ctx, params)
+}
+
+// RefreshToken is the resolver for the refreshToken field.
+func (r *mutationResolver) RefreshToken(ctx context.Context, refreshToken string) (*admin.AuthResponse, error) {
+	client := clientInfoFromContext(ctx)
+
+	// Call the admin service
+	return admin.RefreshToken(ctx, &admin.RefreshParams{
+		RefreshToken: refreshToken,
+		IPAddress:    client.IPAddress,
+		UserAgent:    client.UserAgent,
+	})
+}
+
+// RequestPasswordReset is the resolver for the requestPasswordReset field.
+func (r *mutationResolver) RequestPasswordReset(ctx context.Context, email string) (bool, error) {
+	// Call the admin service
+	if err := admin.RequestPasswordReset(ctx, &admin.RequestPasswordResetParams{Email: email}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ResetPassword is the resolver for the resetPassword field.
+func (r *mutationResolver) ResetPassword(ctx context.Context, token string, newPassword string) (bool, error) {
+	// Call the admin service
+	err := admin.ResetPassword(ctx, &admin.ResetPasswordParams{
+		Token:       token,
+		NewPassword: newPassword,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// VerifyEmail is the resolver for the verifyEmail field.
+func (r *mutationResolver) VerifyEmail(ctx context.Context, token string) (bool, error) {
+	// Call the admin service
+	if err := admin.VerifyEmail(ctx, &admin.VerifyEmailParams{Token: token}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ResendVerificationEmail is the resolver for the resendVerificationEmail field.
+func (r *mutationResolver) ResendVerificationEmail(ctx context.Context) (bool, error) {
+	// Call the admin service
+	if err := admin.ResendVerificationEmail(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ChangeEmail is the resolver for the changeEmail field.
+func (r *mutationResolver) ChangeEmail(ctx context.Context, newEmail string, password string) (bool, error) {
+	// Call the admin service
+	err := admin.ChangeEmail(ctx, &admin.ChangeEmailParams{
+		NewEmail: newEmail,
+		Password: password,
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ChangeUsername is the resolver for the changeUsername field.
+func (r *mutationResolver) ChangeUsername(ctx context.Context, newUsername string, password string) (*admin.User, error) {
+	// Call the admin service
+	return admin.ChangeUsername(ctx, &admin.ChangeUsernameParams{
+		NewUsername: newUsername,
+		Password:    password,
+	})
+}
+
+// UpdateMyProfile is the resolver for the updateMyProfile field.
+func (r *mutationResolver) UpdateMyProfile(ctx context.Context, input model.UpdateProfileInput) (*admin.ProfileResponse, error) {
+	// Convert GraphQL input to service input
+	params := &admin.UpdateProfileParams{
+		Fullname:   input.Fullname,
+		Address:    input.Address,
+		PostalCode: input.PostalCode,
+	}
+	if input.Location != nil {
+		params.Location = &admin.LocationParams{
+			ProvinceID: input.Location.ProvinceID,
+			DistrictID: input.Location.DistrictID,
+			CityID:     input.Location.CityID,
+		}
+	}
+
+	// Call the admin service
+	return admin.UpdateMyProfile(ctx, params)
+}
+
+// VerifyMfa is the resolver for the verifyMfa field.
+func (r *mutationResolver) VerifyMfa(ctx context.Context, mfaToken string, code string) (*admin.AuthResponse, error) {
+	client := clientInfoFromContext(ctx)
+
+	// Call the admin service
+	return admin.VerifyMFA(ctx, &admin.VerifyMFAParams{
+		MFAToken:  mfaToken,
+		Code:      code,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	})
+}
+
+// StartOidcLogin is the resolver for the startOidcLogin field.
+func (r *mutationResolver) StartOidcLogin(ctx context.Context, provider string) (string, error) {
+	// Call the admin service
+	resp, err := admin.StartOIDCLogin(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+	return resp.AuthorizationURL, nil
+}
+
+// LinkOidcProvider is the resolver for the linkOidcProvider field.
+func (r *mutationResolver) LinkOidcProvider(ctx context.Context, provider string) (string, error) {
+	// Call the admin service
+	resp, err := admin.LinkOIDCProvider(ctx, provider)
+	if err != nil {
+		return "", err
+	}
+	return resp.AuthorizationURL, nil
+}
+
+// FinishOidcLogin is the resolver for the finishOidcLogin field.
+func (r *mutationResolver) FinishOidcLogin(ctx context.Context, state string, code string, deviceName *string) (*admin.AuthResponse, error) {
+	client := clientInfoFromContext(ctx)
+	params := &admin.FinishOIDCLoginParams{
+		State:     state,
+		Code:      code,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	}
+	if deviceName != nil {
+		params.DeviceName = *deviceName
+	}
+
+	// Call the admin service
+	return admin.FinishOIDCLogin(ctx, params)
+}
+
+// UnlinkIdentity is the resolver for the unlinkIdentity field.
+func (r *mutationResolver) UnlinkIdentity(ctx context.Context, id int) (bool, error) {
+	if err := admin.UnlinkIdentity(ctx, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateAPIKey is the resolver for the createApiKey field.
+func (r *mutationResolver) CreateAPIKey(ctx context.Context, input model.APIKeyInput) (*admin.CreatedAPIKey, error) {
+	params, err := apiKeyParams(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the admin service
+	return admin.CreateAPIKey(ctx, params)
+}
+
+// RevokeAPIKey is the resolver for the revokeApiKey field.
+func (r *mutationResolver) RevokeAPIKey(ctx context.Context, id int) (bool, error) {
+	if err := admin.RevokeAPIKey(ctx, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateOrganizationAPIKey is the resolver for the createOrganizationApiKey field.
+func (r *mutationResolver) CreateOrganizationAPIKey(ctx context.Context, input model.APIKeyInput) (*admin.CreatedAPIKey, error) {
+	params, err := apiKeyParams(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the admin service
+	return admin.CreateOrgAPIKey(ctx, params)
+}
+
+// RevokeOrganizationAPIKey is the resolver for the revokeOrganizationApiKey field.
+func (r *mutationResolver) RevokeOrganizationAPIKey(ctx context.Context, id int) (bool, error) {
+	if err := admin.RevokeOrgAPIKey(ctx, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// EnrollMfa is the resolver for the enrollMfa field.
+func (r *mutationResolver) EnrollMfa(ctx context.Context) (*admin.MFAEnrollment, error) {
 	// Call the admin service
-	return admin.Login(ctx, &admin.LoginParams{
-		Username: username,
+	return admin.EnrollMFA(ctx)
+}
+
+// ConfirmMfa is the resolver for the confirmMfa field.
+func (r *mutationResolver) ConfirmMfa(ctx context.Context, code string) ([]string, error) {
+	// Call the admin service
+	resp, err := admin.ConfirmMFA(ctx, &admin.MFACodeParams{Code: code})
+	if err != nil {
+		return nil, err
+	}
+	return resp.RecoveryCodes, nil
+}
+
+// DisableMfa is the resolver for the disableMfa field.
+func (r *mutationResolver) DisableMfa(ctx context.Context, password string, code string) (bool, error) {
+	// Call the admin service
+	err := admin.DisableMFA(ctx, &admin.DisableMFAParams{
 		Password: password,
+		Code:     code,
 	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Logout is the resolver for the logout field.
+func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
+	if err := admin.Logout(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// LogoutAllDevices is the resolver for the logoutAllDevices field.
+func (r *mutationResolver) LogoutAllDevices(ctx context.Context) (bool, error) {
+	if err := admin.LogoutAllDevices(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GrantRole is the resolver for the grantRole field.
+func (r *mutationResolver) GrantRole(ctx context.Context, userID int, role authz.Role) ([]authz.Role, error) {
+	// Call the admin service
+	resp, err := admin.GrantRole(ctx, userID, &admin.RoleParams{Role: role})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Roles, nil
+}
+
+// RevokeRole is the resolver for the revokeRole field.
+func (r *mutationResolver) RevokeRole(ctx context.Context, userID int, role authz.Role) ([]authz.Role, error) {
+	// Call the admin service
+	resp, err := admin.RevokeRole(ctx, userID, string(role))
+	if err != nil {
+		return nil, err
+	}
+	return resp.Roles, nil
+}
+
+// UnlockUser is the resolver for the unlockUser field.
+func (r *mutationResolver) UnlockUser(ctx context.Context, userID int) (bool, error) {
+	// Call the admin service
+	if err := admin.UnlockUser(ctx, userID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SuspendUser is the resolver for the suspendUser field.
+func (r *mutationResolver) SuspendUser(ctx context.Context, userID int, reason *string) (*admin.ManagedUser, error) {
+	params := &admin.SuspendUserParams{}
+	if reason != nil {
+		params.Reason = *reason
+	}
+
+	// Call the admin service
+	return admin.SuspendUser(ctx, userID, params)
+}
+
+// ReactivateUser is the resolver for the reactivateUser field.
+func (r *mutationResolver) ReactivateUser(ctx context.Context, userID int) (*admin.ManagedUser, error) {
+	// Call the admin service
+	return admin.ReactivateUser(ctx, userID)
+}
+
+// ForcePasswordReset is the resolver for the forcePasswordReset field.
+func (r *mutationResolver) ForcePasswordReset(ctx context.Context, userID int) (bool, error) {
+	// Call the admin service
+	if err := admin.ForcePasswordReset(ctx, userID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteUser is the resolver for the deleteUser field.
+func (r *mutationResolver) DeleteUser(ctx context.Context, userID int) (bool, error) {
+	// Call the admin service
+	if err := admin.DeleteUser(ctx, userID); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // Me is the resolver for the me field.
@@ -46,6 +431,127 @@ func (r *queryResolver) Me(ctx context.Context) (*admin.ProfileResponse, error)
 	return admin.GetProfile(ctx)
 }
 
+// MySessions is the resolver for the mySessions field.
+func (r *queryResolver) MySessions(ctx context.Context) ([]*admin.Session, error) {
+	resp, err := admin.MySessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Sessions, nil
+}
+
+// OidcProviders is the resolver for the oidcProviders field.
+func (r *queryResolver) OidcProviders(ctx context.Context) ([]string, error) {
+	resp, err := admin.ListOIDCProviders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Providers, nil
+}
+
+// MyIdentities is the resolver for the myIdentities field.
+func (r *queryResolver) MyIdentities(ctx context.Context) ([]*admin.Identity, error) {
+	resp, err := admin.MyIdentities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Identities, nil
+}
+
+// APIKeyScopes is the resolver for the apiKeyScopes field.
+func (r *queryResolver) APIKeyScopes(ctx context.Context) ([]string, error) {
+	scopes := make([]string, len(authz.Scopes))
+	for i, s := range authz.Scopes {
+		scopes[i] = string(s)
+	}
+	return scopes, nil
+}
+
+// MyAPIKeys is the resolver for the myApiKeys field.
+func (r *queryResolver) MyAPIKeys(ctx context.Context) ([]*admin.APIKey, error) {
+	resp, err := admin.MyAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.APIKeys, nil
+}
+
+// OrganizationAPIKeys is the resolver for the organizationApiKeys field.
+func (r *queryResolver) OrganizationAPIKeys(ctx context.Context) ([]*admin.APIKey, error) {
+	resp, err := admin.ListOrgAPIKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.APIKeys, nil
+}
+
+// Users is the resolver for the users field.
+func (r *queryResolver) Users(ctx context.Context, filter *model.UserFilter, sortBy *admin.UserSortField, sortDesc *bool, page *int, pageSize *int) (*admin.UserPage, error) {
+	// Convert GraphQL input to service input
+	params := &admin.ListUsersParams{}
+	if filter != nil {
+		if filter.Search != nil {
+			params.Search = *filter.Search
+		}
+		params.Role = filter.Role
+		params.Verified = filter.Verified
+		params.Status = filter.Status
+
+		var err error
+		if params.CreatedAfter, err = parseTimeInput("created_after", filter.CreatedAfter); err != nil {
+			return nil, err
+		}
+		if params.CreatedBefore, err = parseTimeInput("created_before", filter.CreatedBefore); err != nil {
+			return nil, err
+		}
+	}
+	if sortBy != nil {
+		params.SortBy = *sortBy
+	}
+	if sortDesc != nil {
+		params.SortDesc = *sortDesc
+	}
+	if page != nil {
+		params.Page = *page
+	}
+	if pageSize != nil {
+		params.PageSize = *pageSize
+	}
+
+	// Call the admin service
+	return admin.ListUsers(ctx, params)
+}
+
+// User is the resolver for the user field.
+func (r *queryResolver) User(ctx context.Context, id int) (*admin.ManagedUser, error) {
+	// Call the admin service
+	return admin.GetUser(ctx, id)
+}
+
+// StartedAt is the resolver for the started_at field.
+func (r *sessionResolver) StartedAt(ctx context.Context, obj *admin.Session) (string, error) {
+	return obj.StartedAt.Format(time.RFC3339), nil
+}
+
+// LastSeenAt is the resolver for the last_seen_at field.
+func (r *sessionResolver) LastSeenAt(ctx context.Context, obj *admin.Session) (string, error) {
+	return obj.LastSeenAt.Format(time.RFC3339), nil
+}
+
+// ExpiresAt is the resolver for the expires_at field.
+func (r *sessionResolver) ExpiresAt(ctx context.Context, obj *admin.Session) (string, error) {
+	return obj.ExpiresAt.Format(time.RFC3339), nil
+}
+
+// EmailVerifiedAt is the resolver for the email_verified_at field.
+func (r *userResolver) EmailVerifiedAt(ctx context.Context, obj *admin.User) (*string, error) {
+	if obj == nil || obj.EmailVerifiedAt == nil {
+		return nil, nil
+	}
+	formatted := obj.EmailVerifiedAt.Format(time.RFC3339)
+	return &formatted, nil
+}
+
 // CreatedAt is the resolver for the created_at field.
 func (r *userResolver) CreatedAt(ctx context.Context, obj *admin.User) (*string, error) {
 	if obj == nil {
@@ -65,39 +571,27 @@ func (r *userResolver) UpdatedAt(ctx context.Context, obj *admin.User) (*string,
 }
 
 // Province is the resolver for the province field.
-func (r *userDetailResolver) Province(ctx context.Context, obj *admin.UserDetail) (*model.Province, error) {
-	if obj == nil || obj.ProvinceID == nil {
+func (r *userDetailResolver) Province(ctx context.Context, obj *admin.UserDetail) (*geo.Province, error) {
+	if obj == nil {
 		return nil, nil
 	}
-	// In a real app, you would fetch the province from the database
-	return &model.Province{
-		ID:   *obj.ProvinceID,
-		Name: "", // You would fetch the actual name from the database
-	}, nil
+	return loadOptional(ctx, loadersFromContext(ctx).province, obj.ProvinceID)
 }
 
 // District is the resolver for the district field.
-func (r *userDetailResolver) District(ctx context.Context, obj *admin.UserDetail) (*model.District, error) {
-	if obj == nil || obj.DistrictID == nil {
+func (r *userDetailResolver) District(ctx context.Context, obj *admin.UserDetail) (*geo.District, error) {
+	if obj == nil {
 		return nil, nil
 	}
-	// In a real app, you would fetch the district from the database
-	return &model.District{
-		ID:   *obj.DistrictID,
-		Name: "", // You would fetch the actual name from the database
-	}, nil
+	return loadOptional(ctx, loadersFromContext(ctx).district, obj.DistrictID)
 }
 
 // City is the resolver for the city field.
-func (r *userDetailResolver) City(ctx context.Context, obj *admin.UserDetail) (*model.City, error) {
-	if obj == nil || obj.CityID == nil {
+func (r *userDetailResolver) City(ctx context.Context, obj *admin.UserDetail) (*geo.City, error) {
+	if obj == nil {
 		return nil, nil
 	}
-	// In a real app, you would fetch the city from the database
-	return &model.City{
-		ID:   *obj.CityID,
-		Name: "", // You would fetch the actual name from the database
-	}, nil
+	return loadOptional(ctx, loadersFromContext(ctx).city, obj.CityID)
 }
 
 // CreatedAt is the resolver for the created_at field.
@@ -118,11 +612,31 @@ func (r *userDetailResolver) UpdatedAt(ctx context.Context, obj *admin.UserDetai
 	return &formatted, nil
 }
 
+// APIKey returns generated.APIKeyResolver implementation.
+func (r *Resolver) APIKey() generated.APIKeyResolver { return &aPIKeyResolver{r} }
+
+// AuthResponse returns generated.AuthResponseResolver implementation.
+func (r *Resolver) AuthResponse() generated.AuthResponseResolver { return &authResponseResolver{r} }
+
+// Identity returns generated.IdentityResolver implementation.
+func (r *Resolver) Identity() generated.IdentityResolver { return &identityResolver{r} }
+
+// ManagedUser returns generated.ManagedUserResolver implementation.
+func (r *Resolver) ManagedUser() generated.ManagedUserResolver { return &managedUserResolver{r} }
+
+// Session returns generated.SessionResolver implementation.
+func (r *Resolver) Session() generated.SessionResolver { return &sessionResolver{r} }
+
 // User returns generated.UserResolver implementation.
 func (r *Resolver) User() generated.UserResolver { return &userResolver{r} }
 
 // UserDetail returns generated.UserDetailResolver implementation.
 func (r *Resolver) UserDetail() generated.UserDetailResolver { return &userDetailResolver{r} }
 
+type aPIKeyResolver struct{ *Resolver }
+type authResponseResolver struct{ *Resolver }
+type identityResolver struct{ *Resolver }
+type managedUserResolver struct{ *Resolver }
+type sessionResolver struct{ *Resolver }
 type userResolver struct{ *Resolver }
 type userDetailResolver struct{ *Resolver }
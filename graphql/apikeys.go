@@ -0,0 +1,35 @@
+package graphql
+
+import (
+	"time"
+
+	"encore.app/admin"
+	"encore.app/authz"
+	"encore.app/graphql/model"
+)
+
+// apiKeyParams converts the GraphQL input of the API key mutations
+func apiKeyParams(input model.APIKeyInput) (*admin.CreateAPIKeyParams, error) {
+	expiresAt, err := parseTimeInput("expires_at", input.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	params := &admin.CreateAPIKeyParams{
+		Name:      input.Name,
+		Scopes:    make([]authz.Scope, len(input.Scopes)),
+		ExpiresAt: expiresAt,
+	}
+	for i, s := range input.Scopes {
+		params.Scopes[i] = authz.Scope(s)
+	}
+	return params, nil
+}
+
+// optionalTime formats a time that may be unset
+func optionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format(time.RFC3339)
+	return &formatted
+}
@@ -0,0 +1,78 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
+import (
+	"context"
+
+	"encore.app/graphql/model"
+	"encore.app/trainee"
+)
+
+// AssignWorkout is the resolver for the assignWorkout field.
+func (r *mutationResolver) AssignWorkout(ctx context.Context, workoutID string, traineeID string, dueDate *string) (*model.AssignedWorkout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	traineeUserID, err := parseIDInput("traineeId", traineeID)
+	if err != nil {
+		return nil, err
+	}
+	due, err := parseTimeInput("dueDate", dueDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	a, err := trainee.AssignWorkout(ctx, id, &trainee.AssignWorkoutParams{
+		TraineeID: traineeUserID,
+		DueDate:   due,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return assignmentModel(a), nil
+}
+
+// BulkAssignWorkout is the resolver for the bulkAssignWorkout field.
+func (r *mutationResolver) BulkAssignWorkout(ctx context.Context, workoutID string, traineeIds []string, dueDate *string) ([]*model.AssignedWorkout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	traineeUserIDs, err := parseIDsInput("traineeIds", traineeIds)
+	if err != nil {
+		return nil, err
+	}
+	due, err := parseTimeInput("dueDate", dueDate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	resp, err := trainee.BulkAssignWorkout(ctx, id, &trainee.BulkAssignWorkoutParams{
+		TraineeIDs: traineeUserIDs,
+		DueDate:    due,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return assignmentModels(resp.Assignments), nil
+}
+
+// UnassignWorkout is the resolver for the unassignWorkout field.
+func (r *mutationResolver) UnassignWorkout(ctx context.Context, assignmentID string) (bool, error) {
+	id, err := parseIDInput("assignmentId", assignmentID)
+	if err != nil {
+		return false, err
+	}
+
+	// Call the trainee service
+	if err := trainee.UnassignWorkout(ctx, id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,10 @@
+package graphql
+
+// rawJSON returns JSON text as a string, or nil if there is none
+func rawJSON(data []byte) *string {
+	if len(data) == 0 {
+		return nil
+	}
+	s := string(data)
+	return &s
+}
@@ -0,0 +1,72 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
+import (
+	"context"
+	"time"
+
+	"encore.app/audit"
+	"encore.app/graphql/generated"
+	"encore.app/graphql/model"
+)
+
+// Before is the resolver for the before field.
+func (r *auditEventResolver) Before(ctx context.Context, obj *audit.Event) (*string, error) {
+	return rawJSON(obj.Before), nil
+}
+
+// After is the resolver for the after field.
+func (r *auditEventResolver) After(ctx context.Context, obj *audit.Event) (*string, error) {
+	return rawJSON(obj.After), nil
+}
+
+// OccurredAt is the resolver for the occurred_at field.
+func (r *auditEventResolver) OccurredAt(ctx context.Context, obj *audit.Event) (string, error) {
+	return obj.OccurredAt.Format(time.RFC3339), nil
+}
+
+// AuditLog is the resolver for the auditLog field.
+func (r *queryResolver) AuditLog(ctx context.Context, filter *model.AuditFilter, page *int, pageSize *int) (*audit.EventPage, error) {
+	// Convert GraphQL input to service input
+	params := &audit.ListParams{}
+	if filter != nil {
+		params.ActorID = filter.ActorID
+		if filter.Action != nil {
+			params.Action = *filter.Action
+		}
+		if filter.EntityType != nil {
+			params.EntityType = *filter.EntityType
+		}
+		if filter.EntityID != nil {
+			params.EntityID = *filter.EntityID
+		}
+		if filter.RequestID != nil {
+			params.RequestID = *filter.RequestID
+		}
+
+		var err error
+		if params.From, err = parseTimeInput("from", filter.From); err != nil {
+			return nil, err
+		}
+		if params.To, err = parseTimeInput("to", filter.To); err != nil {
+			return nil, err
+		}
+	}
+	if page != nil {
+		params.Page = *page
+	}
+	if pageSize != nil {
+		params.PageSize = *pageSize
+	}
+
+	// Call the audit service
+	return audit.List(ctx, params)
+}
+
+// AuditEvent returns generated.AuditEventResolver implementation.
+func (r *Resolver) AuditEvent() generated.AuditEventResolver { return &auditEventResolver{r} }
+
+type auditEventResolver struct{ *Resolver }
@@ -0,0 +1,37 @@
+package graphql
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// clientInfo describes the client that sent a GraphQL request.
+// It is recorded on sessions started through login and register.
+type clientInfo struct {
+	// IPAddress is the X-Forwarded-For chain of the request, or the peer address
+	// without a proxy. The admin service picks the client from it using the
+	// number of proxies it trusts.
+	IPAddress string
+	UserAgent string
+}
+
+type clientInfoKey struct{}
+
+// withClientInfo returns a copy of the request context carrying the client's address and user agent
+func withClientInfo(req *http.Request) context.Context {
+	ip := req.Header.Get("X-Forwarded-For")
+	if ip == "" {
+		ip, _, _ = net.SplitHostPort(req.RemoteAddr)
+	}
+	return context.WithValue(req.Context(), clientInfoKey{}, clientInfo{
+		IPAddress: ip,
+		UserAgent: req.UserAgent(),
+	})
+}
+
+// clientInfoFromContext returns the client info stored by withClientInfo
+func clientInfoFromContext(ctx context.Context) clientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(clientInfo)
+	return info
+}
@@ -0,0 +1,47 @@
+package graphql
+
+import (
+	"context"
+
+	"encore.app/authz"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Error codes set in the "code" extension of errors returned by the directives
+const (
+	codeUnauthenticated = "UNAUTHENTICATED"
+	codeForbidden       = "FORBIDDEN"
+)
+
+// authDirective implements @auth: the field resolves only for authenticated callers
+func authDirective(ctx context.Context, obj interface{}, next graphql.Resolver) (interface{}, error) {
+	if _, err := authz.CurrentCaller(); err != nil {
+		return nil, directiveError(ctx, codeUnauthenticated, "authentication required")
+	}
+	return next(ctx)
+}
+
+// hasRoleDirective implements @hasRole: the field resolves only for callers holding the role.
+// Administrators hold every role.
+func hasRoleDirective(ctx context.Context, obj interface{}, next graphql.Resolver, role authz.Role) (interface{}, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, directiveError(ctx, codeUnauthenticated, "authentication required")
+	}
+	if !caller.HasRole(role) && !caller.IsAdmin() {
+		return nil, directiveError(ctx, codeForbidden, "requires role "+string(role))
+	}
+	return next(ctx)
+}
+
+// directiveError builds an error for the current field carrying a machine readable code
+func directiveError(ctx context.Context, code, message string) error {
+	return &gqlerror.Error{
+		Message: message,
+		Path:    graphql.GetPath(ctx),
+		Extensions: map[string]interface{}{
+			"code": code,
+		},
+	}
+}
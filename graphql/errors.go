@@ -0,0 +1,156 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"encore.app/admin"
+	"encore.dev/beta/errs"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Error codes set in the "code" extension of errors returned by services
+const (
+	codeBadUserInput  = "BAD_USER_INPUT"
+	codeAlreadyExists = "ALREADY_EXISTS"
+	codeNotFound      = "NOT_FOUND"
+	codeRateLimited   = "RATE_LIMITED"
+	codeInternal      = "INTERNAL_SERVER_ERROR"
+)
+
+// serviceErrorCodes maps Encore error codes to the codes used in the GraphQL API
+var serviceErrorCodes = map[errs.ErrCode]string{
+	errs.InvalidArgument:    codeBadUserInput,
+	errs.FailedPrecondition: codeBadUserInput,
+	errs.AlreadyExists:      codeAlreadyExists,
+	errs.NotFound:           codeNotFound,
+	errs.Unauthenticated:    codeUnauthenticated,
+	errs.PermissionDenied:   codeForbidden,
+	errs.ResourceExhausted:  codeRateLimited,
+}
+
+// splitFieldErrors is a field middleware reporting every rejected input field
+// of a service validation error as a GraphQL error of its own
+func splitFieldErrors(ctx context.Context, next graphql.Resolver) (interface{}, error) {
+	res, err := next(ctx)
+
+	var e *errs.Error
+	if !errors.As(err, &e) {
+		return res, err
+	}
+	details, ok := e.Details.(admin.ValidationDetails)
+	if !ok || len(details.Violations) < 2 {
+		return res, err
+	}
+
+	list := make(gqlerror.List, 0, len(details.Violations))
+	for _, v := range details.Violations {
+		list = append(list, gqlerror.WrapPath(graphql.GetPath(ctx), &errs.Error{
+			Code:    e.Code,
+			Message: v.Message,
+			Details: admin.ValidationDetails{Violations: []admin.FieldViolation{v}},
+		}))
+	}
+	return res, list
+}
+
+// parseTimeInput parses an optional RFC 3339 timestamp argument
+func parseTimeInput(field string, value *string) (*time.Time, error) {
+	if value == nil {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return nil, invalidFormat(field, field+" must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
+
+// parseIDInput parses a numeric ID argument
+func parseIDInput(field string, value string) (int, error) {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidFormat(field, field+" must be a numeric ID")
+	}
+	return id, nil
+}
+
+// parseOptionalIDInput parses a numeric ID argument that may be left out
+func parseOptionalIDInput(field string, value *string) (*int, error) {
+	if value == nil {
+		return nil, nil
+	}
+	id, err := parseIDInput(field, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// parseIDsInput parses a list of numeric IDs
+func parseIDsInput(field string, values []string) ([]int, error) {
+	ids := make([]int, len(values))
+	for i, value := range values {
+		id, err := parseIDInput(field, value)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// invalidFormat is the error for an argument that can't be parsed
+func invalidFormat(field, msg string) error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: msg,
+		Details: admin.ValidationDetails{Violations: []admin.FieldViolation{{
+			Field:   field,
+			Code:    admin.ViolationInvalidFormat,
+			Message: msg,
+		}}},
+	}
+}
+
+// tooLong is the error for an argument that is larger than allowed
+func tooLong(field, msg string) error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: msg,
+		Details: admin.ValidationDetails{Violations: []admin.FieldViolation{{
+			Field:   field,
+			Code:    admin.ViolationTooLong,
+			Message: msg,
+		}}},
+	}
+}
+
+// presentError converts errors returned by services so that clients get the
+// message and a machine readable "code" extension instead of internal details.
+// Validation errors also carry the rejected input field in the "field" extension.
+func presentError(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+	var e *errs.Error
+	if !errors.As(err, &e) {
+		return gqlErr
+	}
+
+	code, ok := serviceErrorCodes[e.Code]
+	if !ok {
+		code = codeInternal
+	}
+	gqlErr.Message = e.Message
+	gqlErr.Extensions = map[string]interface{}{
+		"code": code,
+	}
+	if details, ok := e.Details.(admin.ValidationDetails); ok && len(details.Violations) == 1 {
+		gqlErr.Extensions["code"] = details.Violations[0].Code
+		gqlErr.Extensions["field"] = details.Violations[0].Field
+	}
+	return gqlErr
+}
@@ -0,0 +1,147 @@
+//go:build encore_app
+
+package graphql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"encore.app/admin"
+	"encore.dev/beta/errs"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// validationError is a service error rejecting the given fields
+func validationError(violations ...admin.FieldViolation) error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: violations[0].Message,
+		Details: admin.ValidationDetails{Violations: violations},
+	}
+}
+
+// resolvedPath is the context of a resolver of the register mutation
+func resolvedPath() context.Context {
+	return graphql.WithPathContext(context.Background(), graphql.NewPathWithField("register"))
+}
+
+func TestSplitFieldErrors(t *testing.T) {
+	ctx := resolvedPath()
+	usernameTaken := admin.FieldViolation{Field: "username", Code: admin.ViolationAlreadyTaken, Message: "username is already taken"}
+	weakPassword := admin.FieldViolation{Field: "password", Code: admin.ViolationWeakPassword, Message: "password is weak"}
+
+	_, err := splitFieldErrors(ctx, func(context.Context) (interface{}, error) {
+		return nil, validationError(usernameTaken, weakPassword)
+	})
+	var list gqlerror.List
+	if !errors.As(err, &list) || len(list) != 2 {
+		t.Fatalf("got %v, want a list of 2 errors", err)
+	}
+	for i, want := range []admin.FieldViolation{usernameTaken, weakPassword} {
+		if list[i].Path.String() != "register" {
+			t.Errorf("error %d has path %q, want register", i, list[i].Path)
+		}
+		var e *errs.Error
+		if !errors.As(list[i], &e) {
+			t.Fatalf("error %d is %T, want a service error", i, list[i].Unwrap())
+		}
+		details, _ := e.Details.(admin.ValidationDetails)
+		if e.Code != errs.InvalidArgument || e.Message != want.Message || len(details.Violations) != 1 || details.Violations[0] != want {
+			t.Errorf("error %d is %+v, want one rejecting %s", i, e, want.Field)
+		}
+	}
+
+	// Other errors are passed through as they are
+	single := validationError(usernameTaken)
+	other := errs.B().Code(errs.NotFound).Msg("user not found").Err()
+	plain := errors.New("boom")
+	for _, want := range []error{single, other, plain, nil} {
+		res, err := splitFieldErrors(ctx, func(context.Context) (interface{}, error) {
+			return "result", want
+		})
+		if err != want || res != "result" {
+			t.Errorf("got %v, %v, want result, %v", res, err, want)
+		}
+	}
+}
+
+func TestPresentError(t *testing.T) {
+	ctx := resolvedPath()
+	tests := []struct {
+		name    string
+		err     error
+		message string
+		ext     map[string]interface{}
+	}{
+		{
+			"field violation",
+			validationError(admin.FieldViolation{Field: "email", Code: admin.ViolationInvalidEmail, Message: "email is not a valid email address"}),
+			"email is not a valid email address",
+			map[string]interface{}{"code": admin.ViolationInvalidEmail, "field": "email"},
+		},
+		{
+			"several violations",
+			validationError(
+				admin.FieldViolation{Field: "email", Code: admin.ViolationInvalidEmail, Message: "email is not a valid email address"},
+				admin.FieldViolation{Field: "username", Code: admin.ViolationTooShort, Message: "username is too short"},
+			),
+			"email is not a valid email address",
+			map[string]interface{}{"code": codeBadUserInput},
+		},
+		{"not found", errs.B().Code(errs.NotFound).Msg("user not found").Err(), "user not found", map[string]interface{}{"code": codeNotFound}},
+		{"unauthenticated", errs.B().Code(errs.Unauthenticated).Msg("invalid credentials").Err(), "invalid credentials", map[string]interface{}{"code": codeUnauthenticated}},
+		{"rate limited", errs.B().Code(errs.ResourceExhausted).Msg("too many attempts").Err(), "too many attempts", map[string]interface{}{"code": codeRateLimited}},
+		{"unmapped code", errs.B().Code(errs.Internal).Msg("database unavailable").Err(), "database unavailable", map[string]interface{}{"code": codeInternal}},
+	}
+	for _, tt := range tests {
+		got := presentError(ctx, tt.err)
+		if got.Message != tt.message || got.Path.String() != "register" {
+			t.Errorf("%s: got %q at %q", tt.name, got.Message, got.Path)
+		}
+		if len(got.Extensions) != len(tt.ext) {
+			t.Errorf("%s: got extensions %v, want %v", tt.name, got.Extensions, tt.ext)
+			continue
+		}
+		for k, v := range tt.ext {
+			if got.Extensions[k] != v {
+				t.Errorf("%s: got extensions %v, want %v", tt.name, got.Extensions, tt.ext)
+			}
+		}
+	}
+
+	// Errors that don't come from a service keep the default presentation
+	if got := presentError(ctx, errors.New("boom")); got.Message != "boom" || got.Extensions != nil {
+		t.Errorf("got %+v for a plain error", got)
+	}
+}
+
+func TestRegisterReportsEveryField(t *testing.T) {
+	s := newTestService(t)
+	resp := execute(t, s, `
+		mutation ($user: UserRegisterRequest!) {
+			register(user: $user) { token }
+		}
+	`, map[string]any{"user": map[string]any{
+		"username": "x",
+		"email":    "not an email",
+		"password": "correct horse battery 1",
+		"fullname": "Test User",
+	}})
+
+	if len(resp.Errors) != 2 {
+		t.Fatalf("got errors %+v, want one per rejected field", resp.Errors)
+	}
+	want := map[string]string{"username": admin.ViolationTooShort, "email": admin.ViolationInvalidEmail}
+	for _, e := range resp.Errors {
+		field, _ := e.Extensions["field"].(string)
+		if code, ok := want[field]; !ok || e.Extensions["code"] != code {
+			t.Errorf("got extensions %v, want the code of a rejected field", e.Extensions)
+		}
+		delete(want, field)
+		if len(e.Path) != 1 || e.Path[0] != "register" {
+			t.Errorf("got path %v, want register", e.Path)
+		}
+	}
+}
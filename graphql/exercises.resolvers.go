@@ -0,0 +1,141 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
+import (
+	"context"
+
+	"encore.app/graphql/model"
+	"encore.app/trainee"
+)
+
+// CreateExercise is the resolver for the createExercise field.
+func (r *mutationResolver) CreateExercise(ctx context.Context, input model.ExerciseInput, library bool) (*model.Exercise, error) {
+	// Convert GraphQL input to service input
+	params := exerciseParams(&input)
+	params.Library = library
+
+	// Call the trainee service
+	e, err := trainee.CreateExercise(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return exerciseModel(e), nil
+}
+
+// UpdateExercise is the resolver for the updateExercise field.
+func (r *mutationResolver) UpdateExercise(ctx context.Context, id string, input model.ExerciseUpdateInput) (*model.Exercise, error) {
+	exerciseID, err := parseIDInput("id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	e, err := trainee.UpdateExercise(ctx, exerciseID, &trainee.UpdateExerciseParams{
+		Name:        input.Name,
+		Description: input.Description,
+		MuscleGroup: input.MuscleGroup,
+		Equipment:   input.Equipment,
+		VideoURL:    input.VideoURL,
+		Aliases:     input.Aliases,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exerciseModel(e), nil
+}
+
+// DeleteExercise is the resolver for the deleteExercise field.
+func (r *mutationResolver) DeleteExercise(ctx context.Context, id string) (bool, error) {
+	exerciseID, err := parseIDInput("id", id)
+	if err != nil {
+		return false, err
+	}
+
+	// Call the trainee service
+	if err := trainee.DeleteExercise(ctx, exerciseID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ImportExercises is the resolver for the importExercises field.
+func (r *mutationResolver) ImportExercises(ctx context.Context, csv *string, exercises []*model.ExerciseInput) (*model.ExerciseImport, error) {
+	// Convert GraphQL input to service input
+	params := &trainee.ImportExercisesParams{}
+	if csv != nil {
+		params.CSV = *csv
+	}
+	for _, e := range exercises {
+		params.Exercises = append(params.Exercises, exerciseParams(e))
+	}
+
+	// Call the trainee service
+	resp, err := trainee.ImportExercises(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ExerciseImport{
+		Created: resp.Created,
+		Updated: resp.Updated,
+	}, nil
+}
+
+// Exercises is the resolver for the exercises field.
+func (r *queryResolver) Exercises(ctx context.Context, filter *model.ExerciseFilter, page *int, pageSize *int) (*model.ExercisePage, error) {
+	// Convert GraphQL input to service input
+	params := &trainee.ListExercisesParams{}
+	if filter != nil {
+		if filter.Search != nil {
+			params.Search = *filter.Search
+		}
+		if filter.MuscleGroup != nil {
+			params.MuscleGroup = *filter.MuscleGroup
+		}
+		if filter.Equipment != nil {
+			params.Equipment = *filter.Equipment
+		}
+		if filter.CustomOnly != nil {
+			params.Custom = *filter.CustomOnly
+		}
+	}
+	if page != nil {
+		params.Page = *page
+	}
+	if pageSize != nil {
+		params.PageSize = *pageSize
+	}
+
+	// Call the trainee service
+	resp, err := trainee.ListExercises(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	m := &model.ExercisePage{
+		Exercises: make([]*model.Exercise, len(resp.Exercises)),
+		Total:     resp.Total,
+		Page:      resp.Page,
+		PageSize:  resp.PageSize,
+	}
+	for i, e := range resp.Exercises {
+		m.Exercises[i] = exerciseModel(e)
+	}
+	return m, nil
+}
+
+// Exercise is the resolver for the exercise field.
+func (r *queryResolver) Exercise(ctx context.Context, id string) (*model.Exercise, error) {
+	exerciseID, err := parseIDInput("id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	e, err := trainee.GetExercise(ctx, exerciseID)
+	if err != nil {
+		return nil, err
+	}
+	return exerciseModel(e), nil
+}
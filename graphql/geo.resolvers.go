@@ -0,0 +1,41 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
+import (
+	"context"
+
+	"encore.app/geo"
+)
+
+// Provinces is the resolver for the provinces field.
+func (r *queryResolver) Provinces(ctx context.Context) ([]*geo.Province, error) {
+	// Call the geo service
+	resp, err := geo.ListProvinces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Provinces, nil
+}
+
+// Districts is the resolver for the districts field.
+func (r *queryResolver) Districts(ctx context.Context, provinceID int) ([]*geo.District, error) {
+	// Call the geo service
+	resp, err := geo.ListDistricts(ctx, provinceID)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Districts, nil
+}
+
+// Cities is the resolver for the cities field.
+func (r *queryResolver) Cities(ctx context.Context, districtID int) ([]*geo.City, error) {
+	// Call the geo service
+	resp, err := geo.ListCities(ctx, districtID)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Cities, nil
+}
@@ -21,7 +21,13 @@ type Service struct {
 
 // initService is automatically called by Encore when the service starts up.
 func initService() (*Service, error) {
-	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: &Resolver{}}))
+	cfg := generated.Config{Resolvers: &Resolver{}}
+	cfg.Directives.Auth = authDirective
+	cfg.Directives.HasRole = hasRoleDirective
+
+	srv := handler.NewDefaultServer(generated.NewExecutableSchema(cfg))
+	srv.AroundFields(splitFieldErrors)
+	srv.SetErrorPresenter(presentError)
 	pg := playground.Handler("GraphQL Playground", "/graphql")
 	return &Service{srv, pg}, nil
 }
@@ -30,9 +36,12 @@ func initService() (*Service, error) {
 //
 // Learn more: https://encore.dev/docs/go/primitives/raw-endpoints
 //
-//encore:api public raw path=/graphql
+// API keys may call it; the services behind the resolvers check their scopes.
+//
+//encore:api public raw path=/graphql tag:api_keys
 func (s *Service) Query(w http.ResponseWriter, req *http.Request) {
-	s.srv.ServeHTTP(w, req)
+	ctx := withLoaders(withClientInfo(req))
+	s.srv.ServeHTTP(w, req.WithContext(ctx))
 }
 
 //encore:api public raw path=/graphql/playground
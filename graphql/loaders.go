@@ -0,0 +1,90 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"encore.app/geo"
+	"github.com/vikstrous/dataloadgen"
+)
+
+// loaders batches lookups made by the resolvers of one request, so a list of
+// users costs one geo lookup instead of one per user
+type loaders struct {
+	province *dataloadgen.Loader[int, *geo.Province]
+	district *dataloadgen.Loader[int, *geo.District]
+	city     *dataloadgen.Loader[int, *geo.City]
+}
+
+type loadersKey struct{}
+
+func newLoaders() *loaders {
+	wait := dataloadgen.WithWait(time.Millisecond)
+	return &loaders{
+		province: dataloadgen.NewMappedLoader(fetchProvinces, wait),
+		district: dataloadgen.NewMappedLoader(fetchDistricts, wait),
+		city:     dataloadgen.NewMappedLoader(fetchCities, wait),
+	}
+}
+
+// withLoaders returns a copy of ctx carrying a fresh set of loaders
+func withLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, loadersKey{}, newLoaders())
+}
+
+// loadersFromContext returns the loaders stored by withLoaders
+func loadersFromContext(ctx context.Context) *loaders {
+	if l, ok := ctx.Value(loadersKey{}).(*loaders); ok {
+		return l
+	}
+	return newLoaders()
+}
+
+// loadOptional loads a value by ID, returning nil for unknown IDs
+func loadOptional[T any](ctx context.Context, loader *dataloadgen.Loader[int, *T], id *int) (*T, error) {
+	if id == nil {
+		return nil, nil
+	}
+	v, err := loader.Load(ctx, *id)
+	if errors.Is(err, dataloadgen.ErrNotFound) {
+		return nil, nil
+	}
+	return v, err
+}
+
+func fetchProvinces(ctx context.Context, ids []int) (map[int]*geo.Province, error) {
+	resp, err := geo.Lookup(ctx, &geo.LookupParams{ProvinceIDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[int]*geo.Province, len(resp.Provinces))
+	for _, p := range resp.Provinces {
+		found[p.ID] = p
+	}
+	return found, nil
+}
+
+func fetchDistricts(ctx context.Context, ids []int) (map[int]*geo.District, error) {
+	resp, err := geo.Lookup(ctx, &geo.LookupParams{DistrictIDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[int]*geo.District, len(resp.Districts))
+	for _, d := range resp.Districts {
+		found[d.ID] = d
+	}
+	return found, nil
+}
+
+func fetchCities(ctx context.Context, ids []int) (map[int]*geo.City, error) {
+	resp, err := geo.Lookup(ctx, &geo.LookupParams{CityIDs: ids})
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[int]*geo.City, len(resp.Cities))
+	for _, c := range resp.Cities {
+		found[c.ID] = c
+	}
+	return found, nil
+}
@@ -9,38 +9,127 @@ import (
 	"strconv"
 
 	"encore.app/admin"
+	"encore.app/authz"
 )
 
+type APIKeyInput struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt *string  `json:"expires_at,omitempty"`
+}
+
+type AssignedWorkout struct {
+	ID           string           `json:"id"`
+	TraineeID    string           `json:"traineeId"`
+	Workout      *Workout         `json:"workout"`
+	AssignedByID *string          `json:"assignedById,omitempty"`
+	AssignedAt   string           `json:"assignedAt"`
+	DueDate      *string          `json:"dueDate,omitempty"`
+	Completed    bool             `json:"completed"`
+	CompletedAt  *string          `json:"completedAt,omitempty"`
+	Status       AssignmentStatus `json:"status"`
+}
+
+type AuditFilter struct {
+	ActorID    *int    `json:"actor_id,omitempty"`
+	Action     *string `json:"action,omitempty"`
+	EntityType *string `json:"entity_type,omitempty"`
+	EntityID   *string `json:"entity_id,omitempty"`
+	RequestID  *string `json:"request_id,omitempty"`
+	From       *string `json:"from,omitempty"`
+	To         *string `json:"to,omitempty"`
+}
+
 type BodyFatEntry struct {
 	Date  string  `json:"date"`
 	Value float64 `json:"value"`
 }
 
-type City struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
-}
-
 type CompletedWorkout struct {
-	ID       string   `json:"id"`
-	Workout  *Workout `json:"workout"`
-	Date     string   `json:"date"`
-	Duration int      `json:"duration"`
-	Notes    *string  `json:"notes,omitempty"`
-	Rating   *int     `json:"rating,omitempty"`
+	ID        string         `json:"id"`
+	Workout   *Workout       `json:"workout"`
+	Date      string         `json:"date"`
+	StartTime string         `json:"startTime"`
+	EndTime   *string        `json:"endTime,omitempty"`
+	Duration  int            `json:"duration"`
+	Notes     *string        `json:"notes,omitempty"`
+	Rating    *int           `json:"rating,omitempty"`
+	Exercises []*ExerciseLog `json:"exercises"`
 }
 
-type District struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+type Exercise struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	MuscleGroup *string  `json:"muscleGroup,omitempty"`
+	Equipment   *string  `json:"equipment,omitempty"`
+	VideoURL    *string  `json:"videoUrl,omitempty"`
+	Aliases     []string `json:"aliases"`
+	IsCustom    bool     `json:"isCustom"`
 }
 
-type Exercise struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
+type ExerciseFilter struct {
+	Search      *string `json:"search,omitempty"`
 	MuscleGroup *string `json:"muscleGroup,omitempty"`
 	Equipment   *string `json:"equipment,omitempty"`
+	CustomOnly  *bool   `json:"customOnly,omitempty"`
+}
+
+type ExerciseImport struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+type ExerciseInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	MuscleGroup *string  `json:"muscleGroup,omitempty"`
+	Equipment   *string  `json:"equipment,omitempty"`
+	VideoURL    *string  `json:"videoUrl,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+type ExerciseLog struct {
+	ID                string           `json:"id"`
+	Exercise          *Exercise        `json:"exercise"`
+	WorkoutExerciseID *string          `json:"workoutExerciseId,omitempty"`
+	Notes             *string          `json:"notes,omitempty"`
+	Sets              []*SetLog        `json:"sets"`
+	Planned           *PlannedExercise `json:"planned,omitempty"`
+	SetsCompleted     int              `json:"setsCompleted"`
+	RepsCompleted     int              `json:"repsCompleted"`
+	DurationSeconds   int              `json:"durationSeconds"`
+	MaxWeight         *float64         `json:"maxWeight,omitempty"`
+	Result            ExerciseResult   `json:"result"`
+}
+
+type ExerciseLogInput struct {
+	WorkoutExerciseID *string        `json:"workoutExerciseId,omitempty"`
+	ExerciseID        *string        `json:"exerciseId,omitempty"`
+	Notes             *string        `json:"notes,omitempty"`
+	Sets              []*SetLogInput `json:"sets"`
+}
+
+type ExercisePage struct {
+	Exercises []*Exercise `json:"exercises"`
+	Total     int         `json:"total"`
+	Page      int         `json:"page"`
+	PageSize  int         `json:"page_size"`
+}
+
+type ExerciseUpdateInput struct {
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	MuscleGroup *string  `json:"muscleGroup,omitempty"`
+	Equipment   *string  `json:"equipment,omitempty"`
+	VideoURL    *string  `json:"videoUrl,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+type LocationInput struct {
+	ProvinceID *int `json:"province_id,omitempty"`
+	DistrictID *int `json:"district_id,omitempty"`
+	CityID     *int `json:"city_id,omitempty"`
 }
 
 type Macros struct {
@@ -122,6 +211,12 @@ type NutritionLogInput struct {
 	Notes       *string `json:"notes,omitempty"`
 }
 
+type PlannedExercise struct {
+	Sets            *int `json:"sets,omitempty"`
+	Reps            *int `json:"reps,omitempty"`
+	DurationSeconds *int `json:"durationSeconds,omitempty"`
+}
+
 type ProgressMetrics struct {
 	Weight   []*WeightEntry   `json:"weight"`
 	BodyFat  []*BodyFatEntry  `json:"bodyFat"`
@@ -129,19 +224,46 @@ type ProgressMetrics struct {
 }
 
 type ProgressPhoto struct {
-	ID    string     `json:"id"`
-	URL   string     `json:"url"`
-	Date  string     `json:"date"`
-	Notes *string    `json:"notes,omitempty"`
-	Angle PhotoAngle `json:"angle"`
+	ID    string      `json:"id"`
+	URL   string      `json:"url"`
+	Date  string      `json:"date"`
+	Notes *string     `json:"notes,omitempty"`
+	Angle *PhotoAngle `json:"angle,omitempty"`
 }
 
-type Province struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+type Query struct {
 }
 
-type Query struct {
+type SetLog struct {
+	SetNumber       int      `json:"setNumber"`
+	Reps            *int     `json:"reps,omitempty"`
+	Weight          *float64 `json:"weight,omitempty"`
+	DurationSeconds *int     `json:"durationSeconds,omitempty"`
+	Rpe             *float64 `json:"rpe,omitempty"`
+	Skipped         bool     `json:"skipped"`
+	TargetReps      *int     `json:"targetReps,omitempty"`
+}
+
+type SetLogInput struct {
+	Reps            *int     `json:"reps,omitempty"`
+	Weight          *float64 `json:"weight,omitempty"`
+	DurationSeconds *int     `json:"durationSeconds,omitempty"`
+	Rpe             *float64 `json:"rpe,omitempty"`
+	Skipped         bool     `json:"skipped"`
+}
+
+type SetTarget struct {
+	Reps         *int     `json:"reps,omitempty"`
+	Rpe          *float64 `json:"rpe,omitempty"`
+	Tempo        *string  `json:"tempo,omitempty"`
+	PercentOneRm *float64 `json:"percentOneRm,omitempty"`
+}
+
+type SetTargetInput struct {
+	Reps         *int     `json:"reps,omitempty"`
+	Rpe          *float64 `json:"rpe,omitempty"`
+	Tempo        *string  `json:"tempo,omitempty"`
+	PercentOneRm *float64 `json:"percentOneRm,omitempty"`
 }
 
 type StrengthEntry struct {
@@ -151,23 +273,27 @@ type StrengthEntry struct {
 }
 
 type Trainee struct {
-	ID           string      `json:"id"`
-	User         *admin.User `json:"user"`
-	Age          int         `json:"age"`
-	Height       float64     `json:"height"`
-	Weight       float64     `json:"weight"`
-	FitnessGoals []string    `json:"fitnessGoals"`
-	Injuries     []string    `json:"injuries"`
-	Preferences  []string    `json:"preferences"`
+	ID                string           `json:"id"`
+	User              *admin.User      `json:"user"`
+	Age               *int             `json:"age,omitempty"`
+	Height            *float64         `json:"height,omitempty"`
+	Weight            *float64         `json:"weight,omitempty"`
+	FitnessLevel      *DifficultyLevel `json:"fitnessLevel,omitempty"`
+	MedicalConditions *string          `json:"medicalConditions,omitempty"`
+	FitnessGoals      []string         `json:"fitnessGoals"`
+	Injuries          []string         `json:"injuries"`
+	Preferences       []string         `json:"preferences"`
 }
 
 type TraineeInput struct {
-	Age          *int     `json:"age,omitempty"`
-	Height       *float64 `json:"height,omitempty"`
-	Weight       *float64 `json:"weight,omitempty"`
-	FitnessGoals []string `json:"fitnessGoals,omitempty"`
-	Injuries     []string `json:"injuries,omitempty"`
-	Preferences  []string `json:"preferences,omitempty"`
+	Age               *int             `json:"age,omitempty"`
+	Height            *float64         `json:"height,omitempty"`
+	Weight            *float64         `json:"weight,omitempty"`
+	FitnessLevel      *DifficultyLevel `json:"fitnessLevel,omitempty"`
+	MedicalConditions *string          `json:"medicalConditions,omitempty"`
+	FitnessGoals      []string         `json:"fitnessGoals,omitempty"`
+	Injuries          []string         `json:"injuries,omitempty"`
+	Preferences       []string         `json:"preferences,omitempty"`
 }
 
 type Trainer struct {
@@ -178,6 +304,22 @@ type Trainer struct {
 	Rating            *float64    `json:"rating,omitempty"`
 }
 
+type UpdateProfileInput struct {
+	Fullname   *string        `json:"fullname,omitempty"`
+	Address    *string        `json:"address,omitempty"`
+	PostalCode *string        `json:"postal_code,omitempty"`
+	Location   *LocationInput `json:"location,omitempty"`
+}
+
+type UserFilter struct {
+	Search        *string           `json:"search,omitempty"`
+	Role          *authz.Role       `json:"role,omitempty"`
+	CreatedAfter  *string           `json:"created_after,omitempty"`
+	CreatedBefore *string           `json:"created_before,omitempty"`
+	Verified      *bool             `json:"verified,omitempty"`
+	Status        *admin.UserStatus `json:"status,omitempty"`
+}
+
 type UserRegisterRequest struct {
 	Username   string  `json:"username"`
 	Email      string  `json:"email"`
@@ -187,6 +329,7 @@ type UserRegisterRequest struct {
 	ProvinceID *int    `json:"province_id,omitempty"`
 	CityID     *int    `json:"city_id,omitempty"`
 	DistrictID *int    `json:"district_id,omitempty"`
+	DeviceName *string `json:"device_name,omitempty"`
 }
 
 type WeightEntry struct {
@@ -195,20 +338,213 @@ type WeightEntry struct {
 }
 
 type Workout struct {
-	ID          string          `json:"id"`
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	Exercises   []*Exercise     `json:"exercises"`
-	Duration    int             `json:"duration"`
-	Difficulty  DifficultyLevel `json:"difficulty"`
-	CreatedBy   *Trainer        `json:"createdBy,omitempty"`
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Exercises   []*WorkoutExercise `json:"exercises"`
+	Blocks      []*WorkoutBlock    `json:"blocks"`
+	Duration    *int               `json:"duration,omitempty"`
+	Difficulty  *DifficultyLevel   `json:"difficulty,omitempty"`
+	IsPublic    bool               `json:"isPublic"`
+	CreatedBy   *Trainer           `json:"createdBy,omitempty"`
+}
+
+type WorkoutBlock struct {
+	ID               string             `json:"id"`
+	Type             BlockType          `json:"type"`
+	Name             *string            `json:"name,omitempty"`
+	Rounds           *int               `json:"rounds,omitempty"`
+	WorkSeconds      *int               `json:"workSeconds,omitempty"`
+	RestSeconds      *int               `json:"restSeconds,omitempty"`
+	RoundRestSeconds *int               `json:"roundRestSeconds,omitempty"`
+	Notes            *string            `json:"notes,omitempty"`
+	Exercises        []*WorkoutExercise `json:"exercises"`
+}
+
+type WorkoutBlockInput struct {
+	Type             BlockType `json:"type"`
+	Name             *string   `json:"name,omitempty"`
+	Rounds           *int      `json:"rounds,omitempty"`
+	WorkSeconds      *int      `json:"workSeconds,omitempty"`
+	RestSeconds      *int      `json:"restSeconds,omitempty"`
+	RoundRestSeconds *int      `json:"roundRestSeconds,omitempty"`
+	Notes            *string   `json:"notes,omitempty"`
+}
+
+type WorkoutExercise struct {
+	ID              string       `json:"id"`
+	Position        int          `json:"position"`
+	Exercise        *Exercise    `json:"exercise"`
+	Sets            *int         `json:"sets,omitempty"`
+	Reps            *int         `json:"reps,omitempty"`
+	DurationSeconds *int         `json:"durationSeconds,omitempty"`
+	Notes           *string      `json:"notes,omitempty"`
+	SetTargets      []*SetTarget `json:"setTargets"`
+	RepScheme       *string      `json:"repScheme,omitempty"`
+	BlockID         *string      `json:"blockId,omitempty"`
+}
+
+type WorkoutExerciseInput struct {
+	ExerciseID      string            `json:"exerciseId"`
+	Sets            *int              `json:"sets,omitempty"`
+	Reps            *int              `json:"reps,omitempty"`
+	DurationSeconds *int              `json:"durationSeconds,omitempty"`
+	Notes           *string           `json:"notes,omitempty"`
+	SetTargets      []*SetTargetInput `json:"setTargets,omitempty"`
 }
 
 type WorkoutLogInput struct {
-	WorkoutID string  `json:"workoutId"`
-	Duration  int     `json:"duration"`
-	Notes     *string `json:"notes,omitempty"`
-	Rating    *int    `json:"rating,omitempty"`
+	WorkoutID         string              `json:"workoutId"`
+	AssignedWorkoutID *string             `json:"assignedWorkoutId,omitempty"`
+	StartTime         *string             `json:"startTime,omitempty"`
+	EndTime           *string             `json:"endTime,omitempty"`
+	Duration          *int                `json:"duration,omitempty"`
+	Notes             *string             `json:"notes,omitempty"`
+	Rating            *int                `json:"rating,omitempty"`
+	Exercises         []*ExerciseLogInput `json:"exercises,omitempty"`
+}
+
+type WorkoutTemplateBlockInput struct {
+	Block             *WorkoutBlockInput `json:"block"`
+	ExercisePositions []int              `json:"exercisePositions"`
+}
+
+type WorkoutTemplateInput struct {
+	Name        string                       `json:"name"`
+	Description string                       `json:"description"`
+	Duration    *int                         `json:"duration,omitempty"`
+	Difficulty  *DifficultyLevel             `json:"difficulty,omitempty"`
+	IsPublic    bool                         `json:"isPublic"`
+	Exercises   []*WorkoutExerciseInput      `json:"exercises"`
+	Blocks      []*WorkoutTemplateBlockInput `json:"blocks,omitempty"`
+}
+
+type WorkoutTemplateUpdateInput struct {
+	Name            *string          `json:"name,omitempty"`
+	Description     *string          `json:"description,omitempty"`
+	Duration        *int             `json:"duration,omitempty"`
+	Difficulty      *DifficultyLevel `json:"difficulty,omitempty"`
+	IsPublic        *bool            `json:"isPublic,omitempty"`
+	ClearDuration   *bool            `json:"clearDuration,omitempty"`
+	ClearDifficulty *bool            `json:"clearDifficulty,omitempty"`
+}
+
+type AssignmentStatus string
+
+const (
+	AssignmentStatusUpcoming  AssignmentStatus = "UPCOMING"
+	AssignmentStatusOverdue   AssignmentStatus = "OVERDUE"
+	AssignmentStatusCompleted AssignmentStatus = "COMPLETED"
+)
+
+var AllAssignmentStatus = []AssignmentStatus{
+	AssignmentStatusUpcoming,
+	AssignmentStatusOverdue,
+	AssignmentStatusCompleted,
+}
+
+func (e AssignmentStatus) IsValid() bool {
+	switch e {
+	case AssignmentStatusUpcoming, AssignmentStatusOverdue, AssignmentStatusCompleted:
+		return true
+	}
+	return false
+}
+
+func (e AssignmentStatus) String() string {
+	return string(e)
+}
+
+func (e *AssignmentStatus) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AssignmentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AssignmentStatus", str)
+	}
+	return nil
+}
+
+func (e AssignmentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *AssignmentStatus) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e AssignmentStatus) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type BlockType string
+
+const (
+	BlockTypeSuperset BlockType = "SUPERSET"
+	BlockTypeCircuit  BlockType = "CIRCUIT"
+	BlockTypeEmom     BlockType = "EMOM"
+	BlockTypeAmrap    BlockType = "AMRAP"
+	BlockTypeTabata   BlockType = "TABATA"
+)
+
+var AllBlockType = []BlockType{
+	BlockTypeSuperset,
+	BlockTypeCircuit,
+	BlockTypeEmom,
+	BlockTypeAmrap,
+	BlockTypeTabata,
+}
+
+func (e BlockType) IsValid() bool {
+	switch e {
+	case BlockTypeSuperset, BlockTypeCircuit, BlockTypeEmom, BlockTypeAmrap, BlockTypeTabata:
+		return true
+	}
+	return false
+}
+
+func (e BlockType) String() string {
+	return string(e)
+}
+
+func (e *BlockType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = BlockType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid BlockType", str)
+	}
+	return nil
+}
+
+func (e BlockType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *BlockType) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e BlockType) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
 }
 
 type DifficultyLevel string
@@ -268,6 +604,65 @@ func (e DifficultyLevel) MarshalJSON() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+type ExerciseResult string
+
+const (
+	ExerciseResultCompleted ExerciseResult = "COMPLETED"
+	ExerciseResultPartial   ExerciseResult = "PARTIAL"
+	ExerciseResultSkipped   ExerciseResult = "SKIPPED"
+	ExerciseResultExtra     ExerciseResult = "EXTRA"
+)
+
+var AllExerciseResult = []ExerciseResult{
+	ExerciseResultCompleted,
+	ExerciseResultPartial,
+	ExerciseResultSkipped,
+	ExerciseResultExtra,
+}
+
+func (e ExerciseResult) IsValid() bool {
+	switch e {
+	case ExerciseResultCompleted, ExerciseResultPartial, ExerciseResultSkipped, ExerciseResultExtra:
+		return true
+	}
+	return false
+}
+
+func (e ExerciseResult) String() string {
+	return string(e)
+}
+
+func (e *ExerciseResult) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ExerciseResult(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ExerciseResult", str)
+	}
+	return nil
+}
+
+func (e ExerciseResult) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ExerciseResult) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ExerciseResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
 type MealType string
 
 const (
@@ -0,0 +1,88 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
+import (
+	"context"
+	"time"
+
+	"encore.app/graphql/generated"
+	"encore.app/privacy"
+)
+
+// RequestedAt is the resolver for the requested_at field.
+func (r *accountDeletionResolver) RequestedAt(ctx context.Context, obj *privacy.AccountDeletion) (string, error) {
+	return obj.RequestedAt.Format(time.RFC3339), nil
+}
+
+// ScheduledFor is the resolver for the scheduled_for field.
+func (r *accountDeletionResolver) ScheduledFor(ctx context.Context, obj *privacy.AccountDeletion) (string, error) {
+	return obj.ScheduledFor.Format(time.RFC3339), nil
+}
+
+// RequestedAt is the resolver for the requested_at field.
+func (r *dataExportResolver) RequestedAt(ctx context.Context, obj *privacy.DataExport) (string, error) {
+	return obj.RequestedAt.Format(time.RFC3339), nil
+}
+
+// CompletedAt is the resolver for the completed_at field.
+func (r *dataExportResolver) CompletedAt(ctx context.Context, obj *privacy.DataExport) (*string, error) {
+	if obj == nil || obj.CompletedAt == nil {
+		return nil, nil
+	}
+	formatted := obj.CompletedAt.Format(time.RFC3339)
+	return &formatted, nil
+}
+
+// ExpiresAt is the resolver for the expires_at field.
+func (r *dataExportResolver) ExpiresAt(ctx context.Context, obj *privacy.DataExport) (*string, error) {
+	if obj == nil || obj.ExpiresAt == nil {
+		return nil, nil
+	}
+	formatted := obj.ExpiresAt.Format(time.RFC3339)
+	return &formatted, nil
+}
+
+// RequestDataExport is the resolver for the requestDataExport field.
+func (r *mutationResolver) RequestDataExport(ctx context.Context) (*privacy.DataExport, error) {
+	// Call the privacy service
+	return privacy.RequestDataExport(ctx)
+}
+
+// DeleteMyAccount is the resolver for the deleteMyAccount field.
+func (r *mutationResolver) DeleteMyAccount(ctx context.Context, password string) (*privacy.AccountDeletion, error) {
+	// Call the privacy service
+	return privacy.DeleteMyAccount(ctx, &privacy.DeleteAccountParams{Password: password})
+}
+
+// CancelAccountDeletion is the resolver for the cancelAccountDeletion field.
+func (r *mutationResolver) CancelAccountDeletion(ctx context.Context) (bool, error) {
+	// Call the privacy service
+	if err := privacy.CancelAccountDeletion(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MyDataExports is the resolver for the myDataExports field.
+func (r *queryResolver) MyDataExports(ctx context.Context) ([]*privacy.DataExport, error) {
+	// Call the privacy service
+	resp, err := privacy.MyDataExports(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Exports, nil
+}
+
+// AccountDeletion returns generated.AccountDeletionResolver implementation.
+func (r *Resolver) AccountDeletion() generated.AccountDeletionResolver {
+	return &accountDeletionResolver{r}
+}
+
+// DataExport returns generated.DataExportResolver implementation.
+func (r *Resolver) DataExport() generated.DataExportResolver { return &dataExportResolver{r} }
+
+type accountDeletionResolver struct{ *Resolver }
+type dataExportResolver struct{ *Resolver }
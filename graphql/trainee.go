@@ -0,0 +1,482 @@
+package graphql
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.app/admin"
+	"encore.app/graphql/model"
+	"encore.app/trainee"
+)
+
+// traineeUser converts the trainee service's copy of a user. Only the public
+// fields are known there, so the email is left out.
+func traineeUser(u *trainee.User) *admin.User {
+	if u == nil {
+		return nil
+	}
+	return &admin.User{
+		ID:        u.ID,
+		Username:  u.Username,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+func traineeModel(t *trainee.Trainee) *model.Trainee {
+	m := &model.Trainee{
+		ID:                strconv.Itoa(t.UserID),
+		User:              traineeUser(t.User),
+		Age:               t.Age,
+		Height:            t.HeightCm,
+		Weight:            t.WeightKg,
+		FitnessLevel:      difficultyModel(t.FitnessLevel),
+		MedicalConditions: t.MedicalConditions,
+		FitnessGoals:      nonNil(t.Goals),
+		Injuries:          nonNil(t.Injuries),
+		Preferences:       nonNil(t.Preferences),
+	}
+	if m.User == nil {
+		m.User = &admin.User{ID: t.UserID}
+	}
+	return m
+}
+
+func difficultyModel(l *trainee.FitnessLevel) *model.DifficultyLevel {
+	if l == nil {
+		return nil
+	}
+	d := model.DifficultyLevel(*l)
+	return &d
+}
+
+// authorModel returns the trainer who wrote something, of whom only the ID is known
+func authorModel(userID *int) *model.Trainer {
+	if userID == nil {
+		return nil
+	}
+	return &model.Trainer{
+		ID:             strconv.Itoa(*userID),
+		User:           &admin.User{ID: *userID},
+		Specialization: []string{},
+	}
+}
+
+func workoutModel(w *trainee.Workout) *model.Workout {
+	m := &model.Workout{
+		ID:          strconv.Itoa(w.ID),
+		Name:        w.Name,
+		Description: w.Description,
+		Exercises:   make([]*model.WorkoutExercise, len(w.Exercises)),
+		Blocks:      make([]*model.WorkoutBlock, len(w.Blocks)),
+		Duration:    w.DurationMinutes,
+		Difficulty:  difficultyModel(w.Difficulty),
+		IsPublic:    w.IsPublic,
+		CreatedBy:   authorModel(w.TrainerID),
+	}
+	byID := make(map[int]*model.WorkoutExercise, len(w.Exercises))
+	for i, e := range w.Exercises {
+		m.Exercises[i] = workoutExerciseModel(e)
+		byID[e.ID] = m.Exercises[i]
+	}
+	for i, b := range w.Blocks {
+		m.Blocks[i] = &model.WorkoutBlock{
+			ID:               strconv.Itoa(b.ID),
+			Type:             model.BlockType(b.Type),
+			Name:             b.Name,
+			Rounds:           b.Rounds,
+			WorkSeconds:      b.WorkSeconds,
+			RestSeconds:      b.RestSeconds,
+			RoundRestSeconds: b.RoundRestSeconds,
+			Notes:            b.Notes,
+			Exercises:        make([]*model.WorkoutExercise, len(b.ExerciseIDs)),
+		}
+		for j, id := range b.ExerciseIDs {
+			m.Blocks[i].Exercises[j] = byID[id]
+		}
+	}
+	return m
+}
+
+func workoutExerciseModel(e *trainee.WorkoutExercise) *model.WorkoutExercise {
+	m := &model.WorkoutExercise{
+		ID:              strconv.Itoa(e.ID),
+		Position:        e.Position,
+		Exercise:        exerciseModel(e.Exercise),
+		Sets:            e.Sets,
+		Reps:            e.Reps,
+		DurationSeconds: e.DurationSeconds,
+		Notes:           e.Notes,
+		SetTargets:      make([]*model.SetTarget, len(e.SetTargets)),
+	}
+	if e.BlockID != nil {
+		id := strconv.Itoa(*e.BlockID)
+		m.BlockID = &id
+	}
+
+	reps := make([]string, 0, len(e.SetTargets))
+	for i, t := range e.SetTargets {
+		m.SetTargets[i] = &model.SetTarget{
+			Reps:         t.Reps,
+			Rpe:          t.RPE,
+			Tempo:        t.Tempo,
+			PercentOneRm: t.PercentOneRM,
+		}
+		if t.Reps != nil {
+			reps = append(reps, strconv.Itoa(*t.Reps))
+		}
+	}
+	if len(reps) > 0 && len(reps) == len(e.SetTargets) {
+		scheme := strings.Join(reps, "/")
+		m.RepScheme = &scheme
+	}
+	return m
+}
+
+func exerciseModel(e *trainee.Exercise) *model.Exercise {
+	return &model.Exercise{
+		ID:          strconv.Itoa(e.ID),
+		Name:        e.Name,
+		Description: e.Description,
+		MuscleGroup: e.MuscleGroup,
+		Equipment:   e.Equipment,
+		VideoURL:    e.VideoURL,
+		Aliases:     nonNil(e.Aliases),
+		IsCustom:    e.OwnerID != nil,
+	}
+}
+
+// exerciseParams converts the GraphQL input for an exercise
+func exerciseParams(input *model.ExerciseInput) *trainee.ExerciseParams {
+	return &trainee.ExerciseParams{
+		Name:        input.Name,
+		Description: input.Description,
+		MuscleGroup: input.MuscleGroup,
+		Equipment:   input.Equipment,
+		VideoURL:    input.VideoURL,
+		Aliases:     input.Aliases,
+	}
+}
+
+func workoutModels(workouts []*trainee.Workout) []*model.Workout {
+	list := make([]*model.Workout, len(workouts))
+	for i, w := range workouts {
+		list[i] = workoutModel(w)
+	}
+	return list
+}
+
+// workoutExerciseParams converts the GraphQL input for an exercise of a workout template
+func workoutExerciseParams(input *model.WorkoutExerciseInput) (*trainee.WorkoutExerciseParams, error) {
+	exerciseID, err := parseIDInput("exerciseId", input.ExerciseID)
+	if err != nil {
+		return nil, err
+	}
+	params := &trainee.WorkoutExerciseParams{
+		ExerciseID:      exerciseID,
+		Sets:            input.Sets,
+		Reps:            input.Reps,
+		DurationSeconds: input.DurationSeconds,
+		Notes:           input.Notes,
+	}
+	for _, t := range input.SetTargets {
+		params.SetTargets = append(params.SetTargets, &trainee.SetTarget{
+			Reps:         t.Reps,
+			RPE:          t.Rpe,
+			Tempo:        t.Tempo,
+			PercentOneRM: t.PercentOneRm,
+		})
+	}
+	return params, nil
+}
+
+// workoutBlockParams converts the GraphQL input for a block of a workout
+// template, together with the exercises in it
+func workoutBlockParams(input *model.WorkoutBlockInput, exercises []int) *trainee.WorkoutBlockParams {
+	return &trainee.WorkoutBlockParams{
+		Type:             trainee.BlockType(input.Type),
+		Name:             input.Name,
+		Rounds:           input.Rounds,
+		WorkSeconds:      input.WorkSeconds,
+		RestSeconds:      input.RestSeconds,
+		RoundRestSeconds: input.RoundRestSeconds,
+		Notes:            input.Notes,
+		Exercises:        exercises,
+	}
+}
+
+// fitnessLevelParam converts an optional difficulty argument
+func fitnessLevelParam(d *model.DifficultyLevel) *trainee.FitnessLevel {
+	if d == nil {
+		return nil
+	}
+	l := trainee.FitnessLevel(*d)
+	return &l
+}
+
+func assignmentModel(a *trainee.Assignment) *model.AssignedWorkout {
+	m := &model.AssignedWorkout{
+		ID:          strconv.Itoa(a.ID),
+		TraineeID:   strconv.Itoa(a.TraineeID),
+		Workout:     workoutModel(a.Workout),
+		AssignedAt:  a.AssignedAt.Format(time.RFC3339),
+		DueDate:     optionalTime(a.DueDate),
+		Completed:   a.Completed,
+		CompletedAt: optionalTime(a.CompletedAt),
+		Status:      model.AssignmentStatus(a.Status),
+	}
+	if a.AssignedBy != nil {
+		id := strconv.Itoa(*a.AssignedBy)
+		m.AssignedByID = &id
+	}
+	return m
+}
+
+func assignmentModels(assignments []*trainee.Assignment) []*model.AssignedWorkout {
+	list := make([]*model.AssignedWorkout, len(assignments))
+	for i, a := range assignments {
+		list[i] = assignmentModel(a)
+	}
+	return list
+}
+
+func completedWorkoutModel(c *trainee.CompletedWorkout) *model.CompletedWorkout {
+	m := &model.CompletedWorkout{
+		ID:        strconv.Itoa(c.ID),
+		Workout:   workoutModel(c.Workout),
+		Date:      c.StartTime.Format(time.RFC3339),
+		StartTime: c.StartTime.Format(time.RFC3339),
+		EndTime:   optionalTime(c.EndTime),
+		Notes:     c.Notes,
+		Rating:    c.Rating,
+		Exercises: make([]*model.ExerciseLog, len(c.Exercises)),
+	}
+	if c.DurationMinutes != nil {
+		m.Duration = *c.DurationMinutes
+	}
+	for i, l := range c.Exercises {
+		m.Exercises[i] = exerciseLogModel(l)
+	}
+	return m
+}
+
+func exerciseLogModel(l *trainee.ExerciseLog) *model.ExerciseLog {
+	m := &model.ExerciseLog{
+		ID:              strconv.Itoa(l.ID),
+		Exercise:        exerciseModel(l.Exercise),
+		Notes:           l.Notes,
+		Sets:            make([]*model.SetLog, len(l.Sets)),
+		SetsCompleted:   l.SetsCompleted,
+		RepsCompleted:   l.RepsCompleted,
+		DurationSeconds: l.DurationSeconds,
+		MaxWeight:       l.MaxWeightKg,
+		Result:          model.ExerciseResult(l.Result),
+	}
+	if l.WorkoutExerciseID != nil {
+		id := strconv.Itoa(*l.WorkoutExerciseID)
+		m.WorkoutExerciseID = &id
+	}
+	if l.Planned != nil {
+		m.Planned = &model.PlannedExercise{
+			Sets:            l.Planned.Sets,
+			Reps:            l.Planned.Reps,
+			DurationSeconds: l.Planned.DurationSeconds,
+		}
+	}
+	for i, s := range l.Sets {
+		m.Sets[i] = &model.SetLog{
+			SetNumber:       s.SetNumber,
+			Reps:            s.Reps,
+			Weight:          s.WeightKg,
+			DurationSeconds: s.DurationSeconds,
+			Rpe:             s.RPE,
+			Skipped:         s.Skipped,
+			TargetReps:      s.TargetReps,
+		}
+	}
+	return m
+}
+
+// exerciseLogParams converts the GraphQL input for a logged exercise
+func exerciseLogParams(input *model.ExerciseLogInput) (*trainee.ExerciseLogParams, error) {
+	workoutExerciseID, err := parseOptionalIDInput("workoutExerciseId", input.WorkoutExerciseID)
+	if err != nil {
+		return nil, err
+	}
+	exerciseID, err := parseOptionalIDInput("exerciseId", input.ExerciseID)
+	if err != nil {
+		return nil, err
+	}
+	params := &trainee.ExerciseLogParams{
+		WorkoutExerciseID: workoutExerciseID,
+		ExerciseID:        exerciseID,
+		Notes:             input.Notes,
+		Sets:              make([]*trainee.SetLogParams, len(input.Sets)),
+	}
+	for i, s := range input.Sets {
+		params.Sets[i] = &trainee.SetLogParams{
+			Reps:            s.Reps,
+			WeightKg:        s.Weight,
+			DurationSeconds: s.DurationSeconds,
+			RPE:             s.Rpe,
+			Skipped:         s.Skipped,
+		}
+	}
+	return params, nil
+}
+
+func macrosModel(m trainee.Macros) *model.Macros {
+	return &model.Macros{
+		Protein: m.ProteinG,
+		Carbs:   m.CarbsG,
+		Fat:     m.FatG,
+	}
+}
+
+func macrosParams(m *model.MacrosInput) trainee.Macros {
+	return trainee.Macros{
+		ProteinG: m.Protein,
+		CarbsG:   m.Carbs,
+		FatG:     m.Fat,
+	}
+}
+
+func mealModel(m *trainee.Meal) *model.Meal {
+	return &model.Meal{
+		ID:           strconv.Itoa(m.ID),
+		Name:         m.Name,
+		Description:  m.Description,
+		Ingredients:  nonNil(m.Ingredients),
+		Instructions: m.Instructions,
+		Calories:     m.Calories,
+		Macros:       macrosModel(m.Macros),
+		MealType:     model.MealType(m.MealType),
+	}
+}
+
+func mealPlanModel(p *trainee.MealPlan) *model.MealPlan {
+	m := &model.MealPlan{
+		ID:          strconv.Itoa(p.ID),
+		Name:        p.Name,
+		Description: p.Description,
+		Meals:       make([]*model.Meal, len(p.Meals)),
+		Calories:    p.Calories,
+		Macros:      macrosModel(p.Macros),
+	}
+	for i, meal := range p.Meals {
+		m.Meals[i] = mealModel(meal)
+	}
+
+	// Custom plans are written by their owner rather than a trainer
+	if p.CreatedBy != nil && *p.CreatedBy != p.OwnerID {
+		m.CreatedBy = authorModel(p.CreatedBy)
+	}
+	return m
+}
+
+// mealPlanParams converts the GraphQL input of createCustomMealPlan
+func mealPlanParams(input model.MealPlanInput) *trainee.CreateMealPlanParams {
+	params := &trainee.CreateMealPlanParams{
+		Name:        input.Name,
+		Description: input.Description,
+		Meals:       make([]*trainee.MealParams, len(input.Meals)),
+		Calories:    input.Calories,
+		Macros:      macrosParams(input.Macros),
+	}
+	for i, m := range input.Meals {
+		params.Meals[i] = &trainee.MealParams{
+			Name:         m.Name,
+			Description:  m.Description,
+			Ingredients:  m.Ingredients,
+			Instructions: m.Instructions,
+			Calories:     m.Calories,
+			Macros:       macrosParams(m.Macros),
+			MealType:     trainee.MealType(m.MealType),
+		}
+	}
+	return params
+}
+
+func nutritionLogModel(l *trainee.NutritionLog) *model.NutritionLog {
+	return &model.NutritionLog{
+		ID:          strconv.Itoa(l.ID),
+		Meal:        mealModel(l.Meal),
+		Date:        l.Date,
+		Time:        l.Time,
+		PortionSize: l.PortionSize,
+		Notes:       l.Notes,
+	}
+}
+
+func progressPhotoModel(p *trainee.ProgressPhoto) *model.ProgressPhoto {
+	m := &model.ProgressPhoto{
+		ID:    strconv.Itoa(p.ID),
+		URL:   p.URL,
+		Date:  p.TakenAt.Format(time.RFC3339),
+		Notes: p.Notes,
+	}
+	if p.Angle != nil {
+		a := model.PhotoAngle(*p.Angle)
+		m.Angle = &a
+	}
+	return m
+}
+
+func progressMetricsModel(p *trainee.ProgressMetrics) *model.ProgressMetrics {
+	m := &model.ProgressMetrics{
+		Weight:   make([]*model.WeightEntry, len(p.Weight)),
+		BodyFat:  make([]*model.BodyFatEntry, len(p.BodyFat)),
+		Strength: make([]*model.StrengthEntry, len(p.Strength)),
+	}
+	for i, e := range p.Weight {
+		m.Weight[i] = &model.WeightEntry{Date: e.MeasuredAt.Format(time.RFC3339), Value: e.Value}
+	}
+	for i, e := range p.BodyFat {
+		m.BodyFat[i] = &model.BodyFatEntry{Date: e.MeasuredAt.Format(time.RFC3339), Value: e.Value}
+	}
+	for i, e := range p.Strength {
+		m.Strength[i] = &model.StrengthEntry{
+			ExerciseID: strconv.Itoa(e.ExerciseID),
+			Date:       e.Date,
+			MaxWeight:  e.MaxWeightKg,
+		}
+	}
+	return m
+}
+
+// trainerModel converts a trainer coaching the current user. The trainee
+// service keeps no coaching details, so those are left empty.
+func trainerModel(t *trainee.Trainer) *model.Trainer {
+	return &model.Trainer{
+		ID:             strconv.Itoa(t.User.ID),
+		User:           traineeUser(t.User),
+		Specialization: []string{},
+	}
+}
+
+func messageModel(m *trainee.Message) *model.Message {
+	return &model.Message{
+		ID:        strconv.Itoa(m.ID),
+		Sender:    traineeUser(m.Sender),
+		Content:   m.Content,
+		Timestamp: m.CreatedAt.Format(time.RFC3339),
+		IsRead:    m.IsRead,
+	}
+}
+
+// optionalList tells a list that was left out or null, which keeps the stored
+// value, apart from an empty list, which clears it
+func optionalList(list []string) *[]string {
+	if list == nil {
+		return nil
+	}
+	return &list
+}
+
+// nonNil returns an empty list instead of nil, for non-null GraphQL lists
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -1,387 +1,332 @@
 package graphql
 
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
 import (
 	"context"
-	"time"
+	"fmt"
+	"io"
 
 	"encore.app/graphql/generated"
 	"encore.app/graphql/model"
+	"encore.app/trainee"
 	"github.com/99designs/gqlgen/graphql"
-	"github.com/google/uuid"
 )
 
-// Profile Resolvers
-
 // UpdateProfile updates the trainee's profile
 func (r *mutationResolver) UpdateProfile(ctx context.Context, input model.TraineeInput) (*model.Trainee, error) {
-	// TODO: Get current user ID from context (from authentication)
-	userID := "1" // Replace with actual user ID from context
-
-	// TODO: Update the trainee profile in the database
-	// This is a simplified example - implement your actual database logic here
-	trainee := &model.Trainee{
-		ID:           userID,
-		Age:          *input.Age,
-		Height:       *input.Height,
-		Weight:       *input.Weight,
-		FitnessGoals: input.FitnessGoals,
-		Injuries:     input.Injuries,
-		Preferences:  input.Preferences,
-	}
-
-	return trainee, nil
-}
+	// Convert GraphQL input to service input
+	params := &trainee.UpdateMyProfileParams{
+		Age:               input.Age,
+		HeightCm:          input.Height,
+		WeightKg:          input.Weight,
+		MedicalConditions: input.MedicalConditions,
+		Goals:             optionalList(input.FitnessGoals),
+		Injuries:          optionalList(input.Injuries),
+		Preferences:       optionalList(input.Preferences),
+	}
+	if input.FitnessLevel != nil {
+		level := trainee.FitnessLevel(*input.FitnessLevel)
+		params.FitnessLevel = &level
+	}
 
-// Workout Resolvers
+	// Call the trainee service
+	t, err := trainee.UpdateMyProfile(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return traineeModel(t), nil
+}
 
 // LogWorkout logs a completed workout
 func (r *mutationResolver) LogWorkout(ctx context.Context, input model.WorkoutLogInput) (*model.CompletedWorkout, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Get workout details from database
-	workout := &model.Workout{
-		ID:          input.WorkoutID,
-		Name:        "Sample Workout", // Replace with actual workout name
-		Description: "Sample description",
-		Duration:    60,
-		Difficulty:  model.DifficultyLevelIntermediate,
+	// Convert GraphQL input to service input
+	workoutID, err := parseIDInput("workoutId", input.WorkoutID)
+	if err != nil {
+		return nil, err
 	}
-
-	completedWorkout := &model.CompletedWorkout{
-		ID:       uuid.NewString(),
-		Workout:  workout,
-		Date:     time.Now().Format(time.RFC3339),
-		Duration: input.Duration,
-		Notes:    input.Notes,
-		Rating:   input.Rating,
+	assignedWorkoutID, err := parseOptionalIDInput("assignedWorkoutId", input.AssignedWorkoutID)
+	if err != nil {
+		return nil, err
+	}
+	startTime, err := parseTimeInput("startTime", input.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	endTime, err := parseTimeInput("endTime", input.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	params := &trainee.LogMyWorkoutParams{
+		WorkoutID:         workoutID,
+		AssignedWorkoutID: assignedWorkoutID,
+		StartTime:         startTime,
+		EndTime:           endTime,
+		Notes:             input.Notes,
+		Rating:            input.Rating,
+	}
+	if input.Duration != nil {
+		params.DurationMinutes = *input.Duration
+	}
+	for _, e := range input.Exercises {
+		p, err := exerciseLogParams(e)
+		if err != nil {
+			return nil, err
+		}
+		params.Exercises = append(params.Exercises, p)
 	}
 
-	// TODO: Save to database
-
-	return completedWorkout, nil
+	// Call the trainee service
+	completed, err := trainee.LogMyWorkout(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return completedWorkoutModel(completed), nil
 }
 
-// Nutrition Resolvers
-
 // LogNutrition logs a nutrition entry
 func (r *mutationResolver) LogNutrition(ctx context.Context, input model.NutritionLogInput) (*model.NutritionLog, error) {
-	// TODO: Get meal details from database
-	meal := &model.Meal{
-		ID:          input.MealID,
-		Name:        "Sample Meal", // Replace with actual meal name
-		Description: "Sample description",
-		Calories:    500,
-		Macros: &model.Macros{
-			Protein: 30,
-			Carbs:   50,
-			Fat:     20,
-		},
-		MealType: model.MealTypeLunch,
-	}
-
-	nutritionLog := &model.NutritionLog{
-		ID:          uuid.NewString(),
-		Meal:        meal,
+	mealID, err := parseIDInput("mealId", input.MealID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	log, err := trainee.LogNutrition(ctx, &trainee.LogNutritionParams{
+		MealID:      mealID,
 		Date:        input.Date,
-		Time:        time.Now().Format("15:04:05"),
+		Time:        input.Time,
 		PortionSize: input.PortionSize,
 		Notes:       input.Notes,
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	// TODO: Save to database
-
-	return nutritionLog, nil
+	return nutritionLogModel(log), nil
 }
 
 // CreateCustomMealPlan creates a custom meal plan
 func (r *mutationResolver) CreateCustomMealPlan(ctx context.Context, input model.MealPlanInput) (*model.MealPlan, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// Convert input meals to model meals
-	var meals []*model.Meal
-	for _, mealInput := range input.Meals {
-		meals = append(meals, &model.Meal{
-			ID:           uuid.NewString(),
-			Name:         mealInput.Name,
-			Description:  mealInput.Description,
-			Ingredients:  mealInput.Ingredients,
-			Instructions: mealInput.Instructions,
-			Calories:     mealInput.Calories,
-			Macros: &model.Macros{
-				Protein: mealInput.Macros.Protein,
-				Carbs:   mealInput.Macros.Carbs,
-				Fat:     mealInput.Macros.Fat,
-			},
-			MealType: mealInput.MealType,
-		})
-	}
-
-	mealPlan := &model.MealPlan{
-		ID:          uuid.NewString(),
-		Name:        input.Name,
-		Description: input.Description,
-		Meals:       meals,
-		Calories:    input.Calories,
-		Macros: &model.Macros{
-			Protein: input.Macros.Protein,
-			Carbs:   input.Macros.Carbs,
-			Fat:     input.Macros.Fat,
-		},
-	}
-
-	// TODO: Save to database
-
-	return mealPlan, nil
+	// Call the trainee service
+	plan, err := trainee.CreateMealPlan(ctx, mealPlanParams(input))
+	if err != nil {
+		return nil, err
+	}
+	return mealPlanModel(plan), nil
 }
 
-// Progress Resolvers
-
 // UploadProgressPhoto handles file upload for progress photos
-func (r *mutationResolver) UploadProgressPhoto(ctx context.Context, image graphql.Upload) (*model.ProgressPhoto, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Upload the file to your storage (e.g., S3, local storage)
-	// This is a simplified example
-	fileURL := "https://example.com/uploads/" + image.Filename
-	note := "Uploaded photo"
-	progressPhoto := &model.ProgressPhoto{
-		ID:    uuid.NewString(),
-		URL:   fileURL,
-		Date:  time.Now().Format(time.RFC3339),
-		Notes: &note,
-		Angle: model.PhotoAngleFront, // Default angle
+func (r *mutationResolver) UploadProgressPhoto(ctx context.Context, image graphql.Upload, angle *model.PhotoAngle, notes *string) (*model.ProgressPhoto, error) {
+	// Read one byte past the limit so oversized photos are rejected without buffering them
+	data, err := io.ReadAll(io.LimitReader(image.File, trainee.MaxPhotoSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > trainee.MaxPhotoSize {
+		return nil, tooLong("image", fmt.Sprintf("photos must be at most %d MB", trainee.MaxPhotoSize>>20))
+	}
+	params := &trainee.UploadProgressPhotoParams{
+		Data:  data,
+		Notes: notes,
+	}
+	if angle != nil {
+		a := trainee.PhotoAngle(*angle)
+		params.Angle = &a
 	}
 
-	// TODO: Save to database
-
-	return progressPhoto, nil
+	// Call the trainee service
+	photo, err := trainee.UploadProgressPhoto(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return progressPhotoModel(photo), nil
 }
 
-// Trainer Interaction Resolvers
-
 // SendMessage sends a message to a trainer
 func (r *mutationResolver) SendMessage(ctx context.Context, trainerID string, content string) (*model.Message, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	message := &model.Message{
-		ID:        uuid.NewString(),
-		Content:   content,
-		Timestamp: time.Now().Format(time.RFC3339),
-		IsRead:    false,
+	id, err := parseIDInput("trainerId", trainerID)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO: Save to database and implement actual messaging logic
-
-	return message, nil
+	// Call the trainee service
+	message, err := trainee.SendMessage(ctx, id, &trainee.SendMessageParams{Content: content})
+	if err != nil {
+		return nil, err
+	}
+	return messageModel(message), nil
 }
 
 // RequestTrainer sends a trainer request
 func (r *mutationResolver) RequestTrainer(ctx context.Context, trainerID string) (bool, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Implement trainer request logic
-	// This could involve creating a request record in the database
-	// and possibly sending a notification to the trainer
+	id, err := parseIDInput("trainerId", trainerID)
+	if err != nil {
+		return false, err
+	}
 
-	return true, nil
+	// Call the trainee service
+	resp, err := trainee.RequestTrainer(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return resp.Requested, nil
 }
 
-// Query Resolvers
-
 // GetMyProfile returns the current trainee's profile
 func (r *queryResolver) GetMyProfile(ctx context.Context) (*model.Trainee, error) {
-	// TODO: Get current user ID from context
-	userID := "1" // Replace with actual user ID from context
-
-	// TODO: Fetch from database
-	return &model.Trainee{
-		ID:           userID,
-		Age:          25, // Example data
-		Height:       175.5,
-		Weight:       70.0,
-		FitnessGoals: []string{"Lose weight", "Build muscle"},
-		Injuries:     []string{"Knee pain"},
-		Preferences:  []string{"Yoga", "Weight lifting"},
-	}, nil
+	// Call the trainee service
+	t, err := trainee.GetMyProfile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return traineeModel(t), nil
 }
 
-// GetMyWorkouts returns the trainee's workouts
-func (r *queryResolver) GetMyWorkouts(ctx context.Context) ([]*model.Workout, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Fetch from database
-	return []*model.Workout{
-		{
-			ID:          "1",
-			Name:        "Morning Workout",
-			Description: "Full body workout",
-			Duration:    60,
-			Difficulty:  model.DifficultyLevelBeginner,
-		},
-	}, nil
+// GetMyWorkouts returns the workouts assigned to the trainee
+func (r *queryResolver) GetMyWorkouts(ctx context.Context, status *model.AssignmentStatus) ([]*model.AssignedWorkout, error) {
+	// Convert GraphQL input to service input
+	params := &trainee.MyWorkoutsParams{}
+	if status != nil {
+		params.Status = string(*status)
+	}
+
+	// Call the trainee service
+	resp, err := trainee.MyWorkouts(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return assignmentModels(resp.Assignments), nil
 }
 
 // GetWorkoutByID returns a specific workout by ID
 func (r *queryResolver) GetWorkoutByID(ctx context.Context, workoutID string) (*model.Workout, error) {
-	// TODO: Fetch from database
-	return &model.Workout{
-		ID:          workoutID,
-		Name:        "Sample Workout",
-		Description: "Sample description",
-		Duration:    60,
-		Difficulty:  model.DifficultyLevelIntermediate,
-	}, nil
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.GetWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
 }
 
 // GetWorkoutHistory returns the trainee's workout history
 func (r *queryResolver) GetWorkoutHistory(ctx context.Context) ([]*model.CompletedWorkout, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-	rating := 4
-	// TODO: Fetch from database
-	return []*model.CompletedWorkout{
-		{
-			ID:       "1",
-			Workout:  &model.Workout{ID: "1", Name: "Morning Workout"},
-			Date:     time.Now().Format(time.RFC3339),
-			Duration: 60,
-			Rating:   &rating,
-		},
-	}, nil
+	// Call the trainee service
+	resp, err := trainee.MyWorkoutHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]*model.CompletedWorkout, len(resp.Workouts))
+	for i, c := range resp.Workouts {
+		history[i] = completedWorkoutModel(c)
+	}
+	return history, nil
 }
 
 // GetMyMealPlans returns the trainee's meal plans
 func (r *queryResolver) GetMyMealPlans(ctx context.Context) ([]*model.MealPlan, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Fetch from database
-	return []*model.MealPlan{
-		{
-			ID:          "1",
-			Name:        "Weight Loss Plan",
-			Description: "7-day weight loss meal plan",
-			Calories:    1800,
-			Macros: &model.Macros{
-				Protein: 150,
-				Carbs:   200,
-				Fat:     50,
-			},
-		},
-	}, nil
+	// Call the trainee service
+	resp, err := trainee.MyMealPlans(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]*model.MealPlan, len(resp.MealPlans))
+	for i, p := range resp.MealPlans {
+		plans[i] = mealPlanModel(p)
+	}
+	return plans, nil
 }
 
 // GetMealPlanByID returns a specific meal plan by ID
 func (r *queryResolver) GetMealPlanByID(ctx context.Context, mealPlanID string) (*model.MealPlan, error) {
-	// TODO: Fetch from database
-	return &model.MealPlan{
-		ID:          mealPlanID,
-		Name:        "Sample Meal Plan",
-		Description: "Sample description",
-		Calories:    2000,
-		Macros: &model.Macros{
-			Protein: 150,
-			Carbs:   250,
-			Fat:     65,
-		},
-	}, nil
+	id, err := parseIDInput("mealPlanId", mealPlanID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	plan, err := trainee.GetMealPlan(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return mealPlanModel(plan), nil
 }
 
 // GetNutritionLogs returns nutrition logs for a specific date
 func (r *queryResolver) GetNutritionLogs(ctx context.Context, date string) ([]*model.NutritionLog, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Fetch from database
-	return []*model.NutritionLog{
-		{
-			ID:   "1",
-			Meal: &model.Meal{ID: "1", Name: "Sample Meal"},
-			Date: date,
-			Time: "12:00:00",
-		},
-	}, nil
+	// Call the trainee service
+	resp, err := trainee.MyNutritionLogs(ctx, &trainee.NutritionLogsParams{Date: date})
+	if err != nil {
+		return nil, err
+	}
+	logs := make([]*model.NutritionLog, len(resp.Logs))
+	for i, l := range resp.Logs {
+		logs[i] = nutritionLogModel(l)
+	}
+	return logs, nil
 }
 
 // GetProgressMetrics returns the trainee's progress metrics
 func (r *queryResolver) GetProgressMetrics(ctx context.Context) (*model.ProgressMetrics, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Fetch from database
-	return &model.ProgressMetrics{
-		Weight: []*model.WeightEntry{
-			{Date: time.Now().AddDate(0, 0, -7).Format(time.RFC3339), Value: 72.5},
-			{Date: time.Now().Format(time.RFC3339), Value: 71.8},
-		},
-		BodyFat: []*model.BodyFatEntry{
-			{Date: time.Now().Format(time.RFC3339), Value: 18.5},
-		},
-		Strength: []*model.StrengthEntry{
-			{ExerciseID: "1", Date: time.Now().Format(time.RFC3339), MaxWeight: 100},
-		},
-	}, nil
+	// Call the trainee service
+	metrics, err := trainee.MyProgressMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return progressMetricsModel(metrics), nil
 }
 
 // GetProgressPhotos returns the trainee's progress photos
 func (r *queryResolver) GetProgressPhotos(ctx context.Context) ([]*model.ProgressPhoto, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Fetch from database
-	return []*model.ProgressPhoto{
-		{
-			ID:    "1",
-			URL:   "https://example.com/photos/1.jpg",
-			Date:  time.Now().Format(time.RFC3339),
-			Angle: model.PhotoAngleFront,
-		},
-	}, nil
+	// Call the trainee service
+	resp, err := trainee.MyProgressPhotos(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*model.ProgressPhoto, len(resp.Photos))
+	for i, p := range resp.Photos {
+		list[i] = progressPhotoModel(p)
+	}
+	return list, nil
 }
 
 // GetMyTrainers returns the trainee's assigned trainers
 func (r *queryResolver) GetMyTrainers(ctx context.Context) ([]*model.Trainer, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Fetch from database
-	rating := 4.8
-	return []*model.Trainer{
-		{
-			ID:                "1",
-			Specialization:    []string{"Weight Loss", "Strength Training"},
-			YearsOfExperience: 5,
-			Rating:            &rating,
-		},
-	}, nil
+	// Call the trainee service
+	resp, err := trainee.MyTrainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trainers := make([]*model.Trainer, len(resp.Trainers))
+	for i, t := range resp.Trainers {
+		trainers[i] = trainerModel(t)
+	}
+	return trainers, nil
 }
 
 // GetMessages returns messages between the trainee and a trainer
 func (r *queryResolver) GetMessages(ctx context.Context, trainerID string) ([]*model.Message, error) {
-	// TODO: Get current user ID from context
-	// userID := "1" // Replace with actual user ID from context
-
-	// TODO: Fetch from database
-	return []*model.Message{
-		{
-			ID:        "1",
-			Content:   "Hello, how can I help you today?",
-			Timestamp: time.Now().Format(time.RFC3339),
-			IsRead:    true,
-		},
-		{
-			ID:        "2",
-			Content:   "I have a question about my workout plan",
-			Timestamp: time.Now().Add(-5 * time.Minute).Format(time.RFC3339),
-			IsRead:    true,
-		},
-	}, nil
+	id, err := parseIDInput("trainerId", trainerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	resp, err := trainee.MyMessages(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*model.Message, len(resp.Messages))
+	for i, m := range resp.Messages {
+		messages[i] = messageModel(m)
+	}
+	return messages, nil
 }
 
 // Mutation returns generated.MutationResolver implementation.
@@ -0,0 +1,650 @@
+//go:build encore_app
+
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"encore.app/authz"
+	"encore.app/authz/authztest"
+	"encore.app/trainee"
+	"encore.dev/et"
+	"encore.dev/storage/sqldb"
+)
+
+// traineeDB is read to check what the mutations stored
+var traineeDB = sqldb.Named("trainee")
+
+// gqlResponse is a GraphQL response with its data left encoded
+type gqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Path       []any          `json:"path"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// newTestService starts the GraphQL service the way Encore does
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	s, err := initService()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// createTestUser adds a user to the trainee service's copy of the users and
+// makes the rest of the test run as them
+func createTestUser(t *testing.T, ctx context.Context, roles ...authz.Role) int {
+	t.Helper()
+	id := authztest.NewUserID()
+	names := make([]string, len(roles))
+	for i, r := range roles {
+		names[i] = string(r)
+	}
+	_, err := traineeDB.Exec(ctx, `
+		INSERT INTO user_projections (user_id, username, fullname, roles, status, created_at, version)
+		VALUES ($1, $2, 'Test User', $3, 'ACTIVE', NOW(), NOW())
+	`, id, fmt.Sprintf("user%d", id), names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authztest.AuthenticateAs(id, roles...)
+	return id
+}
+
+// serve sends a request to the GraphQL endpoint and decodes the response
+func serve(t *testing.T, s *Service, req *http.Request) *gqlResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.Query(w, req)
+
+	var resp gqlResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response %q: %v", w.Body.String(), err)
+	}
+	return &resp
+}
+
+// execute runs a GraphQL document
+func execute(t *testing.T, s *Service, query string, vars map[string]any) *gqlResponse {
+	t.Helper()
+	body, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return serve(t, s, req)
+}
+
+// mustExecute runs a GraphQL document that must succeed and decodes its data into out
+func mustExecute(t *testing.T, s *Service, query string, vars map[string]any, out any) {
+	t.Helper()
+	resp := execute(t, s, query, vars)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("got errors %+v", resp.Errors)
+	}
+	if err := json.Unmarshal(resp.Data, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// upload runs a GraphQL document with a file in the "image" variable, as a
+// multipart request following the GraphQL multipart request spec
+func upload(t *testing.T, s *Service, query string, vars map[string]any, file []byte) *gqlResponse {
+	t.Helper()
+	vars["image"] = nil
+	operations, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("operations", string(operations)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.WriteField("map", `{"0": ["variables.image"]}`); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := mw.CreateFormFile("0", "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return serve(t, s, req)
+}
+
+// parseTime reads a time the API returned
+func parseTime(t *testing.T, s string) time.Time {
+	t.Helper()
+	v, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatalf("got time %q, want RFC 3339: %v", s, err)
+	}
+	return v
+}
+
+// profileFields are the selected fields of a Trainee
+const profileFields = `id user { id username } age height weight fitnessLevel medicalConditions fitnessGoals injuries preferences`
+
+type profileResult struct {
+	ID   string `json:"id"`
+	User struct {
+		ID       int    `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Age               *int     `json:"age"`
+	Height            *float64 `json:"height"`
+	Weight            *float64 `json:"weight"`
+	FitnessLevel      *string  `json:"fitnessLevel"`
+	MedicalConditions *string  `json:"medicalConditions"`
+	FitnessGoals      []string `json:"fitnessGoals"`
+	Injuries          []string `json:"injuries"`
+	Preferences       []string `json:"preferences"`
+}
+
+// storedProfile reads the profile row of a user
+func storedProfile(t *testing.T, ctx context.Context, userID int) (age *int, goals, injuries, preferences *string) {
+	t.Helper()
+	err := traineeDB.QueryRow(ctx, `
+		SELECT age, goals, injuries, preferences
+		FROM trainee_profiles
+		WHERE user_id = $1
+	`, userID).Scan(&age, &goals, &injuries, &preferences)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return age, goals, injuries, preferences
+}
+
+func TestUpdateProfile(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+
+	var data struct {
+		UpdateProfile profileResult `json:"updateProfile"`
+	}
+	mustExecute(t, s, `
+		mutation($input: TraineeInput!) { updateProfile(input: $input) { `+profileFields+` } }
+	`, map[string]any{"input": map[string]any{
+		"age":               31,
+		"height":            172.5,
+		"weight":            68.2,
+		"fitnessLevel":      "ADVANCED",
+		"medicalConditions": "asthma",
+		"fitnessGoals":      []string{"run a marathon"},
+		"injuries":          []string{"left knee"},
+		"preferences":       []string{"mornings", "outdoors"},
+	}}, &data)
+
+	p := data.UpdateProfile
+	if p.ID != strconv.Itoa(userID) || p.User.ID != userID || p.User.Username != fmt.Sprintf("user%d", userID) {
+		t.Errorf("got trainee %s of user %+v, want user %d", p.ID, p.User, userID)
+	}
+	if *p.Age != 31 || *p.Height != 172.5 || *p.Weight != 68.2 || *p.FitnessLevel != "ADVANCED" || *p.MedicalConditions != "asthma" {
+		t.Errorf("got %+v, want the saved fields", p)
+	}
+	if len(p.Preferences) != 2 || p.Preferences[1] != "outdoors" {
+		t.Errorf("got preferences %q, want mornings and outdoors", p.Preferences)
+	}
+
+	age, goals, injuries, preferences := storedProfile(t, ctx, userID)
+	if *age != 31 || *goals != `["run a marathon"]` || *injuries != `["left knee"]` || *preferences != `["mornings","outdoors"]` {
+		t.Errorf("stored age %d, goals %s, injuries %s and preferences %s", *age, *goals, *injuries, *preferences)
+	}
+}
+
+func TestUpdateProfileMissingFields(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+
+	// A first profile with nothing but the age leaves every other field null
+	var data struct {
+		UpdateProfile profileResult `json:"updateProfile"`
+	}
+	mustExecute(t, s, `
+		mutation { updateProfile(input: {age: 40}) { `+profileFields+` } }
+	`, nil, &data)
+	p := data.UpdateProfile
+	if *p.Age != 40 || p.Height != nil || p.FitnessLevel != nil || p.MedicalConditions != nil {
+		t.Errorf("got %+v, want only the age", p)
+	}
+	if p.FitnessGoals == nil || len(p.FitnessGoals) != 0 || len(p.Injuries) != 0 || len(p.Preferences) != 0 {
+		t.Errorf("got goals %q, injuries %q and preferences %q, want empty lists", p.FitnessGoals, p.Injuries, p.Preferences)
+	}
+
+	mustExecute(t, s, `
+		mutation { updateProfile(input: {fitnessGoals: ["get stronger"], injuries: ["wrist"], preferences: ["gym"]}) { `+profileFields+` } }
+	`, nil, &data)
+
+	// Null and missing lists keep their value, an empty list clears it
+	mustExecute(t, s, `
+		mutation { updateProfile(input: {weight: 80, fitnessGoals: null, injuries: []}) { `+profileFields+` } }
+	`, nil, &data)
+	p = data.UpdateProfile
+	if *p.Age != 40 || *p.Weight != 80 {
+		t.Errorf("got age %v and weight %v, want 40 and 80", p.Age, p.Weight)
+	}
+	if len(p.FitnessGoals) != 1 || p.FitnessGoals[0] != "get stronger" || len(p.Preferences) != 1 {
+		t.Errorf("got goals %q and preferences %q, want them kept", p.FitnessGoals, p.Preferences)
+	}
+	if len(p.Injuries) != 0 {
+		t.Errorf("got injuries %q, want them cleared", p.Injuries)
+	}
+
+	_, goals, injuries, _ := storedProfile(t, ctx, userID)
+	if *goals != `["get stronger"]` || *injuries != `[]` {
+		t.Errorf("stored goals %s and injuries %s", *goals, *injuries)
+	}
+}
+
+// completedWorkoutFields are the selected fields of a CompletedWorkout
+const completedWorkoutFields = `id date duration notes rating workout { id name duration difficulty }`
+
+type completedWorkoutResult struct {
+	ID       string  `json:"id"`
+	Date     string  `json:"date"`
+	Duration int     `json:"duration"`
+	Notes    *string `json:"notes"`
+	Rating   *int    `json:"rating"`
+	Workout  struct {
+		ID         string  `json:"id"`
+		Name       string  `json:"name"`
+		Duration   *int    `json:"duration"`
+		Difficulty *string `json:"difficulty"`
+	} `json:"workout"`
+}
+
+// createPublicWorkout stores a public template of a trainer and returns its ID
+func createPublicWorkout(t *testing.T, ctx context.Context, trainerID int) int {
+	t.Helper()
+	var id int
+	err := traineeDB.QueryRow(ctx, `
+		INSERT INTO workout_templates (trainer_id, name, duration_minutes, difficulty, is_public, created_at, updated_at)
+		VALUES ($1, 'Full Body', 50, 'INTERMEDIATE', TRUE, NOW(), NOW())
+		RETURNING id
+	`, trainerID).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestLogWorkoutAndHistory(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	workoutID := createPublicWorkout(t, ctx, trainerID)
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+
+	start := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	var data struct {
+		LogWorkout completedWorkoutResult `json:"logWorkout"`
+	}
+	mustExecute(t, s, `
+		mutation($input: WorkoutLogInput!) { logWorkout(input: $input) { `+completedWorkoutFields+` } }
+	`, map[string]any{"input": map[string]any{
+		"workoutId": strconv.Itoa(workoutID),
+		"startTime": start.Format(time.RFC3339),
+		"duration":  50,
+		"notes":     "felt good",
+		"rating":    5,
+	}}, &data)
+
+	c := data.LogWorkout
+	if c.Workout.ID != strconv.Itoa(workoutID) || c.Workout.Name != "Full Body" || *c.Workout.Duration != 50 || *c.Workout.Difficulty != "INTERMEDIATE" {
+		t.Errorf("got workout %+v, want %d", c.Workout, workoutID)
+	}
+	if !parseTime(t, c.Date).Equal(start) || c.Duration != 50 || *c.Notes != "felt good" || *c.Rating != 5 {
+		t.Errorf("got %+v, want a 50 minute log from %s", c, start)
+	}
+
+	// The log is stored
+	var traineeID, duration int
+	var end time.Time
+	err := traineeDB.QueryRow(ctx, `
+		SELECT trainee_id, duration_minutes, end_time FROM workout_logs WHERE id = $1
+	`, c.ID).Scan(&traineeID, &duration, &end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if traineeID != userID || duration != 50 || !end.Equal(start.Add(50*time.Minute)) {
+		t.Errorf("stored trainee %d, duration %d and end %s, want %d, 50 and %s", traineeID, duration, end, userID, start.Add(50*time.Minute))
+	}
+
+	var history struct {
+		GetWorkoutHistory []completedWorkoutResult `json:"getWorkoutHistory"`
+	}
+	mustExecute(t, s, `{ getWorkoutHistory { `+completedWorkoutFields+` } }`, nil, &history)
+	if len(history.GetWorkoutHistory) != 1 {
+		t.Fatalf("got %d workouts in the history, want 1", len(history.GetWorkoutHistory))
+	}
+	if h := history.GetWorkoutHistory[0]; h.ID != c.ID || h.Date != c.Date || h.Duration != 50 || h.Workout.ID != c.Workout.ID {
+		t.Errorf("got history entry %+v, want the logged workout %+v", h, c)
+	}
+}
+
+// exerciseLogFields are the selected fields of the exercises of a CompletedWorkout
+const exerciseLogFields = `
+	id
+	exercises {
+		id workoutExerciseId setsCompleted repsCompleted maxWeight result
+		exercise { id }
+		planned { sets reps }
+		sets { setNumber reps weight skipped targetReps }
+	}`
+
+type exerciseLogsResult struct {
+	ID        string `json:"id"`
+	Exercises []struct {
+		ID                string   `json:"id"`
+		WorkoutExerciseID *string  `json:"workoutExerciseId"`
+		SetsCompleted     int      `json:"setsCompleted"`
+		RepsCompleted     int      `json:"repsCompleted"`
+		MaxWeight         *float64 `json:"maxWeight"`
+		Result            string   `json:"result"`
+		Exercise          struct {
+			ID string `json:"id"`
+		} `json:"exercise"`
+		Planned *struct {
+			Sets *int `json:"sets"`
+			Reps *int `json:"reps"`
+		} `json:"planned"`
+		Sets []struct {
+			SetNumber  int      `json:"setNumber"`
+			Reps       *int     `json:"reps"`
+			Weight     *float64 `json:"weight"`
+			Skipped    bool     `json:"skipped"`
+			TargetReps *int     `json:"targetReps"`
+		} `json:"sets"`
+	} `json:"exercises"`
+}
+
+// createWorkoutWithExercises creates a public template of two library
+// exercises of three sets of ten reps, as an administrator
+func createWorkoutWithExercises(t *testing.T, ctx context.Context) *trainee.Workout {
+	t.Helper()
+	adminID := createTestUser(t, ctx, authz.RoleAdmin, authz.RoleTrainer)
+
+	sets, reps := 3, 10
+	params := &trainee.CreateWorkoutTemplateParams{Name: "Full Body", IsPublic: true}
+	for i := range 2 {
+		e, err := trainee.CreateExercise(ctx, &trainee.ExerciseParams{
+			Name:    fmt.Sprintf("Exercise %d-%d", adminID, i),
+			Library: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		params.Exercises = append(params.Exercises, &trainee.WorkoutExerciseParams{
+			ExerciseID: e.ID,
+			Sets:       &sets,
+			Reps:       &reps,
+		})
+	}
+
+	w, err := trainee.CreateWorkoutTemplate(ctx, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestLogWorkoutSets(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	workout := createWorkoutWithExercises(t, ctx)
+	createTestUser(t, ctx, authz.RoleTrainee)
+
+	var data struct {
+		LogWorkout exerciseLogsResult `json:"logWorkout"`
+	}
+	mustExecute(t, s, `
+		mutation($input: WorkoutLogInput!) { logWorkout(input: $input) { `+exerciseLogFields+` } }
+	`, map[string]any{"input": map[string]any{
+		"workoutId": strconv.Itoa(workout.ID),
+		"duration":  50,
+		"exercises": []map[string]any{{
+			"workoutExerciseId": strconv.Itoa(workout.Exercises[0].ID),
+			"sets": []map[string]any{
+				{"reps": 10, "weight": 60},
+				{"reps": 10, "weight": 62.5},
+				{"reps": 8, "weight": 62.5},
+			},
+		}},
+	}}, &data)
+
+	c := data.LogWorkout
+	if len(c.Exercises) != 2 {
+		t.Fatalf("got %d exercises, want the logged one and the left out one", len(c.Exercises))
+	}
+	logged, skipped := c.Exercises[0], c.Exercises[1]
+	if logged.Result != "PARTIAL" || logged.SetsCompleted != 3 || logged.RepsCompleted != 28 || logged.MaxWeight == nil || *logged.MaxWeight != 62.5 {
+		t.Errorf("got logged exercise %+v, want 3 partial sets of 28 reps up to 62.5 kg", logged)
+	}
+	if logged.WorkoutExerciseID == nil || *logged.WorkoutExerciseID != strconv.Itoa(workout.Exercises[0].ID) {
+		t.Errorf("got workout exercise %v, want %d", logged.WorkoutExerciseID, workout.Exercises[0].ID)
+	}
+	if logged.Planned == nil || *logged.Planned.Sets != 3 || *logged.Planned.Reps != 10 {
+		t.Errorf("got plan %+v, want 3 sets of 10", logged.Planned)
+	}
+	if len(logged.Sets) != 3 || logged.Sets[2].SetNumber != 3 || *logged.Sets[2].Reps != 8 || *logged.Sets[2].TargetReps != 10 {
+		t.Errorf("got sets %+v, want 3 numbered sets with their targets", logged.Sets)
+	}
+	if skipped.Result != "SKIPPED" || skipped.SetsCompleted != 0 || len(skipped.Sets) != 0 ||
+		skipped.Exercise.ID != strconv.Itoa(workout.Exercises[1].Exercise.ID) {
+		t.Errorf("got left out exercise %+v, want it skipped", skipped)
+	}
+
+	// The history reads the sets back
+	var history struct {
+		GetWorkoutHistory []exerciseLogsResult `json:"getWorkoutHistory"`
+	}
+	mustExecute(t, s, `{ getWorkoutHistory { `+exerciseLogFields+` } }`, nil, &history)
+	if len(history.GetWorkoutHistory) != 1 {
+		t.Fatalf("got %d workouts in the history, want 1", len(history.GetWorkoutHistory))
+	}
+	h := history.GetWorkoutHistory[0]
+	if h.ID != c.ID || len(h.Exercises) != 2 || h.Exercises[0].Result != "PARTIAL" || h.Exercises[1].Result != "SKIPPED" {
+		t.Fatalf("got history entry %+v, want the logged workout %+v", h, c)
+	}
+	for i, set := range h.Exercises[0].Sets {
+		want := logged.Sets[i]
+		if set.SetNumber != want.SetNumber || *set.Reps != *want.Reps || *set.Weight != *want.Weight || set.Skipped {
+			t.Errorf("got set %+v in the history, want %+v", set, want)
+		}
+	}
+}
+
+func TestLogWorkoutHiddenTemplate(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	var workoutID int
+	err := traineeDB.QueryRow(ctx, `
+		INSERT INTO workout_templates (trainer_id, name, is_public, created_at, updated_at)
+		VALUES ($1, 'Private', FALSE, NOW(), NOW())
+		RETURNING id
+	`, trainerID).Scan(&workoutID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestUser(t, ctx, authz.RoleTrainee)
+
+	resp := execute(t, s, `
+		mutation($id: ID!) { logWorkout(input: {workoutId: $id, duration: 30}) { id } }
+	`, map[string]any{"id": strconv.Itoa(workoutID)})
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["code"] != "NOT_FOUND" {
+		t.Errorf("got errors %+v, want NOT_FOUND for another trainer's private template", resp.Errors)
+	}
+}
+
+func TestLogWorkoutInvalidInput(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	createTestUser(t, ctx, authz.RoleTrainee)
+
+	resp := execute(t, s, `
+		mutation { logWorkout(input: {workoutId: "abc", duration: 30}) { id } }
+	`, nil)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["field"] != "workoutId" {
+		t.Errorf("got errors %+v, want one for workoutId", resp.Errors)
+	}
+}
+
+// pngHeader is enough of a PNG file for its type to be detected
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00")
+
+// photoKeyPattern matches the object key uploaded photos are stored under
+var photoKeyPattern = regexp.MustCompile(`^[0-9]+/[0-9a-f-]{36}\.png$`)
+
+func TestUploadProgressPhoto(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+
+	resp := upload(t, s, `
+		mutation($image: Upload!) { uploadProgressPhoto(image: $image, angle: SIDE, notes: "week 4") { id url date notes angle } }
+	`, map[string]any{}, pngHeader)
+	if len(resp.Errors) > 0 {
+		t.Fatalf("got errors %+v", resp.Errors)
+	}
+	var data struct {
+		UploadProgressPhoto struct {
+			ID    string  `json:"id"`
+			URL   string  `json:"url"`
+			Date  string  `json:"date"`
+			Notes *string `json:"notes"`
+			Angle *string `json:"angle"`
+		} `json:"uploadProgressPhoto"`
+	}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	p := data.UploadProgressPhoto
+	if p.URL == "" || *p.Notes != "week 4" || *p.Angle != "SIDE" {
+		t.Errorf("got photo %+v, want a side photo with notes and a URL", p)
+	}
+	parseTime(t, p.Date)
+
+	// The object key is stored rather than a URL, which is signed on every read
+	var traineeID int
+	var stored string
+	err := traineeDB.QueryRow(ctx, `
+		SELECT trainee_id, photo_url FROM progress_photos WHERE id = $1
+	`, p.ID).Scan(&traineeID, &stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if traineeID != userID || !photoKeyPattern.MatchString(stored) || !strings.HasPrefix(stored, strconv.Itoa(userID)+"/") {
+		t.Errorf("stored photo %q of trainee %d, want an object key under %d/", stored, traineeID, userID)
+	}
+}
+
+func TestUploadProgressPhotoTooLarge(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+
+	file := make([]byte, trainee.MaxPhotoSize+1)
+	copy(file, pngHeader)
+	resp := upload(t, s, `
+		mutation($image: Upload!) { uploadProgressPhoto(image: $image) { id } }
+	`, map[string]any{}, file)
+	if len(resp.Errors) != 1 || resp.Errors[0].Extensions["field"] != "image" || resp.Errors[0].Extensions["code"] != "TOO_LONG" {
+		t.Fatalf("got errors %+v, want one for the image being too large", resp.Errors)
+	}
+
+	var photos int
+	err := traineeDB.QueryRow(ctx, `
+		SELECT COUNT(*) FROM progress_photos WHERE trainee_id = $1
+	`, userID).Scan(&photos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if photos != 0 {
+		t.Errorf("stored %d photos, want 0", photos)
+	}
+}
+
+func TestGetMessages(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	otherID := createTestUser(t, ctx, authz.RoleTrainer)
+
+	_, err := traineeDB.Exec(ctx, `
+		INSERT INTO messages (sender_id, receiver_id, content, is_read, created_at)
+		VALUES ($1, $2, 'How did the run go?', TRUE, NOW() - INTERVAL '2 minutes'),
+			($2, $1, 'Great, new record', FALSE, NOW() - INTERVAL '1 minute'),
+			($3, $2, 'Not in this conversation', FALSE, NOW())
+	`, trainerID, traineeID, otherID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data struct {
+		GetMessages []struct {
+			ID     string `json:"id"`
+			Sender struct {
+				ID       int    `json:"id"`
+				Username string `json:"username"`
+			} `json:"sender"`
+			Content   string `json:"content"`
+			Timestamp string `json:"timestamp"`
+			IsRead    bool   `json:"isRead"`
+		} `json:"getMessages"`
+	}
+	mustExecute(t, s, `
+		query($trainerId: ID!) { getMessages(trainerId: $trainerId) { id sender { id username } content timestamp isRead } }
+	`, map[string]any{"trainerId": strconv.Itoa(trainerID)}, &data)
+
+	messages := data.GetMessages
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, want the 2 of the conversation", len(messages))
+	}
+	if messages[0].Sender.ID != trainerID || messages[0].Sender.Username != fmt.Sprintf("user%d", trainerID) ||
+		messages[0].Content != "How did the run go?" || !messages[0].IsRead {
+		t.Errorf("got first message %+v, want the trainer's read question", messages[0])
+	}
+	if messages[1].Sender.ID != traineeID || messages[1].Content != "Great, new record" || messages[1].IsRead {
+		t.Errorf("got second message %+v, want the trainee's unread answer", messages[1])
+	}
+	parseTime(t, messages[0].Timestamp)
+}
+
+func TestTraineeQueriesRequireAuth(t *testing.T) {
+	s := newTestService(t)
+	et.OverrideAuthInfo("", nil)
+
+	resp := execute(t, s, `{ getWorkoutHistory { id } }`, nil)
+	if len(resp.Errors) == 0 {
+		t.Error("got no errors for an anonymous caller")
+	}
+}
@@ -0,0 +1,249 @@
+package graphql
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.78
+
+import (
+	"context"
+
+	"encore.app/graphql/model"
+	"encore.app/trainee"
+)
+
+// CreateWorkoutTemplate is the resolver for the createWorkoutTemplate field.
+func (r *mutationResolver) CreateWorkoutTemplate(ctx context.Context, input model.WorkoutTemplateInput) (*model.Workout, error) {
+	// Convert GraphQL input to service input
+	params := &trainee.CreateWorkoutTemplateParams{
+		Name:            input.Name,
+		Description:     input.Description,
+		DurationMinutes: input.Duration,
+		Difficulty:      fitnessLevelParam(input.Difficulty),
+		IsPublic:        input.IsPublic,
+		Exercises:       make([]*trainee.WorkoutExerciseParams, len(input.Exercises)),
+	}
+	for i, e := range input.Exercises {
+		p, err := workoutExerciseParams(e)
+		if err != nil {
+			return nil, err
+		}
+		params.Exercises[i] = p
+	}
+	for _, b := range input.Blocks {
+		params.Blocks = append(params.Blocks, workoutBlockParams(b.Block, b.ExercisePositions))
+	}
+
+	// Call the trainee service
+	w, err := trainee.CreateWorkoutTemplate(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// UpdateWorkoutTemplate is the resolver for the updateWorkoutTemplate field.
+func (r *mutationResolver) UpdateWorkoutTemplate(ctx context.Context, id string, input model.WorkoutTemplateUpdateInput) (*model.Workout, error) {
+	workoutID, err := parseIDInput("id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.UpdateWorkoutTemplate(ctx, workoutID, &trainee.UpdateWorkoutTemplateParams{
+		Name:            input.Name,
+		Description:     input.Description,
+		DurationMinutes: input.Duration,
+		Difficulty:      fitnessLevelParam(input.Difficulty),
+		IsPublic:        input.IsPublic,
+
+		ClearDurationMinutes: input.ClearDuration != nil && *input.ClearDuration,
+		ClearDifficulty:      input.ClearDifficulty != nil && *input.ClearDifficulty,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// DuplicateWorkoutTemplate is the resolver for the duplicateWorkoutTemplate field.
+func (r *mutationResolver) DuplicateWorkoutTemplate(ctx context.Context, id string) (*model.Workout, error) {
+	workoutID, err := parseIDInput("id", id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.DuplicateWorkoutTemplate(ctx, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// DeleteWorkoutTemplate is the resolver for the deleteWorkoutTemplate field.
+func (r *mutationResolver) DeleteWorkoutTemplate(ctx context.Context, id string) (bool, error) {
+	workoutID, err := parseIDInput("id", id)
+	if err != nil {
+		return false, err
+	}
+
+	// Call the trainee service
+	if err := trainee.DeleteWorkoutTemplate(ctx, workoutID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// AddWorkoutExercise is the resolver for the addWorkoutExercise field.
+func (r *mutationResolver) AddWorkoutExercise(ctx context.Context, workoutID string, input model.WorkoutExerciseInput, position *int) (*model.Workout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	exercise, err := workoutExerciseParams(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.AddWorkoutExercise(ctx, id, &trainee.AddWorkoutExerciseParams{
+		Exercise: exercise,
+		Position: position,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// UpdateWorkoutExercise is the resolver for the updateWorkoutExercise field.
+func (r *mutationResolver) UpdateWorkoutExercise(ctx context.Context, workoutID string, workoutExerciseID string, input model.WorkoutExerciseInput) (*model.Workout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	item, err := parseIDInput("workoutExerciseId", workoutExerciseID)
+	if err != nil {
+		return nil, err
+	}
+	params, err := workoutExerciseParams(&input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.UpdateWorkoutExercise(ctx, id, item, params)
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// RemoveWorkoutExercise is the resolver for the removeWorkoutExercise field.
+func (r *mutationResolver) RemoveWorkoutExercise(ctx context.Context, workoutID string, workoutExerciseID string) (*model.Workout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	item, err := parseIDInput("workoutExerciseId", workoutExerciseID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.RemoveWorkoutExercise(ctx, id, item)
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// ReorderWorkoutExercises is the resolver for the reorderWorkoutExercises field.
+func (r *mutationResolver) ReorderWorkoutExercises(ctx context.Context, workoutID string, workoutExerciseIds []string) (*model.Workout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	itemIDs, err := parseIDsInput("workoutExerciseIds", workoutExerciseIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.ReorderWorkoutExercises(ctx, id, &trainee.ReorderWorkoutExercisesParams{IDs: itemIDs})
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// AddWorkoutBlock is the resolver for the addWorkoutBlock field.
+func (r *mutationResolver) AddWorkoutBlock(ctx context.Context, workoutID string, input model.WorkoutBlockInput, workoutExerciseIds []string) (*model.Workout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	itemIDs, err := parseIDsInput("workoutExerciseIds", workoutExerciseIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.AddWorkoutBlock(ctx, id, workoutBlockParams(&input, itemIDs))
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// UpdateWorkoutBlock is the resolver for the updateWorkoutBlock field.
+func (r *mutationResolver) UpdateWorkoutBlock(ctx context.Context, workoutID string, blockID string, input model.WorkoutBlockInput, workoutExerciseIds []string) (*model.Workout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := parseIDInput("blockId", blockID)
+	if err != nil {
+		return nil, err
+	}
+	itemIDs, err := parseIDsInput("workoutExerciseIds", workoutExerciseIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.UpdateWorkoutBlock(ctx, id, block, workoutBlockParams(&input, itemIDs))
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// RemoveWorkoutBlock is the resolver for the removeWorkoutBlock field.
+func (r *mutationResolver) RemoveWorkoutBlock(ctx context.Context, workoutID string, blockID string) (*model.Workout, error) {
+	id, err := parseIDInput("workoutId", workoutID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := parseIDInput("blockId", blockID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the trainee service
+	w, err := trainee.RemoveWorkoutBlock(ctx, id, block)
+	if err != nil {
+		return nil, err
+	}
+	return workoutModel(w), nil
+}
+
+// GetMyWorkoutTemplates is the resolver for the getMyWorkoutTemplates field.
+func (r *queryResolver) GetMyWorkoutTemplates(ctx context.Context) ([]*model.Workout, error) {
+	// Call the trainee service
+	resp, err := trainee.MyWorkoutTemplates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return workoutModels(resp.Workouts), nil
+}
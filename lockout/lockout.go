@@ -0,0 +1,76 @@
+// Package lockout slows down and temporarily blocks repeated failed attempts,
+// such as password guessing, using failure counters kept in a pluggable Store.
+package lockout
+
+import (
+	"context"
+	"time"
+)
+
+// Counter is the failure history of one key, e.g. a username or an IP address
+type Counter struct {
+	Failures      int
+	LastFailureAt time.Time
+}
+
+// Store keeps failure counters
+type Store interface {
+	// Get returns the counter of a key, or a zero Counter if there is none
+	Get(ctx context.Context, key string) (Counter, error)
+
+	// RecordFailure adds a failure at now and returns the updated counter.
+	// A counter whose last failure is older than window starts over.
+	RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error)
+
+	// Reset clears the counter of a key
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy decides how long a key is blocked after a number of failures
+type Policy struct {
+	// FreeFailures is how many failures are allowed before any delay applies
+	FreeFailures int
+
+	// BaseDelay is the delay after the first failure past FreeFailures.
+	// It doubles with every further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	// LockoutAfter is the number of failures that locks the key for LockoutDuration.
+	// Zero disables lockout.
+	LockoutAfter    int
+	LockoutDuration time.Duration
+
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// Delay returns how long to wait after the last of the given number of failures
+func (p Policy) Delay(failures int) time.Duration {
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeFailures {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeFailures + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Locked reports whether a counter has reached the lockout threshold
+func (p Policy) Locked(c Counter) bool {
+	return p.LockoutAfter > 0 && c.Failures >= p.LockoutAfter
+}
+
+// BlockedFor returns how much longer a key with the given counter is blocked at now
+func (p Policy) BlockedFor(c Counter, now time.Time) time.Duration {
+	if c.Failures == 0 || now.Sub(c.LastFailureAt) > p.Window {
+		return 0
+	}
+	remaining := c.LastFailureAt.Add(p.Delay(c.Failures)).Sub(now)
+	return max(remaining, 0)
+}
@@ -0,0 +1,144 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeFailures:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        30 * time.Second,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{8, 16 * time.Second},
+		{9, 30 * time.Second},
+		{10, 15 * time.Minute},
+		{25, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := testPolicy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryStoreBackoff(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var c Counter
+	for range 3 {
+		c = recordFailure(t, store, "user", now)
+		if wait := testPolicy.BlockedFor(c, now); wait != 0 {
+			t.Fatalf("blocked for %s after %d failures, want free failures", wait, c.Failures)
+		}
+	}
+
+	c = recordFailure(t, store, "user", now)
+	if wait := testPolicy.BlockedFor(c, now); wait != time.Second {
+		t.Errorf("blocked for %s after 4 failures, want 1s", wait)
+	}
+	if wait := testPolicy.BlockedFor(c, now.Add(500*time.Millisecond)); wait != 500*time.Millisecond {
+		t.Errorf("blocked for %s half way through the delay, want 500ms", wait)
+	}
+	if wait := testPolicy.BlockedFor(c, now.Add(time.Second)); wait != 0 {
+		t.Errorf("blocked for %s after the delay, want 0", wait)
+	}
+
+	c = recordFailure(t, store, "user", now)
+	if wait := testPolicy.BlockedFor(c, now); wait != 2*time.Second {
+		t.Errorf("blocked for %s after 5 failures, want 2s", wait)
+	}
+
+	// Other keys are counted separately
+	other, err := store.Get(ctx, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Failures != 0 {
+		t.Errorf("other key has %d failures, want 0", other.Failures)
+	}
+}
+
+func TestMemoryStoreLockout(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var c Counter
+	for i := range testPolicy.LockoutAfter {
+		c = recordFailure(t, store, "user", now.Add(time.Duration(i)*time.Minute))
+		if i < testPolicy.LockoutAfter-1 && testPolicy.Locked(c) {
+			t.Fatalf("locked after %d failures", c.Failures)
+		}
+	}
+	if !testPolicy.Locked(c) {
+		t.Fatalf("not locked after %d failures", c.Failures)
+	}
+
+	last := c.LastFailureAt
+	if wait := testPolicy.BlockedFor(c, last.Add(time.Minute)); wait != 14*time.Minute {
+		t.Errorf("blocked for %s a minute into the lockout, want 14m", wait)
+	}
+	if wait := testPolicy.BlockedFor(c, last.Add(testPolicy.LockoutDuration)); wait != 0 {
+		t.Errorf("blocked for %s after the lockout, want 0", wait)
+	}
+}
+
+func TestMemoryStoreWindow(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for range 5 {
+		recordFailure(t, store, "user", now)
+	}
+	c := recordFailure(t, store, "user", now.Add(testPolicy.Window+time.Second))
+	if c.Failures != 1 {
+		t.Errorf("counter has %d failures after the window, want 1", c.Failures)
+	}
+}
+
+func TestMemoryStoreReset(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for range testPolicy.LockoutAfter {
+		recordFailure(t, store, "user", now)
+	}
+	if err := store.Reset(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := store.Get(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Failures != 0 || testPolicy.BlockedFor(c, now) != 0 {
+		t.Errorf("counter is %+v after reset, want zero", c)
+	}
+}
+
+func recordFailure(t *testing.T, store Store, key string, now time.Time) Counter {
+	t.Helper()
+	c, err := store.RecordFailure(context.Background(), key, now, testPolicy.Window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
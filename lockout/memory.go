@@ -0,0 +1,49 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in memory. It is meant for tests and single
+// instance development setups since counters are neither shared nor persisted.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]Counter
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]Counter)}
+}
+
+// Get returns the counter of a key
+func (s *MemoryStore) Get(ctx context.Context, key string) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[key], nil
+}
+
+// RecordFailure adds a failure to the counter of a key
+func (s *MemoryStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.counters[key]
+	if now.Sub(c.LastFailureAt) > window {
+		c.Failures = 0
+	}
+	c.Failures++
+	c.LastFailureAt = now
+	s.counters[key] = c
+	return c, nil
+}
+
+// Reset clears the counter of a key
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.counters, key)
+	return nil
+}
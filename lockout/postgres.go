@@ -0,0 +1,65 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"encore.dev/storage/sqldb"
+)
+
+// PostgresStore keeps counters in the lockout_counters table of a database,
+// so they are shared by every instance of a service. The table is created by
+// the migrations of the service owning the database:
+//
+//	CREATE TABLE lockout_counters (
+//	    key VARCHAR(320) PRIMARY KEY,
+//	    failures INTEGER NOT NULL,
+//	    last_failure_at TIMESTAMPTZ NOT NULL
+//	);
+type PostgresStore struct {
+	db *sqldb.Database
+}
+
+// NewPostgresStore creates a store backed by db
+func NewPostgresStore(db *sqldb.Database) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Get returns the counter of a key
+func (s *PostgresStore) Get(ctx context.Context, key string) (Counter, error) {
+	var c Counter
+	err := s.db.QueryRow(ctx, `
+        SELECT failures, last_failure_at
+        FROM lockout_counters
+        WHERE key = $1
+    `, key).Scan(&c.Failures, &c.LastFailureAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return Counter{}, nil
+	}
+	return c, err
+}
+
+// RecordFailure adds a failure to the counter of a key.
+// The upsert keeps concurrent failures from being lost.
+func (s *PostgresStore) RecordFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Counter, error) {
+	var c Counter
+	err := s.db.QueryRow(ctx, `
+        INSERT INTO lockout_counters (key, failures, last_failure_at)
+        VALUES ($1, 1, $2)
+        ON CONFLICT (key) DO UPDATE
+        SET failures = CASE
+                WHEN lockout_counters.last_failure_at < $3 THEN 1
+                ELSE lockout_counters.failures + 1
+            END,
+            last_failure_at = EXCLUDED.last_failure_at
+        RETURNING failures, last_failure_at
+    `, key, now, now.Add(-window)).Scan(&c.Failures, &c.LastFailureAt)
+	return c, err
+}
+
+// Reset clears the counter of a key
+func (s *PostgresStore) Reset(ctx context.Context, key string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM lockout_counters WHERE key = $1`, key)
+	return err
+}
@@ -0,0 +1,153 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"encore.app/oidc/oidctest"
+)
+
+var testUser = oidctest.User{
+	Subject:       "oidctest|alice",
+	Email:         "alice@example.com",
+	EmailVerified: true,
+	Name:          "Alice",
+}
+
+// newTestProvider starts a mock issuer and discovers it
+func newTestProvider(t *testing.T, clientID string) (*Provider, *oidctest.Issuer) {
+	t.Helper()
+	issuer := oidctest.NewServer(testUser)
+	t.Cleanup(issuer.Close)
+
+	p, err := NewProvider(context.Background(), Config{
+		Issuer:      issuer.URL,
+		ClientID:    clientID,
+		Scopes:      []string{"email"},
+		RedirectURL: "http://localhost:3000/auth/callback",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, issuer
+}
+
+// authorize follows the authorization URL and returns the code and state sent to the redirect URL
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorization returned %s, want a redirect", resp.Status)
+	}
+
+	redirect, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redirect.Query().Get("code"), redirect.Query().Get("state")
+}
+
+func TestFlow(t *testing.T) {
+	ctx := context.Background()
+	p, _ := newTestProvider(t, "fitness")
+
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := authorize(t, p.AuthCodeURL("the-state", "the-nonce", Challenge(verifier)))
+	if state != "the-state" {
+		t.Errorf("got state %q, want the-state", state)
+	}
+
+	tokens, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Verify(ctx, tokens.IDToken, "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != testUser.Subject || claims.Email != testUser.Email || !claims.EmailVerified || claims.Name != testUser.Name {
+		t.Errorf("got claims %+v, want those of %+v", claims, testUser)
+	}
+
+	// Codes can only be exchanged once
+	if _, err := p.Exchange(ctx, code, verifier); err == nil {
+		t.Error("exchanged a code twice")
+	}
+}
+
+func TestExchangeVerifierMismatch(t *testing.T) {
+	p, _ := newTestProvider(t, "fitness")
+
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, p.AuthCodeURL("state", "nonce", Challenge(verifier)))
+
+	if _, err := p.Exchange(context.Background(), code, other); err == nil {
+		t.Error("exchanged a code with the wrong verifier")
+	}
+}
+
+func TestVerifyNonceMismatch(t *testing.T) {
+	ctx := context.Background()
+	p, _ := newTestProvider(t, "fitness")
+
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, p.AuthCodeURL("state", "nonce", Challenge(verifier)))
+	tokens, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Verify(ctx, tokens.IDToken, "another-nonce"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v for another nonce, want ErrInvalidToken", err)
+	}
+}
+
+func TestVerifyAudience(t *testing.T) {
+	ctx := context.Background()
+	p, issuer := newTestProvider(t, "fitness")
+	other, err := NewProvider(ctx, Config{
+		Issuer:      issuer.URL,
+		ClientID:    "another-client",
+		RedirectURL: "http://localhost:3000/auth/callback",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, p.AuthCodeURL("state", "nonce", Challenge(verifier)))
+	tokens, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := other.Verify(ctx, tokens.IDToken, "nonce"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("got %v for a token issued to another client, want ErrInvalidToken", err)
+	}
+}
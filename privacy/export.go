@@ -0,0 +1,485 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	"encore.app/admin"
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.app/trainee"
+	"encore.dev"
+	"encore.dev/beta/errs"
+	"encore.dev/cron"
+	"encore.dev/pubsub"
+	"encore.dev/rlog"
+	"encore.dev/storage/objects"
+	"encore.dev/storage/sqldb"
+	"github.com/google/uuid"
+)
+
+const (
+	// exportTTL is how long a finished export can be downloaded
+	exportTTL = 7 * 24 * time.Hour
+
+	// downloadURLTTL is how long a download link works
+	downloadURLTTL = 15 * time.Minute
+
+	// exportCooldown is the time a user has to wait between exports
+	exportCooldown = time.Hour
+
+	// maxPhotoSize is the largest photo file included in an export
+	maxPhotoSize = 20 << 20
+
+	// exportAttempts is how often building an export is tried before it fails
+	exportAttempts = 4
+)
+
+// ExportStatus is the state of a data export
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "PENDING"
+	ExportReady   ExportStatus = "READY"
+	ExportFailed  ExportStatus = "FAILED"
+	ExportExpired ExportStatus = "EXPIRED"
+)
+
+// DataExport is an archive of a user's personal data
+type DataExport struct {
+	ID          string       `json:"id"`
+	Status      ExportStatus `json:"status"`
+	RequestedAt time.Time    `json:"requested_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time   `json:"expires_at,omitempty"`
+
+	// DownloadURL is a short-lived link to the ZIP file of a ready export
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// DataExportsResponse lists the data exports of a user, newest first
+type DataExportsResponse struct {
+	Exports []*DataExport `json:"exports"`
+}
+
+// ExportRequest asks for a data export to be built
+type ExportRequest struct {
+	ExportID string `json:"export_id"`
+	UserID   int    `json:"user_id"`
+}
+
+// ExportRequests carries export requests to the worker building them
+var ExportRequests = pubsub.NewTopic[*ExportRequest]("data-export-requested", pubsub.TopicConfig{
+	DeliveryGuarantee: pubsub.AtLeastOnce,
+})
+
+var _ = pubsub.NewSubscription(ExportRequests, "build-data-export", pubsub.SubscriptionConfig[*ExportRequest]{
+	Handler:        buildExport,
+	MaxConcurrency: 2,
+	AckDeadline:    10 * time.Minute,
+	RetryPolicy: &pubsub.RetryPolicy{
+		MinBackoff: time.Minute,
+		MaxRetries: exportAttempts - 1,
+	},
+})
+
+// exports stores the finished ZIP files
+var exports = objects.NewBucket("data-exports", objects.BucketConfig{})
+
+// RequestDataExport starts building a ZIP file with all personal data of the current user.
+// Its progress can be followed with MyDataExports.
+//
+//encore:api auth method=POST path=/privacy/exports
+func RequestDataExport(ctx context.Context) (*DataExport, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+
+	var last *time.Time
+	err = db.QueryRow(ctx, `
+        SELECT MAX(requested_at)
+        FROM data_exports
+        WHERE user_id = $1
+    `, caller.UserID).Scan(&last)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && time.Since(*last) < exportCooldown {
+		return nil, &errs.Error{
+			Code:    errs.ResourceExhausted,
+			Message: "a data export was requested recently, please wait before requesting another",
+		}
+	}
+
+	export := &DataExport{ID: uuid.NewString(), Status: ExportPending}
+	err = db.QueryRow(ctx, `
+        INSERT INTO data_exports (id, user_id, status, requested_at)
+        VALUES ($1, $2, $3, NOW())
+        RETURNING requested_at
+    `, export.ID, caller.UserID, export.Status).Scan(&export.RequestedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ExportRequests.Publish(ctx, &ExportRequest{ExportID: export.ID, UserID: caller.UserID})
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     actionRequestExport,
+		EntityType: "user",
+		EntityID:   strconv.Itoa(caller.UserID),
+	})
+	return export, nil
+}
+
+// MyDataExports lists the data exports of the current user
+//
+//encore:api auth method=GET path=/privacy/exports
+func MyDataExports(ctx context.Context) (*DataExportsResponse, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+        SELECT id::TEXT, status, COALESCE(object_key, ''), requested_at, completed_at, expires_at
+        FROM data_exports
+        WHERE user_id = $1
+        ORDER BY requested_at DESC
+        LIMIT 20
+    `, caller.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*DataExport{}
+	var keys []string
+	for rows.Next() {
+		var e DataExport
+		var key string
+		if err := rows.Scan(&e.ID, &e.Status, &key, &e.RequestedAt, &e.CompletedAt, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		list = append(list, &e)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, e := range list {
+		if e.Status != ExportReady || e.ExpiresAt == nil || time.Now().After(*e.ExpiresAt) {
+			continue
+		}
+		signed, err := exports.SignedDownloadURL(ctx, keys[i], objects.WithTTL(downloadURLTTL))
+		if err != nil {
+			return nil, err
+		}
+		e.DownloadURL = signed.URL
+	}
+
+	return &DataExportsResponse{Exports: list}, nil
+}
+
+// buildExport collects a user's data from every service and stores it as a ZIP file.
+// After the last attempt the export is marked failed so the user can ask again.
+func buildExport(ctx context.Context, req *ExportRequest) error {
+	var status ExportStatus
+	err := db.QueryRow(ctx, `SELECT status FROM data_exports WHERE id = $1`, req.ExportID).Scan(&status)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		// The user's account was erased in the meantime
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if status != ExportPending {
+		// Redelivered after it was built
+		return nil
+	}
+
+	key := fmt.Sprintf("%d/%s.zip", req.UserID, req.ExportID)
+	if err := writeExport(ctx, key, req.UserID); err != nil {
+		if msg := encore.CurrentRequest().Message; msg != nil && msg.DeliveryAttempt < exportAttempts {
+			return err
+		}
+		rlog.Error("data export failed", "export_id", req.ExportID, "user_id", req.UserID, "err", err)
+		_, err = db.Exec(ctx, `
+            UPDATE data_exports
+            SET status = $2, error = $3, completed_at = NOW()
+            WHERE id = $1
+        `, req.ExportID, ExportFailed, err.Error())
+		return err
+	}
+
+	_, err = db.Exec(ctx, `
+        UPDATE data_exports
+        SET status = $2, object_key = $3, completed_at = NOW(), expires_at = $4
+        WHERE id = $1
+    `, req.ExportID, ExportReady, key, time.Now().Add(exportTTL))
+	return err
+}
+
+// manifest describes the contents of an export
+type manifest struct {
+	UserID        int       `json:"user_id"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	Files         []string  `json:"files"`
+	MissingPhotos []string  `json:"missing_photos"`
+}
+
+// writeExport writes the ZIP file of a user's data to the bucket
+func writeExport(ctx context.Context, key string, userID int) (err error) {
+	// Call the admin service
+	account, err := admin.ExportUserData(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	// Call the trainee service
+	fitness, err := trainee.ExportUserData(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	w := exports.Upload(ctx, key, objects.WithUploadAttrs(objects.UploadAttrs{ContentType: "application/zip"}))
+	defer func() {
+		if err != nil {
+			w.Abort(err)
+		}
+	}()
+	zw := zip.NewWriter(w)
+	m := &manifest{UserID: userID, GeneratedAt: time.Now(), MissingPhotos: []string{}}
+
+	if err := writeJSON(zw, m, "account.json", account); err != nil {
+		return err
+	}
+	for _, table := range fitness.Tables {
+		if err := writeCSV(zw, m, "trainee/"+table.Name+".csv", table); err != nil {
+			return err
+		}
+	}
+	for _, photo := range fitness.Photos {
+		if err := writePhoto(ctx, zw, m, photo); err != nil {
+			rlog.Warn("could not add photo to data export", "photo_id", photo.ID, "err", err)
+			m.MissingPhotos = append(m.MissingPhotos, photo.URL)
+		}
+	}
+	if err := writeJSON(zw, nil, "manifest.json", m); err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// writeJSON adds a JSON file to the archive and, unless m is nil, to the manifest
+func writeJSON(zw *zip.Writer, m *manifest, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if m != nil {
+		m.Files = append(m.Files, name)
+	}
+	return nil
+}
+
+// writeCSV adds a table as a CSV file to the archive
+func writeCSV(zw *zip.Writer, m *manifest, name string, table *trainee.DataTable) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	if err := cw.Write(table.Columns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(table.Rows); err != nil {
+		return err
+	}
+	m.Files = append(m.Files, name)
+	return nil
+}
+
+// writePhoto downloads a progress photo into the archive
+func writePhoto(ctx context.Context, zw *zip.Writer, m *manifest, photo *trainee.PhotoFile) error {
+	u, err := url.Parse(photo.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := photoClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	// Read the whole photo first, the archive cannot drop a partly written file
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxPhotoSize {
+		return fmt.Errorf("photo is larger than %d bytes", maxPhotoSize)
+	}
+
+	ext := path.Ext(u.Path)
+	if exts, _ := mime.ExtensionsByType(resp.Header.Get("Content-Type")); ext == "" && len(exts) > 0 {
+		ext = exts[0]
+	}
+	name := "photos/" + photo.ID + ext
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	m.Files = append(m.Files, name)
+	return nil
+}
+
+// photoClient downloads photos from public addresses only, so a photo URL
+// cannot be used to reach services on the internal network
+var photoClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+					return fmt.Errorf("address %s is not public", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+// Remove export files once they can no longer be downloaded
+var _ = cron.NewJob("expire-data-exports", cron.JobConfig{
+	Title:    "Remove expired data exports",
+	Every:    1 * cron.Hour,
+	Endpoint: ExpireDataExports,
+})
+
+// ExpireDataExports removes the files of exports that have expired
+//
+//encore:api private method=POST path=/privacy/exports/expire
+func ExpireDataExports(ctx context.Context) error {
+	rows, err := db.Query(ctx, `
+        SELECT id::TEXT, object_key
+        FROM data_exports
+        WHERE status = $1 AND expires_at <= NOW()
+    `, ExportReady)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	expired := map[string]string{}
+	for rows.Next() {
+		var id, key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return err
+		}
+		expired[id] = key
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for id, key := range expired {
+		if err := removeObject(ctx, key); err != nil {
+			return err
+		}
+		_, err := db.Exec(ctx, `UPDATE data_exports SET status = $2 WHERE id = $1`, id, ExportExpired)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeExports deletes every export of a user, including their files
+func removeExports(ctx context.Context, userID int) error {
+	rows, err := db.Query(ctx, `
+        SELECT object_key
+        FROM data_exports
+        WHERE user_id = $1 AND object_key IS NOT NULL
+    `, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, key := range keys {
+		if err := removeObject(ctx, key); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(ctx, `DELETE FROM data_exports WHERE user_id = $1`, userID)
+	return err
+}
+
+// removeObject deletes a file from the bucket. A file that is already gone is fine.
+func removeObject(ctx context.Context, key string) error {
+	err := exports.Remove(ctx, key)
+	if errors.Is(err, objects.ErrObjectNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('PENDING', 'READY', 'FAILED', 'EXPIRED')),
+    object_key VARCHAR(255),
+    error TEXT,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_data_exports_user_id ON data_exports(user_id, requested_at);
+CREATE UNIQUE INDEX idx_data_exports_pending ON data_exports(user_id) WHERE status = 'PENDING';
+
+-- Accounts waiting out the grace period before their data is erased
+CREATE TABLE account_deletions (
+    user_id BIGINT PRIMARY KEY,
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    scheduled_for TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_account_deletions_scheduled_for ON account_deletions(scheduled_for);
+
+-- Proof that an account was erased, without any of its data
+CREATE TABLE erasure_tombstones (
+    user_id BIGINT PRIMARY KEY,
+    requested_at TIMESTAMPTZ NOT NULL,
+    erased_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,220 @@
+// Package privacy lets users export their personal data and erase their account.
+package privacy
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"encore.app/admin"
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.app/trainee"
+	"encore.dev/beta/errs"
+	"encore.dev/cron"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// deletionGracePeriod is how long a user can change their mind after asking to delete their account
+const deletionGracePeriod = 30 * 24 * time.Hour
+
+// Actions recorded in the audit log
+const (
+	actionRequestExport  = "user.request_export"
+	actionRequestErasure = "user.request_erasure"
+	actionCancelErasure  = "user.cancel_erasure"
+)
+
+// AccountDeletion is a pending deletion of an account
+type AccountDeletion struct {
+	RequestedAt  time.Time `json:"requested_at"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+// DeleteAccountParams confirms the deletion of the current user's account
+type DeleteAccountParams struct {
+	Password string `json:"password"`
+}
+
+// DeleteMyAccount schedules the erasure of the current user's account and personal data.
+// Until the grace period ends the account keeps working and the deletion can be cancelled.
+//
+//encore:api auth method=POST path=/privacy/account/delete
+func DeleteMyAccount(ctx context.Context, params *DeleteAccountParams) (*AccountDeletion, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+
+	// Call the admin service
+	if err := admin.CheckPassword(ctx, caller.UserID, &admin.CheckPasswordParams{Password: params.Password}); err != nil {
+		return nil, err
+	}
+
+	// Asking again keeps the original schedule
+	_, err = db.Exec(ctx, `
+        INSERT INTO account_deletions (user_id, requested_at, scheduled_for)
+        VALUES ($1, NOW(), $2)
+        ON CONFLICT (user_id) DO NOTHING
+    `, caller.UserID, time.Now().Add(deletionGracePeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	var d AccountDeletion
+	err = db.QueryRow(ctx, `
+        SELECT requested_at, scheduled_for
+        FROM account_deletions
+        WHERE user_id = $1
+    `, caller.UserID).Scan(&d.RequestedAt, &d.ScheduledFor)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     actionRequestErasure,
+		EntityType: "user",
+		EntityID:   strconv.Itoa(caller.UserID),
+		After:      &d,
+	})
+	return &d, nil
+}
+
+// CancelAccountDeletion keeps the current user's account after all
+//
+//encore:api auth method=POST path=/privacy/account/delete/cancel
+func CancelAccountDeletion(ctx context.Context) error {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return err
+	}
+
+	var d AccountDeletion
+	err = db.QueryRow(ctx, `
+        DELETE FROM account_deletions
+        WHERE user_id = $1
+        RETURNING requested_at, scheduled_for
+    `, caller.UserID).Scan(&d.RequestedAt, &d.ScheduledFor)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return &errs.Error{
+			Code:    errs.NotFound,
+			Message: "no account deletion is pending",
+		}
+	} else if err != nil {
+		return err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     actionCancelErasure,
+		EntityType: "user",
+		EntityID:   strconv.Itoa(caller.UserID),
+		Before:     &d,
+	})
+	return nil
+}
+
+// Erase accounts once their grace period is over
+var _ = cron.NewJob("erase-accounts", cron.JobConfig{
+	Title:    "Erase accounts after the deletion grace period",
+	Every:    1 * cron.Hour,
+	Endpoint: EraseDueAccounts,
+})
+
+// EraseDueAccounts erases the accounts whose grace period is over.
+// An account that fails is retried on the next run.
+//
+//encore:api private method=POST path=/privacy/account/erase-due
+func EraseDueAccounts(ctx context.Context) error {
+	rows, err := db.Query(ctx, `
+        SELECT user_id, requested_at
+        FROM account_deletions
+        WHERE scheduled_for <= NOW()
+        ORDER BY scheduled_for
+        LIMIT 100
+    `)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type due struct {
+		userID      int
+		requestedAt time.Time
+	}
+	var accounts []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.userID, &d.requestedAt); err != nil {
+			return err
+		}
+		accounts = append(accounts, d)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, d := range accounts {
+		if err := eraseAccount(ctx, d.userID, d.requestedAt); err != nil {
+			rlog.Error("could not erase account", "user_id", d.userID, "err", err)
+		}
+	}
+	return nil
+}
+
+// eraseAccount erases a user's data in every service and leaves a tombstone.
+// Each step can be repeated, so a failed erasure is simply run again.
+func eraseAccount(ctx context.Context, userID int, requestedAt time.Time) error {
+	// Call the trainee service
+	if err := trainee.EraseUserData(ctx, userID); err != nil {
+		return err
+	}
+
+	// Call the admin service
+	if err := admin.EraseUser(ctx, userID); err != nil {
+		return err
+	}
+
+	// Call the audit service
+	if err := audit.Redact(ctx, &audit.RedactParams{UserID: userID}); err != nil {
+		return err
+	}
+
+	if err := removeExports(ctx, userID); err != nil {
+		return err
+	}
+
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO erasure_tombstones (user_id, requested_at, erased_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (user_id) DO NOTHING
+    `, userID, requestedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM account_deletions WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	rlog.Info("account erased", "user_id", userID)
+	return nil
+}
+
+// Define the database connection
+var db = sqldb.Named("privacy")
@@ -0,0 +1,414 @@
+package trainee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"encore.app/admin"
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+const maxTraineesPerAssignment = 100
+
+var (
+	errAssignmentNotFound = &errs.Error{
+		Code:    errs.NotFound,
+		Message: "assignment not found",
+	}
+	errAssignmentCompleted = &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: "the assignment is already completed",
+	}
+)
+
+// AssignmentStatus is where an assignment stands
+type AssignmentStatus string
+
+const (
+	// AssignmentUpcoming assignments are open and due later, or whenever
+	AssignmentUpcoming AssignmentStatus = "UPCOMING"
+	// AssignmentOverdue assignments are open past their due date
+	AssignmentOverdue AssignmentStatus = "OVERDUE"
+	// AssignmentCompleted assignments have a workout logged against them
+	AssignmentCompleted AssignmentStatus = "COMPLETED"
+)
+
+// Valid reports whether s is a known status
+func (s AssignmentStatus) Valid() bool {
+	switch s {
+	case AssignmentUpcoming, AssignmentOverdue, AssignmentCompleted:
+		return true
+	}
+	return false
+}
+
+// Assignment is a workout template a trainer assigned to a trainee. It is
+// completed when the trainee logs a workout against it.
+type Assignment struct {
+	ID          int              `json:"id"`
+	TraineeID   int              `json:"trainee_id"`
+	Workout     *Workout         `json:"workout"`
+	AssignedBy  *int             `json:"assigned_by,omitempty"`
+	AssignedAt  time.Time        `json:"assigned_at"`
+	DueDate     *time.Time       `json:"due_date,omitempty"`
+	Completed   bool             `json:"completed"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+	Status      AssignmentStatus `json:"status"`
+}
+
+// MyWorkoutsParams filters the assignments of the current user
+type MyWorkoutsParams struct {
+	// Status is UPCOMING, OVERDUE or COMPLETED; without one every assignment is listed
+	Status string `query:"status"`
+}
+
+// AssignmentsResponse lists assignments
+type AssignmentsResponse struct {
+	Assignments []*Assignment `json:"assignments"`
+}
+
+// AssignWorkoutParams contains the trainee to assign a workout to.
+// Without a due date the assignment stays upcoming until it is completed.
+type AssignWorkoutParams struct {
+	TraineeID int        `json:"trainee_id"`
+	DueDate   *time.Time `json:"due_date,omitempty"`
+}
+
+// BulkAssignWorkoutParams contains the trainees to assign a workout to, all
+// with the same due date
+type BulkAssignWorkoutParams struct {
+	TraineeIDs []int      `json:"trainee_ids"`
+	DueDate    *time.Time `json:"due_date,omitempty"`
+}
+
+// AssignWorkout assigns a workout template the current user can see to a
+// trainee they coach. Administrators may assign to any trainee.
+//
+//encore:api auth method=POST path=/trainee/workouts/:id/assignments tag:trainer tag:scope_workouts_write
+func AssignWorkout(ctx context.Context, id int, params *AssignWorkoutParams) (*Assignment, error) {
+	assignments, err := assignWorkout(ctx, id, []int{params.TraineeID}, params.DueDate)
+	if err != nil {
+		return nil, err
+	}
+	return assignments[0], nil
+}
+
+// BulkAssignWorkout assigns a workout template the current user can see to
+// several trainees they coach. Either every trainee is assigned the workout
+// or none is.
+//
+//encore:api auth method=POST path=/trainee/workouts/:id/assignments/bulk tag:trainer tag:scope_workouts_write
+func BulkAssignWorkout(ctx context.Context, id int, params *BulkAssignWorkoutParams) (*AssignmentsResponse, error) {
+	assignments, err := assignWorkout(ctx, id, params.TraineeIDs, params.DueDate)
+	if err != nil {
+		return nil, err
+	}
+	return &AssignmentsResponse{Assignments: assignments}, nil
+}
+
+// UnassignWorkout removes an assignment that isn't completed yet. Trainers
+// may remove the assignments they made and those of the trainees they coach.
+//
+//encore:api auth method=DELETE path=/trainee/assignments/:id tag:trainer tag:scope_workouts_write
+func UnassignWorkout(ctx context.Context, id int) error {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return err
+	}
+	if err := caller.Require(authz.PermAssignWorkouts); err != nil {
+		return err
+	}
+
+	assignment, err := repo.GetAssignment(ctx, id)
+	if err != nil {
+		return err
+	}
+	ok, err := canManageTrainee(ctx, caller, assignment.TraineeID)
+	if err != nil {
+		return err
+	}
+	if !ok && (assignment.AssignedBy == nil || *assignment.AssignedBy != caller.UserID) {
+		return errAssignmentNotFound
+	}
+	if assignment.Completed {
+		return errAssignmentCompleted
+	}
+
+	if err := repo.UnassignWorkout(ctx, id); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "workout.unassign",
+		EntityType: "assigned_workout",
+		EntityID:   strconv.Itoa(id),
+		Before:     assignment,
+	})
+	return nil
+}
+
+// GetTraineeAssignments retrieves the assignments of a trainee with a status,
+// or all of them for an empty status
+func GetTraineeAssignments(ctx context.Context, traineeID int, status AssignmentStatus) ([]*Assignment, error) {
+	if status != "" && !status.Valid() {
+		return nil, invalidArgument("status must be UPCOMING, OVERDUE or COMPLETED")
+	}
+	return repo.Assignments(ctx, traineeID, status)
+}
+
+// assignWorkout assigns a workout to trainees on behalf of the current user
+// and returns the assignments ordered by trainee
+func assignWorkout(ctx context.Context, workoutID int, traineeIDs []int, dueDate *time.Time) ([]*Assignment, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	if err := caller.Require(authz.PermAssignWorkouts); err != nil {
+		return nil, err
+	}
+	if err := checkWorkoutVisible(ctx, caller, workoutID); err != nil {
+		return nil, err
+	}
+
+	// Validate the input
+	switch {
+	case len(traineeIDs) == 0:
+		return nil, invalidArgument("at least one trainee is required")
+	case len(traineeIDs) > maxTraineesPerAssignment:
+		return nil, invalidArgument(fmt.Sprintf("a workout can be assigned to at most %d trainees at once", maxTraineesPerAssignment))
+	case dueDate != nil && !dueDate.After(time.Now()):
+		return nil, invalidArgument("the due date must be in the future")
+	}
+
+	// A trainee listed twice is assigned the workout once
+	ids := slices.Clone(traineeIDs)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	for _, traineeID := range ids {
+		if err := checkAssignable(ctx, caller, traineeID); err != nil {
+			return nil, err
+		}
+	}
+
+	assignments, err := repo.AssignWorkout(ctx, workoutID, caller.UserID, ids, dueDate)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range assignments {
+		audit.Record(ctx, audit.Change{
+			Action:     "workout.assign",
+			EntityType: "assigned_workout",
+			EntityID:   strconv.Itoa(a.ID),
+			After:      a,
+		})
+	}
+	return assignments, nil
+}
+
+// checkAssignable returns an error unless the caller may assign workouts to
+// a user who isn't deleted
+func checkAssignable(ctx context.Context, caller *authz.Caller, traineeID int) error {
+	ok, err := canManageTrainee(ctx, caller, traineeID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: fmt.Sprintf("you don't coach trainee %d", traineeID),
+		}
+	}
+
+	user, err := GetUser(ctx, traineeID)
+	if errors.Is(err, sqldb.ErrNoRows) || (err == nil && user.Status == string(admin.UserStatusDeleted)) {
+		return errTraineeNotFound
+	}
+	return err
+}
+
+// assignmentStatus returns where an assignment stands at a time
+func assignmentStatus(a *Assignment, now time.Time) AssignmentStatus {
+	switch {
+	case a.Completed:
+		return AssignmentCompleted
+	case a.DueDate != nil && a.DueDate.Before(now):
+		return AssignmentOverdue
+	}
+	return AssignmentUpcoming
+}
+
+// Assignments returns the assignments of a trainee with a status. Open
+// assignments of deleted templates are left out.
+func (r *postgresRepository) Assignments(ctx context.Context, traineeID int, status AssignmentStatus) ([]*Assignment, error) {
+	// Upcoming and overdue assignments are listed by due date, the others
+	// most recent first
+	condition, order := "TRUE", "a.assigned_at DESC, a.id DESC"
+	switch status {
+	case AssignmentUpcoming:
+		condition = "NOT a.completed AND (a.due_date IS NULL OR a.due_date >= NOW())"
+		order = "a.due_date NULLS LAST, a.id"
+	case AssignmentOverdue:
+		condition = "NOT a.completed AND a.due_date < NOW()"
+		order = "a.due_date, a.id"
+	case AssignmentCompleted:
+		condition = "a.completed"
+		order = "a.completed_at DESC NULLS LAST, a.id DESC"
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT `+assignmentColumns+`, `+workoutColumns+`
+		FROM assigned_workouts a
+		JOIN workout_templates w ON w.id = a.workout_id
+		WHERE a.trainee_id = $1 AND (w.deleted_at IS NULL OR a.completed) AND `+condition+`
+		ORDER BY `+order,
+		traineeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	assignments := []*Assignment{}
+	var workouts []*Workout
+	for rows.Next() {
+		a, err := scanAssignment(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+		workouts = append(workouts, a.Workout)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.addExercises(ctx, workouts); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// GetAssignment returns an assignment with its template
+func (r *postgresRepository) GetAssignment(ctx context.Context, assignmentID int) (*Assignment, error) {
+	a, err := scanAssignment(r.db.QueryRow(ctx, `
+		SELECT `+assignmentColumns+`, `+workoutColumns+`
+		FROM assigned_workouts a
+		JOIN workout_templates w ON w.id = a.workout_id
+		WHERE a.id = $1
+	`, assignmentID), time.Now())
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errAssignmentNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := r.addExercises(ctx, []*Workout{a.Workout}); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AssignWorkout inserts an assignment of a template that is not deleted for each trainee
+func (r *postgresRepository) AssignWorkout(ctx context.Context, workoutID, assignedBy int, traineeIDs []int, dueDate *time.Time) ([]*Assignment, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workout, err := scanWorkout(tx.QueryRow(ctx, `
+		SELECT `+workoutColumns+`
+		FROM workout_templates w
+		WHERE w.id = $1 AND w.deleted_at IS NULL
+		FOR SHARE
+	`, workoutID))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errWorkoutNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO assigned_workouts (trainee_id, workout_id, assigned_by, assigned_at, due_date, completed, created_at, updated_at)
+		SELECT t.id, $1, $2, NOW(), $4, FALSE, NOW(), NOW()
+		FROM unnest($3::BIGINT[]) AS t(id)
+		RETURNING id, trainee_id, assigned_at
+	`, workoutID, assignedBy, traineeIDs, dueDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	assignments := []*Assignment{}
+	for rows.Next() {
+		a := &Assignment{
+			Workout:    workout,
+			AssignedBy: &assignedBy,
+			DueDate:    dueDate,
+		}
+		if err := rows.Scan(&a.ID, &a.TraineeID, &a.AssignedAt); err != nil {
+			return nil, err
+		}
+		a.Status = assignmentStatus(a, now)
+		assignments = append(assignments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(assignments, func(a, b *Assignment) int { return a.TraineeID - b.TraineeID })
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := r.addExercises(ctx, []*Workout{workout}); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// UnassignWorkout deletes an assignment that is not completed
+func (r *postgresRepository) UnassignWorkout(ctx context.Context, assignmentID int) error {
+	res, err := r.db.Exec(ctx, `
+		DELETE FROM assigned_workouts
+		WHERE id = $1 AND NOT completed
+	`, assignmentID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return errAssignmentNotFound
+	}
+	return nil
+}
+
+const assignmentColumns = `a.id, a.trainee_id, a.assigned_by, a.assigned_at, a.due_date, a.completed, a.completed_at`
+
+// scanAssignment reads the assignmentColumns followed by the workoutColumns
+// and works out the status of the assignment at now
+func scanAssignment(row interface{ Scan(...interface{}) error }, now time.Time) (*Assignment, error) {
+	var a Assignment
+	w, err := scanWorkout(row,
+		&a.ID,
+		&a.TraineeID,
+		&a.AssignedBy,
+		&a.AssignedAt,
+		&a.DueDate,
+		&a.Completed,
+		&a.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	a.Workout = w
+	a.Status = assignmentStatus(&a, now)
+	return &a, nil
+}
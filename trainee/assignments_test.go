@@ -0,0 +1,198 @@
+//go:build encore_app
+
+package trainee
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"encore.app/admin"
+	"encore.app/authz"
+	"encore.app/authz/authztest"
+	"encore.dev/beta/errs"
+)
+
+func TestAssignWorkout(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	strangerID := createTestUser(t, ctx, authz.RoleTrainee)
+	coachTestTrainee(t, ctx, trainerID, traineeID)
+	workoutID := createTestWorkout(t, ctx, trainerID)
+	authztest.AuthenticateAs(trainerID, authz.RoleTrainer)
+
+	due := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	a, err := AssignWorkout(ctx, workoutID, &AssignWorkoutParams{TraineeID: traineeID, DueDate: &due})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.TraineeID != traineeID || a.Workout.ID != workoutID || a.AssignedBy == nil || *a.AssignedBy != trainerID {
+		t.Errorf("got %+v, want an assignment of workout %d to %d by %d", a, workoutID, traineeID, trainerID)
+	}
+	if a.DueDate == nil || !a.DueDate.Equal(due) || a.Completed || a.Status != AssignmentUpcoming {
+		t.Errorf("got due date %v and status %s, want %s and UPCOMING", a.DueDate, a.Status, due)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name      string
+		workoutID int
+		params    *AssignWorkoutParams
+		code      errs.ErrCode
+	}{
+		{"trainee of another trainer", workoutID, &AssignWorkoutParams{TraineeID: strangerID}, errs.PermissionDenied},
+		{"due date in the past", workoutID, &AssignWorkoutParams{TraineeID: traineeID, DueDate: &past}, errs.InvalidArgument},
+		{"unknown workout", -1, &AssignWorkoutParams{TraineeID: traineeID}, errs.NotFound},
+	}
+	for _, tt := range tests {
+		if _, err := AssignWorkout(ctx, tt.workoutID, tt.params); errs.Code(err) != tt.code {
+			t.Errorf("%s: got %v, want %s", tt.name, err, tt.code)
+		}
+	}
+
+	// Trainees can't assign workouts
+	authztest.AuthenticateAs(traineeID, authz.RoleTrainee)
+	if _, err := AssignWorkout(ctx, workoutID, &AssignWorkoutParams{TraineeID: traineeID}); errs.Code(err) != errs.PermissionDenied {
+		t.Errorf("got %v assigning as a trainee, want PermissionDenied", err)
+	}
+
+	// Deleted users can't be assigned workouts, not even by administrators
+	deletedID := createTestUserWithStatus(t, ctx, admin.UserStatusDeleted, authz.RoleTrainee)
+	authztest.AuthenticateAs(createTestUser(t, ctx, authz.RoleAdmin), authz.RoleAdmin)
+	if _, err := AssignWorkout(ctx, workoutID, &AssignWorkoutParams{TraineeID: deletedID}); !errors.Is(err, errTraineeNotFound) {
+		t.Errorf("got %v assigning to a deleted user, want errTraineeNotFound", err)
+	}
+	if _, err := AssignWorkout(ctx, workoutID, &AssignWorkoutParams{TraineeID: strangerID}); err != nil {
+		t.Errorf("got %v assigning as an administrator", err)
+	}
+}
+
+func TestBulkAssignWorkout(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	first := createTestUser(t, ctx, authz.RoleTrainee)
+	second := createTestUser(t, ctx, authz.RoleTrainee)
+	strangerID := createTestUser(t, ctx, authz.RoleTrainee)
+	coachTestTrainee(t, ctx, trainerID, first)
+	coachTestTrainee(t, ctx, trainerID, second)
+	workoutID := createTestWorkout(t, ctx, trainerID)
+	authztest.AuthenticateAs(trainerID, authz.RoleTrainer)
+
+	// A trainee listed twice is assigned the workout once
+	resp, err := BulkAssignWorkout(ctx, workoutID, &BulkAssignWorkoutParams{TraineeIDs: []int{second, first, second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Assignments) != 2 || resp.Assignments[0].TraineeID != first || resp.Assignments[1].TraineeID != second {
+		t.Fatalf("got %+v, want an assignment to %d and to %d", resp.Assignments, first, second)
+	}
+
+	// Either every trainee is assigned the workout or none is
+	_, err = BulkAssignWorkout(ctx, workoutID, &BulkAssignWorkoutParams{TraineeIDs: []int{first, strangerID}})
+	if errs.Code(err) != errs.PermissionDenied {
+		t.Errorf("got %v including a trainee of another trainer, want PermissionDenied", err)
+	}
+	assignments, err := GetTraineeAssignments(ctx, first, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 1 {
+		t.Errorf("got %d assignments after the rejected bulk assignment, want 1", len(assignments))
+	}
+
+	tooMany := make([]int, maxTraineesPerAssignment+1)
+	for _, ids := range [][]int{nil, tooMany} {
+		_, err := BulkAssignWorkout(ctx, workoutID, &BulkAssignWorkoutParams{TraineeIDs: ids})
+		if errs.Code(err) != errs.InvalidArgument {
+			t.Errorf("got %v assigning to %d trainees, want InvalidArgument", err, len(ids))
+		}
+	}
+}
+
+func TestUnassignWorkout(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	otherTrainer := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	coachTestTrainee(t, ctx, trainerID, traineeID)
+	workoutID := createTestWorkout(t, ctx, trainerID)
+	open := assignTestWorkout(t, ctx, workoutID, trainerID, traineeID, nil)
+	completed := assignTestWorkout(t, ctx, workoutID, trainerID, traineeID, nil)
+	_, err := LogWorkout(ctx, &LogWorkoutRequest{
+		TraineeID:         traineeID,
+		WorkoutID:         workoutID,
+		AssignedWorkoutID: &completed.ID,
+		DurationMinutes:   30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Other trainers can't tell the assignment exists
+	authztest.AuthenticateAs(otherTrainer, authz.RoleTrainer)
+	if err := UnassignWorkout(ctx, open.ID); !errors.Is(err, errAssignmentNotFound) {
+		t.Errorf("got %v unassigning as another trainer, want errAssignmentNotFound", err)
+	}
+
+	authztest.AuthenticateAs(trainerID, authz.RoleTrainer)
+	if err := UnassignWorkout(ctx, completed.ID); !errors.Is(err, errAssignmentCompleted) {
+		t.Errorf("got %v unassigning a completed assignment, want errAssignmentCompleted", err)
+	}
+	if err := UnassignWorkout(ctx, open.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnassignWorkout(ctx, open.ID); !errors.Is(err, errAssignmentNotFound) {
+		t.Errorf("got %v unassigning twice, want errAssignmentNotFound", err)
+	}
+
+	assignments, err := GetTraineeAssignments(ctx, traineeID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 1 || assignments[0].ID != completed.ID {
+		t.Errorf("got %+v, want only the completed assignment", assignments)
+	}
+}
+
+func TestMyWorkoutsStatus(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	workoutID := createTestWorkout(t, ctx, trainerID)
+	past := time.Now().Add(-time.Hour)
+	overdue := assignTestWorkout(t, ctx, workoutID, trainerID, traineeID, &past)
+	upcoming := assignTestWorkout(t, ctx, workoutID, trainerID, traineeID, nil)
+	authztest.AuthenticateAs(traineeID, authz.RoleTrainee)
+
+	tests := []struct {
+		status string
+		want   []int
+	}{
+		{"", []int{upcoming.ID, overdue.ID}},
+		{"UPCOMING", []int{upcoming.ID}},
+		{"OVERDUE", []int{overdue.ID}},
+		{"COMPLETED", nil},
+	}
+	for _, tt := range tests {
+		resp, err := MyWorkouts(ctx, &MyWorkoutsParams{Status: tt.status})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, a := range resp.Assignments {
+			got = append(got, a.ID)
+		}
+		slices.Sort(got)
+		slices.Sort(tt.want)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("got assignments %v with status %q, want %v", got, tt.status, tt.want)
+		}
+	}
+
+	if _, err := MyWorkouts(ctx, &MyWorkoutsParams{Status: "upcoming"}); errs.Code(err) != errs.InvalidArgument {
+		t.Errorf("got %v for a lower case status, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,546 @@
+package trainee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+const (
+	maxRounds       = 100
+	maxPercentOneRM = 120
+)
+
+var errWorkoutBlockNotFound = &errs.Error{
+	Code:    errs.NotFound,
+	Message: "block not found in the workout",
+}
+
+// tempoPattern matches a lifting tempo such as 31X0 or 3-1-X-0: the seconds
+// of the lowering, bottom, lifting and top phases, X meaning explosive
+var tempoPattern = regexp.MustCompile(`^[0-9X]{4}$|^[0-9X](-[0-9X]){3}$`)
+
+// BlockType is how the exercises of a block are done
+type BlockType string
+
+const (
+	// BlockSuperset does its exercises back to back, for a number of rounds
+	BlockSuperset BlockType = "SUPERSET"
+	// BlockCircuit goes through its exercises as stations, for a number of rounds
+	BlockCircuit BlockType = "CIRCUIT"
+	// BlockEMOM starts the exercises at the start of every interval, for a number of intervals
+	BlockEMOM BlockType = "EMOM"
+	// BlockAMRAP repeats its exercises as often as possible until the time cap
+	BlockAMRAP BlockType = "AMRAP"
+	// BlockTabata alternates work and rest intervals, 8 rounds of 20 and 10 seconds by default
+	BlockTabata BlockType = "TABATA"
+)
+
+// Valid reports whether t is a known block type
+func (t BlockType) Valid() bool {
+	switch t {
+	case BlockSuperset, BlockCircuit, BlockEMOM, BlockAMRAP, BlockTabata:
+		return true
+	}
+	return false
+}
+
+// minExercises is the number of exercises a block of the type needs
+func (t BlockType) minExercises() int {
+	if t == BlockSuperset || t == BlockCircuit {
+		return 2
+	}
+	return 1
+}
+
+// WorkoutBlock groups consecutive exercises of a template that are done
+// together. WorkSeconds is the length of each work interval, or the time cap
+// of an AMRAP; RestSeconds is the rest after each interval or exercise and
+// RoundRestSeconds the rest between rounds.
+type WorkoutBlock struct {
+	ID               int       `json:"id"`
+	Type             BlockType `json:"type"`
+	Name             *string   `json:"name,omitempty"`
+	Rounds           *int      `json:"rounds,omitempty"`
+	WorkSeconds      *int      `json:"work_seconds,omitempty"`
+	RestSeconds      *int      `json:"rest_seconds,omitempty"`
+	RoundRestSeconds *int      `json:"round_rest_seconds,omitempty"`
+	Notes            *string   `json:"notes,omitempty"`
+
+	// ExerciseIDs are the workout exercises done in the block, in order
+	ExerciseIDs []int `json:"exercise_ids"`
+}
+
+// SetTarget is what a single set of an exercise aims for. A list of targets
+// gives each set its own, e.g. 5, 3 and 1 reps for a 5/3/1 scheme.
+type SetTarget struct {
+	Reps *int `json:"reps,omitempty"`
+
+	// RPE is the rate of perceived exertion from 1 to 10, in steps of 0.5
+	RPE *float64 `json:"rpe,omitempty"`
+
+	// Tempo is the lifting tempo, such as 31X0 or 3-1-X-0
+	Tempo *string `json:"tempo,omitempty"`
+
+	// PercentOneRM is the weight as a percentage of the trainee's one-rep max
+	PercentOneRM *float64 `json:"percent_one_rm,omitempty"`
+}
+
+// WorkoutBlockParams describes a block of a workout template. Exercises lists
+// the workout exercise IDs of the exercises in the block; when a template is
+// created they are positions in its list of exercises instead. Tabata blocks
+// default to 8 rounds of 20 seconds work and 10 seconds rest, and EMOM
+// intervals to a minute.
+type WorkoutBlockParams struct {
+	Type             BlockType `json:"type"`
+	Name             *string   `json:"name,omitempty"`
+	Rounds           *int      `json:"rounds,omitempty"`
+	WorkSeconds      *int      `json:"work_seconds,omitempty"`
+	RestSeconds      *int      `json:"rest_seconds,omitempty"`
+	RoundRestSeconds *int      `json:"round_rest_seconds,omitempty"`
+	Notes            *string   `json:"notes,omitempty"`
+	Exercises        []int     `json:"exercises"`
+}
+
+// AddWorkoutBlock groups exercises of a template the current user wrote into a block
+//
+//encore:api auth method=POST path=/trainee/workouts/:id/blocks tag:trainer tag:scope_workouts_write
+func AddWorkoutBlock(ctx context.Context, id int, params *WorkoutBlockParams) (*Workout, error) {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWorkoutBlock(params); err != nil {
+		return nil, err
+	}
+
+	after, err := repo.AddWorkoutBlock(ctx, id, params)
+	if err != nil {
+		return nil, err
+	}
+	recordWorkoutUpdate(ctx, before, after)
+	return after, nil
+}
+
+// UpdateWorkoutBlock replaces a block of a template the current user wrote,
+// including which exercises are in it
+//
+//encore:api auth method=PUT path=/trainee/workouts/:id/blocks/:block tag:trainer tag:scope_workouts_write
+func UpdateWorkoutBlock(ctx context.Context, id int, block int, params *WorkoutBlockParams) (*Workout, error) {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWorkoutBlock(params); err != nil {
+		return nil, err
+	}
+
+	after, err := repo.UpdateWorkoutBlock(ctx, id, block, params)
+	if err != nil {
+		return nil, err
+	}
+	recordWorkoutUpdate(ctx, before, after)
+	return after, nil
+}
+
+// RemoveWorkoutBlock removes a block from a template the current user wrote.
+// Its exercises stay in the template on their own.
+//
+//encore:api auth method=DELETE path=/trainee/workouts/:id/blocks/:block tag:trainer tag:scope_workouts_write
+func RemoveWorkoutBlock(ctx context.Context, id int, block int) (*Workout, error) {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := repo.RemoveWorkoutBlock(ctx, id, block)
+	if err != nil {
+		return nil, err
+	}
+	recordWorkoutUpdate(ctx, before, after)
+	return after, nil
+}
+
+// validateWorkoutBlock checks a block on its own and fills in the defaults of
+// its type. Whether its exercises fit it is checked when they are saved.
+func validateWorkoutBlock(p *WorkoutBlockParams) error {
+	if !p.Type.Valid() {
+		return invalidArgument("unknown block type")
+	}
+
+	// Fill in the defaults
+	switch p.Type {
+	case BlockEMOM:
+		if p.WorkSeconds == nil {
+			p.WorkSeconds = intValue(60)
+		}
+	case BlockTabata:
+		if p.Rounds == nil {
+			p.Rounds = intValue(8)
+		}
+		if p.WorkSeconds == nil {
+			p.WorkSeconds = intValue(20)
+		}
+		if p.RestSeconds == nil {
+			p.RestSeconds = intValue(10)
+		}
+	}
+	if p.Name != nil {
+		s := strings.TrimSpace(*p.Name)
+		p.Name = &s
+	}
+
+	// Check what the type allows
+	switch {
+	case p.Type == BlockAMRAP && p.Rounds != nil:
+		return invalidArgument("AMRAP blocks are done as often as possible; set work_seconds as the time cap instead of rounds")
+	case p.Type == BlockAMRAP && p.WorkSeconds == nil:
+		return invalidArgument("AMRAP blocks need work_seconds as the time cap")
+	case p.Type != BlockAMRAP && p.Rounds == nil:
+		return invalidArgument(fmt.Sprintf("%s blocks need a number of rounds", p.Type))
+	case p.Type == BlockSuperset && p.WorkSeconds != nil:
+		return invalidArgument("SUPERSET blocks are not timed")
+	case (p.Type == BlockEMOM || p.Type == BlockAMRAP) && (p.RestSeconds != nil || p.RoundRestSeconds != nil):
+		return invalidArgument(fmt.Sprintf("%s blocks rest whenever the work is done, so they take no rest times", p.Type))
+	case p.Type == BlockTabata && p.RoundRestSeconds != nil:
+		return invalidArgument("TABATA blocks only rest between intervals")
+	}
+
+	// Check the values
+	switch {
+	case p.Rounds != nil && (*p.Rounds < 1 || *p.Rounds > maxRounds):
+		return invalidArgument(fmt.Sprintf("rounds must be between 1 and %d", maxRounds))
+	case p.WorkSeconds != nil && (*p.WorkSeconds < 1 || *p.WorkSeconds > maxExerciseSeconds):
+		return invalidArgument(fmt.Sprintf("work must be between 1 and %d seconds", maxExerciseSeconds))
+	case p.RestSeconds != nil && (*p.RestSeconds < 0 || *p.RestSeconds > maxExerciseSeconds):
+		return invalidArgument(fmt.Sprintf("rest must be between 0 and %d seconds", maxExerciseSeconds))
+	case p.RoundRestSeconds != nil && (*p.RoundRestSeconds < 0 || *p.RoundRestSeconds > maxExerciseSeconds):
+		return invalidArgument(fmt.Sprintf("rest between rounds must be between 0 and %d seconds", maxExerciseSeconds))
+	case p.Name != nil && utf8.RuneCountInString(*p.Name) > nameMaxLength:
+		return invalidArgument(fmt.Sprintf("block name must be at most %d characters", nameMaxLength))
+	case p.Notes != nil && utf8.RuneCountInString(*p.Notes) > notesMaxLength:
+		return invalidArgument(fmt.Sprintf("notes must be at most %d characters", notesMaxLength))
+	case len(p.Exercises) < p.Type.minExercises():
+		return invalidArgument(fmt.Sprintf("%s blocks need at least %d exercises", p.Type, p.Type.minExercises()))
+	case len(p.Exercises) > maxExercisesPerWorkout:
+		return invalidArgument(fmt.Sprintf("a workout may have at most %d exercises", maxExercisesPerWorkout))
+	}
+	if len(slices.Compact(slices.Sorted(slices.Values(p.Exercises)))) != len(p.Exercises) {
+		return invalidArgument("list each exercise of a block once")
+	}
+	return nil
+}
+
+// validateSetTargets checks the set targets of an exercise against what else
+// it prescribes
+func validateSetTargets(p *WorkoutExerciseParams) error {
+	if len(p.SetTargets) == 0 {
+		return nil
+	}
+	switch {
+	case len(p.SetTargets) > maxSets:
+		return invalidArgument(fmt.Sprintf("an exercise may have at most %d set targets", maxSets))
+	case p.Sets != nil && *p.Sets != len(p.SetTargets):
+		return invalidArgument("give one set target for each set")
+	}
+
+	for i, t := range p.SetTargets {
+		if t == nil || (t.Reps == nil && t.RPE == nil && t.Tempo == nil && t.PercentOneRM == nil) {
+			return invalidArgument(fmt.Sprintf("set target %d is empty", i+1))
+		}
+		if t.Tempo != nil {
+			s := strings.ToUpper(strings.TrimSpace(*t.Tempo))
+			t.Tempo = &s
+		}
+		switch {
+		case t.Reps != nil && p.Reps != nil:
+			return invalidArgument("set reps either for the exercise or for each set, not both")
+		case t.Reps != nil && (*t.Reps < 1 || *t.Reps > maxReps):
+			return invalidArgument(fmt.Sprintf("reps must be between 1 and %d", maxReps))
+		case t.RPE != nil && (*t.RPE < 1 || *t.RPE > 10 || math.Mod(*t.RPE*2, 1) != 0):
+			return invalidArgument("RPE must be between 1 and 10, in steps of 0.5")
+		case t.Tempo != nil && !tempoPattern.MatchString(*t.Tempo):
+			return invalidArgument("tempo must be four phases such as 31X0 or 3-1-X-0")
+		case t.PercentOneRM != nil && (*t.PercentOneRM <= 0 || *t.PercentOneRM > maxPercentOneRM):
+			return invalidArgument(fmt.Sprintf("percentage of one-rep max must be above 0 and at most %d", maxPercentOneRM))
+		}
+	}
+	return nil
+}
+
+// intValue returns a pointer to n, for defaults of optional fields
+func intValue(n int) *int {
+	return &n
+}
+
+// AddWorkoutBlock inserts a block holding exercises of a template
+func (r *postgresRepository) AddWorkoutBlock(ctx context.Context, workoutID int, params *WorkoutBlockParams) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := touchWorkout(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+	if _, err := insertWorkoutBlock(ctx, tx, workoutID, params, params.Exercises); err != nil {
+		return nil, err
+	}
+	if err := checkBlocks(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// UpdateWorkoutBlock replaces the settings and exercises of a block
+func (r *postgresRepository) UpdateWorkoutBlock(ctx context.Context, workoutID, blockID int, params *WorkoutBlockParams) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := touchWorkout(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec(ctx, `
+		UPDATE workout_blocks
+		SET block_type = $3, name = NULLIF($4, ''), rounds = $5, work_seconds = $6, rest_seconds = $7,
+			round_rest_seconds = $8, notes = NULLIF($9, ''), updated_at = NOW()
+		WHERE id = $2 AND workout_id = $1
+	`, workoutID, blockID, string(params.Type), params.Name, params.Rounds, params.WorkSeconds,
+		params.RestSeconds, params.RoundRestSeconds, params.Notes)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() == 0 {
+		return nil, errWorkoutBlockNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE workout_exercises SET block_id = NULL, updated_at = NOW() WHERE block_id = $1
+	`, blockID)
+	if err != nil {
+		return nil, err
+	}
+	if err := setBlockExercises(ctx, tx, workoutID, blockID, params.Exercises); err != nil {
+		return nil, err
+	}
+	if err := checkBlocks(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// RemoveWorkoutBlock deletes a block. The foreign key takes its exercises out of it.
+func (r *postgresRepository) RemoveWorkoutBlock(ctx context.Context, workoutID, blockID int) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := touchWorkout(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec(ctx, `
+		DELETE FROM workout_blocks WHERE id = $2 AND workout_id = $1
+	`, workoutID, blockID)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() == 0 {
+		return nil, errWorkoutBlockNotFound
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// insertWorkoutBlock inserts a workout_blocks row and moves the given workout exercises into it
+func insertWorkoutBlock(ctx context.Context, tx *sqldb.Tx, workoutID int, params *WorkoutBlockParams, exerciseIDs []int) (int, error) {
+	var blockID int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO workout_blocks (workout_id, block_type, name, rounds, work_seconds, rest_seconds,
+			round_rest_seconds, notes, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, NULLIF($8, ''), NOW(), NOW())
+		RETURNING id
+	`, workoutID, string(params.Type), params.Name, params.Rounds, params.WorkSeconds,
+		params.RestSeconds, params.RoundRestSeconds, params.Notes).Scan(&blockID)
+	if err != nil {
+		return 0, err
+	}
+	return blockID, setBlockExercises(ctx, tx, workoutID, blockID, exerciseIDs)
+}
+
+// setBlockExercises moves workout exercises that are in no block into a block
+func setBlockExercises(ctx context.Context, tx *sqldb.Tx, workoutID, blockID int, exerciseIDs []int) error {
+	res, err := tx.Exec(ctx, `
+		UPDATE workout_exercises
+		SET block_id = $2, updated_at = NOW()
+		WHERE workout_id = $1 AND id = ANY($3) AND block_id IS NULL
+	`, workoutID, blockID, exerciseIDs)
+	if err != nil {
+		return err
+	}
+	if int(res.RowsAffected()) != len(exerciseIDs) {
+		return invalidArgument("blocks can only hold exercises of the workout that are in no other block")
+	}
+	return nil
+}
+
+// checkBlocks validates the blocks of a template against their exercises
+// once a change is made, before it is committed
+func checkBlocks(ctx context.Context, tx *sqldb.Tx, workoutID int) error {
+	rows, err := tx.Query(ctx, `
+		SELECT b.block_type, b.rounds, COUNT(we.id),
+			COALESCE(MAX(we.order_index) - MIN(we.order_index) + 1, 0),
+			COUNT(we.sets), COALESCE(MAX(jsonb_array_length(we.set_targets)), 0)
+		FROM workout_blocks b
+		LEFT JOIN workout_exercises we ON we.block_id = b.id
+		WHERE b.workout_id = $1
+		GROUP BY b.id
+		ORDER BY b.id
+	`, workoutID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			typeName                          string
+			rounds                            *int
+			count, span, withSets, maxTargets int
+		)
+		if err := rows.Scan(&typeName, &rounds, &count, &span, &withSets, &maxTargets); err != nil {
+			return err
+		}
+		blockType := BlockType(typeName)
+
+		// Each round does every exercise once, so a round is a set. AMRAP
+		// rounds aren't known ahead, so their exercises get a single target.
+		perRound := 1
+		if rounds != nil {
+			perRound = *rounds
+		}
+		switch {
+		case count < blockType.minExercises():
+			return invalidArgument(fmt.Sprintf("%s blocks need at least %d exercises", blockType, blockType.minExercises()))
+		case span != count:
+			return invalidArgument("the exercises of a block must follow each other")
+		case withSets > 0:
+			return invalidArgument("exercises in a block take no sets; the rounds of the block set how often they are done")
+		case maxTargets > perRound:
+			return invalidArgument("exercises in a block have at most one set target for each round")
+		}
+	}
+	return rows.Err()
+}
+
+// copyWorkoutBlocks copies the blocks of a template to another. It returns
+// the IDs of the blocks copied and of their copies, in the same order.
+func copyWorkoutBlocks(ctx context.Context, tx *sqldb.Tx, fromID, toID int) (from, to []int, err error) {
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(array_agg(id ORDER BY id), '{}') FROM workout_blocks WHERE workout_id = $1
+	`, fromID).Scan(&from)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	to = make([]int, len(from))
+	for i, id := range from {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO workout_blocks (workout_id, block_type, name, rounds, work_seconds, rest_seconds,
+				round_rest_seconds, notes, created_at, updated_at)
+			SELECT $2, block_type, name, rounds, work_seconds, rest_seconds, round_rest_seconds, notes, NOW(), NOW()
+			FROM workout_blocks
+			WHERE id = $1
+			RETURNING id
+		`, id, toID).Scan(&to[i])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return from, to, nil
+}
+
+// addBlocks loads the blocks of workouts whose exercises are loaded, in the
+// order of their first exercise
+func (r *postgresRepository) addBlocks(ctx context.Context, workouts []*Workout, ids []int) error {
+	byID := make(map[int]*WorkoutBlock)
+	rows, err := r.db.Query(ctx, `
+		SELECT id, block_type, name, rounds, work_seconds, rest_seconds, round_rest_seconds, notes
+		FROM workout_blocks
+		WHERE workout_id = ANY($1)
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b WorkoutBlock
+		var blockType string
+		err := rows.Scan(&b.ID, &blockType, &b.Name, &b.Rounds, &b.WorkSeconds, &b.RestSeconds, &b.RoundRestSeconds, &b.Notes)
+		if err != nil {
+			return err
+		}
+		b.Type = BlockType(blockType)
+		b.ExerciseIDs = []int{}
+		byID[b.ID] = &b
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Workouts loaded twice share their blocks, like their exercises
+	added := make(map[int]bool)
+	for _, w := range workouts {
+		w.Blocks = []*WorkoutBlock{}
+		for _, we := range w.Exercises {
+			if we.BlockID == nil {
+				continue
+			}
+			b, ok := byID[*we.BlockID]
+			if !ok {
+				return errors.New("workout exercise in an unknown block")
+			}
+			if !slices.Contains(w.Blocks, b) {
+				w.Blocks = append(w.Blocks, b)
+			}
+			if !added[we.ID] {
+				b.ExerciseIDs = append(b.ExerciseIDs, we.ID)
+				added[we.ID] = true
+			}
+		}
+	}
+	return nil
+}
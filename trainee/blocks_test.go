@@ -0,0 +1,268 @@
+//go:build encore_app
+
+package trainee
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+)
+
+func TestValidateWorkoutBlock(t *testing.T) {
+	n := intValue
+	tests := []struct {
+		name   string
+		params WorkoutBlockParams
+		ok     bool
+	}{
+		{"superset", WorkoutBlockParams{Type: BlockSuperset, Rounds: n(3), RestSeconds: n(0), RoundRestSeconds: n(90), Exercises: []int{1, 2}}, true},
+		{"circuit with timed stations", WorkoutBlockParams{Type: BlockCircuit, Rounds: n(2), WorkSeconds: n(45), RestSeconds: n(15), Exercises: []int{1, 2, 3}}, true},
+		{"EMOM", WorkoutBlockParams{Type: BlockEMOM, Rounds: n(10), Exercises: []int{1}}, true},
+		{"AMRAP", WorkoutBlockParams{Type: BlockAMRAP, WorkSeconds: n(600), Exercises: []int{1, 2}}, true},
+		{"tabata", WorkoutBlockParams{Type: BlockTabata, Exercises: []int{1}}, true},
+		{"unknown type", WorkoutBlockParams{Type: "LADDER", Rounds: n(3), Exercises: []int{1, 2}}, false},
+		{"superset of one exercise", WorkoutBlockParams{Type: BlockSuperset, Rounds: n(3), Exercises: []int{1}}, false},
+		{"circuit of one exercise", WorkoutBlockParams{Type: BlockCircuit, Rounds: n(3), Exercises: []int{1}}, false},
+		{"EMOM without exercises", WorkoutBlockParams{Type: BlockEMOM, Rounds: n(10)}, false},
+		{"superset without rounds", WorkoutBlockParams{Type: BlockSuperset, Exercises: []int{1, 2}}, false},
+		{"timed superset", WorkoutBlockParams{Type: BlockSuperset, Rounds: n(3), WorkSeconds: n(30), Exercises: []int{1, 2}}, false},
+		{"AMRAP with rounds", WorkoutBlockParams{Type: BlockAMRAP, Rounds: n(3), WorkSeconds: n(600), Exercises: []int{1}}, false},
+		{"AMRAP without time cap", WorkoutBlockParams{Type: BlockAMRAP, Exercises: []int{1}}, false},
+		{"AMRAP with rest", WorkoutBlockParams{Type: BlockAMRAP, WorkSeconds: n(600), RestSeconds: n(30), Exercises: []int{1}}, false},
+		{"EMOM with rest between rounds", WorkoutBlockParams{Type: BlockEMOM, Rounds: n(10), RoundRestSeconds: n(60), Exercises: []int{1}}, false},
+		{"tabata with rest between rounds", WorkoutBlockParams{Type: BlockTabata, RoundRestSeconds: n(60), Exercises: []int{1}}, false},
+		{"no rounds", WorkoutBlockParams{Type: BlockCircuit, Rounds: n(0), Exercises: []int{1, 2}}, false},
+		{"too many rounds", WorkoutBlockParams{Type: BlockCircuit, Rounds: n(maxRounds + 1), Exercises: []int{1, 2}}, false},
+		{"no work", WorkoutBlockParams{Type: BlockEMOM, Rounds: n(10), WorkSeconds: n(0), Exercises: []int{1}}, false},
+		{"negative rest", WorkoutBlockParams{Type: BlockCircuit, Rounds: n(3), RestSeconds: n(-1), Exercises: []int{1, 2}}, false},
+		{"too much rest between rounds", WorkoutBlockParams{Type: BlockCircuit, Rounds: n(3), RoundRestSeconds: n(maxExerciseSeconds + 1), Exercises: []int{1, 2}}, false},
+		{"long name", WorkoutBlockParams{Type: BlockEMOM, Rounds: n(10), Name: stringValue(strings.Repeat("a", nameMaxLength+1)), Exercises: []int{1}}, false},
+		{"long notes", WorkoutBlockParams{Type: BlockEMOM, Rounds: n(10), Notes: stringValue(strings.Repeat("a", notesMaxLength+1)), Exercises: []int{1}}, false},
+		{"exercise listed twice", WorkoutBlockParams{Type: BlockSuperset, Rounds: n(3), Exercises: []int{1, 2, 1}}, false},
+	}
+	for _, tt := range tests {
+		err := validateWorkoutBlock(&tt.params)
+		if tt.ok && err != nil {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+		if !tt.ok && errs.Code(err) != errs.InvalidArgument {
+			t.Errorf("%s: got %v, want InvalidArgument", tt.name, err)
+		}
+	}
+}
+
+func TestValidateWorkoutBlockDefaults(t *testing.T) {
+	tabata := &WorkoutBlockParams{Type: BlockTabata, Name: stringValue("  Finisher "), Exercises: []int{1}}
+	if err := validateWorkoutBlock(tabata); err != nil {
+		t.Fatal(err)
+	}
+	if *tabata.Rounds != 8 || *tabata.WorkSeconds != 20 || *tabata.RestSeconds != 10 || *tabata.Name != "Finisher" {
+		t.Errorf("got %d rounds of %ds work and %ds rest named %q, want 8 of 20s and 10s named Finisher",
+			*tabata.Rounds, *tabata.WorkSeconds, *tabata.RestSeconds, *tabata.Name)
+	}
+
+	// Values that are given are kept
+	emom := &WorkoutBlockParams{Type: BlockEMOM, Rounds: intValue(12), WorkSeconds: intValue(90), Exercises: []int{1}}
+	if err := validateWorkoutBlock(emom); err != nil {
+		t.Fatal(err)
+	}
+	if *emom.WorkSeconds != 90 {
+		t.Errorf("got intervals of %ds, want 90s", *emom.WorkSeconds)
+	}
+	emom = &WorkoutBlockParams{Type: BlockEMOM, Rounds: intValue(12), Exercises: []int{1}}
+	if err := validateWorkoutBlock(emom); err != nil {
+		t.Fatal(err)
+	}
+	if *emom.WorkSeconds != 60 {
+		t.Errorf("got intervals of %ds, want a minute", *emom.WorkSeconds)
+	}
+}
+
+func TestValidateSetTargets(t *testing.T) {
+	n := intValue
+	f := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name   string
+		params WorkoutExerciseParams
+		ok     bool
+	}{
+		{"no targets", WorkoutExerciseParams{Sets: n(3), Reps: n(10)}, true},
+		{"5/3/1", WorkoutExerciseParams{Sets: n(3), SetTargets: []*SetTarget{{Reps: n(5)}, {Reps: n(3)}, {Reps: n(1)}}}, true},
+		{"targets without sets", WorkoutExerciseParams{SetTargets: []*SetTarget{{Reps: n(8)}, {Reps: n(8)}}}, true},
+		{"RPE, tempo and percentage", WorkoutExerciseParams{Reps: n(5), SetTargets: []*SetTarget{
+			{RPE: f(7.5), Tempo: stringValue("31X0"), PercentOneRM: f(75)},
+			{RPE: f(10), Tempo: stringValue("3-1-x-0"), PercentOneRM: f(120)},
+		}}, true},
+		{"more targets than sets", WorkoutExerciseParams{Sets: n(2), SetTargets: []*SetTarget{{Reps: n(5)}, {Reps: n(3)}, {Reps: n(1)}}}, false},
+		{"fewer targets than sets", WorkoutExerciseParams{Sets: n(4), SetTargets: []*SetTarget{{Reps: n(5)}}}, false},
+		{"too many targets", WorkoutExerciseParams{SetTargets: make([]*SetTarget, maxSets+1)}, false},
+		{"empty target", WorkoutExerciseParams{SetTargets: []*SetTarget{{Reps: n(5)}, {}}}, false},
+		{"missing target", WorkoutExerciseParams{SetTargets: []*SetTarget{nil}}, false},
+		{"reps twice", WorkoutExerciseParams{Reps: n(5), SetTargets: []*SetTarget{{Reps: n(5)}}}, false},
+		{"no reps", WorkoutExerciseParams{SetTargets: []*SetTarget{{Reps: n(0)}}}, false},
+		{"too many reps", WorkoutExerciseParams{SetTargets: []*SetTarget{{Reps: n(maxReps + 1)}}}, false},
+		{"RPE below 1", WorkoutExerciseParams{SetTargets: []*SetTarget{{RPE: f(0.5)}}}, false},
+		{"RPE above 10", WorkoutExerciseParams{SetTargets: []*SetTarget{{RPE: f(10.5)}}}, false},
+		{"RPE between steps", WorkoutExerciseParams{SetTargets: []*SetTarget{{RPE: f(7.25)}}}, false},
+		{"tempo of three phases", WorkoutExerciseParams{SetTargets: []*SetTarget{{Tempo: stringValue("310")}}}, false},
+		{"tempo with letters", WorkoutExerciseParams{SetTargets: []*SetTarget{{Tempo: stringValue("3A10")}}}, false},
+		{"tempo with mixed separators", WorkoutExerciseParams{SetTargets: []*SetTarget{{Tempo: stringValue("3-1X0")}}}, false},
+		{"no percentage", WorkoutExerciseParams{SetTargets: []*SetTarget{{PercentOneRM: f(0)}}}, false},
+		{"percentage above the maximum", WorkoutExerciseParams{SetTargets: []*SetTarget{{PercentOneRM: f(maxPercentOneRM + 1)}}}, false},
+	}
+	for _, tt := range tests {
+		err := validateSetTargets(&tt.params)
+		if tt.ok && err != nil {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+		if !tt.ok && errs.Code(err) != errs.InvalidArgument {
+			t.Errorf("%s: got %v, want InvalidArgument", tt.name, err)
+		}
+	}
+
+	// Tempos are stored in upper case without surrounding space
+	p := &WorkoutExerciseParams{SetTargets: []*SetTarget{{Tempo: stringValue(" 2-0-x-1 ")}}}
+	if err := validateSetTargets(p); err != nil {
+		t.Fatal(err)
+	}
+	if got := *p.SetTargets[0].Tempo; got != "2-0-X-1" {
+		t.Errorf("got tempo %q, want 2-0-X-1", got)
+	}
+}
+
+func TestCheckBlocks(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	n := intValue
+	exercises := func(params ...*WorkoutExerciseParams) []*WorkoutExerciseParams {
+		for _, p := range params {
+			p.ExerciseID = createTestExercise(t, ctx)
+		}
+		return params
+	}
+
+	tests := []struct {
+		name      string
+		exercises []*WorkoutExerciseParams
+		blocks    []*WorkoutBlockParams
+		ok        bool
+	}{
+		{
+			"superset and circuit",
+			exercises(&WorkoutExerciseParams{Sets: n(3)}, &WorkoutExerciseParams{}, &WorkoutExerciseParams{}, &WorkoutExerciseParams{}, &WorkoutExerciseParams{}),
+			[]*WorkoutBlockParams{
+				{Type: BlockSuperset, Rounds: n(3), Exercises: []int{1, 2}},
+				{Type: BlockCircuit, Rounds: n(2), Exercises: []int{3, 4}},
+			},
+			true,
+		},
+		{
+			"a set target for each round",
+			exercises(&WorkoutExerciseParams{SetTargets: []*SetTarget{{Reps: n(10)}, {Reps: n(8)}, {Reps: n(6)}}}, &WorkoutExerciseParams{}),
+			[]*WorkoutBlockParams{{Type: BlockSuperset, Rounds: n(3), Exercises: []int{0, 1}}},
+			true,
+		},
+		{
+			"AMRAP with a set target",
+			exercises(&WorkoutExerciseParams{SetTargets: []*SetTarget{{Reps: n(10)}}}),
+			[]*WorkoutBlockParams{{Type: BlockAMRAP, WorkSeconds: n(600), Exercises: []int{0}}},
+			true,
+		},
+		{
+			"exercises apart",
+			exercises(&WorkoutExerciseParams{}, &WorkoutExerciseParams{}, &WorkoutExerciseParams{}),
+			[]*WorkoutBlockParams{{Type: BlockSuperset, Rounds: n(3), Exercises: []int{0, 2}}},
+			false,
+		},
+		{
+			"superset of one exercise",
+			exercises(&WorkoutExerciseParams{}, &WorkoutExerciseParams{}),
+			[]*WorkoutBlockParams{{Type: BlockSuperset, Rounds: n(3), Exercises: []int{0}}},
+			false,
+		},
+		{
+			"exercise with sets",
+			exercises(&WorkoutExerciseParams{Sets: n(3)}, &WorkoutExerciseParams{}),
+			[]*WorkoutBlockParams{{Type: BlockSuperset, Rounds: n(3), Exercises: []int{0, 1}}},
+			false,
+		},
+		{
+			"more set targets than rounds",
+			exercises(&WorkoutExerciseParams{SetTargets: []*SetTarget{{Reps: n(10)}, {Reps: n(8)}, {Reps: n(6)}}}, &WorkoutExerciseParams{}),
+			[]*WorkoutBlockParams{{Type: BlockCircuit, Rounds: n(2), Exercises: []int{0, 1}}},
+			false,
+		},
+		{
+			"AMRAP with several set targets",
+			exercises(&WorkoutExerciseParams{SetTargets: []*SetTarget{{Reps: n(10)}, {Reps: n(8)}}}),
+			[]*WorkoutBlockParams{{Type: BlockAMRAP, WorkSeconds: n(600), Exercises: []int{0}}},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		w, err := repo.CreateWorkout(ctx, trainerID, &CreateWorkoutTemplateParams{
+			Name:      tt.name,
+			Exercises: tt.exercises,
+			Blocks:    tt.blocks,
+		})
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%s: got %v", tt.name, err)
+			} else if len(w.Blocks) != len(tt.blocks) {
+				t.Errorf("%s: got %d blocks, want %d", tt.name, len(w.Blocks), len(tt.blocks))
+			}
+			continue
+		}
+		if errs.Code(err) != errs.InvalidArgument {
+			t.Errorf("%s: got %v, want InvalidArgument", tt.name, err)
+		}
+	}
+
+	// Rejected templates are rolled back
+	workouts, err := repo.TrainerWorkouts(ctx, trainerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workouts) != 3 {
+		t.Errorf("got %d templates, want the 3 valid ones", len(workouts))
+	}
+}
+
+func TestAddWorkoutBlockChecksExercises(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	w, err := repo.CreateWorkout(ctx, trainerID, &CreateWorkoutTemplateParams{
+		Name: "Test Workout",
+		Exercises: []*WorkoutExerciseParams{
+			{ExerciseID: createTestExercise(t, ctx)},
+			{ExerciseID: createTestExercise(t, ctx), Sets: intValue(3)},
+			{ExerciseID: createTestExercise(t, ctx)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second, third := w.Exercises[0].ID, w.Exercises[1].ID, w.Exercises[2].ID
+
+	for _, ids := range [][]int{{first, third}, {first, second}, {first, -1}} {
+		_, err := repo.AddWorkoutBlock(ctx, w.ID, &WorkoutBlockParams{Type: BlockSuperset, Rounds: intValue(3), Exercises: ids})
+		if errs.Code(err) != errs.InvalidArgument {
+			t.Errorf("got %v grouping %v, want InvalidArgument", err, ids)
+		}
+	}
+
+	// Once the sets are removed the exercises can be grouped
+	if _, err := db.Exec(ctx, `UPDATE workout_exercises SET sets = NULL WHERE id = $1`, second); err != nil {
+		t.Fatal(err)
+	}
+	w, err = repo.AddWorkoutBlock(ctx, w.ID, &WorkoutBlockParams{Type: BlockSuperset, Rounds: intValue(3), Exercises: []int{first, second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Blocks) != 1 || len(w.Blocks[0].ExerciseIDs) != 2 {
+		t.Errorf("got blocks %+v, want one of the first two exercises", w.Blocks)
+	}
+}
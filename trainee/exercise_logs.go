@@ -0,0 +1,427 @@
+package trainee
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"encore.dev/storage/sqldb"
+)
+
+// maxLoggedWeightKg is the heaviest weight the weight_kg columns hold
+const maxLoggedWeightKg = 999.99
+
+// ExerciseResult is how a logged exercise compares with the template
+type ExerciseResult string
+
+const (
+	// ExerciseCompleted exercises have every planned set done, meeting its targets
+	ExerciseCompleted ExerciseResult = "COMPLETED"
+	// ExercisePartial exercises miss planned sets or fall short of their targets
+	ExercisePartial ExerciseResult = "PARTIAL"
+	// ExerciseSkipped exercises have no set done
+	ExerciseSkipped ExerciseResult = "SKIPPED"
+	// ExerciseExtra exercises were done on top of the template
+	ExerciseExtra ExerciseResult = "EXTRA"
+)
+
+// ExerciseLog is what a trainee did of an exercise during a logged workout.
+// The totals only count the sets that weren't skipped.
+type ExerciseLog struct {
+	ID       int       `json:"id"`
+	Exercise *Exercise `json:"exercise"`
+	Notes    *string   `json:"notes,omitempty"`
+	Sets     []*SetLog `json:"sets"`
+
+	// WorkoutExerciseID is the exercise of the template it was planned as,
+	// while the template still has it
+	WorkoutExerciseID *int `json:"workout_exercise_id,omitempty"`
+
+	// Planned is what the template prescribed when the workout was logged.
+	// Exercises done on top of the template have none.
+	Planned *PlannedExercise `json:"planned,omitempty"`
+
+	SetsCompleted   int            `json:"sets_completed"`
+	RepsCompleted   int            `json:"reps_completed"`
+	DurationSeconds int            `json:"duration_seconds"`
+	MaxWeightKg     *float64       `json:"max_weight_kg,omitempty"`
+	Result          ExerciseResult `json:"result"`
+}
+
+// PlannedExercise is what a template prescribed for an exercise
+type PlannedExercise struct {
+	Sets            *int `json:"sets,omitempty"`
+	Reps            *int `json:"reps,omitempty"`
+	DurationSeconds *int `json:"duration_seconds,omitempty"`
+}
+
+// SetLog is a set of a logged exercise. Sets are numbered from 1.
+type SetLog struct {
+	SetNumber       int      `json:"set_number"`
+	Reps            *int     `json:"reps,omitempty"`
+	WeightKg        *float64 `json:"weight_kg,omitempty"`
+	DurationSeconds *int     `json:"duration_seconds,omitempty"`
+	RPE             *float64 `json:"rpe,omitempty"`
+	Skipped         bool     `json:"skipped"`
+
+	// TargetReps is the number of reps the template prescribed for the set
+	TargetReps *int `json:"target_reps,omitempty"`
+}
+
+// ExerciseLogParams is what a trainee did of an exercise. An exercise of the
+// template is given by its workout exercise ID, with an exercise ID if the
+// trainee did another exercise in its place. Exercises done on top of the
+// template are given by their exercise ID alone.
+type ExerciseLogParams struct {
+	WorkoutExerciseID *int            `json:"workout_exercise_id,omitempty"`
+	ExerciseID        *int            `json:"exercise_id,omitempty"`
+	Notes             *string         `json:"notes,omitempty"`
+	Sets              []*SetLogParams `json:"sets"`
+}
+
+// SetLogParams is a set as the trainee did it, in the order of the sets
+type SetLogParams struct {
+	Reps            *int     `json:"reps,omitempty"`
+	WeightKg        *float64 `json:"weight_kg,omitempty"`
+	DurationSeconds *int     `json:"duration_seconds,omitempty"`
+	RPE             *float64 `json:"rpe,omitempty"`
+	Skipped         bool     `json:"skipped"`
+}
+
+// validateExerciseLogs checks the exercises of a workout log
+func validateExerciseLogs(params []*ExerciseLogParams) error {
+	if len(params) > maxExercisesPerWorkout {
+		return invalidArgument(fmt.Sprintf("a workout log may have at most %d exercises", maxExercisesPerWorkout))
+	}
+
+	seen := make(map[int]bool, len(params))
+	for i, e := range params {
+		switch {
+		case e == nil || (e.WorkoutExerciseID == nil && e.ExerciseID == nil):
+			return invalidArgument(fmt.Sprintf("logged exercise %d needs a workout exercise or an exercise", i+1))
+		case e.WorkoutExerciseID != nil && seen[*e.WorkoutExerciseID]:
+			return invalidArgument(fmt.Sprintf("workout exercise %d is logged twice", *e.WorkoutExerciseID))
+		case len(e.Sets) > maxSets:
+			return invalidArgument(fmt.Sprintf("an exercise may have at most %d sets", maxSets))
+		}
+		if e.WorkoutExerciseID != nil {
+			seen[*e.WorkoutExerciseID] = true
+		}
+
+		for j, s := range e.Sets {
+			switch {
+			case s == nil:
+				return invalidArgument(fmt.Sprintf("set %d of logged exercise %d is empty", j+1, i+1))
+			case s.Reps != nil && (*s.Reps < 0 || *s.Reps > maxReps):
+				return invalidArgument(fmt.Sprintf("reps must be between 0 and %d", maxReps))
+			case s.WeightKg != nil && (*s.WeightKg < 0 || *s.WeightKg > maxLoggedWeightKg):
+				return invalidArgument(fmt.Sprintf("weight must be between 0 and %g kg", maxLoggedWeightKg))
+			case s.DurationSeconds != nil && (*s.DurationSeconds < 0 || *s.DurationSeconds > maxExerciseSeconds):
+				return invalidArgument(fmt.Sprintf("duration must be between 0 and %d seconds", maxExerciseSeconds))
+			case s.RPE != nil && (*s.RPE < 1 || *s.RPE > 10 || math.Mod(*s.RPE*2, 1) != 0):
+				return invalidArgument("RPE must be between 1 and 10, in steps of 0.5")
+			}
+		}
+	}
+	return nil
+}
+
+// exerciseResult compares a logged exercise with what was planned for it
+func exerciseResult(l *ExerciseLog) ExerciseResult {
+	switch {
+	case l.SetsCompleted == 0:
+		return ExerciseSkipped
+	case l.Planned == nil:
+		return ExerciseExtra
+	case l.Planned.Sets != nil && l.SetsCompleted < *l.Planned.Sets:
+		return ExercisePartial
+	}
+	for _, s := range l.Sets {
+		if s.Skipped {
+			continue
+		}
+		if s.TargetReps != nil && (s.Reps == nil || *s.Reps < *s.TargetReps) {
+			return ExercisePartial
+		}
+		if l.Planned.DurationSeconds != nil && (s.DurationSeconds == nil || *s.DurationSeconds < *l.Planned.DurationSeconds) {
+			return ExercisePartial
+		}
+	}
+	return ExerciseCompleted
+}
+
+// templateExercise is what a template prescribes for one of its exercises
+type templateExercise struct {
+	id         int
+	exerciseID int
+	planned    PlannedExercise
+	targets    []*SetTarget
+}
+
+// targetReps returns the reps prescribed for a set, counted from 0. Sets
+// beyond the planned ones have no target.
+func (t *templateExercise) targetReps(set int) *int {
+	if set < len(t.targets) {
+		return t.targets[set].Reps
+	}
+	if t.planned.Sets == nil || set < *t.planned.Sets {
+		return t.planned.Reps
+	}
+	return nil
+}
+
+// insertExerciseLogs stores the exercises of a workout log in the order they
+// are given. Exercises of the template the trainee left out are stored
+// without sets, so they show up as skipped.
+func insertExerciseLogs(ctx context.Context, tx *sqldb.Tx, workoutLogID, workoutID int, params []*ExerciseLogParams) error {
+	rows, err := tx.Query(ctx, `
+		SELECT id, exercise_id, sets, reps, duration_seconds, set_targets
+		FROM workout_exercises
+		WHERE workout_id = $1
+		ORDER BY order_index
+	`, workoutID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var plan []*templateExercise
+	byID := make(map[int]*templateExercise)
+	for rows.Next() {
+		var t templateExercise
+		var targets []byte
+		err := rows.Scan(&t.id, &t.exerciseID, &t.planned.Sets, &t.planned.Reps, &t.planned.DurationSeconds, &targets)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(targets, &t.targets); err != nil {
+			return err
+		}
+		plan = append(plan, &t)
+		byID[t.id] = &t
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	position := 0
+	logged := make(map[int]bool, len(params))
+	for _, p := range params {
+		var planned *templateExercise
+		var exerciseID int
+		if p.WorkoutExerciseID != nil {
+			planned = byID[*p.WorkoutExerciseID]
+			if planned == nil {
+				return invalidArgument(fmt.Sprintf("workout exercise %d is not in the workout", *p.WorkoutExerciseID))
+			}
+			exerciseID = planned.exerciseID
+			logged[planned.id] = true
+		}
+
+		// Substitutes and exercises on top of the template must be ones it could hold
+		if p.ExerciseID != nil && *p.ExerciseID != exerciseID {
+			if err := checkExercise(ctx, tx, workoutID, *p.ExerciseID); err != nil {
+				return err
+			}
+			exerciseID = *p.ExerciseID
+		}
+
+		if err := insertExerciseLog(ctx, tx, workoutLogID, position, exerciseID, planned, p.Notes, p.Sets); err != nil {
+			return err
+		}
+		position++
+	}
+
+	for _, t := range plan {
+		if logged[t.id] {
+			continue
+		}
+		if err := insertExerciseLog(ctx, tx, workoutLogID, position, t.exerciseID, t, nil, nil); err != nil {
+			return err
+		}
+		position++
+	}
+	return nil
+}
+
+// insertExerciseLog stores a logged exercise and its sets, summing up the
+// sets that weren't skipped in the exercise_logs row
+func insertExerciseLog(ctx context.Context, tx *sqldb.Tx, workoutLogID, position, exerciseID int, planned *templateExercise, notes *string, sets []*SetLogParams) error {
+	type setRow struct {
+		SetNumber       int      `json:"set_number"`
+		Reps            *int     `json:"reps"`
+		WeightKg        *float64 `json:"weight_kg"`
+		DurationSeconds *int     `json:"duration_seconds"`
+		RPE             *float64 `json:"rpe"`
+		Skipped         bool     `json:"skipped"`
+		TargetReps      *int     `json:"target_reps"`
+	}
+
+	var setsCompleted, reps, seconds int
+	var maxWeight *float64
+	setRows := make([]setRow, len(sets))
+	for i, s := range sets {
+		setRows[i] = setRow{
+			SetNumber:       i + 1,
+			Reps:            s.Reps,
+			WeightKg:        s.WeightKg,
+			DurationSeconds: s.DurationSeconds,
+			RPE:             s.RPE,
+			Skipped:         s.Skipped,
+		}
+		if planned != nil {
+			setRows[i].TargetReps = planned.targetReps(i)
+		}
+		if s.Skipped {
+			continue
+		}
+		setsCompleted++
+		if s.Reps != nil {
+			reps += *s.Reps
+		}
+		if s.DurationSeconds != nil {
+			seconds += *s.DurationSeconds
+		}
+		if s.WeightKg != nil && (maxWeight == nil || *s.WeightKg > *maxWeight) {
+			maxWeight = s.WeightKg
+		}
+	}
+
+	var workoutExerciseID *int
+	var plannedValues PlannedExercise
+	if planned != nil {
+		workoutExerciseID = &planned.id
+		plannedValues = planned.planned
+	}
+
+	var logID int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO exercise_logs (
+			workout_log_id, exercise_id, workout_exercise_id, position, planned, planned_sets,
+			planned_reps, planned_duration_seconds, sets_completed, reps_completed, weight_kg,
+			duration_seconds, notes, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NOW(), NOW())
+		RETURNING id
+	`, workoutLogID, exerciseID, workoutExerciseID, position, planned != nil, plannedValues.Sets,
+		plannedValues.Reps, plannedValues.DurationSeconds, setsCompleted, reps, maxWeight,
+		seconds, notes,
+	).Scan(&logID)
+	if err != nil {
+		return err
+	}
+	if len(setRows) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(setRows)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO exercise_log_sets (
+			exercise_log_id, set_number, reps, weight_kg, duration_seconds, rpe, skipped, target_reps, created_at
+		)
+		SELECT $1, s.set_number, s.reps, s.weight_kg, s.duration_seconds, s.rpe, s.skipped, s.target_reps, NOW()
+		FROM jsonb_to_recordset($2::JSONB) AS s(
+			set_number INTEGER, reps INTEGER, weight_kg DECIMAL, duration_seconds INTEGER,
+			rpe DECIMAL, skipped BOOLEAN, target_reps INTEGER
+		)
+	`, logID, string(data))
+	return err
+}
+
+// addExerciseLogs fills in the logged exercises of workout logs, with their
+// sets and how they compare with the template
+func (r *postgresRepository) addExerciseLogs(ctx context.Context, history []*CompletedWorkout) error {
+	byID := make(map[int]*CompletedWorkout, len(history))
+	ids := make([]int, 0, len(history))
+	for _, c := range history {
+		c.Exercises = []*ExerciseLog{}
+		byID[c.ID] = c
+		ids = append(ids, c.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT l.workout_log_id, l.id, l.workout_exercise_id, l.planned, l.planned_sets, l.planned_reps,
+			l.planned_duration_seconds, COALESCE(l.sets_completed, 0), COALESCE(l.reps_completed, 0),
+			COALESCE(l.duration_seconds, 0), l.weight_kg::FLOAT8, l.notes, `+exerciseColumns+`
+		FROM exercise_logs l
+		JOIN exercises e ON e.id = l.exercise_id
+		WHERE l.workout_log_id = ANY($1)
+		ORDER BY l.workout_log_id, l.position, l.id
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	logs := make(map[int]*ExerciseLog)
+	logIDs := []int{}
+	for rows.Next() {
+		var workoutLogID int
+		var planned bool
+		var p PlannedExercise
+		l := &ExerciseLog{Sets: []*SetLog{}}
+		e, err := scanExercise(rows,
+			&workoutLogID,
+			&l.ID,
+			&l.WorkoutExerciseID,
+			&planned,
+			&p.Sets,
+			&p.Reps,
+			&p.DurationSeconds,
+			&l.SetsCompleted,
+			&l.RepsCompleted,
+			&l.DurationSeconds,
+			&l.MaxWeightKg,
+			&l.Notes,
+		)
+		if err != nil {
+			return err
+		}
+		l.Exercise = e
+		if planned {
+			l.Planned = &p
+		}
+		byID[workoutLogID].Exercises = append(byID[workoutLogID].Exercises, l)
+		logs[l.ID] = l
+		logIDs = append(logIDs, l.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = r.db.Query(ctx, `
+		SELECT exercise_log_id, set_number, reps, weight_kg::FLOAT8, duration_seconds, rpe::FLOAT8,
+			skipped, target_reps
+		FROM exercise_log_sets
+		WHERE exercise_log_id = ANY($1)
+		ORDER BY exercise_log_id, set_number
+	`, logIDs)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var logID int
+		var s SetLog
+		err := rows.Scan(&logID, &s.SetNumber, &s.Reps, &s.WeightKg, &s.DurationSeconds, &s.RPE, &s.Skipped, &s.TargetReps)
+		if err != nil {
+			return err
+		}
+		logs[logID].Sets = append(logs[logID].Sets, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range logs {
+		l.Result = exerciseResult(l)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+//go:build encore_app
+
+package trainee
+
+import (
+	"context"
+	"testing"
+
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+)
+
+func TestExerciseResult(t *testing.T) {
+	n := intValue
+	set := func(reps, seconds *int, skipped bool, target *int) *SetLog {
+		return &SetLog{Reps: reps, DurationSeconds: seconds, Skipped: skipped, TargetReps: target}
+	}
+	tests := []struct {
+		name string
+		log  ExerciseLog
+		want ExerciseResult
+	}{
+		{"every set done", ExerciseLog{
+			Planned:       &PlannedExercise{Sets: n(2), Reps: n(10)},
+			Sets:          []*SetLog{set(n(10), nil, false, n(10)), set(n(12), nil, false, n(10))},
+			SetsCompleted: 2,
+		}, ExerciseCompleted},
+		{"more sets than planned", ExerciseLog{
+			Planned:       &PlannedExercise{Sets: n(1), Reps: n(10)},
+			Sets:          []*SetLog{set(n(10), nil, false, n(10)), set(n(6), nil, false, nil)},
+			SetsCompleted: 2,
+		}, ExerciseCompleted},
+		{"set short of its reps", ExerciseLog{
+			Planned:       &PlannedExercise{Sets: n(2), Reps: n(10)},
+			Sets:          []*SetLog{set(n(10), nil, false, n(10)), set(n(8), nil, false, n(10))},
+			SetsCompleted: 2,
+		}, ExercisePartial},
+		{"set without reps", ExerciseLog{
+			Planned:       &PlannedExercise{Sets: n(1), Reps: n(10)},
+			Sets:          []*SetLog{set(nil, nil, false, n(10))},
+			SetsCompleted: 1,
+		}, ExercisePartial},
+		{"planned set skipped", ExerciseLog{
+			Planned:       &PlannedExercise{Sets: n(2), Reps: n(10)},
+			Sets:          []*SetLog{set(n(10), nil, false, n(10)), set(nil, nil, true, n(10))},
+			SetsCompleted: 1,
+		}, ExercisePartial},
+		{"fewer sets than planned", ExerciseLog{
+			Planned:       &PlannedExercise{Sets: n(3), Reps: n(10)},
+			Sets:          []*SetLog{set(n(10), nil, false, n(10))},
+			SetsCompleted: 1,
+		}, ExercisePartial},
+		{"skipped set short of its reps", ExerciseLog{
+			Planned:       &PlannedExercise{Reps: n(10)},
+			Sets:          []*SetLog{set(n(10), nil, false, n(10)), set(n(2), nil, true, n(10))},
+			SetsCompleted: 1,
+		}, ExerciseCompleted},
+		{"timed sets held", ExerciseLog{
+			Planned:       &PlannedExercise{Sets: n(2), DurationSeconds: n(60)},
+			Sets:          []*SetLog{set(nil, n(60), false, nil), set(nil, n(75), false, nil)},
+			SetsCompleted: 2,
+		}, ExerciseCompleted},
+		{"timed set cut short", ExerciseLog{
+			Planned:       &PlannedExercise{Sets: n(2), DurationSeconds: n(60)},
+			Sets:          []*SetLog{set(nil, n(60), false, nil), set(nil, n(45), false, nil)},
+			SetsCompleted: 2,
+		}, ExercisePartial},
+		{"nothing planned but sets", ExerciseLog{
+			Planned:       &PlannedExercise{},
+			Sets:          []*SetLog{set(n(3), nil, false, nil)},
+			SetsCompleted: 1,
+		}, ExerciseCompleted},
+		{"no sets", ExerciseLog{Planned: &PlannedExercise{Sets: n(3), Reps: n(10)}}, ExerciseSkipped},
+		{"every set skipped", ExerciseLog{
+			Planned: &PlannedExercise{Sets: n(1), Reps: n(10)},
+			Sets:    []*SetLog{set(nil, nil, true, n(10))},
+		}, ExerciseSkipped},
+		{"on top of the template", ExerciseLog{
+			Sets:          []*SetLog{set(n(5), nil, false, nil)},
+			SetsCompleted: 1,
+		}, ExerciseExtra},
+		{"skipped on top of the template", ExerciseLog{Sets: []*SetLog{set(nil, nil, true, nil)}}, ExerciseSkipped},
+	}
+	for _, tt := range tests {
+		if got := exerciseResult(&tt.log); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTargetReps(t *testing.T) {
+	n := intValue
+	tests := []struct {
+		name     string
+		exercise templateExercise
+		want     []*int
+	}{
+		{"sets of reps", templateExercise{planned: PlannedExercise{Sets: n(2), Reps: n(10)}}, []*int{n(10), n(10), nil}},
+		{"reps without sets", templateExercise{planned: PlannedExercise{Reps: n(8)}}, []*int{n(8), n(8), n(8)}},
+		{"no reps", templateExercise{planned: PlannedExercise{Sets: n(2), DurationSeconds: n(60)}}, []*int{nil, nil, nil}},
+		{"5/3/1", templateExercise{
+			planned: PlannedExercise{Sets: n(3)},
+			targets: []*SetTarget{{Reps: n(5)}, {Reps: n(3)}, {Reps: n(1)}},
+		}, []*int{n(5), n(3), n(1), nil}},
+		{"targets without reps", templateExercise{
+			planned: PlannedExercise{Sets: n(2), Reps: n(6)},
+			targets: []*SetTarget{{RPE: new(float64)}, {Tempo: stringValue("31X0")}},
+		}, []*int{nil, nil, nil}},
+		{"targets without sets", templateExercise{
+			targets: []*SetTarget{{Reps: n(12)}, {Reps: n(10)}},
+		}, []*int{n(12), n(10), nil}},
+	}
+	for _, tt := range tests {
+		for set, want := range tt.want {
+			got := tt.exercise.targetReps(set)
+			if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+				t.Errorf("%s: got %v for set %d, want %v", tt.name, deref(got), set, deref(want))
+			}
+		}
+	}
+}
+
+func TestLogWorkoutExercises(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	n := intValue
+	workout, err := repo.CreateWorkout(ctx, trainerID, &CreateWorkoutTemplateParams{
+		Name:     "Test Workout",
+		IsPublic: true,
+		Exercises: []*WorkoutExerciseParams{
+			{ExerciseID: createTestExercise(t, ctx), Sets: n(3), Reps: n(10)},
+			{ExerciseID: createTestExercise(t, ctx), Sets: n(3), SetTargets: []*SetTarget{{Reps: n(5)}, {Reps: n(3)}, {Reps: n(1)}}},
+			{ExerciseID: createTestExercise(t, ctx), Sets: n(2), DurationSeconds: n(60)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	squat, press, plank := workout.Exercises[0], workout.Exercises[1], workout.Exercises[2]
+	substitute := createTestExercise(t, ctx)
+	extra := createTestExercise(t, ctx)
+
+	// The squats fall short, the press is swapped for another exercise and
+	// the plank is left out
+	weight := 60.0
+	completed, err := LogWorkout(ctx, &LogWorkoutRequest{
+		TraineeID:       traineeID,
+		WorkoutID:       workout.ID,
+		DurationMinutes: 40,
+		Exercises: []*ExerciseLogParams{
+			{WorkoutExerciseID: &press.ID, ExerciseID: &substitute, Sets: []*SetLogParams{{Reps: n(5)}, {Reps: n(4)}, {Reps: n(2)}}},
+			{WorkoutExerciseID: &squat.ID, Sets: []*SetLogParams{
+				{Reps: n(10), WeightKg: &weight},
+				{Reps: n(10), WeightKg: &weight},
+				{Reps: n(7), Skipped: true},
+			}},
+			{ExerciseID: &extra, Sets: []*SetLogParams{{Reps: n(15)}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := repo.WorkoutHistory(ctx, traineeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].ID != completed.ID {
+		t.Fatalf("got history %+v, want the logged workout", history)
+	}
+	logs := history[0].Exercises
+	if len(logs) != 4 {
+		t.Fatalf("got %d logged exercises, want the 3 logged and the left out one", len(logs))
+	}
+
+	// Exercises are listed as they were logged, then the left out ones
+	tests := []struct {
+		exerciseID        int
+		workoutExerciseID *int
+		result            ExerciseResult
+		sets, reps        int
+		targets           []*int
+	}{
+		{substitute, &press.ID, ExerciseCompleted, 3, 11, []*int{n(5), n(3), n(1)}},
+		{squat.Exercise.ID, &squat.ID, ExercisePartial, 2, 20, []*int{n(10), n(10), n(10)}},
+		{extra, nil, ExerciseExtra, 1, 15, []*int{nil}},
+		{plank.Exercise.ID, &plank.ID, ExerciseSkipped, 0, 0, nil},
+	}
+	for i, tt := range tests {
+		l := logs[i]
+		if l.Exercise.ID != tt.exerciseID || deref(l.WorkoutExerciseID) != deref(tt.workoutExerciseID) {
+			t.Errorf("exercise %d: got exercise %d of workout exercise %v, want %d of %v",
+				i, l.Exercise.ID, deref(l.WorkoutExerciseID), tt.exerciseID, deref(tt.workoutExerciseID))
+		}
+		if l.Result != tt.result || l.SetsCompleted != tt.sets || l.RepsCompleted != tt.reps {
+			t.Errorf("exercise %d: got %s with %d sets of %d reps, want %s with %d of %d",
+				i, l.Result, l.SetsCompleted, l.RepsCompleted, tt.result, tt.sets, tt.reps)
+		}
+		if len(l.Sets) != len(tt.targets) {
+			t.Errorf("exercise %d: got %d sets, want %d", i, len(l.Sets), len(tt.targets))
+			continue
+		}
+		for j, s := range l.Sets {
+			if s.SetNumber != j+1 || deref(s.TargetReps) != deref(tt.targets[j]) {
+				t.Errorf("exercise %d: got set %d with target %v, want set %d with %v",
+					i, s.SetNumber, deref(s.TargetReps), j+1, deref(tt.targets[j]))
+			}
+		}
+	}
+
+	// The plan is what the template prescribed when the workout was logged
+	if p := logs[1].Planned; p == nil || deref(p.Sets) != 3 || deref(p.Reps) != 10 {
+		t.Errorf("got plan %+v for the squats, want 3 sets of 10", p)
+	}
+	if p := logs[3].Planned; p == nil || deref(p.Sets) != 2 || deref(p.DurationSeconds) != 60 {
+		t.Errorf("got plan %+v for the plank, want 2 sets of 60 seconds", p)
+	}
+	if logs[2].Planned != nil {
+		t.Errorf("got plan %+v for the extra exercise, want none", logs[2].Planned)
+	}
+	if w := logs[1].MaxWeightKg; w == nil || *w != 60 || !logs[1].Sets[2].Skipped {
+		t.Errorf("got max weight %v and sets %+v, want 60 kg and the last set skipped", w, logs[1].Sets)
+	}
+
+	// Exercises can only be swapped for ones the template could hold
+	otherTrainer := createTestUser(t, ctx, authz.RoleTrainer)
+	custom, err := repo.CreateExercise(ctx, &otherTrainer, &ExerciseParams{Name: "Secret Move"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = LogWorkout(ctx, &LogWorkoutRequest{
+		TraineeID:       traineeID,
+		WorkoutID:       workout.ID,
+		DurationMinutes: 40,
+		Exercises:       []*ExerciseLogParams{{WorkoutExerciseID: &squat.ID, ExerciseID: &custom.ID}},
+	})
+	if errs.Code(err) != errs.InvalidArgument {
+		t.Errorf("got %v swapping in another trainer's exercise, want InvalidArgument", err)
+	}
+}
+
+// deref returns the value n points to, or -1 for nil
+func deref(n *int) int {
+	if n == nil {
+		return -1
+	}
+	return *n
+}
@@ -0,0 +1,778 @@
+package trainee
+
+import (
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+const (
+	defaultExercisePageSize = 50
+	maxExercisePageSize     = 100
+	maxAliasesPerExercise   = 20
+	maxExercisesPerImport   = 5000
+	videoURLMaxLength       = 512
+)
+
+var (
+	errExerciseNotFound = &errs.Error{
+		Code:    errs.NotFound,
+		Message: "exercise not found",
+	}
+	errExerciseExists = &errs.Error{
+		Code:    errs.AlreadyExists,
+		Message: "an exercise with this name already exists",
+	}
+)
+
+// exerciseImportColumns is the header an exercise import CSV must start with.
+// Aliases are separated by "|".
+var exerciseImportColumns = []string{"name", "description", "muscle_group", "equipment", "video_url", "aliases"}
+
+// starterExercises is the catalog imported when an import names no exercises
+//
+//go:embed seed/exercises.json
+var starterExercises []byte
+
+// ListExercisesParams filters and pages the exercises. Every filter is optional.
+type ListExercisesParams struct {
+	// Search is a full-text search over the names, aliases and descriptions
+	Search      string `query:"search"`
+	MuscleGroup string `query:"muscle_group"`
+	Equipment   string `query:"equipment"`
+
+	// Custom only lists the caller's own exercises, leaving out the library
+	Custom bool `query:"custom"`
+
+	// Page starts at 1
+	Page     int `query:"page"`
+	PageSize int `query:"page_size"`
+}
+
+// ExercisePage is one page of exercises. Searches list the best matches
+// first, otherwise exercises are sorted by name.
+type ExercisePage struct {
+	Exercises []*Exercise `json:"exercises"`
+	Total     int         `json:"total"`
+	Page      int         `json:"page"`
+	PageSize  int         `json:"page_size"`
+}
+
+// ExerciseParams describes an exercise
+type ExerciseParams struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	MuscleGroup *string  `json:"muscle_group,omitempty"`
+	Equipment   *string  `json:"equipment,omitempty"`
+	VideoURL    *string  `json:"video_url,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+
+	// Library adds the exercise to the shared library rather than to the
+	// caller's custom exercises, which only administrators can do. Imported
+	// exercises always go to the library.
+	Library bool `json:"library,omitempty"`
+}
+
+// UpdateExerciseParams contains the exercise fields to change. Fields that
+// are left out keep their current value; empty strings clear the optional
+// ones, and a list of aliases replaces the current aliases.
+type UpdateExerciseParams struct {
+	Name        *string  `json:"name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	MuscleGroup *string  `json:"muscle_group,omitempty"`
+	Equipment   *string  `json:"equipment,omitempty"`
+	VideoURL    *string  `json:"video_url,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+// ImportExercisesParams contains library exercises as a list or in CSV form.
+// With neither, the starter catalog is imported.
+type ImportExercisesParams struct {
+	CSV       string            `json:"csv,omitempty"`
+	Exercises []*ExerciseParams `json:"exercises,omitempty"`
+}
+
+// ImportExercisesResponse reports how many library exercises an import created or updated
+type ImportExercisesResponse struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+}
+
+// ListExercises searches the exercise library and the caller's custom exercises
+//
+//encore:api auth method=GET path=/trainee/exercises tag:scope_workouts_read
+func ListExercises(ctx context.Context, params *ListExercisesParams) (*ExercisePage, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+
+	page := max(params.Page, 1)
+	pageSize := params.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultExercisePageSize
+	}
+	pageSize = min(pageSize, maxExercisePageSize)
+
+	exercises, total, err := repo.ListExercises(ctx, caller.UserID, params, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &ExercisePage{
+		Exercises: exercises,
+		Total:     total,
+		Page:      page,
+		PageSize:  pageSize,
+	}, nil
+}
+
+// GetExercise returns a library exercise or a custom exercise of the caller
+//
+//encore:api auth method=GET path=/trainee/exercises/:id tag:scope_workouts_read
+func GetExercise(ctx context.Context, id int) (*Exercise, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	exercise, err := repo.GetExercise(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if exercise.OwnerID != nil && *exercise.OwnerID != caller.UserID && !caller.IsAdmin() {
+		return nil, errExerciseNotFound
+	}
+	return exercise, nil
+}
+
+// CreateExercise adds a custom exercise of the current user, or a library
+// exercise when an administrator asks for one
+//
+//encore:api auth method=POST path=/trainee/exercises tag:trainer tag:scope_workouts_write
+func CreateExercise(ctx context.Context, params *ExerciseParams) (*Exercise, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	if err := caller.Require(authz.PermAuthorWorkouts); err != nil {
+		return nil, err
+	}
+	if params.Library && !caller.IsAdmin() {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "only administrators can add to the exercise library",
+		}
+	}
+	if err := normalizeExercise(params); err != nil {
+		return nil, invalidArgument(err.Error())
+	}
+
+	var ownerID *int
+	if !params.Library {
+		ownerID = &caller.UserID
+	}
+	exercise, err := repo.CreateExercise(ctx, ownerID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "exercise.create",
+		EntityType: "exercise",
+		EntityID:   strconv.Itoa(exercise.ID),
+		After:      exercise,
+	})
+	return exercise, nil
+}
+
+// UpdateExercise changes a custom exercise of the current user, or any
+// exercise for administrators
+//
+//encore:api auth method=PATCH path=/trainee/exercises/:id tag:trainer tag:scope_workouts_write
+func UpdateExercise(ctx context.Context, id int, params *UpdateExerciseParams) (*Exercise, error) {
+	before, err := editableExercise(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeExerciseUpdate(params); err != nil {
+		return nil, invalidArgument(err.Error())
+	}
+
+	after, err := repo.UpdateExercise(ctx, id, params)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "exercise.update",
+		EntityType: "exercise",
+		EntityID:   strconv.Itoa(id),
+		Before:     before,
+		After:      after,
+	})
+	return after, nil
+}
+
+// DeleteExercise removes a custom exercise of the current user, or any
+// exercise for administrators. Workout templates and logs that use it keep
+// showing it, but it can't be added to templates anymore.
+//
+//encore:api auth method=DELETE path=/trainee/exercises/:id tag:trainer tag:scope_workouts_write
+func DeleteExercise(ctx context.Context, id int) error {
+	before, err := editableExercise(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := repo.DeleteExercise(ctx, id); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "exercise.delete",
+		EntityType: "exercise",
+		EntityID:   strconv.Itoa(id),
+		Before:     before,
+	})
+	return nil
+}
+
+// ImportExercises creates or updates library exercises from seed data,
+// matching them to the library by name. Exercises that are not in the data
+// are kept.
+//
+//encore:api auth method=POST path=/trainee/import/exercises tag:admin
+func ImportExercises(ctx context.Context, params *ImportExercisesParams) (*ImportExercisesResponse, error) {
+	var exercises []*ExerciseParams
+	switch {
+	case params.CSV != "" && len(params.Exercises) > 0:
+		return nil, invalidArgument("send either csv or exercises, not both")
+	case params.CSV != "":
+		var err error
+		if exercises, err = parseExerciseCSV(strings.NewReader(params.CSV)); err != nil {
+			return nil, err
+		}
+	case len(params.Exercises) > 0:
+		exercises = params.Exercises
+	default:
+		if err := json.Unmarshal(starterExercises, &exercises); err != nil {
+			return nil, fmt.Errorf("parse starter exercises: %w", err)
+		}
+	}
+
+	// Validate the input
+	if len(exercises) > maxExercisesPerImport {
+		return nil, invalidArgument(fmt.Sprintf("an import may have at most %d exercises", maxExercisesPerImport))
+	}
+	names := make(map[string]bool, len(exercises))
+	for i, e := range exercises {
+		if e == nil {
+			return nil, invalidArgument(fmt.Sprintf("exercise %d: missing", i+1))
+		}
+		if err := normalizeExercise(e); err != nil {
+			return nil, invalidArgument(fmt.Sprintf("exercise %d: %s", i+1, err))
+		}
+		name := strings.ToLower(e.Name)
+		if names[name] {
+			return nil, invalidArgument(fmt.Sprintf("exercise %d: %q is listed twice", i+1, e.Name))
+		}
+		names[name] = true
+	}
+
+	resp, err := repo.ImportExercises(ctx, exercises)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "exercise.import",
+		EntityType: "exercise",
+		After:      resp,
+	})
+	return resp, nil
+}
+
+// parseExerciseCSV reads the exercises of an import CSV
+func parseExerciseCSV(r io.Reader) ([]*ExerciseParams, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(exerciseImportColumns)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, importError(1, "missing header")
+	} else if err != nil {
+		return nil, importError(1, err.Error())
+	}
+	for i, col := range exerciseImportColumns {
+		if strings.TrimSpace(header[i]) != col {
+			return nil, importError(1, "header must be "+strings.Join(exerciseImportColumns, ","))
+		}
+	}
+
+	var exercises []*ExerciseParams
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, importError(line, err.Error())
+		}
+
+		e := &ExerciseParams{
+			Name:        record[0],
+			Description: record[1],
+			MuscleGroup: &record[2],
+			Equipment:   &record[3],
+			VideoURL:    &record[4],
+		}
+		if record[5] != "" {
+			e.Aliases = strings.Split(record[5], "|")
+		}
+
+		// Report problems with their line rather than their position in the list
+		if err := normalizeExercise(e); err != nil {
+			return nil, importError(line, err.Error())
+		}
+		exercises = append(exercises, e)
+	}
+	return exercises, nil
+}
+
+// importError reports a problem with the CSV data at a line
+func importError(line int, msg string) error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: fmt.Sprintf("line %d: %s", line, msg),
+	}
+}
+
+// editableExercise returns an exercise the current user may change: one of
+// their custom exercises, or any exercise for administrators. Custom
+// exercises of others are reported missing.
+func editableExercise(ctx context.Context, id int) (*Exercise, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	if err := caller.Require(authz.PermAuthorWorkouts); err != nil {
+		return nil, err
+	}
+	exercise, err := repo.GetExercise(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if caller.IsAdmin() {
+		return exercise, nil
+	}
+	if exercise.OwnerID == nil {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "only administrators can change the exercise library",
+		}
+	}
+	if *exercise.OwnerID != caller.UserID {
+		return nil, errExerciseNotFound
+	}
+	return exercise, nil
+}
+
+// normalizeExercise trims the fields of a new exercise and checks them
+func normalizeExercise(p *ExerciseParams) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Description = strings.TrimSpace(p.Description)
+	if err := validateExerciseFields(&p.Name, &p.Description, p.MuscleGroup, p.Equipment, p.VideoURL); err != nil {
+		return err
+	}
+	aliases, err := normalizeAliases(p.Name, p.Aliases)
+	if err != nil {
+		return err
+	}
+	p.Aliases = aliases
+	return nil
+}
+
+// normalizeExerciseUpdate trims the set fields of an exercise update and checks them
+func normalizeExerciseUpdate(p *UpdateExerciseParams) error {
+	for _, s := range []*string{p.Name, p.Description} {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+	if err := validateExerciseFields(p.Name, p.Description, p.MuscleGroup, p.Equipment, p.VideoURL); err != nil {
+		return err
+	}
+	if p.Aliases != nil {
+		name := ""
+		if p.Name != nil {
+			name = *p.Name
+		}
+		aliases, err := normalizeAliases(name, p.Aliases)
+		if err != nil {
+			return err
+		}
+		p.Aliases = aliases
+	}
+	return nil
+}
+
+// validateExerciseFields checks the exercise fields that are set. The
+// optional ones are trimmed.
+func validateExerciseFields(name, description, muscleGroup, equipment, videoURL *string) error {
+	for _, s := range []*string{muscleGroup, equipment, videoURL} {
+		if s != nil {
+			*s = strings.TrimSpace(*s)
+		}
+	}
+
+	if name != nil {
+		switch n := utf8.RuneCountInString(*name); {
+		case n == 0:
+			return errors.New("exercise name is required")
+		case n > nameMaxLength:
+			return fmt.Errorf("exercise name must be at most %d characters", nameMaxLength)
+		}
+	}
+	switch {
+	case description != nil && utf8.RuneCountInString(*description) > notesMaxLength:
+		return fmt.Errorf("description must be at most %d characters", notesMaxLength)
+	case muscleGroup != nil && utf8.RuneCountInString(*muscleGroup) > nameMaxLength:
+		return fmt.Errorf("muscle group must be at most %d characters", nameMaxLength)
+	case equipment != nil && utf8.RuneCountInString(*equipment) > nameMaxLength:
+		return fmt.Errorf("equipment must be at most %d characters", nameMaxLength)
+	}
+
+	if videoURL != nil && *videoURL != "" {
+		if len(*videoURL) > videoURLMaxLength {
+			return fmt.Errorf("video URL must be at most %d characters", videoURLMaxLength)
+		}
+		u, err := url.Parse(*videoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("video URL must be an http or https URL")
+		}
+	}
+	return nil
+}
+
+// normalizeAliases trims aliases and drops empty ones, duplicates and ones
+// equal to the name
+func normalizeAliases(name string, aliases []string) ([]string, error) {
+	seen := map[string]bool{strings.ToLower(name): true}
+	list := []string{}
+	for _, a := range aliases {
+		a = strings.Join(strings.Fields(a), " ")
+		if a == "" || seen[strings.ToLower(a)] {
+			continue
+		}
+		if utf8.RuneCountInString(a) > nameMaxLength {
+			return nil, fmt.Errorf("aliases must be at most %d characters", nameMaxLength)
+		}
+		seen[strings.ToLower(a)] = true
+		list = append(list, a)
+	}
+	if len(list) > maxAliasesPerExercise {
+		return nil, fmt.Errorf("an exercise may have at most %d aliases", maxAliasesPerExercise)
+	}
+	return list, nil
+}
+
+// exerciseFilter restricts exercises aliased e to those matching the
+// arguments of ListExercises. $5 is the search text.
+const exerciseFilter = `
+		WHERE e.deleted_at IS NULL
+			AND (e.owner_id IS NULL OR e.owner_id = $1)
+			AND (NOT $2 OR e.owner_id = $1)
+			AND ($3 = '' OR LOWER(e.muscle_group) = LOWER($3))
+			AND ($4 = '' OR LOWER(e.equipment_required) = LOWER($4))
+			AND ($5 = '' OR e.search_vector @@ websearch_to_tsquery('english', $5) OR EXISTS (
+				SELECT 1 FROM exercise_aliases a
+				WHERE a.exercise_id = e.id AND to_tsvector('english', a.alias) @@ websearch_to_tsquery('english', $5)
+			))`
+
+// ListExercises returns a page of the exercises a user can see that match params
+func (r *postgresRepository) ListExercises(ctx context.Context, userID int, params *ListExercisesParams, limit, offset int) ([]*Exercise, int, error) {
+	args := []interface{}{
+		userID,
+		params.Custom,
+		strings.TrimSpace(params.MuscleGroup),
+		strings.TrimSpace(params.Equipment),
+		strings.TrimSpace(params.Search),
+	}
+
+	// Count all matches for the page count
+	var total int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM exercises e
+	`+exerciseFilter, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Matches on the name or an alias rank above matches on the description
+	rows, err := r.db.Query(ctx, `
+		SELECT `+exerciseColumns+`
+		FROM exercises e
+	`+exerciseFilter+`
+		ORDER BY CASE WHEN $5 = '' THEN 0 ELSE GREATEST(
+				ts_rank(e.search_vector, websearch_to_tsquery('english', $5)),
+				(SELECT COALESCE(MAX(ts_rank(setweight(to_tsvector('english', a.alias), 'A'), websearch_to_tsquery('english', $5))), 0)
+				FROM exercise_aliases a WHERE a.exercise_id = e.id)
+			) END DESC, LOWER(e.name), e.id
+		LIMIT $6 OFFSET $7
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	exercises := []*Exercise{}
+	for rows.Next() {
+		e, err := scanExercise(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		exercises = append(exercises, e)
+	}
+	return exercises, total, rows.Err()
+}
+
+// GetExercise returns an exercise with its aliases
+func (r *postgresRepository) GetExercise(ctx context.Context, exerciseID int) (*Exercise, error) {
+	e, err := scanExercise(r.db.QueryRow(ctx, `
+		SELECT `+exerciseColumns+`
+		FROM exercises e
+		WHERE e.id = $1 AND e.deleted_at IS NULL
+	`, exerciseID))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errExerciseNotFound
+	}
+	return e, err
+}
+
+// CreateExercise inserts an exercise and its aliases
+func (r *postgresRepository) CreateExercise(ctx context.Context, ownerID *int, params *ExerciseParams) (*Exercise, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := exerciseNamed(ctx, tx, ownerID, params.Name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if existing != 0 {
+		return nil, errExerciseExists
+	}
+	exerciseID, err := insertExercise(ctx, tx, ownerID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetExercise(ctx, exerciseID)
+}
+
+// UpdateExercise updates the set fields of an exercise and replaces its aliases if given
+func (r *postgresRepository) UpdateExercise(ctx context.Context, exerciseID int, params *UpdateExerciseParams) (*Exercise, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ownerID *int
+	err = tx.QueryRow(ctx, `
+		SELECT owner_id FROM exercises WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	`, exerciseID).Scan(&ownerID)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errExerciseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if params.Name != nil {
+		existing, err := exerciseNamed(ctx, tx, ownerID, *params.Name, exerciseID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != 0 {
+			return nil, errExerciseExists
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE exercises
+		SET name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			muscle_group = CASE WHEN $4::TEXT IS NULL THEN muscle_group ELSE NULLIF($4, '') END,
+			equipment_required = CASE WHEN $5::TEXT IS NULL THEN equipment_required ELSE NULLIF($5, '') END,
+			video_url = CASE WHEN $6::TEXT IS NULL THEN video_url ELSE NULLIF($6, '') END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, exerciseID, params.Name, params.Description, params.MuscleGroup, params.Equipment, params.VideoURL)
+	if err != nil {
+		return nil, err
+	}
+	if params.Aliases != nil {
+		if err := setAliases(ctx, tx, exerciseID, params.Aliases); err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetExercise(ctx, exerciseID)
+}
+
+// DeleteExercise sets deleted_at on an exercise. The row stays for the
+// templates and logs that refer to it.
+func (r *postgresRepository) DeleteExercise(ctx context.Context, exerciseID int) error {
+	res, err := r.db.Exec(ctx, `
+		UPDATE exercises
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, exerciseID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return errExerciseNotFound
+	}
+	return nil
+}
+
+// ImportExercises upserts library exercises in a single transaction
+func (r *postgresRepository) ImportExercises(ctx context.Context, exercises []*ExerciseParams) (*ImportExercisesResponse, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	resp := &ImportExercisesResponse{}
+	for _, e := range exercises {
+		existing, err := exerciseNamed(ctx, tx, nil, e.Name, 0)
+		if err != nil {
+			return nil, err
+		}
+		if existing == 0 {
+			if _, err := insertExercise(ctx, tx, nil, e); err != nil {
+				return nil, err
+			}
+			resp.Created++
+			continue
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE exercises
+			SET name = $2, description = NULLIF($3, ''), muscle_group = NULLIF($4, ''),
+				equipment_required = NULLIF($5, ''), video_url = NULLIF($6, ''), updated_at = NOW()
+			WHERE id = $1
+		`, existing, e.Name, e.Description, e.MuscleGroup, e.Equipment, e.VideoURL)
+		if err != nil {
+			return nil, err
+		}
+		if err := setAliases(ctx, tx, existing, e.Aliases); err != nil {
+			return nil, err
+		}
+		resp.Updated++
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// exerciseNamed returns the ID of an exercise that is not deleted with the
+// given name, ignoring case, among the custom exercises of an owner or the
+// library without one. It returns 0 if there is none besides exceptID.
+func exerciseNamed(ctx context.Context, tx *sqldb.Tx, ownerID *int, name string, exceptID int) (int, error) {
+	var id int
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM exercises
+		WHERE owner_id IS NOT DISTINCT FROM $1::BIGINT AND deleted_at IS NULL
+			AND LOWER(name) = LOWER($2) AND id <> $3
+		ORDER BY id
+		LIMIT 1
+	`, ownerID, name, exceptID).Scan(&id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// insertExercise inserts an exercises row and its aliases
+func insertExercise(ctx context.Context, tx *sqldb.Tx, ownerID *int, params *ExerciseParams) (int, error) {
+	var exerciseID int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO exercises (owner_id, name, description, muscle_group, equipment_required, video_url, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NOW(), NOW())
+		RETURNING id
+	`, ownerID, params.Name, params.Description, params.MuscleGroup, params.Equipment, params.VideoURL).Scan(&exerciseID)
+	if err != nil {
+		return 0, err
+	}
+	return exerciseID, setAliases(ctx, tx, exerciseID, params.Aliases)
+}
+
+// setAliases replaces the aliases of an exercise
+func setAliases(ctx context.Context, tx *sqldb.Tx, exerciseID int, aliases []string) error {
+	_, err := tx.Exec(ctx, `DELETE FROM exercise_aliases WHERE exercise_id = $1`, exerciseID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO exercise_aliases (exercise_id, alias)
+		SELECT $1, alias FROM unnest($2::TEXT[]) AS alias
+	`, exerciseID, aliases)
+	return err
+}
+
+// exerciseColumns are the columns scanExercise reads, from exercises aliased e
+const exerciseColumns = `e.id, e.owner_id, e.name, COALESCE(e.description, ''), e.muscle_group, e.equipment_required,
+			e.video_url, ARRAY(SELECT a.alias FROM exercise_aliases a WHERE a.exercise_id = e.id ORDER BY a.alias),
+			e.created_at, e.updated_at, e.deleted_at`
+
+// scanExercise reads the exerciseColumns following the given leading columns
+func scanExercise(row interface{ Scan(...interface{}) error }, leading ...interface{}) (*Exercise, error) {
+	var e Exercise
+	err := row.Scan(append(leading,
+		&e.ID,
+		&e.OwnerID,
+		&e.Name,
+		&e.Description,
+		&e.MuscleGroup,
+		&e.Equipment,
+		&e.VideoURL,
+		&e.Aliases,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+		&e.DeletedAt,
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
@@ -0,0 +1,93 @@
+//go:build encore_app
+
+package trainee
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"encore.app/admin"
+	"encore.app/authz"
+	"encore.app/authz/authztest"
+)
+
+// createTestUser projects a user with the given roles and returns their ID
+func createTestUser(t *testing.T, ctx context.Context, roles ...authz.Role) int {
+	t.Helper()
+	return createTestUserWithStatus(t, ctx, admin.UserStatusActive, roles...)
+}
+
+// createTestUserWithStatus projects a user in a status and returns their ID
+func createTestUserWithStatus(t *testing.T, ctx context.Context, status admin.UserStatus, roles ...authz.Role) int {
+	t.Helper()
+	id := authztest.NewUserID()
+	err := projectUser(ctx, &admin.UserSnapshot{
+		ID:        id,
+		Username:  fmt.Sprintf("user%d", id),
+		Fullname:  "Test User",
+		Roles:     roles,
+		Status:    status,
+		CreatedAt: time.Now(),
+		Version:   time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// createTestWorkout stores a template of a trainer and returns its ID
+func createTestWorkout(t *testing.T, ctx context.Context, trainerID int) int {
+	t.Helper()
+	var id int
+	err := db.QueryRow(ctx, `
+		INSERT INTO workout_templates (trainer_id, name, duration_minutes, difficulty, is_public, created_at, updated_at)
+		VALUES ($1, 'Test Workout', 45, 'BEGINNER', FALSE, NOW(), NOW())
+		RETURNING id
+	`, trainerID).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// assignTestWorkout assigns a workout to a trainee
+func assignTestWorkout(t *testing.T, ctx context.Context, workoutID, trainerID, traineeID int, dueDate *time.Time) *Assignment {
+	t.Helper()
+	assignments, err := repo.AssignWorkout(ctx, workoutID, trainerID, []int{traineeID}, dueDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assignments[0]
+}
+
+// createTestExercise adds an exercise to the library and returns its ID
+func createTestExercise(t *testing.T, ctx context.Context) int {
+	t.Helper()
+	e, err := repo.CreateExercise(ctx, nil, &ExerciseParams{
+		Name: fmt.Sprintf("Exercise %d", authztest.NewUserID()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.ID
+}
+
+// coachTestTrainee starts an active relationship between a trainer and a trainee
+func coachTestTrainee(t *testing.T, ctx context.Context, trainerID, traineeID int) {
+	t.Helper()
+	_, err := db.Exec(ctx, `
+		INSERT INTO trainer_trainee_relationships (trainer_id, trainee_id, is_active, start_date, created_at, updated_at)
+		VALUES ($1, $2, TRUE, NOW(), NOW(), NOW())
+	`, trainerID, traineeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stringValue returns a pointer to s
+func stringValue(s string) *string {
+	return &s
+}
@@ -0,0 +1,17 @@
+-- Users are owned by the admin service. The copy of its table that used to live
+-- here was never filled, so it is replaced by a read model fed from the
+-- user-created, user-updated and user-deleted topics. Dropping the table also
+-- drops the foreign keys pointing at it; user IDs here refer to admin users.
+DROP TABLE users CASCADE;
+
+CREATE TABLE user_projections (
+    user_id BIGINT PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    fullname VARCHAR(255) NOT NULL DEFAULT '',
+    roles TEXT[] NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL CHECK (status IN ('ACTIVE', 'SUSPENDED', 'DELETED')),
+    created_at TIMESTAMPTZ NOT NULL,
+    -- When the admin service read the snapshot; older snapshots are ignored
+    version TIMESTAMPTZ NOT NULL,
+    synced_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- A user has at most one profile, so profile updates can upsert it
+DROP INDEX idx_trainee_profiles_user_id;
+CREATE UNIQUE INDEX idx_trainee_profiles_user_id ON trainee_profiles(user_id);
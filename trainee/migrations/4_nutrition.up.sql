@@ -0,0 +1,54 @@
+-- Meals are written by trainees for their own plans or by trainers for their trainees
+CREATE TABLE meals (
+    id BIGSERIAL PRIMARY KEY,
+    created_by BIGINT,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    ingredients TEXT[] NOT NULL DEFAULT '{}',
+    instructions TEXT,
+    calories INTEGER NOT NULL CHECK (calories >= 0),
+    protein_g DECIMAL(7,2) NOT NULL DEFAULT 0 CHECK (protein_g >= 0),
+    carbs_g DECIMAL(7,2) NOT NULL DEFAULT 0 CHECK (carbs_g >= 0),
+    fat_g DECIMAL(7,2) NOT NULL DEFAULT 0 CHECK (fat_g >= 0),
+    meal_type VARCHAR(20) NOT NULL CHECK (meal_type IN ('BREAKFAST', 'LUNCH', 'DINNER', 'SNACK')),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A meal plan belongs to the trainee who follows it
+CREATE TABLE meal_plans (
+    id BIGSERIAL PRIMARY KEY,
+    owner_id BIGINT NOT NULL,
+    created_by BIGINT,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    calories INTEGER NOT NULL CHECK (calories >= 0),
+    protein_g DECIMAL(7,2) NOT NULL DEFAULT 0 CHECK (protein_g >= 0),
+    carbs_g DECIMAL(7,2) NOT NULL DEFAULT 0 CHECK (carbs_g >= 0),
+    fat_g DECIMAL(7,2) NOT NULL DEFAULT 0 CHECK (fat_g >= 0),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE meal_plan_meals (
+    meal_plan_id BIGINT NOT NULL REFERENCES meal_plans(id) ON DELETE CASCADE,
+    meal_id BIGINT NOT NULL REFERENCES meals(id) ON DELETE CASCADE,
+    order_index INTEGER NOT NULL,
+    PRIMARY KEY (meal_plan_id, order_index)
+);
+
+CREATE TABLE nutrition_logs (
+    id BIGSERIAL PRIMARY KEY,
+    trainee_id BIGINT NOT NULL,
+    meal_id BIGINT NOT NULL REFERENCES meals(id) ON DELETE CASCADE,
+    eaten_on DATE NOT NULL,
+    eaten_at TIME NOT NULL,
+    portion_size VARCHAR(100),
+    notes TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_meals_created_by ON meals(created_by);
+CREATE INDEX idx_meal_plans_owner_id ON meal_plans(owner_id);
+CREATE INDEX idx_meal_plan_meals_meal_id ON meal_plan_meals(meal_id);
+CREATE INDEX idx_nutrition_logs_trainee_day ON nutrition_logs(trainee_id, eaten_on);
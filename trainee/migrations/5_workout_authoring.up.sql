@@ -0,0 +1,9 @@
+-- Deleted templates are kept for the workouts logged against them
+ALTER TABLE workout_templates ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Exercises of a template have distinct positions. The check runs at commit so
+-- a reorder can move exercises past each other.
+ALTER TABLE workout_exercises
+    ADD CONSTRAINT workout_exercises_position UNIQUE (workout_id, order_index) DEFERRABLE INITIALLY DEFERRED;
+
+CREATE INDEX idx_workout_templates_trainer ON workout_templates(trainer_id);
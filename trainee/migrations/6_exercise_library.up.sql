@@ -0,0 +1,23 @@
+-- Exercises without an owner make up the shared library. Trainers' custom
+-- exercises belong to them and are only offered to them.
+ALTER TABLE exercises
+    ADD COLUMN owner_id BIGINT,
+    ADD COLUMN deleted_at TIMESTAMPTZ,
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', name), 'A') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+    ) STORED;
+
+CREATE INDEX idx_exercises_owner ON exercises(owner_id);
+CREATE INDEX idx_exercises_search ON exercises USING GIN (search_vector);
+CREATE INDEX idx_exercises_muscle_group ON exercises(LOWER(muscle_group));
+CREATE INDEX idx_exercises_equipment ON exercises(LOWER(equipment_required));
+
+-- Other names an exercise is known by, e.g. "DB bench" for "Dumbbell Bench Press"
+CREATE TABLE exercise_aliases (
+    exercise_id BIGINT NOT NULL REFERENCES exercises(id) ON DELETE CASCADE,
+    alias VARCHAR(255) NOT NULL,
+    PRIMARY KEY (exercise_id, alias)
+);
+
+CREATE INDEX idx_exercise_aliases_search ON exercise_aliases USING GIN (to_tsvector('english', alias));
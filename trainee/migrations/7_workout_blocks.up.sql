@@ -0,0 +1,24 @@
+-- Consecutive exercises of a template done together, such as supersets,
+-- circuits and interval blocks. Removing a block leaves its exercises.
+CREATE TABLE workout_blocks (
+    id BIGSERIAL PRIMARY KEY,
+    workout_id BIGINT NOT NULL REFERENCES workout_templates(id) ON DELETE CASCADE,
+    block_type VARCHAR(20) NOT NULL CHECK (block_type IN ('SUPERSET', 'CIRCUIT', 'EMOM', 'AMRAP', 'TABATA')),
+    name VARCHAR(255),
+    rounds INTEGER,
+    work_seconds INTEGER,
+    rest_seconds INTEGER,
+    round_rest_seconds INTEGER,
+    notes TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_workout_blocks_workout ON workout_blocks(workout_id);
+
+-- set_targets holds a target per set: reps, RPE, tempo or percentage of one-rep max
+ALTER TABLE workout_exercises
+    ADD COLUMN block_id BIGINT REFERENCES workout_blocks(id) ON DELETE SET NULL,
+    ADD COLUMN set_targets JSONB NOT NULL DEFAULT '[]';
+
+CREATE INDEX idx_workout_exercises_block ON workout_exercises(block_id);
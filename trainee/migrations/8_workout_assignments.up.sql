@@ -0,0 +1,9 @@
+-- Assignments are listed by whether they are completed and when they are due
+UPDATE assigned_workouts SET completed = FALSE WHERE completed IS NULL;
+UPDATE assigned_workouts SET assigned_at = created_at WHERE assigned_at IS NULL;
+ALTER TABLE assigned_workouts
+    ALTER COLUMN completed SET NOT NULL,
+    ALTER COLUMN assigned_at SET NOT NULL;
+
+DROP INDEX idx_assigned_workouts_trainee;
+CREATE INDEX idx_assigned_workouts_trainee ON assigned_workouts(trainee_id, completed, due_date);
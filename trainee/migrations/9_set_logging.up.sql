@@ -0,0 +1,26 @@
+-- A logged exercise keeps what the template prescribed when it was logged, so
+-- the history compares against the plan even after the template changes.
+-- sets_completed, reps_completed and duration_seconds sum up its completed
+-- sets and weight_kg holds the heaviest of them.
+ALTER TABLE exercise_logs
+    ADD COLUMN workout_exercise_id BIGINT REFERENCES workout_exercises(id) ON DELETE SET NULL,
+    ADD COLUMN position INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN planned BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN planned_sets INTEGER,
+    ADD COLUMN planned_reps INTEGER,
+    ADD COLUMN planned_duration_seconds INTEGER;
+
+-- Each set of a logged exercise as the trainee did it, or skipped it
+CREATE TABLE exercise_log_sets (
+    id BIGSERIAL PRIMARY KEY,
+    exercise_log_id BIGINT NOT NULL REFERENCES exercise_logs(id) ON DELETE CASCADE,
+    set_number INTEGER NOT NULL,
+    reps INTEGER,
+    weight_kg DECIMAL(5,2),
+    duration_seconds INTEGER,
+    rpe DECIMAL(3,1),
+    skipped BOOLEAN NOT NULL DEFAULT FALSE,
+    target_reps INTEGER,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (exercise_log_id, set_number)
+);
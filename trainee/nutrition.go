@@ -0,0 +1,576 @@
+package trainee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"encore.app/admin"
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+const (
+	nameMaxLength        = 255
+	portionSizeMaxLength = 100
+	maxMealsPerPlan      = 50
+)
+
+var errMealPlanNotFound = &errs.Error{
+	Code:    errs.NotFound,
+	Message: "meal plan not found",
+}
+
+// MealType is the time of day a meal is meant for
+type MealType string
+
+const (
+	MealBreakfast MealType = "BREAKFAST"
+	MealLunch     MealType = "LUNCH"
+	MealDinner    MealType = "DINNER"
+	MealSnack     MealType = "SNACK"
+)
+
+// Valid reports whether t is a known meal type
+func (t MealType) Valid() bool {
+	switch t {
+	case MealBreakfast, MealLunch, MealDinner, MealSnack:
+		return true
+	}
+	return false
+}
+
+// Macros are macronutrients in grams
+type Macros struct {
+	ProteinG float64 `json:"protein_g"`
+	CarbsG   float64 `json:"carbs_g"`
+	FatG     float64 `json:"fat_g"`
+}
+
+// Meal is a meal of a meal plan
+type Meal struct {
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Ingredients  []string `json:"ingredients"`
+	Instructions *string  `json:"instructions,omitempty"`
+	Calories     int      `json:"calories"`
+	Macros       Macros   `json:"macros"`
+	MealType     MealType `json:"meal_type"`
+}
+
+// MealPlan is a set of meals a trainee follows. CreatedBy is the trainee
+// themselves for a custom plan.
+type MealPlan struct {
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"owner_id"`
+	CreatedBy   *int      `json:"created_by,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Meals       []*Meal   `json:"meals"`
+	Calories    int       `json:"calories"`
+	Macros      Macros    `json:"macros"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// NutritionLog is a meal a trainee ate. Date and Time are the trainee's local
+// date (YYYY-MM-DD) and time of day (HH:MM:SS).
+type NutritionLog struct {
+	ID          int       `json:"id"`
+	TraineeID   int       `json:"trainee_id"`
+	Meal        *Meal     `json:"meal"`
+	Date        string    `json:"date"`
+	Time        string    `json:"time"`
+	PortionSize *string   `json:"portion_size,omitempty"`
+	Notes       *string   `json:"notes,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// MealParams describes a meal of a new meal plan
+type MealParams struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Ingredients  []string `json:"ingredients"`
+	Instructions *string  `json:"instructions,omitempty"`
+	Calories     int      `json:"calories"`
+	Macros       Macros   `json:"macros"`
+	MealType     MealType `json:"meal_type"`
+}
+
+// CreateMealPlanParams contains the data needed to create a meal plan
+type CreateMealPlanParams struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Meals       []*MealParams `json:"meals"`
+	Calories    int           `json:"calories"`
+	Macros      Macros        `json:"macros"`
+}
+
+// MealPlansResponse lists meal plans, newest first
+type MealPlansResponse struct {
+	MealPlans []*MealPlan `json:"meal_plans"`
+}
+
+// NutritionLogsParams selects the day to list, as YYYY-MM-DD
+type NutritionLogsParams struct {
+	Date string `query:"date"`
+}
+
+// NutritionLogsResponse lists the meals of a day in the order they were eaten
+type NutritionLogsResponse struct {
+	Logs []*NutritionLog `json:"logs"`
+}
+
+// LogNutritionParams contains a meal the current user ate. Time may leave out the seconds.
+type LogNutritionParams struct {
+	MealID      int     `json:"meal_id"`
+	Date        string  `json:"date"`
+	Time        string  `json:"time"`
+	PortionSize *string `json:"portion_size,omitempty"`
+	Notes       *string `json:"notes,omitempty"`
+}
+
+// MyMealPlans returns the meal plans of the current user
+//
+//encore:api auth method=GET path=/trainee/me/meal-plans tag:scope_nutrition_read
+func MyMealPlans(ctx context.Context) (*MealPlansResponse, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	plans, err := repo.MealPlans(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &MealPlansResponse{MealPlans: plans}, nil
+}
+
+// GetMealPlan returns a meal plan of a trainee the caller may see
+//
+//encore:api auth method=GET path=/trainee/meal-plans/:id tag:scope_nutrition_read
+func GetMealPlan(ctx context.Context, id int) (*MealPlan, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	plan, err := repo.GetMealPlan(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Hidden plans look the same as missing ones
+	if plan.CreatedBy == nil || *plan.CreatedBy != caller.UserID {
+		ok, err := canViewTrainee(ctx, caller, plan.OwnerID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errMealPlanNotFound
+		}
+	}
+	return plan, nil
+}
+
+// CreateMealPlan creates a custom meal plan for the current user
+//
+//encore:api auth method=POST path=/trainee/me/meal-plans tag:scope_nutrition_write
+func CreateMealPlan(ctx context.Context, params *CreateMealPlanParams) (*MealPlan, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateMealPlan(params); err != nil {
+		return nil, err
+	}
+
+	plan, err := repo.CreateMealPlan(ctx, userID, userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "meal_plan.create",
+		EntityType: "meal_plan",
+		EntityID:   strconv.Itoa(plan.ID),
+		After:      plan,
+	})
+	return plan, nil
+}
+
+// MyNutritionLogs returns what the current user logged eating on a day
+//
+//encore:api auth method=GET path=/trainee/me/nutrition-logs tag:scope_nutrition_read
+func MyNutritionLogs(ctx context.Context, params *NutritionLogsParams) (*NutritionLogsResponse, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := time.Parse(time.DateOnly, params.Date); err != nil {
+		return nil, invalidArgument("date must be formatted as YYYY-MM-DD")
+	}
+	logs, err := repo.NutritionLogs(ctx, userID, params.Date)
+	if err != nil {
+		return nil, err
+	}
+	return &NutritionLogsResponse{Logs: logs}, nil
+}
+
+// LogNutrition logs a meal from one of the current user's meal plans
+//
+//encore:api auth method=POST path=/trainee/me/nutrition-logs tag:scope_nutrition_write
+func LogNutrition(ctx context.Context, params *LogNutritionParams) (*NutritionLog, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the input
+	if _, err := time.Parse(time.DateOnly, params.Date); err != nil {
+		return nil, invalidArgument("date must be formatted as YYYY-MM-DD")
+	}
+	if _, err := time.Parse(time.TimeOnly, params.Time); err != nil {
+		if _, err := time.Parse("15:04", params.Time); err != nil {
+			return nil, invalidArgument("time must be formatted as HH:MM or HH:MM:SS")
+		}
+	}
+	if params.PortionSize != nil && utf8.RuneCountInString(*params.PortionSize) > portionSizeMaxLength {
+		return nil, invalidArgument(fmt.Sprintf("portion size must be at most %d characters", portionSizeMaxLength))
+	}
+
+	ok, err := repo.CanLogMeal(ctx, userID, params.MealID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: "meal not found in your meal plans",
+		}
+	}
+
+	log, err := repo.LogNutrition(ctx, userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "nutrition.log",
+		EntityType: "nutrition_log",
+		EntityID:   strconv.Itoa(log.ID),
+		After:      log,
+	})
+	return log, nil
+}
+
+// validateMealPlan checks a new meal plan and its meals
+func validateMealPlan(params *CreateMealPlanParams) error {
+	if err := validateNutrition("meal plan", params.Name, params.Calories, params.Macros); err != nil {
+		return err
+	}
+	switch {
+	case len(params.Meals) == 0:
+		return invalidArgument("a meal plan needs at least one meal")
+	case len(params.Meals) > maxMealsPerPlan:
+		return invalidArgument(fmt.Sprintf("a meal plan may have at most %d meals", maxMealsPerPlan))
+	}
+	for _, m := range params.Meals {
+		if err := validateNutrition("meal", m.Name, m.Calories, m.Macros); err != nil {
+			return err
+		}
+		if !m.MealType.Valid() {
+			return invalidArgument("unknown meal type")
+		}
+		for _, ingredient := range m.Ingredients {
+			if strings.TrimSpace(ingredient) == "" {
+				return invalidArgument("ingredients must not be empty")
+			}
+		}
+	}
+	return nil
+}
+
+// validateNutrition checks the fields meals and meal plans share
+func validateNutrition(kind, name string, calories int, macros Macros) error {
+	switch n := utf8.RuneCountInString(strings.TrimSpace(name)); {
+	case n == 0:
+		return invalidArgument(kind + " name is required")
+	case n > nameMaxLength:
+		return invalidArgument(fmt.Sprintf("%s name must be at most %d characters", kind, nameMaxLength))
+	case calories < 0:
+		return invalidArgument("calories must not be negative")
+	case macros.ProteinG < 0 || macros.CarbsG < 0 || macros.FatG < 0:
+		return invalidArgument("macros must not be negative")
+	case macros.ProteinG >= 100000 || macros.CarbsG >= 100000 || macros.FatG >= 100000:
+		return invalidArgument("macros must be less than 100000 g")
+	}
+	return nil
+}
+
+// MealPlans returns the meal plans of a trainee
+func (r *postgresRepository) MealPlans(ctx context.Context, ownerID int) ([]*MealPlan, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+mealPlanColumns+`
+		FROM meal_plans p
+		WHERE p.owner_id = $1
+		ORDER BY p.created_at DESC, p.id DESC
+	`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []*MealPlan{}
+	for rows.Next() {
+		p, err := scanMealPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.addMeals(ctx, plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+// GetMealPlan returns a meal plan with its meals
+func (r *postgresRepository) GetMealPlan(ctx context.Context, mealPlanID int) (*MealPlan, error) {
+	p, err := scanMealPlan(r.db.QueryRow(ctx, `
+		SELECT `+mealPlanColumns+`
+		FROM meal_plans p
+		WHERE p.id = $1
+	`, mealPlanID))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errMealPlanNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := r.addMeals(ctx, []*MealPlan{p}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CreateMealPlan inserts a meal plan and its meals
+func (r *postgresRepository) CreateMealPlan(ctx context.Context, ownerID, createdBy int, params *CreateMealPlanParams) (*MealPlan, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var planID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO meal_plans (owner_id, created_by, name, description, calories, protein_g, carbs_g, fat_g, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		RETURNING id
+	`, ownerID, createdBy, strings.TrimSpace(params.Name), strings.TrimSpace(params.Description),
+		params.Calories, params.Macros.ProteinG, params.Macros.CarbsG, params.Macros.FatG,
+	).Scan(&planID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, m := range params.Meals {
+		ingredients := make([]string, len(m.Ingredients))
+		for j, ingredient := range m.Ingredients {
+			ingredients[j] = strings.TrimSpace(ingredient)
+		}
+		_, err = tx.Exec(ctx, `
+			WITH meal AS (
+				INSERT INTO meals (
+					created_by, name, description, ingredients, instructions, calories,
+					protein_g, carbs_g, fat_g, meal_type, created_at, updated_at
+				) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10, NOW(), NOW())
+				RETURNING id
+			)
+			INSERT INTO meal_plan_meals (meal_plan_id, meal_id, order_index)
+			SELECT $11, id, $12 FROM meal
+		`, createdBy, strings.TrimSpace(m.Name), strings.TrimSpace(m.Description), ingredients, m.Instructions,
+			m.Calories, m.Macros.ProteinG, m.Macros.CarbsG, m.Macros.FatG, string(m.MealType), planID, i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetMealPlan(ctx, planID)
+}
+
+// CanLogMeal reports whether a meal is in one of the trainee's meal plans
+func (r *postgresRepository) CanLogMeal(ctx context.Context, traineeID, mealID int) (bool, error) {
+	var ok bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM meal_plan_meals pm
+			JOIN meal_plans p ON p.id = pm.meal_plan_id
+			WHERE pm.meal_id = $1 AND p.owner_id = $2
+		)
+	`, mealID, traineeID).Scan(&ok)
+	return ok, err
+}
+
+// NutritionLogs returns the meals a trainee logged on a day
+func (r *postgresRepository) NutritionLogs(ctx context.Context, traineeID int, date string) ([]*NutritionLog, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+nutritionLogColumns+`
+		FROM nutrition_logs l
+		JOIN meals m ON m.id = l.meal_id
+		WHERE l.trainee_id = $1 AND l.eaten_on = $2::DATE
+		ORDER BY l.eaten_at, l.id
+	`, traineeID, date)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []*NutritionLog{}
+	for rows.Next() {
+		l, err := scanNutritionLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+// LogNutrition inserts a nutrition_logs row
+func (r *postgresRepository) LogNutrition(ctx context.Context, traineeID int, params *LogNutritionParams) (*NutritionLog, error) {
+	return scanNutritionLog(r.db.QueryRow(ctx, `
+		WITH l AS (
+			INSERT INTO nutrition_logs (trainee_id, meal_id, eaten_on, eaten_at, portion_size, notes, created_at)
+			VALUES ($1, $2, $3::DATE, $4::TIME, NULLIF($5, ''), NULLIF($6, ''), NOW())
+			RETURNING *
+		)
+		SELECT `+nutritionLogColumns+`
+		FROM l
+		JOIN meals m ON m.id = l.meal_id
+	`, traineeID, params.MealID, params.Date, params.Time, params.PortionSize, params.Notes))
+}
+
+// addMeals loads the meals of meal plans with a single query
+func (r *postgresRepository) addMeals(ctx context.Context, plans []*MealPlan) error {
+	byID := make(map[int]*MealPlan, len(plans))
+	ids := make([]int, len(plans))
+	for i, p := range plans {
+		p.Meals = []*Meal{}
+		byID[p.ID] = p
+		ids[i] = p.ID
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT pm.meal_plan_id, `+mealColumns+`
+		FROM meal_plan_meals pm
+		JOIN meals m ON m.id = pm.meal_id
+		WHERE pm.meal_plan_id = ANY($1)
+		ORDER BY pm.meal_plan_id, pm.order_index
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var planID int
+		m, err := scanMeal(rows, &planID)
+		if err != nil {
+			return err
+		}
+		byID[planID].Meals = append(byID[planID].Meals, m)
+	}
+	return rows.Err()
+}
+
+// mealColumns are the columns scanMeal reads, from meals aliased m
+const mealColumns = `m.id, m.name, m.description, m.ingredients, m.instructions, m.calories,
+			m.protein_g::FLOAT8, m.carbs_g::FLOAT8, m.fat_g::FLOAT8, m.meal_type`
+
+// scanMeal reads the mealColumns following the given leading columns
+func scanMeal(row interface{ Scan(...interface{}) error }, leading ...interface{}) (*Meal, error) {
+	var m Meal
+	var mealType string
+	err := row.Scan(append(leading,
+		&m.ID,
+		&m.Name,
+		&m.Description,
+		&m.Ingredients,
+		&m.Instructions,
+		&m.Calories,
+		&m.Macros.ProteinG,
+		&m.Macros.CarbsG,
+		&m.Macros.FatG,
+		&mealType,
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	m.MealType = MealType(mealType)
+	return &m, nil
+}
+
+// mealPlanColumns are the columns scanMealPlan reads, from meal_plans aliased p
+const mealPlanColumns = `p.id, p.owner_id, p.created_by, p.name, p.description, p.calories,
+			p.protein_g::FLOAT8, p.carbs_g::FLOAT8, p.fat_g::FLOAT8, p.created_at, p.updated_at`
+
+func scanMealPlan(row interface{ Scan(...interface{}) error }) (*MealPlan, error) {
+	var p MealPlan
+	err := row.Scan(
+		&p.ID,
+		&p.OwnerID,
+		&p.CreatedBy,
+		&p.Name,
+		&p.Description,
+		&p.Calories,
+		&p.Macros.ProteinG,
+		&p.Macros.CarbsG,
+		&p.Macros.FatG,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// nutritionLogColumns are the columns scanNutritionLog reads, from nutrition_logs
+// aliased l joined with their meals aliased m
+const nutritionLogColumns = `l.id, l.trainee_id, l.eaten_on::TEXT, to_char(l.eaten_at, 'HH24:MI:SS'),
+			l.portion_size, l.notes, l.created_at, ` + mealColumns
+
+func scanNutritionLog(row interface{ Scan(...interface{}) error }) (*NutritionLog, error) {
+	var l NutritionLog
+	meal, err := scanMeal(row,
+		&l.ID,
+		&l.TraineeID,
+		&l.Date,
+		&l.Time,
+		&l.PortionSize,
+		&l.Notes,
+		&l.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	l.Meal = meal
+	return &l, nil
+}
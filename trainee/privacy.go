@@ -0,0 +1,201 @@
+package trainee
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"encore.app/audit"
+	"encore.dev/rlog"
+)
+
+// DataTable is one table of a data export, with every value as text
+type DataTable struct {
+	Name    string     `json:"name"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+}
+
+// PhotoFile is a progress photo to include in a data export
+type PhotoFile struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// UserDataExport is everything the trainee service stores about a user
+type UserDataExport struct {
+	Tables []*DataTable `json:"tables"`
+	Photos []*PhotoFile `json:"photos"`
+}
+
+// exportTables lists the rows holding a user's data. $1 is the user ID.
+var exportTables = []struct {
+	name    string
+	from    string
+	columns []string
+}{
+	{"profile", "trainee_profiles WHERE user_id = $1",
+		[]string{"id", "age", "height_cm", "weight_kg", "fitness_level", "medical_conditions", "injuries", "preferences", "goals", "created_at", "updated_at"}},
+	{"trainer_relationships", "trainer_trainee_relationships WHERE trainer_id = $1 OR trainee_id = $1",
+		[]string{"id", "trainer_id", "trainee_id", "is_active", "start_date", "end_date", "created_at"}},
+	{"workout_templates", "workout_templates WHERE trainer_id = $1",
+		[]string{"id", "name", "description", "duration_minutes", "difficulty", "is_public", "created_at", "updated_at"}},
+	{"assigned_workouts", "assigned_workouts WHERE trainee_id = $1",
+		[]string{"id", "workout_id", "assigned_by", "assigned_at", "due_date", "completed", "completed_at"}},
+	{"workout_logs", "workout_logs WHERE trainee_id = $1",
+		[]string{"id", "assigned_workout_id", "workout_id", "start_time", "end_time", "duration_minutes", "notes", "rating"}},
+	{"exercise_logs", "exercise_logs WHERE workout_log_id IN (SELECT id FROM workout_logs WHERE trainee_id = $1)",
+		[]string{"id", "workout_log_id", "exercise_id", "workout_exercise_id", "position", "planned_sets", "planned_reps", "planned_duration_seconds", "sets_completed", "reps_completed", "weight_kg", "duration_seconds", "notes"}},
+	{"exercise_log_sets", "exercise_log_sets WHERE exercise_log_id IN (SELECT e.id FROM exercise_logs e JOIN workout_logs l ON l.id = e.workout_log_id WHERE l.trainee_id = $1)",
+		[]string{"id", "exercise_log_id", "set_number", "reps", "weight_kg", "duration_seconds", "rpe", "skipped", "target_reps"}},
+	{"progress_metrics", "progress_metrics WHERE trainee_id = $1",
+		[]string{"id", "metric_type", "value", "measured_at", "notes"}},
+	{"progress_photos", "progress_photos WHERE trainee_id = $1",
+		[]string{"id", "photo_url", "taken_at", "angle", "notes"}},
+	{"meal_plans", "meal_plans WHERE owner_id = $1",
+		[]string{"id", "created_by", "name", "description", "calories", "protein_g", "carbs_g", "fat_g", "created_at"}},
+	{"meals", "meals WHERE created_by = $1 OR id IN (SELECT meal_id FROM meal_plan_meals WHERE meal_plan_id IN (SELECT id FROM meal_plans WHERE owner_id = $1))",
+		[]string{"id", "name", "description", "ingredients", "instructions", "calories", "protein_g", "carbs_g", "fat_g", "meal_type"}},
+	{"nutrition_logs", "nutrition_logs WHERE trainee_id = $1",
+		[]string{"id", "meal_id", "eaten_on", "eaten_at", "portion_size", "notes", "created_at"}},
+	{"exercises", "exercises WHERE owner_id = $1",
+		[]string{"id", "name", "description", "muscle_group", "equipment_required", "video_url", "created_at", "updated_at", "deleted_at"}},
+	{"messages", "messages WHERE sender_id = $1 OR receiver_id = $1",
+		[]string{"id", "sender_id", "receiver_id", "content", "is_read", "read_at", "created_at"}},
+}
+
+// ExportUserData collects the personal data of a user for a data export
+//
+//encore:api private method=GET path=/trainee/users/:id/export
+func ExportUserData(ctx context.Context, id int) (*UserDataExport, error) {
+	export := &UserDataExport{}
+	for _, t := range exportTables {
+		table, err := exportTable(ctx, t.name, t.from, t.columns, id)
+		if err != nil {
+			return nil, err
+		}
+		export.Tables = append(export.Tables, table)
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id::TEXT, photo_url
+		FROM progress_photos
+		WHERE trainee_id = $1
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	export.Photos = []*PhotoFile{}
+	for rows.Next() {
+		var p PhotoFile
+		if err := rows.Scan(&p.ID, &p.URL); err != nil {
+			return nil, err
+		}
+		export.Photos = append(export.Photos, &p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The photos are private, so the export downloads them through signed URLs
+	for _, p := range export.Photos {
+		if p.URL, err = photoURL(ctx, p.URL); err != nil {
+			return nil, err
+		}
+	}
+	return export, nil
+}
+
+// exportTable selects the given columns as text
+func exportTable(ctx context.Context, name, from string, columns []string, userID int) (*DataTable, error) {
+	selects := make([]string, len(columns))
+	for i, c := range columns {
+		selects[i] = fmt.Sprintf("COALESCE(%s::TEXT, '')", c)
+	}
+
+	// The table and column names come from exportTables, never from the caller
+	rows, err := db.Query(ctx, fmt.Sprintf(`SELECT %s FROM %s ORDER BY id`,
+		strings.Join(selects, ", "), from), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	table := &DataTable{Name: name, Columns: columns, Rows: [][]string{}}
+	for rows.Next() {
+		row := make([]string, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table, rows.Err()
+}
+
+// EraseUserData deletes the fitness and health data of a user. Workout templates they
+// wrote stay available to the trainees they were assigned to, without an author.
+//
+//encore:api private method=POST path=/trainee/users/:id/erase
+func EraseUserData(ctx context.Context, id int) error {
+	// Start a transaction
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		`DELETE FROM exercise_log_sets WHERE exercise_log_id IN (SELECT e.id FROM exercise_logs e JOIN workout_logs l ON l.id = e.workout_log_id WHERE l.trainee_id = $1)`,
+		`DELETE FROM exercise_logs WHERE workout_log_id IN (SELECT id FROM workout_logs WHERE trainee_id = $1)`,
+		`DELETE FROM workout_logs WHERE trainee_id = $1`,
+		`DELETE FROM assigned_workouts WHERE trainee_id = $1`,
+		`UPDATE assigned_workouts SET assigned_by = NULL WHERE assigned_by = $1`,
+		`UPDATE workout_templates SET trainer_id = NULL WHERE trainer_id = $1`,
+		`DELETE FROM progress_metrics WHERE trainee_id = $1`,
+		`DELETE FROM progress_photos WHERE trainee_id = $1`,
+		`DELETE FROM nutrition_logs WHERE trainee_id = $1`,
+		`DELETE FROM meal_plans WHERE owner_id = $1`,
+		`UPDATE meal_plans SET created_by = NULL WHERE created_by = $1`,
+		// Meals of the user's own plans; meals they wrote for others stay without an author
+		`DELETE FROM meals WHERE created_by = $1 AND id NOT IN (SELECT meal_id FROM meal_plan_meals)`,
+		`UPDATE meals SET created_by = NULL WHERE created_by = $1`,
+		// Custom exercises nothing refers to; the others stay, hidden and without an owner
+		`DELETE FROM exercises WHERE owner_id = $1 AND id NOT IN (SELECT exercise_id FROM workout_exercises)
+			AND id NOT IN (SELECT exercise_id FROM exercise_logs)`,
+		`UPDATE exercises SET owner_id = NULL, deleted_at = COALESCE(deleted_at, NOW()) WHERE owner_id = $1`,
+		`DELETE FROM messages WHERE sender_id = $1 OR receiver_id = $1`,
+		`DELETE FROM trainer_trainee_relationships WHERE trainer_id = $1 OR trainee_id = $1`,
+		`DELETE FROM trainee_profiles WHERE user_id = $1`,
+		// Keep the row and its version so late snapshots from before the erasure are ignored
+		`UPDATE user_projections SET username = 'deleted-' || user_id, fullname = '', status = 'DELETED' WHERE user_id = $1`,
+	} {
+		if _, err := tx.Exec(ctx, stmt, id); err != nil {
+			return err
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// The rows are gone, so photo files left behind are unreachable; log and carry on
+	if err := removePhotos(ctx, id); err != nil {
+		rlog.Error("could not remove progress photo files", "user_id", id, "err", err)
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "trainee.erase",
+		EntityType: "user",
+		EntityID:   strconv.Itoa(id),
+	})
+	return nil
+}
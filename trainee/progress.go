@@ -0,0 +1,339 @@
+package trainee
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"encore.app/admin"
+	"encore.app/audit"
+	"encore.dev/rlog"
+	"encore.dev/storage/objects"
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxPhotoSize is the largest progress photo that can be uploaded
+	MaxPhotoSize = 10 << 20
+
+	// photoURLTTL is how long the download URL of a progress photo works
+	photoURLTTL = 15 * time.Minute
+
+	notesMaxLength = 2000
+)
+
+// photoExtensions maps the accepted photo formats to their file extensions
+var photoExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// PhotoAngle is the side a progress photo is taken from
+type PhotoAngle string
+
+const (
+	PhotoFront PhotoAngle = "FRONT"
+	PhotoSide  PhotoAngle = "SIDE"
+	PhotoBack  PhotoAngle = "BACK"
+)
+
+// Valid reports whether a is a known angle
+func (a PhotoAngle) Valid() bool {
+	switch a {
+	case PhotoFront, PhotoSide, PhotoBack:
+		return true
+	}
+	return false
+}
+
+// ProgressPhoto is a photo a trainee took to follow their progress. The URL
+// of an uploaded photo is signed and stops working after a few minutes.
+type ProgressPhoto struct {
+	ID        int         `json:"id"`
+	TraineeID int         `json:"trainee_id"`
+	URL       string      `json:"url"`
+	TakenAt   time.Time   `json:"taken_at"`
+	Notes     *string     `json:"notes,omitempty"`
+	Angle     *PhotoAngle `json:"angle,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// MetricEntry is a measurement taken at a point in time
+type MetricEntry struct {
+	MeasuredAt time.Time `json:"measured_at"`
+	Value      float64   `json:"value"`
+}
+
+// StrengthEntry is the heaviest weight logged for an exercise on a day (YYYY-MM-DD)
+type StrengthEntry struct {
+	ExerciseID  int     `json:"exercise_id"`
+	Date        string  `json:"date"`
+	MaxWeightKg float64 `json:"max_weight_kg"`
+}
+
+// ProgressMetrics are the measurements of a trainee, oldest first
+type ProgressMetrics struct {
+	Weight   []*MetricEntry   `json:"weight"`
+	BodyFat  []*MetricEntry   `json:"body_fat"`
+	Strength []*StrengthEntry `json:"strength"`
+}
+
+// ProgressPhotosResponse lists progress photos, newest first
+type ProgressPhotosResponse struct {
+	Photos []*ProgressPhoto `json:"photos"`
+}
+
+// UploadProgressPhotoParams contains a JPEG, PNG or WebP photo. Photos without
+// a time are taken to be taken now.
+type UploadProgressPhotoParams struct {
+	Data    []byte      `json:"data"`
+	Angle   *PhotoAngle `json:"angle,omitempty"`
+	Notes   *string     `json:"notes,omitempty"`
+	TakenAt *time.Time  `json:"taken_at,omitempty"`
+}
+
+// photos stores the uploaded progress photos under "<user ID>/". The bucket is
+// private; photos are downloaded through signed URLs handed to their owner.
+var photos = objects.NewBucket("progress-photos", objects.BucketConfig{})
+
+// MyProgressMetrics returns the measurements of the current user
+//
+//encore:api auth method=GET path=/trainee/me/progress-metrics tag:scope_metrics_read
+func MyProgressMetrics(ctx context.Context) (*ProgressMetrics, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	return repo.ProgressMetrics(ctx, userID)
+}
+
+// MyProgressPhotos returns the progress photos of the current user
+//
+//encore:api auth method=GET path=/trainee/me/progress-photos tag:scope_metrics_read
+func MyProgressPhotos(ctx context.Context) (*ProgressPhotosResponse, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	list, err := repo.ProgressPhotos(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range list {
+		if p.URL, err = photoURL(ctx, p.URL); err != nil {
+			return nil, err
+		}
+	}
+	return &ProgressPhotosResponse{Photos: list}, nil
+}
+
+// UploadProgressPhoto stores a progress photo of the current user
+//
+//encore:api auth method=POST path=/trainee/me/progress-photos tag:scope_metrics_write
+func UploadProgressPhoto(ctx context.Context, params *UploadProgressPhotoParams) (*ProgressPhoto, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the input
+	if len(params.Data) == 0 {
+		return nil, invalidArgument("the photo is empty")
+	}
+	if len(params.Data) > MaxPhotoSize {
+		return nil, invalidArgument(fmt.Sprintf("photos must be at most %d MB", MaxPhotoSize>>20))
+	}
+	contentType := http.DetectContentType(params.Data)
+	ext, ok := photoExtensions[contentType]
+	if !ok {
+		return nil, invalidArgument("photos must be JPEG, PNG or WebP images")
+	}
+	if params.Angle != nil && !params.Angle.Valid() {
+		return nil, invalidArgument("unknown photo angle")
+	}
+	if params.Notes != nil && utf8.RuneCountInString(*params.Notes) > notesMaxLength {
+		return nil, invalidArgument(fmt.Sprintf("notes must be at most %d characters", notesMaxLength))
+	}
+	takenAt := time.Now()
+	if params.TakenAt != nil {
+		if params.TakenAt.After(takenAt) {
+			return nil, invalidArgument("the photo can't be taken in the future")
+		}
+		takenAt = *params.TakenAt
+	}
+
+	// Upload the photo
+	key := fmt.Sprintf("%d/%s%s", userID, uuid.NewString(), ext)
+	w := photos.Upload(ctx, key, objects.WithUploadAttrs(objects.UploadAttrs{ContentType: contentType}))
+	if _, err := w.Write(params.Data); err != nil {
+		w.Abort(err)
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	photo, err := repo.AddProgressPhoto(ctx, &ProgressPhoto{
+		TraineeID: userID,
+		URL:       key,
+		TakenAt:   takenAt,
+		Notes:     params.Notes,
+		Angle:     params.Angle,
+	})
+	if err != nil {
+		if err := photos.Remove(ctx, key); err != nil {
+			rlog.Error("could not remove unsaved progress photo", "key", key, "err", err)
+		}
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "progress_photo.upload",
+		EntityType: "progress_photo",
+		EntityID:   strconv.Itoa(photo.ID),
+		After:      photo,
+	})
+
+	if photo.URL, err = photoURL(ctx, key); err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+// photoURL returns a download URL for the stored location of a photo: a signed
+// URL for an object key, or the address of a photo saved before uploads
+func photoURL(ctx context.Context, stored string) (string, error) {
+	if strings.Contains(stored, "://") {
+		return stored, nil
+	}
+	u, err := photos.SignedDownloadURL(ctx, stored, objects.WithTTL(photoURLTTL))
+	if err != nil {
+		return "", err
+	}
+	return u.URL, nil
+}
+
+// removePhotos deletes the stored photo files of a user
+func removePhotos(ctx context.Context, userID int) error {
+	for entry, err := range photos.List(ctx, &objects.Query{Prefix: fmt.Sprintf("%d/", userID)}) {
+		if err != nil {
+			return err
+		}
+		if err := photos.Remove(ctx, entry.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProgressMetrics returns the weight and body fat measurements and strength records of a trainee
+func (r *postgresRepository) ProgressMetrics(ctx context.Context, traineeID int) (*ProgressMetrics, error) {
+	metrics := &ProgressMetrics{
+		Weight:   []*MetricEntry{},
+		BodyFat:  []*MetricEntry{},
+		Strength: []*StrengthEntry{},
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT metric_type, measured_at, value::FLOAT8
+		FROM progress_metrics
+		WHERE trainee_id = $1 AND metric_type IN ('WEIGHT', 'BODY_FAT') AND measured_at IS NOT NULL
+		ORDER BY measured_at, id
+	`, traineeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var metricType string
+		var e MetricEntry
+		if err := rows.Scan(&metricType, &e.MeasuredAt, &e.Value); err != nil {
+			return nil, err
+		}
+		if metricType == "WEIGHT" {
+			metrics.Weight = append(metrics.Weight, &e)
+		} else {
+			metrics.BodyFat = append(metrics.BodyFat, &e)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.Query(ctx, `
+		SELECT e.exercise_id, l.start_time::DATE::TEXT AS day, MAX(e.weight_kg)::FLOAT8
+		FROM exercise_logs e
+		JOIN workout_logs l ON l.id = e.workout_log_id
+		WHERE l.trainee_id = $1 AND e.weight_kg IS NOT NULL
+		GROUP BY e.exercise_id, day
+		ORDER BY day, e.exercise_id
+	`, traineeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e StrengthEntry
+		if err := rows.Scan(&e.ExerciseID, &e.Date, &e.MaxWeightKg); err != nil {
+			return nil, err
+		}
+		metrics.Strength = append(metrics.Strength, &e)
+	}
+	return metrics, rows.Err()
+}
+
+// ProgressPhotos returns the progress photos of a trainee
+func (r *postgresRepository) ProgressPhotos(ctx context.Context, traineeID int) ([]*ProgressPhoto, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, trainee_id, photo_url, COALESCE(taken_at, created_at), notes, angle, created_at
+		FROM progress_photos
+		WHERE trainee_id = $1
+		ORDER BY taken_at DESC, id DESC
+	`, traineeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []*ProgressPhoto{}
+	for rows.Next() {
+		p, err := scanProgressPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// AddProgressPhoto inserts a progress_photos row
+func (r *postgresRepository) AddProgressPhoto(ctx context.Context, photo *ProgressPhoto) (*ProgressPhoto, error) {
+	var angle *string
+	if photo.Angle != nil {
+		s := string(*photo.Angle)
+		angle = &s
+	}
+	return scanProgressPhoto(r.db.QueryRow(ctx, `
+		INSERT INTO progress_photos (trainee_id, photo_url, taken_at, angle, notes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NOW(), NOW())
+		RETURNING id, trainee_id, photo_url, taken_at, notes, angle, created_at
+	`, photo.TraineeID, photo.URL, photo.TakenAt, angle, photo.Notes))
+}
+
+func scanProgressPhoto(row interface{ Scan(...interface{}) error }) (*ProgressPhoto, error) {
+	var p ProgressPhoto
+	var angle *string
+	if err := row.Scan(&p.ID, &p.TraineeID, &p.URL, &p.TakenAt, &p.Notes, &angle, &p.CreatedAt); err != nil {
+		return nil, err
+	}
+	if angle != nil {
+		a := PhotoAngle(*angle)
+		p.Angle = &a
+	}
+	return &p, nil
+}
@@ -0,0 +1,566 @@
+package trainee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+var (
+	errTraineeNotFound = &errs.Error{
+		Code:    errs.NotFound,
+		Message: "trainee not found",
+	}
+	errWorkoutNotFound = &errs.Error{
+		Code:    errs.NotFound,
+		Message: "workout not found",
+	}
+)
+
+// Repository is the trainee service's access to its database
+type Repository interface {
+	// GetProfile returns the profile of a user that is not deleted
+	GetProfile(ctx context.Context, userID int) (*Trainee, error)
+
+	// UpdateProfile applies the set fields of req, creating the profile if needed
+	UpdateProfile(ctx context.Context, req *UpdateProfileRequest) (*Trainee, error)
+
+	// GetWorkout returns a workout template that is not deleted, with its exercises
+	GetWorkout(ctx context.Context, workoutID int) (*Workout, error)
+
+	// CanSeeWorkout reports whether a template is public, written by the user or assigned to them
+	CanSeeWorkout(ctx context.Context, userID, workoutID int) (bool, error)
+
+	// TrainerWorkouts returns the templates a trainer wrote that are not deleted, newest first
+	TrainerWorkouts(ctx context.Context, trainerID int) ([]*Workout, error)
+
+	// CreateWorkout stores a template written by a trainer together with its exercises
+	CreateWorkout(ctx context.Context, trainerID int, params *CreateWorkoutTemplateParams) (*Workout, error)
+
+	// UpdateWorkout applies the set fields of params to a template
+	UpdateWorkout(ctx context.Context, workoutID int, params *UpdateWorkoutTemplateParams) (*Workout, error)
+
+	// DuplicateWorkout copies a template and its exercises into a private template of a trainer,
+	// unless it uses custom exercises of another trainer
+	DuplicateWorkout(ctx context.Context, workoutID, trainerID int, name string) (*Workout, error)
+
+	// DeleteWorkout marks a template deleted
+	DeleteWorkout(ctx context.Context, workoutID int) error
+
+	// AddWorkoutExercise inserts an exercise into a template at a position, or last without one
+	AddWorkoutExercise(ctx context.Context, workoutID int, position *int, params *WorkoutExerciseParams) (*Workout, error)
+
+	// UpdateWorkoutExercise replaces what an exercise of a template prescribes
+	UpdateWorkoutExercise(ctx context.Context, workoutID, itemID int, params *WorkoutExerciseParams) (*Workout, error)
+
+	// RemoveWorkoutExercise removes an exercise from a template, closing the gap it leaves
+	RemoveWorkoutExercise(ctx context.Context, workoutID, itemID int) (*Workout, error)
+
+	// ReorderWorkoutExercises puts the exercises of a template in the order of
+	// itemIDs, which must list each of them once
+	ReorderWorkoutExercises(ctx context.Context, workoutID int, itemIDs []int) (*Workout, error)
+
+	// ListExercises returns a page of the library and the custom exercises of
+	// a user that match params, together with the number of matches
+	ListExercises(ctx context.Context, userID int, params *ListExercisesParams, limit, offset int) ([]*Exercise, int, error)
+
+	// GetExercise returns an exercise that is not deleted
+	GetExercise(ctx context.Context, exerciseID int) (*Exercise, error)
+
+	// CreateExercise stores a custom exercise of a trainer, or a library exercise without an owner
+	CreateExercise(ctx context.Context, ownerID *int, params *ExerciseParams) (*Exercise, error)
+
+	// UpdateExercise applies the set fields of params to an exercise
+	UpdateExercise(ctx context.Context, exerciseID int, params *UpdateExerciseParams) (*Exercise, error)
+
+	// DeleteExercise marks an exercise deleted
+	DeleteExercise(ctx context.Context, exerciseID int) error
+
+	// ImportExercises creates or updates library exercises, matching them by name
+	ImportExercises(ctx context.Context, exercises []*ExerciseParams) (*ImportExercisesResponse, error)
+
+	// AddWorkoutBlock groups exercises of a template into a new block
+	AddWorkoutBlock(ctx context.Context, workoutID int, params *WorkoutBlockParams) (*Workout, error)
+
+	// UpdateWorkoutBlock replaces the settings and exercises of a block of a template
+	UpdateWorkoutBlock(ctx context.Context, workoutID, blockID int, params *WorkoutBlockParams) (*Workout, error)
+
+	// RemoveWorkoutBlock removes a block from a template, keeping its exercises
+	RemoveWorkoutBlock(ctx context.Context, workoutID, blockID int) (*Workout, error)
+
+	// Assignments returns the assignments of a trainee with a status, or all of
+	// them for an empty status
+	Assignments(ctx context.Context, traineeID int, status AssignmentStatus) ([]*Assignment, error)
+
+	// GetAssignment returns an assignment with its template
+	GetAssignment(ctx context.Context, assignmentID int) (*Assignment, error)
+
+	// AssignWorkout assigns a template to each of the trainees
+	AssignWorkout(ctx context.Context, workoutID, assignedBy int, traineeIDs []int, dueDate *time.Time) ([]*Assignment, error)
+
+	// UnassignWorkout removes an assignment that is not completed
+	UnassignWorkout(ctx context.Context, assignmentID int) error
+
+	// LogWorkout stores a completed workout with its exercises and sets,
+	// completing the assignment it was logged against
+	LogWorkout(ctx context.Context, req *LogWorkoutRequest) (*CompletedWorkout, error)
+
+	// WorkoutHistory returns the workouts a trainee logged with their exercises, most recent first
+	WorkoutHistory(ctx context.Context, traineeID int) ([]*CompletedWorkout, error)
+
+	// MealPlans returns the meal plans of a trainee, newest first
+	MealPlans(ctx context.Context, ownerID int) ([]*MealPlan, error)
+
+	// GetMealPlan returns a meal plan with its meals
+	GetMealPlan(ctx context.Context, mealPlanID int) (*MealPlan, error)
+
+	// CreateMealPlan stores a meal plan for a trainee together with its meals
+	CreateMealPlan(ctx context.Context, ownerID, createdBy int, params *CreateMealPlanParams) (*MealPlan, error)
+
+	// CanLogMeal reports whether a meal is in a meal plan of the trainee
+	CanLogMeal(ctx context.Context, traineeID, mealID int) (bool, error)
+
+	// NutritionLogs returns what a trainee logged eating on a day, in order
+	NutritionLogs(ctx context.Context, traineeID int, date string) ([]*NutritionLog, error)
+
+	// LogNutrition stores a meal a trainee ate
+	LogNutrition(ctx context.Context, traineeID int, params *LogNutritionParams) (*NutritionLog, error)
+
+	// ProgressMetrics returns the measurements of a trainee and their heaviest
+	// logged weight per exercise and day, oldest first
+	ProgressMetrics(ctx context.Context, traineeID int) (*ProgressMetrics, error)
+
+	// ProgressPhotos returns the progress photos of a trainee, newest first
+	ProgressPhotos(ctx context.Context, traineeID int) ([]*ProgressPhoto, error)
+
+	// AddProgressPhoto stores an uploaded progress photo
+	AddProgressPhoto(ctx context.Context, photo *ProgressPhoto) (*ProgressPhoto, error)
+
+	// Trainers returns the trainers actively coaching a trainee
+	Trainers(ctx context.Context, traineeID int) ([]*Trainer, error)
+
+	// IsTrainerOf reports whether a trainer actively coaches a trainee
+	IsTrainerOf(ctx context.Context, trainerID, traineeID int) (bool, error)
+
+	// RequestTrainer records an inactive relationship for the trainer to accept.
+	// It reports false if the two already have a relationship.
+	RequestTrainer(ctx context.Context, trainerID, traineeID int) (bool, error)
+
+	// Messages returns the messages between two users, oldest first
+	Messages(ctx context.Context, userID, otherID int) ([]*Message, error)
+
+	// SendMessage stores a message
+	SendMessage(ctx context.Context, senderID, receiverID int, content string) (*Message, error)
+}
+
+// postgresRepository implements Repository on the trainee database
+type postgresRepository struct {
+	db *sqldb.Database
+}
+
+// NewPostgresRepository creates a repository backed by db
+func NewPostgresRepository(db *sqldb.Database) Repository {
+	return &postgresRepository{db: db}
+}
+
+// GetProfile returns the profile of a user. Users known from the admin service
+// without a saved profile get an empty one.
+func (r *postgresRepository) GetProfile(ctx context.Context, userID int) (*Trainee, error) {
+	var (
+		t                            Trainee
+		level                        *string
+		goals, injuries, preferences *string
+	)
+	u, err := scanUser(r.db.QueryRow(ctx, `
+		SELECT `+userColumns+`, p.age, p.height_cm::FLOAT8, p.weight_kg::FLOAT8, p.fitness_level,
+			p.medical_conditions, p.goals, p.injuries, p.preferences, p.created_at, p.updated_at
+		FROM user_projections u
+		LEFT JOIN trainee_profiles p ON p.user_id = u.user_id
+		WHERE u.user_id = $1 AND u.status <> 'DELETED'
+	`, userID),
+		&t.Age,
+		&t.HeightCm,
+		&t.WeightKg,
+		&level,
+		&t.MedicalConditions,
+		&goals,
+		&injuries,
+		&preferences,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errTraineeNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	t.UserID = u.ID
+	t.User = u
+	if level != nil {
+		l := FitnessLevel(*level)
+		t.FitnessLevel = &l
+	}
+	t.Goals = decodeList(goals)
+	t.Injuries = decodeList(injuries)
+	t.Preferences = decodeList(preferences)
+	return &t, nil
+}
+
+// UpdateProfile upserts the profile row. Empty medical conditions clear them.
+func (r *postgresRepository) UpdateProfile(ctx context.Context, req *UpdateProfileRequest) (*Trainee, error) {
+	var level *string
+	if req.FitnessLevel != nil {
+		s := string(*req.FitnessLevel)
+		level = &s
+	}
+	goals, err := encodeList(req.Goals)
+	if err != nil {
+		return nil, err
+	}
+	injuries, err := encodeList(req.Injuries)
+	if err != nil {
+		return nil, err
+	}
+	preferences, err := encodeList(req.Preferences)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.db.Exec(ctx, `
+		INSERT INTO trainee_profiles (
+			user_id, age, height_cm, weight_kg, fitness_level, medical_conditions,
+			goals, injuries, preferences, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, NOW(), NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET age = COALESCE($2, trainee_profiles.age),
+			height_cm = COALESCE($3, trainee_profiles.height_cm),
+			weight_kg = COALESCE($4, trainee_profiles.weight_kg),
+			fitness_level = COALESCE($5, trainee_profiles.fitness_level),
+			medical_conditions = CASE WHEN $6::TEXT IS NULL THEN trainee_profiles.medical_conditions ELSE NULLIF($6, '') END,
+			goals = COALESCE($7, trainee_profiles.goals),
+			injuries = COALESCE($8, trainee_profiles.injuries),
+			preferences = COALESCE($9, trainee_profiles.preferences),
+			updated_at = NOW()
+	`, req.UserID, req.Age, req.HeightCm, req.WeightKg, level, req.MedicalConditions, goals, injuries, preferences)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetProfile(ctx, req.UserID)
+}
+
+// GetWorkout returns a workout template with its exercises
+func (r *postgresRepository) GetWorkout(ctx context.Context, workoutID int) (*Workout, error) {
+	w, err := scanWorkout(r.db.QueryRow(ctx, `
+		SELECT `+workoutColumns+`
+		FROM workout_templates w
+		WHERE w.id = $1 AND w.deleted_at IS NULL
+	`, workoutID))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errWorkoutNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := r.addExercises(ctx, []*Workout{w}); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// CanSeeWorkout reports whether a user may see a workout template
+func (r *postgresRepository) CanSeeWorkout(ctx context.Context, userID, workoutID int) (bool, error) {
+	var ok bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM workout_templates w
+			WHERE w.id = $1 AND w.deleted_at IS NULL AND (
+				w.is_public OR w.trainer_id = $2
+				OR EXISTS (SELECT 1 FROM assigned_workouts a WHERE a.workout_id = w.id AND a.trainee_id = $2)
+			)
+		)
+	`, workoutID, userID).Scan(&ok)
+	return ok, err
+}
+
+// LogWorkout inserts a workout_logs row for a workout the trainee may see and
+// completes the assignment it was logged against, which must still be open
+func (r *postgresRepository) LogWorkout(ctx context.Context, req *LogWorkoutRequest) (*CompletedWorkout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workout, err := scanWorkout(tx.QueryRow(ctx, `
+		SELECT `+workoutColumns+`
+		FROM workout_templates w
+		WHERE w.id = $1 AND w.deleted_at IS NULL
+	`, req.WorkoutID))
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errWorkoutNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	// An assignment must be an open assignment of this workout to the
+	// trainee. Its row stays locked so it is only completed once.
+	if req.AssignedWorkoutID != nil {
+		var completed bool
+		err = tx.QueryRow(ctx, `
+			SELECT completed FROM assigned_workouts
+			WHERE id = $1 AND trainee_id = $2 AND workout_id = $3
+			FOR UPDATE
+		`, *req.AssignedWorkoutID, req.TraineeID, req.WorkoutID).Scan(&completed)
+		if errors.Is(err, sqldb.ErrNoRows) {
+			return nil, invalidArgument("the assignment is not an assignment of this workout to the trainee")
+		} else if err != nil {
+			return nil, err
+		}
+		if completed {
+			return nil, errAssignmentCompleted
+		}
+	}
+
+	duration := time.Duration(req.DurationMinutes) * time.Minute
+	end := time.Now()
+	start := end.Add(-duration)
+	switch {
+	case req.StartTime != nil && req.EndTime != nil:
+		start, end = *req.StartTime, *req.EndTime
+	case req.StartTime != nil:
+		start = *req.StartTime
+		end = start.Add(duration)
+	case req.EndTime != nil:
+		end = *req.EndTime
+		start = end.Add(-duration)
+	}
+
+	completed := &CompletedWorkout{
+		TraineeID:         req.TraineeID,
+		AssignedWorkoutID: req.AssignedWorkoutID,
+		Workout:           workout,
+		DurationMinutes:   &req.DurationMinutes,
+		Notes:             req.Notes,
+		Rating:            req.Rating,
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO workout_logs (
+			assigned_workout_id, trainee_id, workout_id, start_time, end_time,
+			duration_minutes, notes, rating, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
+		RETURNING id, start_time, end_time
+	`, req.AssignedWorkoutID, req.TraineeID, req.WorkoutID, start, end,
+		req.DurationMinutes, req.Notes, req.Rating,
+	).Scan(&completed.ID, &completed.StartTime, &completed.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Exercises) > 0 {
+		if err := insertExerciseLogs(ctx, tx, completed.ID, req.WorkoutID, req.Exercises); err != nil {
+			return nil, err
+		}
+	}
+
+	// The assignment is completed when the workout ended
+	if req.AssignedWorkoutID != nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE assigned_workouts
+			SET completed = TRUE, completed_at = $2, updated_at = NOW()
+			WHERE id = $1
+		`, *req.AssignedWorkoutID, end)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := r.addExercises(ctx, []*Workout{workout}); err != nil {
+		return nil, err
+	}
+	if err := r.addExerciseLogs(ctx, []*CompletedWorkout{completed}); err != nil {
+		return nil, err
+	}
+	return completed, nil
+}
+
+// WorkoutHistory returns the workouts a trainee logged with their templates
+func (r *postgresRepository) WorkoutHistory(ctx context.Context, traineeID int) ([]*CompletedWorkout, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT l.id, l.trainee_id, l.assigned_workout_id, l.start_time, l.end_time,
+			l.duration_minutes, l.notes, l.rating, `+workoutColumns+`
+		FROM workout_logs l
+		JOIN workout_templates w ON w.id = l.workout_id
+		WHERE l.trainee_id = $1
+		ORDER BY l.start_time DESC, l.id DESC
+	`, traineeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []*CompletedWorkout{}
+	var workouts []*Workout
+	for rows.Next() {
+		var c CompletedWorkout
+		w, err := scanWorkout(rows,
+			&c.ID,
+			&c.TraineeID,
+			&c.AssignedWorkoutID,
+			&c.StartTime,
+			&c.EndTime,
+			&c.DurationMinutes,
+			&c.Notes,
+			&c.Rating,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.Workout = w
+		history = append(history, &c)
+		workouts = append(workouts, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.addExercises(ctx, workouts); err != nil {
+		return nil, err
+	}
+	if err := r.addExerciseLogs(ctx, history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// addExercises loads the exercises of workouts with a single query, then their blocks
+func (r *postgresRepository) addExercises(ctx context.Context, workouts []*Workout) error {
+	byID := make(map[int][]*Workout, len(workouts))
+	ids := make([]int, 0, len(workouts))
+	for _, w := range workouts {
+		w.Exercises = []*WorkoutExercise{}
+		if _, ok := byID[w.ID]; !ok {
+			ids = append(ids, w.ID)
+		}
+		byID[w.ID] = append(byID[w.ID], w)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT we.workout_id, we.id, we.order_index, we.sets, we.reps, we.duration_seconds, we.notes,
+			we.set_targets, we.block_id, `+exerciseColumns+`
+		FROM workout_exercises we
+		JOIN exercises e ON e.id = we.exercise_id
+		WHERE we.workout_id = ANY($1)
+		ORDER BY we.workout_id, we.order_index
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var we WorkoutExercise
+		var targets []byte
+		e, err := scanExercise(rows,
+			&workoutID,
+			&we.ID,
+			&we.Position,
+			&we.Sets,
+			&we.Reps,
+			&we.DurationSeconds,
+			&we.Notes,
+			&targets,
+			&we.BlockID,
+		)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(targets, &we.SetTargets); err != nil {
+			return err
+		}
+		we.Exercise = e
+		for _, w := range byID[workoutID] {
+			w.Exercises = append(w.Exercises, &we)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return r.addBlocks(ctx, workouts, ids)
+}
+
+// workoutColumns are the columns scanWorkout reads, from workout_templates aliased w
+const workoutColumns = `w.id, w.trainer_id, w.name, COALESCE(w.description, ''), w.duration_minutes,
+			w.difficulty, COALESCE(w.is_public, FALSE), w.created_at, w.updated_at, w.deleted_at`
+
+// scanWorkout reads the workoutColumns following the given leading columns
+func scanWorkout(row interface{ Scan(...interface{}) error }, leading ...interface{}) (*Workout, error) {
+	var w Workout
+	var difficulty *string
+	err := row.Scan(append(leading,
+		&w.ID,
+		&w.TrainerID,
+		&w.Name,
+		&w.Description,
+		&w.DurationMinutes,
+		&difficulty,
+		&w.IsPublic,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+		&w.DeletedAt,
+	)...)
+	if err != nil {
+		return nil, err
+	}
+	if difficulty != nil {
+		d := FitnessLevel(*difficulty)
+		w.Difficulty = &d
+	}
+	return &w, nil
+}
+
+// encodeList stores a list as a JSON array. A missing list stays nil so the
+// column keeps its value.
+func encodeList(list *[]string) (*string, error) {
+	if list == nil {
+		return nil, nil
+	}
+	items := make([]string, len(*list))
+	for i, item := range *list {
+		items[i] = strings.TrimSpace(item)
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	s := string(data)
+	return &s, nil
+}
+
+// decodeList reads a list stored by encodeList. Text that isn't a JSON array,
+// such as injuries typed in by hand, is kept as a single entry.
+func decodeList(s *string) []string {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return []string{}
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(*s), &list); err != nil {
+		return []string{*s}
+	}
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
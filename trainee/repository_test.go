@@ -0,0 +1,396 @@
+//go:build encore_app
+
+package trainee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"encore.app/admin"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+)
+
+func TestGetTraineeByID(t *testing.T) {
+	ctx := context.Background()
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+
+	// A user without a saved profile gets an empty one
+	trainee, err := GetTraineeByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trainee.UserID != userID || trainee.User == nil || trainee.User.ID != userID {
+		t.Errorf("got trainee %+v, want user %d", trainee, userID)
+	}
+	if trainee.Age != nil || trainee.CreatedAt != nil {
+		t.Errorf("got %+v, want an empty profile", trainee)
+	}
+	if trainee.Goals == nil || trainee.Injuries == nil || trainee.Preferences == nil {
+		t.Errorf("got nil lists in %+v, want empty ones", trainee)
+	}
+
+	if _, err := GetTraineeByID(ctx, userID+1_000_000); !errors.Is(err, errTraineeNotFound) {
+		t.Errorf("got %v for an unknown user, want errTraineeNotFound", err)
+	}
+
+	deleted := createTestUserWithStatus(t, ctx, admin.UserStatusDeleted, authz.RoleTrainee)
+	if _, err := GetTraineeByID(ctx, deleted); !errors.Is(err, errTraineeNotFound) {
+		t.Errorf("got %v for a deleted user, want errTraineeNotFound", err)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	ctx := context.Background()
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+	if userID <= 1<<31 {
+		t.Fatalf("test user ID %d does not exceed 32 bits", userID)
+	}
+
+	age := 30
+	height := 180.5
+	level := FitnessIntermediate
+	conditions := "asthma"
+	trainee, err := UpdateProfile(ctx, &UpdateProfileRequest{
+		UserID:            userID,
+		Age:               &age,
+		HeightCm:          &height,
+		FitnessLevel:      &level,
+		MedicalConditions: &conditions,
+		Goals:             &[]string{" lose weight ", "run 5k"},
+		Injuries:          &[]string{"left knee"},
+		Preferences:       &[]string{"mornings"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trainee.UserID != userID || *trainee.Age != 30 || *trainee.HeightCm != 180.5 || *trainee.FitnessLevel != FitnessIntermediate {
+		t.Errorf("got %+v, want the saved fields", trainee)
+	}
+	if !slices.Equal(trainee.Goals, []string{"lose weight", "run 5k"}) {
+		t.Errorf("got goals %q, want them trimmed", trainee.Goals)
+	}
+
+	// Lists are stored as JSON arrays
+	var goals, injuries, preferences string
+	err = db.QueryRow(ctx, `
+		SELECT goals, injuries, preferences
+		FROM trainee_profiles
+		WHERE user_id = $1
+	`, userID).Scan(&goals, &injuries, &preferences)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goals != `["lose weight","run 5k"]` || injuries != `["left knee"]` || preferences != `["mornings"]` {
+		t.Errorf("stored %s, %s and %s, want JSON arrays", goals, injuries, preferences)
+	}
+
+	// Fields that are left out keep their value
+	weight := 75.0
+	trainee, err = UpdateProfile(ctx, &UpdateProfileRequest{UserID: userID, WeightKg: &weight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *trainee.Age != 30 || *trainee.WeightKg != 75 || *trainee.MedicalConditions != "asthma" {
+		t.Errorf("got %+v, want the earlier fields kept", trainee)
+	}
+	if !slices.Equal(trainee.Injuries, []string{"left knee"}) || !slices.Equal(trainee.Preferences, []string{"mornings"}) {
+		t.Errorf("got injuries %q and preferences %q, want them kept", trainee.Injuries, trainee.Preferences)
+	}
+
+	// Injuries typed in by hand before lists were JSON are read as one entry
+	_, err = db.Exec(ctx, `
+		UPDATE trainee_profiles SET injuries = 'sore back' WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trainee, err = GetTraineeByID(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(trainee.Injuries, []string{"sore back"}) {
+		t.Errorf("got injuries %q, want the legacy text as one entry", trainee.Injuries)
+	}
+}
+
+func TestUpdateProfileClearsLists(t *testing.T) {
+	ctx := context.Background()
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+
+	_, err := UpdateProfile(ctx, &UpdateProfileRequest{
+		UserID:      userID,
+		Goals:       &[]string{"run 5k"},
+		Injuries:    &[]string{"left knee"},
+		Preferences: &[]string{"mornings"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty list clears the stored one, a missing list keeps it
+	trainee, err := UpdateProfile(ctx, &UpdateProfileRequest{
+		UserID:   userID,
+		Goals:    &[]string{},
+		Injuries: &[]string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trainee.Goals) != 0 || len(trainee.Injuries) != 0 {
+		t.Errorf("got goals %q and injuries %q, want them cleared", trainee.Goals, trainee.Injuries)
+	}
+	if !slices.Equal(trainee.Preferences, []string{"mornings"}) {
+		t.Errorf("got preferences %q, want them kept", trainee.Preferences)
+	}
+}
+
+func TestUpdateProfileRequestJSON(t *testing.T) {
+	// Requests to the private endpoint are encoded, so an empty list must
+	// survive the round trip while a missing one stays missing
+	data, err := json.Marshal(&UpdateProfileRequest{UserID: 1, Goals: &[]string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req UpdateProfileRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Goals == nil || len(*req.Goals) != 0 {
+		t.Errorf("decoded goals %v from %s, want an empty list", req.Goals, data)
+	}
+	if req.Injuries != nil || req.Preferences != nil {
+		t.Errorf("decoded injuries %v and preferences %v from %s, want them missing", req.Injuries, req.Preferences, data)
+	}
+}
+
+func TestUpdateProfileValidation(t *testing.T) {
+	ctx := context.Background()
+	userID := createTestUser(t, ctx, authz.RoleTrainee)
+
+	age := 0
+	level := FitnessLevel("EXPERT")
+	for _, req := range []*UpdateProfileRequest{
+		{UserID: userID, Age: &age},
+		{UserID: userID, FitnessLevel: &level},
+		{UserID: userID, Goals: &[]string{"run", " "}},
+	} {
+		if _, err := UpdateProfile(ctx, req); errs.Code(err) != errs.InvalidArgument {
+			t.Errorf("got %v for %+v, want InvalidArgument", err, req)
+		}
+	}
+}
+
+func TestGetTraineeAssignments(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	workoutID := createTestWorkout(t, ctx, trainerID)
+
+	past := time.Now().Add(-24 * time.Hour)
+	future := time.Now().Add(24 * time.Hour)
+	overdue := assignTestWorkout(t, ctx, workoutID, trainerID, traineeID, &past)
+	upcoming := assignTestWorkout(t, ctx, workoutID, trainerID, traineeID, &future)
+	completed := assignTestWorkout(t, ctx, workoutID, trainerID, traineeID, &past)
+	_, err := LogWorkout(ctx, &LogWorkoutRequest{
+		TraineeID:         traineeID,
+		WorkoutID:         workoutID,
+		AssignedWorkoutID: &completed.ID,
+		DurationMinutes:   30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		status AssignmentStatus
+		want   []int
+	}{
+		{"", []int{overdue.ID, upcoming.ID, completed.ID}},
+		{AssignmentUpcoming, []int{upcoming.ID}},
+		{AssignmentOverdue, []int{overdue.ID}},
+		{AssignmentCompleted, []int{completed.ID}},
+	}
+	for _, tt := range tests {
+		assignments, err := GetTraineeAssignments(ctx, traineeID, tt.status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, a := range assignments {
+			if a.TraineeID != traineeID || a.Workout == nil || a.Workout.ID != workoutID {
+				t.Errorf("got assignment %+v, want one of workout %d to trainee %d", a, workoutID, traineeID)
+			}
+			if tt.status != "" && a.Status != tt.status {
+				t.Errorf("got status %s listing %q, want %s", a.Status, tt.status, tt.status)
+			}
+			got = append(got, a.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("got assignments %v with status %q, want %v", got, tt.status, tt.want)
+		}
+	}
+
+	if _, err := GetTraineeAssignments(ctx, traineeID, "LATE"); errs.Code(err) != errs.InvalidArgument {
+		t.Errorf("got %v for an unknown status, want InvalidArgument", err)
+	}
+
+	// Other trainees don't see the assignments
+	other := createTestUser(t, ctx, authz.RoleTrainee)
+	assignments, err := GetTraineeAssignments(ctx, other, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assignments) != 0 {
+		t.Errorf("got %d assignments of another trainee, want 0", len(assignments))
+	}
+}
+
+func TestLogWorkout(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	workoutID := createTestWorkout(t, ctx, trainerID)
+	assignment := assignTestWorkout(t, ctx, workoutID, trainerID, traineeID, nil)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	rating := 4
+	completed, err := LogWorkout(ctx, &LogWorkoutRequest{
+		TraineeID:         traineeID,
+		WorkoutID:         workoutID,
+		AssignedWorkoutID: &assignment.ID,
+		StartTime:         &start,
+		DurationMinutes:   45,
+		Rating:            &rating,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed.TraineeID != traineeID || completed.Workout.ID != workoutID || *completed.DurationMinutes != 45 {
+		t.Errorf("got %+v, want a 45 minute log of workout %d", completed, workoutID)
+	}
+	if !completed.StartTime.Equal(start) || completed.EndTime == nil || !completed.EndTime.Equal(start.Add(45*time.Minute)) {
+		t.Errorf("got %s to %v, want 45 minutes from %s", completed.StartTime, completed.EndTime, start)
+	}
+
+	// The log is stored and completes the assignment when the workout ended
+	var (
+		storedTrainee, storedWorkout int
+		storedRating                 *int
+		done                         bool
+		completedAt                  *time.Time
+	)
+	err = db.QueryRow(ctx, `
+		SELECT l.trainee_id, l.workout_id, l.rating, a.completed, a.completed_at
+		FROM workout_logs l
+		JOIN assigned_workouts a ON a.id = l.assigned_workout_id
+		WHERE l.id = $1
+	`, completed.ID).Scan(&storedTrainee, &storedWorkout, &storedRating, &done, &completedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storedTrainee != traineeID || storedWorkout != workoutID || storedRating == nil || *storedRating != 4 {
+		t.Errorf("stored trainee %d, workout %d and rating %v, want %d, %d and 4",
+			storedTrainee, storedWorkout, storedRating, traineeID, workoutID)
+	}
+	if end := start.Add(45 * time.Minute); !done || completedAt == nil || !completedAt.Equal(end) {
+		t.Errorf("assignment completed %v at %v, want completed at %s", done, completedAt, end)
+	}
+
+	// A completed assignment can't be logged against again
+	_, err = LogWorkout(ctx, &LogWorkoutRequest{
+		TraineeID:         traineeID,
+		WorkoutID:         workoutID,
+		AssignedWorkoutID: &assignment.ID,
+		DurationMinutes:   20,
+	})
+	if !errors.Is(err, errAssignmentCompleted) {
+		t.Errorf("got %v logging against a completed assignment, want errAssignmentCompleted", err)
+	}
+	var logs int
+	err = db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM workout_logs WHERE assigned_workout_id = $1
+	`, assignment.ID).Scan(&logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs != 1 {
+		t.Errorf("stored %d logs of the assignment, want 1", logs)
+	}
+
+	// Without a start time the workout ends now
+	completed, err = LogWorkout(ctx, &LogWorkoutRequest{TraineeID: traineeID, WorkoutID: workoutID, DurationMinutes: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed.EndTime == nil || time.Since(*completed.EndTime) > time.Minute || completed.EndTime.Sub(completed.StartTime) != 30*time.Minute {
+		t.Errorf("got %s to %v, want 30 minutes ending now", completed.StartTime, completed.EndTime)
+	}
+
+	rating = 6
+	for _, req := range []*LogWorkoutRequest{
+		{TraineeID: traineeID, WorkoutID: workoutID, DurationMinutes: -1},
+		{TraineeID: traineeID, WorkoutID: workoutID, Rating: &rating},
+	} {
+		if _, err := LogWorkout(ctx, req); errs.Code(err) != errs.InvalidArgument {
+			t.Errorf("got %v for %+v, want InvalidArgument", err, req)
+		}
+	}
+}
+
+func TestLogWorkoutChecksAssignment(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	otherTrainee := createTestUser(t, ctx, authz.RoleTrainee)
+	workoutID := createTestWorkout(t, ctx, trainerID)
+	otherWorkoutID := createTestWorkout(t, ctx, trainerID)
+
+	othersAssignment := assignTestWorkout(t, ctx, workoutID, trainerID, otherTrainee, nil)
+	otherWorkoutAssignment := assignTestWorkout(t, ctx, otherWorkoutID, trainerID, traineeID, nil)
+
+	for name, assignmentID := range map[string]int{
+		"another trainee's assignment":     othersAssignment.ID,
+		"an assignment of another workout": otherWorkoutAssignment.ID,
+	} {
+		_, err := LogWorkout(ctx, &LogWorkoutRequest{
+			TraineeID:         traineeID,
+			WorkoutID:         workoutID,
+			AssignedWorkoutID: &assignmentID,
+			DurationMinutes:   30,
+		})
+		if errs.Code(err) != errs.InvalidArgument {
+			t.Errorf("got %v logging against %s, want InvalidArgument", err, name)
+		}
+	}
+
+	// Nothing was logged and neither assignment was completed
+	var logs int
+	err := db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM workout_logs WHERE trainee_id = $1
+	`, traineeID).Scan(&logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logs != 0 {
+		t.Errorf("stored %d logs, want 0", logs)
+	}
+	for _, id := range []int{othersAssignment.ID, otherWorkoutAssignment.ID} {
+		a, err := repo.GetAssignment(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Completed {
+			t.Errorf("assignment %d was completed", id)
+		}
+	}
+
+	if _, err := LogWorkout(ctx, &LogWorkoutRequest{TraineeID: traineeID, WorkoutID: -1}); !errors.Is(err, errWorkoutNotFound) {
+		t.Errorf("got %v for an unknown workout, want errWorkoutNotFound", err)
+	}
+}
@@ -0,0 +1,859 @@
+package trainee
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+const (
+	maxExercisesPerWorkout = 100
+	maxWorkoutMinutes      = 24 * 60
+	maxSets                = 100
+	maxReps                = 1000
+	maxExerciseSeconds     = 24 * 60 * 60
+)
+
+var (
+	errWorkoutExerciseNotFound = &errs.Error{
+		Code:    errs.NotFound,
+		Message: "exercise not found in the workout",
+	}
+	errHiddenExercises = &errs.Error{
+		Code:    errs.FailedPrecondition,
+		Message: "the workout uses custom exercises of another trainer",
+	}
+)
+
+// WorkoutExerciseParams describes an exercise of a workout template
+type WorkoutExerciseParams struct {
+	ExerciseID      int     `json:"exercise_id"`
+	Sets            *int    `json:"sets,omitempty"`
+	Reps            *int    `json:"reps,omitempty"`
+	DurationSeconds *int    `json:"duration_seconds,omitempty"`
+	Notes           *string `json:"notes,omitempty"`
+
+	// SetTargets give each set its own target; with sets, there is one per set
+	SetTargets []*SetTarget `json:"set_targets,omitempty"`
+}
+
+// CreateWorkoutTemplateParams contains a new workout template. Its exercises
+// are done in the order they are listed, and its blocks refer to them by
+// their position in the list.
+type CreateWorkoutTemplateParams struct {
+	Name            string                   `json:"name"`
+	Description     string                   `json:"description"`
+	DurationMinutes *int                     `json:"duration_minutes,omitempty"`
+	Difficulty      *FitnessLevel            `json:"difficulty,omitempty"`
+	IsPublic        bool                     `json:"is_public"`
+	Exercises       []*WorkoutExerciseParams `json:"exercises"`
+	Blocks          []*WorkoutBlockParams    `json:"blocks,omitempty"`
+}
+
+// UpdateWorkoutTemplateParams contains the template fields to change.
+// Fields that are left out keep their current value.
+type UpdateWorkoutTemplateParams struct {
+	Name            *string       `json:"name,omitempty"`
+	Description     *string       `json:"description,omitempty"`
+	DurationMinutes *int          `json:"duration_minutes,omitempty"`
+	Difficulty      *FitnessLevel `json:"difficulty,omitempty"`
+	IsPublic        *bool         `json:"is_public,omitempty"`
+
+	// ClearDurationMinutes and ClearDifficulty remove the duration and the
+	// difficulty; they can't be combined with a new value
+	ClearDurationMinutes bool `json:"clear_duration_minutes,omitempty"`
+	ClearDifficulty      bool `json:"clear_difficulty,omitempty"`
+}
+
+// AddWorkoutExerciseParams contains an exercise to add to a template. Without
+// a position it is added last.
+type AddWorkoutExerciseParams struct {
+	Exercise *WorkoutExerciseParams `json:"exercise"`
+	Position *int                   `json:"position,omitempty"`
+}
+
+// ReorderWorkoutExercisesParams lists every exercise of a template by its
+// workout exercise ID, in the new order
+type ReorderWorkoutExercisesParams struct {
+	IDs []int `json:"ids"`
+}
+
+// MyWorkoutTemplates returns the templates the current user wrote, newest first
+//
+//encore:api auth method=GET path=/trainee/me/workout-templates tag:trainer tag:scope_workouts_read
+func MyWorkoutTemplates(ctx context.Context) (*WorkoutsResponse, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	workouts, err := repo.TrainerWorkouts(ctx, caller.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &WorkoutsResponse{Workouts: workouts}, nil
+}
+
+// CreateWorkoutTemplate creates a workout template written by the current user
+//
+//encore:api auth method=POST path=/trainee/workouts tag:trainer tag:scope_workouts_write
+func CreateWorkoutTemplate(ctx context.Context, params *CreateWorkoutTemplateParams) (*Workout, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	if err := caller.Require(authz.PermAuthorWorkouts); err != nil {
+		return nil, err
+	}
+
+	// Validate the input
+	if err := validateWorkoutFields(&params.Name, params.DurationMinutes, params.Difficulty); err != nil {
+		return nil, err
+	}
+	if len(params.Exercises) > maxExercisesPerWorkout {
+		return nil, invalidArgument(fmt.Sprintf("a workout may have at most %d exercises", maxExercisesPerWorkout))
+	}
+	for _, e := range params.Exercises {
+		if err := validateWorkoutExercise(e); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range params.Blocks {
+		if err := validateWorkoutBlock(b); err != nil {
+			return nil, err
+		}
+		for _, position := range b.Exercises {
+			if position < 0 || position >= len(params.Exercises) {
+				return nil, invalidArgument(fmt.Sprintf("blocks refer to exercises by their position, from 0 to %d", len(params.Exercises)-1))
+			}
+		}
+	}
+
+	workout, err := repo.CreateWorkout(ctx, caller.UserID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "workout_template.create",
+		EntityType: "workout_template",
+		EntityID:   strconv.Itoa(workout.ID),
+		After:      workout,
+	})
+	return workout, nil
+}
+
+// UpdateWorkoutTemplate changes a template the current user wrote
+//
+//encore:api auth method=PATCH path=/trainee/workouts/:id tag:trainer tag:scope_workouts_write
+func UpdateWorkoutTemplate(ctx context.Context, id int, params *UpdateWorkoutTemplateParams) (*Workout, error) {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWorkoutFields(params.Name, params.DurationMinutes, params.Difficulty); err != nil {
+		return nil, err
+	}
+	switch {
+	case params.ClearDurationMinutes && params.DurationMinutes != nil:
+		return nil, invalidArgument("a duration can't be set and cleared at once")
+	case params.ClearDifficulty && params.Difficulty != nil:
+		return nil, invalidArgument("a difficulty can't be set and cleared at once")
+	}
+
+	after, err := repo.UpdateWorkout(ctx, id, params)
+	if err != nil {
+		return nil, err
+	}
+	recordWorkoutUpdate(ctx, before, after)
+	return after, nil
+}
+
+// DuplicateWorkoutTemplate copies a template the current user can see into a
+// private template of their own. Templates using custom exercises of another
+// trainer can't be copied, since those exercises are private to their owner.
+//
+//encore:api auth method=POST path=/trainee/workouts/:id/duplicate tag:trainer tag:scope_workouts_write
+func DuplicateWorkoutTemplate(ctx context.Context, id int) (*Workout, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	if err := caller.Require(authz.PermAuthorWorkouts); err != nil {
+		return nil, err
+	}
+	if err := checkWorkoutVisible(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	source, err := repo.GetWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the name of the copy within the column
+	name := []rune(source.Name + " (copy)")
+	if len(name) > nameMaxLength {
+		name = name[:nameMaxLength]
+	}
+	workout, err := repo.DuplicateWorkout(ctx, id, caller.UserID, string(name))
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "workout_template.duplicate",
+		EntityType: "workout_template",
+		EntityID:   strconv.Itoa(workout.ID),
+		Before:     source,
+		After:      workout,
+	})
+	return workout, nil
+}
+
+// DeleteWorkoutTemplate deletes a template the current user wrote. Workouts
+// trainees logged against it keep showing it in their history.
+//
+//encore:api auth method=DELETE path=/trainee/workouts/:id tag:trainer tag:scope_workouts_write
+func DeleteWorkoutTemplate(ctx context.Context, id int) error {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := repo.DeleteWorkout(ctx, id); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "workout_template.delete",
+		EntityType: "workout_template",
+		EntityID:   strconv.Itoa(id),
+		Before:     before,
+	})
+	return nil
+}
+
+// AddWorkoutExercise adds an exercise to a template the current user wrote
+//
+//encore:api auth method=POST path=/trainee/workouts/:id/exercises tag:trainer tag:scope_workouts_write
+func AddWorkoutExercise(ctx context.Context, id int, params *AddWorkoutExerciseParams) (*Workout, error) {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the input
+	if params.Exercise == nil {
+		return nil, invalidArgument("exercise is required")
+	}
+	if err := validateWorkoutExercise(params.Exercise); err != nil {
+		return nil, err
+	}
+	if params.Position != nil && (*params.Position < 0 || *params.Position > len(before.Exercises)) {
+		return nil, invalidArgument(fmt.Sprintf("position must be between 0 and %d", len(before.Exercises)))
+	}
+	if len(before.Exercises) >= maxExercisesPerWorkout {
+		return nil, invalidArgument(fmt.Sprintf("a workout may have at most %d exercises", maxExercisesPerWorkout))
+	}
+
+	after, err := repo.AddWorkoutExercise(ctx, id, params.Position, params.Exercise)
+	if err != nil {
+		return nil, err
+	}
+	recordWorkoutUpdate(ctx, before, after)
+	return after, nil
+}
+
+// UpdateWorkoutExercise replaces what an exercise of a template the current user wrote prescribes
+//
+//encore:api auth method=PUT path=/trainee/workouts/:id/exercises/:item tag:trainer tag:scope_workouts_write
+func UpdateWorkoutExercise(ctx context.Context, id int, item int, params *WorkoutExerciseParams) (*Workout, error) {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWorkoutExercise(params); err != nil {
+		return nil, err
+	}
+
+	after, err := repo.UpdateWorkoutExercise(ctx, id, item, params)
+	if err != nil {
+		return nil, err
+	}
+	recordWorkoutUpdate(ctx, before, after)
+	return after, nil
+}
+
+// RemoveWorkoutExercise removes an exercise from a template the current user wrote
+//
+//encore:api auth method=DELETE path=/trainee/workouts/:id/exercises/:item tag:trainer tag:scope_workouts_write
+func RemoveWorkoutExercise(ctx context.Context, id int, item int) (*Workout, error) {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := repo.RemoveWorkoutExercise(ctx, id, item)
+	if err != nil {
+		return nil, err
+	}
+	recordWorkoutUpdate(ctx, before, after)
+	return after, nil
+}
+
+// ReorderWorkoutExercises changes the order of the exercises of a template the current user wrote
+//
+//encore:api auth method=POST path=/trainee/workouts/:id/exercise-order tag:trainer tag:scope_workouts_write
+func ReorderWorkoutExercises(ctx context.Context, id int, params *ReorderWorkoutExercisesParams) (*Workout, error) {
+	before, err := editableWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := repo.ReorderWorkoutExercises(ctx, id, params.IDs)
+	if err != nil {
+		return nil, err
+	}
+	recordWorkoutUpdate(ctx, before, after)
+	return after, nil
+}
+
+// editableWorkout returns a template the current user may change: one they
+// wrote, or any template for administrators. Templates they can't see are
+// reported missing.
+func editableWorkout(ctx context.Context, id int) (*Workout, error) {
+	caller, err := authz.CurrentCaller()
+	if err != nil {
+		return nil, err
+	}
+	if err := caller.Require(authz.PermAuthorWorkouts); err != nil {
+		return nil, err
+	}
+	if err := checkWorkoutVisible(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	workout, err := repo.GetWorkout(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.IsAdmin() && (workout.TrainerID == nil || *workout.TrainerID != caller.UserID) {
+		return nil, &errs.Error{
+			Code:    errs.PermissionDenied,
+			Message: "only the author of a workout can change it",
+		}
+	}
+	return workout, nil
+}
+
+func recordWorkoutUpdate(ctx context.Context, before, after *Workout) {
+	audit.Record(ctx, audit.Change{
+		Action:     "workout_template.update",
+		EntityType: "workout_template",
+		EntityID:   strconv.Itoa(after.ID),
+		Before:     before,
+		After:      after,
+	})
+}
+
+// validateWorkoutFields checks the template fields that are set
+func validateWorkoutFields(name *string, durationMinutes *int, difficulty *FitnessLevel) error {
+	if name != nil {
+		switch n := utf8.RuneCountInString(strings.TrimSpace(*name)); {
+		case n == 0:
+			return invalidArgument("workout name is required")
+		case n > nameMaxLength:
+			return invalidArgument(fmt.Sprintf("workout name must be at most %d characters", nameMaxLength))
+		}
+	}
+	switch {
+	case durationMinutes != nil && (*durationMinutes < 1 || *durationMinutes > maxWorkoutMinutes):
+		return invalidArgument(fmt.Sprintf("duration must be between 1 and %d minutes", maxWorkoutMinutes))
+	case difficulty != nil && !difficulty.Valid():
+		return invalidArgument("unknown difficulty")
+	}
+	return nil
+}
+
+// validateWorkoutExercise checks what an exercise of a template prescribes.
+// Whether it fits its block is checked when it is saved.
+func validateWorkoutExercise(p *WorkoutExerciseParams) error {
+	if err := validateSetTargets(p); err != nil {
+		return err
+	}
+	switch {
+	case p.Sets != nil && (*p.Sets < 1 || *p.Sets > maxSets):
+		return invalidArgument(fmt.Sprintf("sets must be between 1 and %d", maxSets))
+	case p.Reps != nil && (*p.Reps < 1 || *p.Reps > maxReps):
+		return invalidArgument(fmt.Sprintf("reps must be between 1 and %d", maxReps))
+	case p.DurationSeconds != nil && (*p.DurationSeconds < 1 || *p.DurationSeconds > maxExerciseSeconds):
+		return invalidArgument(fmt.Sprintf("duration must be between 1 and %d seconds", maxExerciseSeconds))
+	case p.Notes != nil && utf8.RuneCountInString(*p.Notes) > notesMaxLength:
+		return invalidArgument(fmt.Sprintf("notes must be at most %d characters", notesMaxLength))
+	}
+	return nil
+}
+
+// TrainerWorkouts returns the templates a trainer wrote
+func (r *postgresRepository) TrainerWorkouts(ctx context.Context, trainerID int) ([]*Workout, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+workoutColumns+`
+		FROM workout_templates w
+		WHERE w.trainer_id = $1 AND w.deleted_at IS NULL
+		ORDER BY w.created_at DESC, w.id DESC
+	`, trainerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []*Workout{}
+	for rows.Next() {
+		w, err := scanWorkout(rows)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := r.addExercises(ctx, workouts); err != nil {
+		return nil, err
+	}
+	return workouts, nil
+}
+
+// CreateWorkout inserts a template and its exercises
+func (r *postgresRepository) CreateWorkout(ctx context.Context, trainerID int, params *CreateWorkoutTemplateParams) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var workoutID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO workout_templates (trainer_id, name, description, duration_minutes, difficulty, is_public, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		RETURNING id
+	`, trainerID, strings.TrimSpace(params.Name), strings.TrimSpace(params.Description),
+		params.DurationMinutes, difficultyValue(params.Difficulty), params.IsPublic,
+	).Scan(&workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	itemIDs := make([]int, len(params.Exercises))
+	for i, e := range params.Exercises {
+		if itemIDs[i], err = insertWorkoutExercise(ctx, tx, workoutID, i, e); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range params.Blocks {
+		ids := make([]int, len(b.Exercises))
+		for i, position := range b.Exercises {
+			ids[i] = itemIDs[position]
+		}
+		if _, err := insertWorkoutBlock(ctx, tx, workoutID, b, ids); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkBlocks(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// UpdateWorkout updates the set fields of a template
+func (r *postgresRepository) UpdateWorkout(ctx context.Context, workoutID int, params *UpdateWorkoutTemplateParams) (*Workout, error) {
+	var name, description *string
+	if params.Name != nil {
+		s := strings.TrimSpace(*params.Name)
+		name = &s
+	}
+	if params.Description != nil {
+		s := strings.TrimSpace(*params.Description)
+		description = &s
+	}
+
+	res, err := r.db.Exec(ctx, `
+		UPDATE workout_templates
+		SET name = COALESCE($2, name),
+			description = COALESCE($3, description),
+			duration_minutes = CASE WHEN $7 THEN NULL ELSE COALESCE($4, duration_minutes) END,
+			difficulty = CASE WHEN $8 THEN NULL ELSE COALESCE($5, difficulty) END,
+			is_public = COALESCE($6, is_public),
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, workoutID, name, description, params.DurationMinutes, difficultyValue(params.Difficulty), params.IsPublic,
+		params.ClearDurationMinutes, params.ClearDifficulty)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() == 0 {
+		return nil, errWorkoutNotFound
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// DuplicateWorkout copies a template with its exercises and blocks. It returns
+// errHiddenExercises if the template uses custom exercises of someone other
+// than trainerID.
+func (r *postgresRepository) DuplicateWorkout(ctx context.Context, workoutID, trainerID int, name string) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var copyID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO workout_templates (trainer_id, name, description, duration_minutes, difficulty, is_public, created_at, updated_at)
+		SELECT $2, $3, description, duration_minutes, difficulty, FALSE, NOW(), NOW()
+		FROM workout_templates
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id
+	`, workoutID, trainerID, name).Scan(&copyID)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errWorkoutNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	// The copy may only use exercises checkExercise would let its author add
+	var hidden bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM workout_exercises we
+			JOIN exercises e ON e.id = we.exercise_id
+			WHERE we.workout_id = $1 AND e.owner_id IS NOT NULL AND e.owner_id <> $2
+		)
+	`, workoutID, trainerID).Scan(&hidden)
+	if err != nil {
+		return nil, err
+	}
+	if hidden {
+		return nil, errHiddenExercises
+	}
+
+	blockIDs, copyIDs, err := copyWorkoutBlocks(ctx, tx, workoutID, copyID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO workout_exercises (workout_id, exercise_id, sets, reps, duration_seconds, notes, set_targets,
+			block_id, order_index, created_at, updated_at)
+		SELECT $2, we.exercise_id, we.sets, we.reps, we.duration_seconds, we.notes, we.set_targets,
+			b.copy_id, we.order_index, NOW(), NOW()
+		FROM workout_exercises we
+		LEFT JOIN unnest($3::BIGINT[], $4::BIGINT[]) AS b(id, copy_id) ON b.id = we.block_id
+		WHERE we.workout_id = $1
+	`, workoutID, copyID, blockIDs, copyIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, copyID)
+}
+
+// DeleteWorkout sets deleted_at on a template
+func (r *postgresRepository) DeleteWorkout(ctx context.Context, workoutID int) error {
+	res, err := r.db.Exec(ctx, `
+		UPDATE workout_templates
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, workoutID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return errWorkoutNotFound
+	}
+	return nil
+}
+
+// AddWorkoutExercise inserts an exercise, moving the ones after it down
+func (r *postgresRepository) AddWorkoutExercise(ctx context.Context, workoutID int, position *int, params *WorkoutExerciseParams) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := touchWorkout(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	var count int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM workout_exercises WHERE workout_id = $1
+	`, workoutID).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	at := count
+	if position != nil && *position < count {
+		at = max(*position, 0)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE workout_exercises
+		SET order_index = order_index + 1, updated_at = NOW()
+		WHERE workout_id = $1 AND order_index >= $2
+	`, workoutID, at)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := insertWorkoutExercise(ctx, tx, workoutID, at, params); err != nil {
+		return nil, err
+	}
+	if err := checkBlocks(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// UpdateWorkoutExercise replaces the exercise and prescription of a workout_exercises row
+func (r *postgresRepository) UpdateWorkoutExercise(ctx context.Context, workoutID, itemID int, params *WorkoutExerciseParams) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := touchWorkout(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+	if err := checkExercise(ctx, tx, workoutID, params.ExerciseID); err != nil {
+		return nil, err
+	}
+
+	targets, err := encodeSetTargets(params.SetTargets)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(ctx, `
+		UPDATE workout_exercises
+		SET exercise_id = $3, sets = $4, reps = $5, duration_seconds = $6, notes = NULLIF($7, ''),
+			set_targets = $8::JSONB, updated_at = NOW()
+		WHERE id = $2 AND workout_id = $1
+	`, workoutID, itemID, params.ExerciseID, params.Sets, params.Reps, params.DurationSeconds, params.Notes, targets)
+	if err != nil {
+		return nil, err
+	}
+	if res.RowsAffected() == 0 {
+		return nil, errWorkoutExerciseNotFound
+	}
+	if err := checkBlocks(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// RemoveWorkoutExercise deletes a workout_exercises row, moving the ones after it up
+func (r *postgresRepository) RemoveWorkoutExercise(ctx context.Context, workoutID, itemID int) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := touchWorkout(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	var position int
+	err = tx.QueryRow(ctx, `
+		DELETE FROM workout_exercises
+		WHERE id = $2 AND workout_id = $1
+		RETURNING order_index
+	`, workoutID, itemID).Scan(&position)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errWorkoutExerciseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE workout_exercises
+		SET order_index = order_index - 1, updated_at = NOW()
+		WHERE workout_id = $1 AND order_index > $2
+	`, workoutID, position)
+	if err != nil {
+		return nil, err
+	}
+
+	// A block left without exercises goes with its last one
+	_, err = tx.Exec(ctx, `
+		DELETE FROM workout_blocks b
+		WHERE b.workout_id = $1 AND NOT EXISTS (SELECT 1 FROM workout_exercises we WHERE we.block_id = b.id)
+	`, workoutID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBlocks(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// ReorderWorkoutExercises sets the positions of the workout_exercises rows of a template
+func (r *postgresRepository) ReorderWorkoutExercises(ctx context.Context, workoutID int, itemIDs []int) (*Workout, error) {
+	// Start a transaction
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := touchWorkout(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	var current []int
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(array_agg(id ORDER BY id), '{}') FROM workout_exercises WHERE workout_id = $1
+	`, workoutID).Scan(&current)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Equal(current, slices.Sorted(slices.Values(itemIDs))) {
+		return nil, invalidArgument("list every exercise of the workout exactly once")
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE workout_exercises we
+		SET order_index = o.position - 1, updated_at = NOW()
+		FROM unnest($2::BIGINT[]) WITH ORDINALITY AS o(id, position)
+		WHERE we.id = o.id AND we.workout_id = $1
+	`, workoutID, itemIDs)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBlocks(ctx, tx, workoutID); err != nil {
+		return nil, err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return r.GetWorkout(ctx, workoutID)
+}
+
+// touchWorkout bumps updated_at of a template that is not deleted. It also
+// locks the template, so concurrent changes to its exercises wait their turn.
+func touchWorkout(ctx context.Context, tx *sqldb.Tx, workoutID int) error {
+	res, err := tx.Exec(ctx, `
+		UPDATE workout_templates SET updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, workoutID)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return errWorkoutNotFound
+	}
+	return nil
+}
+
+// insertWorkoutExercise inserts a workout_exercises row at a position and returns its ID
+func insertWorkoutExercise(ctx context.Context, tx *sqldb.Tx, workoutID, position int, params *WorkoutExerciseParams) (int, error) {
+	if err := checkExercise(ctx, tx, workoutID, params.ExerciseID); err != nil {
+		return 0, err
+	}
+	targets, err := encodeSetTargets(params.SetTargets)
+	if err != nil {
+		return 0, err
+	}
+	var itemID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO workout_exercises (workout_id, exercise_id, sets, reps, duration_seconds, notes, set_targets,
+			order_index, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7::JSONB, $8, NOW(), NOW())
+		RETURNING id
+	`, workoutID, params.ExerciseID, params.Sets, params.Reps, params.DurationSeconds, params.Notes, targets, position).Scan(&itemID)
+	return itemID, err
+}
+
+// encodeSetTargets stores set targets as a JSON array
+func encodeSetTargets(targets []*SetTarget) (string, error) {
+	if targets == nil {
+		targets = []*SetTarget{}
+	}
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// checkExercise reports an exercise as invalid input unless it can be added
+// to a template: it must not be deleted, and be in the library or a custom
+// exercise of the template's author
+func checkExercise(ctx context.Context, tx *sqldb.Tx, workoutID, exerciseID int) error {
+	var ok bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM exercises e
+			JOIN workout_templates w ON w.id = $1
+			WHERE e.id = $2 AND e.deleted_at IS NULL
+				AND (e.owner_id IS NULL OR e.owner_id = w.trainer_id)
+		)
+	`, workoutID, exerciseID).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return invalidArgument(fmt.Sprintf("unknown exercise %d", exerciseID))
+	}
+	return nil
+}
+
+// difficultyValue converts an optional difficulty for a query parameter
+func difficultyValue(d *FitnessLevel) *string {
+	if d == nil {
+		return nil
+	}
+	s := string(*d)
+	return &s
+}
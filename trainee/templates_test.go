@@ -0,0 +1,120 @@
+//go:build encore_app
+
+package trainee
+
+import (
+	"context"
+	"testing"
+
+	"encore.app/authz"
+	"encore.app/authz/authztest"
+	"encore.dev/beta/errs"
+)
+
+func TestDuplicateWorkoutTemplate(t *testing.T) {
+	ctx := context.Background()
+	authorID := createTestUser(t, ctx, authz.RoleTrainer)
+	sets := 3
+	source, err := repo.CreateWorkout(ctx, authorID, &CreateWorkoutTemplateParams{
+		Name:     "Test Workout",
+		IsPublic: true,
+		Exercises: []*WorkoutExerciseParams{
+			{ExerciseID: createTestExercise(t, ctx), Sets: &sets},
+			{ExerciseID: createTestExercise(t, ctx)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	authztest.AuthenticateAs(trainerID, authz.RoleTrainer)
+	copied, err := DuplicateWorkoutTemplate(ctx, source.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.ID == source.ID || copied.TrainerID == nil || *copied.TrainerID != trainerID || copied.IsPublic || copied.Name != "Test Workout (copy)" {
+		t.Errorf("got copy %+v, want a private template of %d", copied, trainerID)
+	}
+	if len(copied.Exercises) != 2 || copied.Exercises[1].Exercise.ID != source.Exercises[1].Exercise.ID {
+		t.Errorf("got exercises %+v, want those of the source", copied.Exercises)
+	}
+}
+
+func TestUpdateWorkoutTemplateClearsFields(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	id := createTestWorkout(t, ctx, trainerID)
+	authztest.AuthenticateAs(trainerID, authz.RoleTrainer)
+
+	// Fields that are left out keep their value
+	name := "Renamed"
+	w, err := UpdateWorkoutTemplate(ctx, id, &UpdateWorkoutTemplateParams{Name: &name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Name != name || w.DurationMinutes == nil || *w.DurationMinutes != 45 || w.Difficulty == nil || *w.Difficulty != FitnessBeginner {
+		t.Fatalf("got %+v after a rename, want the duration and difficulty kept", w)
+	}
+
+	w, err = UpdateWorkoutTemplate(ctx, id, &UpdateWorkoutTemplateParams{
+		ClearDurationMinutes: true,
+		ClearDifficulty:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.DurationMinutes != nil || w.Difficulty != nil || w.Name != name {
+		t.Errorf("got %+v, want the duration and difficulty cleared", w)
+	}
+
+	duration := 30
+	_, err = UpdateWorkoutTemplate(ctx, id, &UpdateWorkoutTemplateParams{
+		DurationMinutes:      &duration,
+		ClearDurationMinutes: true,
+	})
+	if errs.Code(err) != errs.InvalidArgument {
+		t.Errorf("got %v setting and clearing the duration, want InvalidArgument", err)
+	}
+}
+
+func TestDuplicateWorkoutTemplateHiddenExercises(t *testing.T) {
+	ctx := context.Background()
+	authorID := createTestUser(t, ctx, authz.RoleTrainer)
+	custom, err := repo.CreateExercise(ctx, &authorID, &ExerciseParams{Name: "Secret Move"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := repo.CreateWorkout(ctx, authorID, &CreateWorkoutTemplateParams{
+		Name:      "Signature Workout",
+		IsPublic:  true,
+		Exercises: []*WorkoutExerciseParams{{ExerciseID: custom.ID}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Others can see the template but not its custom exercise
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	authztest.AuthenticateAs(trainerID, authz.RoleTrainer)
+	if _, err := DuplicateWorkoutTemplate(ctx, source.ID); errs.Code(err) != errs.FailedPrecondition {
+		t.Fatalf("got %v duplicating another trainer's custom exercises, want FailedPrecondition", err)
+	}
+	workouts, err := repo.TrainerWorkouts(ctx, trainerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workouts) != 0 {
+		t.Errorf("got %d templates after the rejected duplicate, want 0", len(workouts))
+	}
+
+	// The author can copy their own
+	authztest.AuthenticateAs(authorID, authz.RoleTrainer)
+	copied, err := DuplicateWorkoutTemplate(ctx, source.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copied.Exercises) != 1 || copied.Exercises[0].Exercise.ID != custom.ID {
+		t.Errorf("got exercises %+v, want the custom exercise", copied.Exercises)
+	}
+}
@@ -3,246 +3,407 @@ package trainee
 
 import (
 	"context"
+	"strconv"
+	"strings"
 	"time"
 
+	"encore.app/admin"
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
 	"encore.dev/storage/sqldb"
 )
 
-// Trainee represents a trainee user in the system
+// FitnessLevel is how experienced a trainee is. Workout difficulties use the same values.
+type FitnessLevel string
+
+const (
+	FitnessBeginner     FitnessLevel = "BEGINNER"
+	FitnessIntermediate FitnessLevel = "INTERMEDIATE"
+	FitnessAdvanced     FitnessLevel = "ADVANCED"
+)
+
+// Valid reports whether l is a known level
+func (l FitnessLevel) Valid() bool {
+	switch l {
+	case FitnessBeginner, FitnessIntermediate, FitnessAdvanced:
+		return true
+	}
+	return false
+}
+
+// Trainee is the fitness profile of a user. Users who never saved a profile
+// have one with every field empty.
 type Trainee struct {
-	ID           string    `json:"id"`
-	UserID       int       `json:"user_id"`
-	Age          int       `json:"age"`
-	Height       float64   `json:"height"`
-	Weight       float64   `json:"weight"`
-	FitnessGoals []string  `json:"fitness_goals"`
-	Injuries     []string  `json:"injuries"`
-	Preferences  []string  `json:"preferences"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-}
-
-// Workout represents a workout plan
+	// UserID identifies the trainee; trainee_id columns hold user IDs too
+	UserID            int           `json:"user_id"`
+	User              *User         `json:"user"`
+	Age               *int          `json:"age,omitempty"`
+	HeightCm          *float64      `json:"height_cm,omitempty"`
+	WeightKg          *float64      `json:"weight_kg,omitempty"`
+	FitnessLevel      *FitnessLevel `json:"fitness_level,omitempty"`
+	MedicalConditions *string       `json:"medical_conditions,omitempty"`
+	Goals             []string      `json:"goals"`
+	Injuries          []string      `json:"injuries"`
+	Preferences       []string      `json:"preferences"`
+	CreatedAt         *time.Time    `json:"created_at,omitempty"`
+	UpdatedAt         *time.Time    `json:"updated_at,omitempty"`
+}
+
+// Workout is a workout template written by a trainer
 type Workout struct {
-	ID          string    `json:"id"`
-	TrainerID   string    `json:"trainer_id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Duration    int       `json:"duration"`
-	Difficulty  string    `json:"difficulty"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID              int                `json:"id"`
+	TrainerID       *int               `json:"trainer_id,omitempty"`
+	Name            string             `json:"name"`
+	Description     string             `json:"description"`
+	DurationMinutes *int               `json:"duration_minutes,omitempty"`
+	Difficulty      *FitnessLevel      `json:"difficulty,omitempty"`
+	IsPublic        bool               `json:"is_public"`
+	Exercises       []*WorkoutExercise `json:"exercises"`
+	Blocks          []*WorkoutBlock    `json:"blocks"`
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+
+	// DeletedAt is set on deleted templates, which are kept for the workouts logged against them
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// WorkoutExercise is an exercise of a workout template with what the trainee
+// should do. Position orders the exercises of a template from 0.
+type WorkoutExercise struct {
+	ID              int          `json:"id"`
+	Position        int          `json:"position"`
+	Exercise        *Exercise    `json:"exercise"`
+	Sets            *int         `json:"sets,omitempty"`
+	Reps            *int         `json:"reps,omitempty"`
+	DurationSeconds *int         `json:"duration_seconds,omitempty"`
+	Notes           *string      `json:"notes,omitempty"`
+	SetTargets      []*SetTarget `json:"set_targets"`
+
+	// BlockID is the block the exercise is done in, if any
+	BlockID *int `json:"block_id,omitempty"`
+}
+
+// Exercise is an exercise of the shared library, or a custom exercise of the
+// trainer who owns it
+type Exercise struct {
+	ID          int        `json:"id"`
+	OwnerID     *int       `json:"owner_id,omitempty"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	MuscleGroup *string    `json:"muscle_group,omitempty"`
+	Equipment   *string    `json:"equipment,omitempty"`
+	VideoURL    *string    `json:"video_url,omitempty"`
+	Aliases     []string   `json:"aliases"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
-// CompletedWorkout represents a workout completed by a trainee
+// CompletedWorkout is a workout a trainee logged
 type CompletedWorkout struct {
-	ID        string   `json:"id"`
-	TraineeID string   `json:"trainee_id"`
-	Workout   *Workout `json:"workout"`
-	Date      string   `json:"date"`
-	Duration  int      `json:"duration"`
-	Notes     *string  `json:"notes,omitempty"`
-	Rating    *int     `json:"rating,omitempty"`
-}
-
-// ProgressPhoto represents a progress photo uploaded by a trainee
-type ProgressPhoto struct {
-	ID        string    `json:"id"`
-	TraineeID string    `json:"trainee_id"`
-	URL       string    `json:"url"`
-	Date      string    `json:"date"`
-	Notes     *string   `json:"notes,omitempty"`
-	Angle     string    `json:"angle"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// Trainer represents a trainer in the system
-type Trainer struct {
-	ID                string   `json:"id"`
-	UserID            int      `json:"user_id"`
-	Specialization    []string `json:"specialization"`
-	YearsOfExperience int      `json:"years_of_experience"`
-	Rating            *float64 `json:"rating,omitempty"`
-}
-
-// Message represents a message between trainee and trainer
-type Message struct {
-	ID        string    `json:"id"`
-	SenderID  string    `json:"sender_id"`
-	Content   string    `json:"content"`
-	Timestamp string    `json:"timestamp"`
-	IsRead    bool      `json:"is_read"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// UpdateProfileRequest contains the data needed to update a trainee's profile
+	ID                int        `json:"id"`
+	TraineeID         int        `json:"trainee_id"`
+	AssignedWorkoutID *int       `json:"assigned_workout_id,omitempty"`
+	Workout           *Workout   `json:"workout"`
+	StartTime         time.Time  `json:"start_time"`
+	EndTime           *time.Time `json:"end_time,omitempty"`
+	DurationMinutes   *int       `json:"duration_minutes,omitempty"`
+	Notes             *string    `json:"notes,omitempty"`
+	Rating            *int       `json:"rating,omitempty"`
+
+	// Exercises are the logged exercises in the order they were done, followed
+	// by the exercises of the template that were left out
+	Exercises []*ExerciseLog `json:"exercises"`
+}
+
+// UpdateProfileRequest contains the profile fields to change.
+// Fields that are left out or null keep their current value; an empty list clears one.
 type UpdateProfileRequest struct {
-	TraineeID    string   `json:"trainee_id"`
-	Age          *int     `json:"age,omitempty"`
-	Height       *float64 `json:"height,omitempty"`
-	Weight       *float64 `json:"weight,omitempty"`
-	FitnessGoals []string `json:"fitness_goals,omitempty"`
-	Injuries     []string `json:"injuries,omitempty"`
-	Preferences  []string `json:"preferences,omitempty"`
+	UserID            int           `json:"user_id"`
+	Age               *int          `json:"age,omitempty"`
+	HeightCm          *float64      `json:"height_cm,omitempty"`
+	WeightKg          *float64      `json:"weight_kg,omitempty"`
+	FitnessLevel      *FitnessLevel `json:"fitness_level,omitempty"`
+	MedicalConditions *string       `json:"medical_conditions,omitempty"`
+	Goals             *[]string     `json:"goals"`
+	Injuries          *[]string     `json:"injuries"`
+	Preferences       *[]string     `json:"preferences"`
 }
 
-// UpdateProfile updates the trainee's profile
+// LogWorkoutRequest contains a workout a trainee completed. With a start and
+// an end time the duration is the time between them; with neither the
+// workout is taken to have ended now.
+type LogWorkoutRequest struct {
+	TraineeID         int                  `json:"trainee_id"`
+	WorkoutID         int                  `json:"workout_id"`
+	AssignedWorkoutID *int                 `json:"assigned_workout_id,omitempty"`
+	StartTime         *time.Time           `json:"start_time,omitempty"`
+	EndTime           *time.Time           `json:"end_time,omitempty"`
+	DurationMinutes   int                  `json:"duration_minutes"`
+	Notes             *string              `json:"notes,omitempty"`
+	Rating            *int                 `json:"rating,omitempty"`
+	Exercises         []*ExerciseLogParams `json:"exercises,omitempty"`
+}
+
+// UpdateMyProfileParams contains the profile fields to change.
+// Fields that are left out or null keep their current value; an empty list clears one.
+type UpdateMyProfileParams struct {
+	Age               *int          `json:"age,omitempty"`
+	HeightCm          *float64      `json:"height_cm,omitempty"`
+	WeightKg          *float64      `json:"weight_kg,omitempty"`
+	FitnessLevel      *FitnessLevel `json:"fitness_level,omitempty"`
+	MedicalConditions *string       `json:"medical_conditions,omitempty"`
+	Goals             *[]string     `json:"goals"`
+	Injuries          *[]string     `json:"injuries"`
+	Preferences       *[]string     `json:"preferences"`
+}
+
+// LogMyWorkoutParams contains a workout the current user completed. With a
+// start and an end time the duration is the time between them; with neither
+// the workout is taken to have ended now.
+type LogMyWorkoutParams struct {
+	WorkoutID         int                  `json:"workout_id"`
+	AssignedWorkoutID *int                 `json:"assigned_workout_id,omitempty"`
+	StartTime         *time.Time           `json:"start_time,omitempty"`
+	EndTime           *time.Time           `json:"end_time,omitempty"`
+	DurationMinutes   int                  `json:"duration_minutes"`
+	Notes             *string              `json:"notes,omitempty"`
+	Rating            *int                 `json:"rating,omitempty"`
+	Exercises         []*ExerciseLogParams `json:"exercises,omitempty"`
+}
+
+// WorkoutsResponse lists workout templates
+type WorkoutsResponse struct {
+	Workouts []*Workout `json:"workouts"`
+}
+
+// WorkoutHistoryResponse lists logged workouts, most recent first
+type WorkoutHistoryResponse struct {
+	Workouts []*CompletedWorkout `json:"workouts"`
+}
+
+// GetMyProfile returns the fitness profile of the current user
 //
-//encore:api private method=POST path=/trainee/profile
-func UpdateProfile(ctx context.Context, req *UpdateProfileRequest) (*Trainee, error) {
-	// Start a transaction
-	tx, err := db.Begin(ctx)
+//encore:api auth method=GET path=/trainee/me/profile tag:scope_profile_read tag:scope_profile_write
+func GetMyProfile(ctx context.Context) (*Trainee, error) {
+	userID, err := admin.CurrentUserID()
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
-
-	// Update trainee profile
-	_, err = tx.Exec(ctx, `
-		UPDATE trainees
-		SET 
-			age = COALESCE($1, age),
-			height = COALESCE($2, height),
-			weight = COALESCE($3, weight),
-			fitness_goals = COALESCE($4, fitness_goals),
-			injuries = COALESCE($5, injuries),
-			preferences = COALESCE($6, preferences),
-			updated_at = NOW()
-		WHERE id = $7
-	`,
-		req.Age,
-		req.Height,
-		req.Weight,
-		req.FitnessGoals,
-		req.Injuries,
-		req.Preferences,
-		req.TraineeID,
-	)
+	return GetTraineeByID(ctx, userID)
+}
+
+// UpdateMyProfile changes the fitness profile of the current user
+//
+//encore:api auth method=POST path=/trainee/me/profile tag:scope_profile_write
+func UpdateMyProfile(ctx context.Context, params *UpdateMyProfileParams) (*Trainee, error) {
+	userID, err := admin.CurrentUserID()
 	if err != nil {
 		return nil, err
 	}
+	return UpdateProfile(ctx, &UpdateProfileRequest{
+		UserID:            userID,
+		Age:               params.Age,
+		HeightCm:          params.HeightCm,
+		WeightKg:          params.WeightKg,
+		FitnessLevel:      params.FitnessLevel,
+		MedicalConditions: params.MedicalConditions,
+		Goals:             params.Goals,
+		Injuries:          params.Injuries,
+		Preferences:       params.Preferences,
+	})
+}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
+// MyWorkouts returns the workouts assigned to the current user. Upcoming and
+// overdue assignments are listed by due date, the others newest first.
+//
+//encore:api auth method=GET path=/trainee/me/workouts tag:scope_workouts_read
+func MyWorkouts(ctx context.Context, params *MyWorkoutsParams) (*AssignmentsResponse, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
 		return nil, err
 	}
-
-	// Return the updated profile
-	return GetTraineeByID(ctx, req.TraineeID)
+	assignments, err := GetTraineeAssignments(ctx, userID, AssignmentStatus(params.Status))
+	if err != nil {
+		return nil, err
+	}
+	return &AssignmentsResponse{Assignments: assignments}, nil
 }
 
-// GetTraineeByID retrieves a trainee by ID
-func GetTraineeByID(ctx context.Context, traineeID string) (*Trainee, error) {
-	var t Trainee
-	err := db.QueryRow(ctx, `
-		SELECT id, user_id, age, height, weight, fitness_goals, injuries, preferences, created_at, updated_at
-		FROM trainees
-		WHERE id = $1
-	`, traineeID).Scan(
-		&t.ID,
-		&t.UserID,
-		&t.Age,
-		&t.Height,
-		&t.Weight,
-		&t.FitnessGoals,
-		&t.Injuries,
-		&t.Preferences,
-		&t.CreatedAt,
-		&t.UpdatedAt,
-	)
+// GetWorkout returns a workout template that is public, written by the current
+// user or assigned to them. Administrators may see every template.
+//
+//encore:api auth method=GET path=/trainee/workouts/:id tag:scope_workouts_read
+func GetWorkout(ctx context.Context, id int) (*Workout, error) {
+	caller, err := authz.CurrentCaller()
 	if err != nil {
 		return nil, err
 	}
-	return &t, nil
+	if err := checkWorkoutVisible(ctx, caller, id); err != nil {
+		return nil, err
+	}
+	return repo.GetWorkout(ctx, id)
 }
 
-// GetTraineeWorkouts retrieves all workouts for a trainee
-func GetTraineeWorkouts(ctx context.Context, traineeID string) ([]*Workout, error) {
-	rows, err := db.Query(ctx, `
-		SELECT w.id, w.trainer_id, w.name, w.description, w.duration, w.difficulty, w.created_at, w.updated_at
-		FROM workouts w
-		JOIN trainee_workouts tw ON w.id = tw.workout_id
-		WHERE tw.trainee_id = $1
-		ORDER BY w.created_at DESC
-	`, traineeID)
+// MyWorkoutHistory returns the workouts the current user logged, most recent first
+//
+//encore:api auth method=GET path=/trainee/me/workout-history tag:scope_workouts_read
+func MyWorkoutHistory(ctx context.Context) (*WorkoutHistoryResponse, error) {
+	userID, err := admin.CurrentUserID()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var workouts []*Workout
-	for rows.Next() {
-		var w Workout
-		if err := rows.Scan(
-			&w.ID,
-			&w.TrainerID,
-			&w.Name,
-			&w.Description,
-			&w.Duration,
-			&w.Difficulty,
-			&w.CreatedAt,
-			&w.UpdatedAt,
-		); err != nil {
-			return nil, err
-		}
-		workouts = append(workouts, &w)
+	workouts, err := repo.WorkoutHistory(ctx, userID)
+	if err != nil {
+		return nil, err
 	}
-	return workouts, nil
+	return &WorkoutHistoryResponse{Workouts: workouts}, nil
 }
 
-// LogWorkout logs a completed workout for a trainee
-func LogWorkout(ctx context.Context, traineeID string, workoutID string, duration int, notes *string, rating *int) (*CompletedWorkout, error) {
-	// Start a transaction
-	tx, err := db.Begin(ctx)
+// LogMyWorkout logs a workout the current user completed
+//
+//encore:api auth method=POST path=/trainee/me/workout-logs tag:scope_workouts_write
+func LogMyWorkout(ctx context.Context, params *LogMyWorkoutParams) (*CompletedWorkout, error) {
+	userID, err := admin.CurrentUserID()
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
-
-	// Get workout details
-	var workout Workout
-	err = tx.QueryRow(ctx, `
-		SELECT id, trainer_id, name, description, duration, difficulty
-		FROM workouts
-		WHERE id = $1
-	`, workoutID).Scan(
-		&workout.ID,
-		&workout.TrainerID,
-		&workout.Name,
-		&workout.Description,
-		&workout.Duration,
-		&workout.Difficulty,
-	)
+	caller, err := authz.CurrentCaller()
 	if err != nil {
 		return nil, err
 	}
+	if err := checkWorkoutVisible(ctx, caller, params.WorkoutID); err != nil {
+		return nil, err
+	}
+	return LogWorkout(ctx, &LogWorkoutRequest{
+		TraineeID:         userID,
+		WorkoutID:         params.WorkoutID,
+		AssignedWorkoutID: params.AssignedWorkoutID,
+		StartTime:         params.StartTime,
+		EndTime:           params.EndTime,
+		DurationMinutes:   params.DurationMinutes,
+		Notes:             params.Notes,
+		Rating:            params.Rating,
+		Exercises:         params.Exercises,
+	})
+}
+
+// UpdateProfile updates the trainee's profile, creating it on first use
+//
+//encore:api private method=POST path=/trainee/profile tag:scope_profile_write
+func UpdateProfile(ctx context.Context, req *UpdateProfileRequest) (*Trainee, error) {
+	if err := validateProfile(req); err != nil {
+		return nil, err
+	}
 
-	// Log the completed workout
-	var completedWorkoutID string
-	err = tx.QueryRow(ctx, `
-		INSERT INTO completed_workouts (trainee_id, workout_id, date, duration, notes, rating)
-		VALUES ($1, $2, NOW(), $3, $4, $5)
-		RETURNING id
-	`, traineeID, workoutID, duration, notes, rating).Scan(&completedWorkoutID)
+	before, err := GetTraineeByID(ctx, req.UserID)
 	if err != nil {
 		return nil, err
 	}
+	after, err := repo.UpdateProfile(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	audit.Record(ctx, audit.Change{
+		Action:     "trainee.update_profile",
+		EntityType: "trainee",
+		EntityID:   strconv.Itoa(req.UserID),
+		Before:     before,
+		After:      after,
+	})
+	return after, nil
+}
+
+// GetTraineeByID retrieves the profile of a trainee by their user ID
+func GetTraineeByID(ctx context.Context, userID int) (*Trainee, error) {
+	return repo.GetProfile(ctx, userID)
+}
+
+// LogWorkout logs a completed workout for a trainee. Logging it against an
+// assignment completes the assignment.
+func LogWorkout(ctx context.Context, req *LogWorkoutRequest) (*CompletedWorkout, error) {
+	if req.StartTime != nil && req.EndTime != nil {
+		if !req.EndTime.After(*req.StartTime) {
+			return nil, invalidArgument("the end time must be after the start time")
+		}
+		req.DurationMinutes = int(req.EndTime.Sub(*req.StartTime).Round(time.Minute) / time.Minute)
+	}
+	if req.DurationMinutes < 0 {
+		return nil, invalidArgument("duration must not be negative")
+	}
+	if req.Rating != nil && (*req.Rating < 1 || *req.Rating > 5) {
+		return nil, invalidArgument("rating must be between 1 and 5")
+	}
+	if err := validateExerciseLogs(req.Exercises); err != nil {
+		return nil, err
+	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
+	completed, err := repo.LogWorkout(ctx, req)
+	if err != nil {
 		return nil, err
 	}
 
-	return &CompletedWorkout{
-		ID:        completedWorkoutID,
-		TraineeID: traineeID,
-		Workout:   &workout,
-		Date:      time.Now().Format(time.RFC3339),
-		Duration:  duration,
-		Notes:     notes,
-		Rating:    rating,
-	}, nil
+	audit.Record(ctx, audit.Change{
+		Action:     "workout.log",
+		EntityType: "workout_log",
+		EntityID:   strconv.Itoa(completed.ID),
+		After:      completed,
+	})
+	return completed, nil
+}
+
+// checkWorkoutVisible returns errWorkoutNotFound unless the caller may see a
+// workout, so hidden templates can't be told apart from missing ones
+func checkWorkoutVisible(ctx context.Context, caller *authz.Caller, workoutID int) error {
+	if caller.IsAdmin() {
+		return nil
+	}
+	ok, err := repo.CanSeeWorkout(ctx, caller.UserID, workoutID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errWorkoutNotFound
+	}
+	return nil
+}
+
+// validateProfile checks the ranges the profile columns can hold
+func validateProfile(req *UpdateProfileRequest) error {
+	switch {
+	case req.Age != nil && (*req.Age < 1 || *req.Age > 120):
+		return invalidArgument("age must be between 1 and 120")
+	case req.HeightCm != nil && (*req.HeightCm <= 0 || *req.HeightCm >= 1000):
+		return invalidArgument("height must be between 0 and 1000 cm")
+	case req.WeightKg != nil && (*req.WeightKg <= 0 || *req.WeightKg >= 1000):
+		return invalidArgument("weight must be between 0 and 1000 kg")
+	case req.FitnessLevel != nil && !req.FitnessLevel.Valid():
+		return invalidArgument("unknown fitness level")
+	}
+	for _, list := range []*[]string{req.Goals, req.Injuries, req.Preferences} {
+		if list == nil {
+			continue
+		}
+		for _, item := range *list {
+			if strings.TrimSpace(item) == "" {
+				return invalidArgument("list entries must not be empty")
+			}
+		}
+	}
+	return nil
+}
+
+func invalidArgument(msg string) error {
+	return &errs.Error{
+		Code:    errs.InvalidArgument,
+		Message: msg,
+	}
 }
 
 // Define the database connection
 var db = sqldb.Named("trainee")
+
+// repo is the data access used by the endpoints
+var repo Repository = NewPostgresRepository(db)
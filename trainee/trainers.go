@@ -0,0 +1,360 @@
+package trainee
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"encore.app/admin"
+	"encore.app/audit"
+	"encore.app/authz"
+	"encore.dev/beta/errs"
+)
+
+const messageMaxLength = 5000
+
+// Trainer is a trainer coaching a trainee
+type Trainer struct {
+	User  *User      `json:"user"`
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Message is a message between a trainee and a trainer
+type Message struct {
+	ID         int        `json:"id"`
+	SenderID   int        `json:"sender_id"`
+	Sender     *User      `json:"sender"`
+	ReceiverID int        `json:"receiver_id"`
+	Content    string     `json:"content"`
+	IsRead     bool       `json:"is_read"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TrainersResponse lists trainers
+type TrainersResponse struct {
+	Trainers []*Trainer `json:"trainers"`
+}
+
+// RequestTrainerResponse reports whether a new request was made
+type RequestTrainerResponse struct {
+	Requested bool `json:"requested"`
+}
+
+// MessagesResponse lists messages, oldest first
+type MessagesResponse struct {
+	Messages []*Message `json:"messages"`
+}
+
+// SendMessageParams contains a message to send
+type SendMessageParams struct {
+	Content string `json:"content"`
+}
+
+// IsTrainerOfResponse reports whether a trainer coaches a trainee
+type IsTrainerOfResponse struct {
+	Coaching bool `json:"coaching"`
+}
+
+// MyTrainers returns the trainers actively coaching the current user
+//
+//encore:api auth method=GET path=/trainee/me/trainers tag:scope_profile_read
+func MyTrainers(ctx context.Context) (*TrainersResponse, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	trainers, err := repo.Trainers(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &TrainersResponse{Trainers: trainers}, nil
+}
+
+// RequestTrainer asks a trainer to coach the current user. The request
+// becomes an inactive relationship until the trainer accepts it.
+//
+//encore:api auth method=POST path=/trainee/me/trainers/:id/request
+func RequestTrainer(ctx context.Context, id int) (*RequestTrainerResponse, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	if id == userID {
+		return nil, invalidArgument("you can't be your own trainer")
+	}
+
+	trainer, err := GetUser(ctx, id)
+	if err != nil || trainer.Status != string(admin.UserStatusActive) || !slices.Contains(trainer.Roles, authz.RoleTrainer) {
+		return nil, &errs.Error{
+			Code:    errs.NotFound,
+			Message: "trainer not found",
+		}
+	}
+
+	requested, err := repo.RequestTrainer(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if requested {
+		audit.Record(ctx, audit.Change{
+			Action:     "trainer.request",
+			EntityType: "user",
+			EntityID:   strconv.Itoa(id),
+		})
+	}
+	return &RequestTrainerResponse{Requested: requested}, nil
+}
+
+// MyMessages returns the messages between the current user and a trainer
+//
+//encore:api auth method=GET path=/trainee/me/trainers/:id/messages
+func MyMessages(ctx context.Context, id int) (*MessagesResponse, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+	messages, err := repo.Messages(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &MessagesResponse{Messages: messages}, nil
+}
+
+// SendMessage sends a message from the current user to a trainer coaching them
+//
+//encore:api auth method=POST path=/trainee/me/trainers/:id/messages
+func SendMessage(ctx context.Context, id int, params *SendMessageParams) (*Message, error) {
+	userID, err := admin.CurrentUserID()
+	if err != nil {
+		return nil, err
+	}
+
+	content := strings.TrimSpace(params.Content)
+	switch n := utf8.RuneCountInString(content); {
+	case n == 0:
+		return nil, invalidArgument("the message is empty")
+	case n > messageMaxLength:
+		return nil, invalidArgument(fmt.Sprintf("messages must be at most %d characters", messageMaxLength))
+	}
+
+	ok, err := repo.IsTrainerOf(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &errs.Error{
+			Code:    errs.FailedPrecondition,
+			Message: "you can only message trainers who coach you",
+		}
+	}
+	return repo.SendMessage(ctx, userID, id, content)
+}
+
+// IsTrainerOf reports whether there is an active trainer-trainee relationship
+// between two users. The relationships belong to this service, so other
+// services ask it rather than reading them.
+//
+//encore:api private method=GET path=/trainee/trainers/:trainerID/trainees/:traineeID
+func IsTrainerOf(ctx context.Context, trainerID, traineeID int) (*IsTrainerOfResponse, error) {
+	ok, err := repo.IsTrainerOf(ctx, trainerID, traineeID)
+	if err != nil {
+		return nil, err
+	}
+	return &IsTrainerOfResponse{Coaching: ok}, nil
+}
+
+// canViewTrainee reports whether the caller may see a trainee's data.
+// Trainees can see their own data, trainers the data of the trainees they
+// actively coach, and admins everything.
+func canViewTrainee(ctx context.Context, caller *authz.Caller, traineeID int) (bool, error) {
+	if caller.UserID == traineeID || caller.Can(authz.PermViewAllTrainees) {
+		return true, nil
+	}
+	if !caller.Can(authz.PermCoachTrainees) {
+		return false, nil
+	}
+	return repo.IsTrainerOf(ctx, caller.UserID, traineeID)
+}
+
+// canManageTrainee reports whether the caller may act on behalf of a trainee,
+// for example to assign them a workout
+func canManageTrainee(ctx context.Context, caller *authz.Caller, traineeID int) (bool, error) {
+	if caller.IsAdmin() {
+		return true, nil
+	}
+	if !caller.Can(authz.PermCoachTrainees) {
+		return false, nil
+	}
+	return repo.IsTrainerOf(ctx, caller.UserID, traineeID)
+}
+
+// Trainers returns the active trainers of a trainee
+func (r *postgresRepository) Trainers(ctx context.Context, traineeID int) ([]*Trainer, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+userColumns+`, t.start_date
+		FROM trainer_trainee_relationships t
+		JOIN user_projections u ON u.user_id = t.trainer_id
+		WHERE t.trainee_id = $1 AND t.is_active
+			AND (t.end_date IS NULL OR t.end_date > NOW())
+			AND u.status <> 'DELETED'
+		ORDER BY t.start_date, t.trainer_id
+	`, traineeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trainers := []*Trainer{}
+	for rows.Next() {
+		var t Trainer
+		u, err := scanUser(rows, &t.Since)
+		if err != nil {
+			return nil, err
+		}
+		t.User = u
+		trainers = append(trainers, &t)
+	}
+	return trainers, rows.Err()
+}
+
+// IsTrainerOf looks for an active relationship that hasn't ended
+func (r *postgresRepository) IsTrainerOf(ctx context.Context, trainerID, traineeID int) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM trainer_trainee_relationships
+			WHERE trainer_id = $1 AND trainee_id = $2 AND is_active
+				AND (end_date IS NULL OR end_date > NOW())
+		)
+	`, trainerID, traineeID).Scan(&exists)
+	return exists, err
+}
+
+// RequestTrainer inserts an inactive relationship unless there is one already
+func (r *postgresRepository) RequestTrainer(ctx context.Context, trainerID, traineeID int) (bool, error) {
+	res, err := r.db.Exec(ctx, `
+		INSERT INTO trainer_trainee_relationships (trainer_id, trainee_id, is_active, start_date, created_at, updated_at)
+		VALUES ($1, $2, FALSE, NULL, NOW(), NOW())
+		ON CONFLICT (trainer_id, trainee_id) DO NOTHING
+	`, trainerID, traineeID)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// Messages returns the messages between two users
+func (r *postgresRepository) Messages(ctx context.Context, userID, otherID int) ([]*Message, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT `+messageColumns+`
+		FROM messages m
+		LEFT JOIN user_projections u ON u.user_id = m.sender_id
+		WHERE (m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1)
+		ORDER BY m.created_at, m.id
+	`, userID, otherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*Message{}
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// SendMessage inserts a message
+func (r *postgresRepository) SendMessage(ctx context.Context, senderID, receiverID int, content string) (*Message, error) {
+	return scanMessage(r.db.QueryRow(ctx, `
+		WITH m AS (
+			INSERT INTO messages (sender_id, receiver_id, content, is_read, created_at, updated_at)
+			VALUES ($1, $2, $3, FALSE, NOW(), NOW())
+			RETURNING *
+		)
+		SELECT `+messageColumns+`
+		FROM m
+		LEFT JOIN user_projections u ON u.user_id = m.sender_id
+	`, senderID, receiverID, content))
+}
+
+// userColumns are the columns scanUser reads, from user_projections aliased u
+const userColumns = `u.user_id, u.username, u.fullname, u.roles, u.status, u.created_at`
+
+// scanUser reads the userColumns followed by the given trailing columns
+func scanUser(row interface{ Scan(...interface{}) error }, trailing ...interface{}) (*User, error) {
+	var u User
+	var roles []string
+	err := row.Scan(append([]interface{}{
+		&u.ID,
+		&u.Username,
+		&u.Fullname,
+		&roles,
+		&u.Status,
+		&u.CreatedAt,
+	}, trailing...)...)
+	if err != nil {
+		return nil, err
+	}
+	u.Roles = make([]authz.Role, len(roles))
+	for i, r := range roles {
+		u.Roles[i] = authz.Role(r)
+	}
+	return &u, nil
+}
+
+// messageColumns are the columns scanMessage reads, from messages aliased m
+// joined with the sender's projection aliased u
+const messageColumns = `m.id, m.sender_id, m.receiver_id, m.content, COALESCE(m.is_read, FALSE), m.read_at, m.created_at,
+			u.user_id, u.username, u.fullname, u.roles, u.status, u.created_at`
+
+func scanMessage(row interface{ Scan(...interface{}) error }) (*Message, error) {
+	var m Message
+	var (
+		senderID                   *int
+		username, fullname, status *string
+		roles                      []string
+		senderCreatedAt            *time.Time
+	)
+	err := row.Scan(
+		&m.ID,
+		&m.SenderID,
+		&m.ReceiverID,
+		&m.Content,
+		&m.IsRead,
+		&m.ReadAt,
+		&m.CreatedAt,
+		&senderID,
+		&username,
+		&fullname,
+		&roles,
+		&status,
+		&senderCreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Senders missing from the projection are shown by ID only
+	m.Sender = &User{ID: m.SenderID, Roles: []authz.Role{}}
+	if senderID != nil {
+		m.Sender.Username = *username
+		m.Sender.Fullname = *fullname
+		m.Sender.Status = *status
+		m.Sender.CreatedAt = *senderCreatedAt
+		for _, r := range roles {
+			m.Sender.Roles = append(m.Sender.Roles, authz.Role(r))
+		}
+	}
+	return &m, nil
+}
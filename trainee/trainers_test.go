@@ -0,0 +1,82 @@
+//go:build encore_app
+
+package trainee
+
+import (
+	"context"
+	"testing"
+
+	"encore.app/authz"
+)
+
+func TestIsTrainerOf(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	coachTestTrainee(t, ctx, trainerID, traineeID)
+
+	// Requested and ended relationships don't count
+	requested := createTestUser(t, ctx, authz.RoleTrainee)
+	if _, err := repo.RequestTrainer(ctx, trainerID, requested); err != nil {
+		t.Fatal(err)
+	}
+	ended := createTestUser(t, ctx, authz.RoleTrainee)
+	_, err := db.Exec(ctx, `
+		INSERT INTO trainer_trainee_relationships (trainer_id, trainee_id, is_active, start_date, end_date, created_at, updated_at)
+		VALUES ($1, $2, TRUE, NOW() - INTERVAL '2 days', NOW() - INTERVAL '1 day', NOW(), NOW())
+	`, trainerID, ended)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		trainerID, traineeID int
+		want                 bool
+	}{
+		{trainerID, traineeID, true},
+		{traineeID, trainerID, false},
+		{trainerID, requested, false},
+		{trainerID, ended, false},
+	}
+	for _, tt := range tests {
+		resp, err := IsTrainerOf(ctx, tt.trainerID, tt.traineeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Coaching != tt.want {
+			t.Errorf("got %v for trainer %d of trainee %d, want %v", resp.Coaching, tt.trainerID, tt.traineeID, tt.want)
+		}
+	}
+}
+
+func TestCanManageTrainee(t *testing.T) {
+	ctx := context.Background()
+	trainerID := createTestUser(t, ctx, authz.RoleTrainer)
+	traineeID := createTestUser(t, ctx, authz.RoleTrainee)
+	coachTestTrainee(t, ctx, trainerID, traineeID)
+	otherTrainer := createTestUser(t, ctx, authz.RoleTrainer)
+
+	tests := []struct {
+		name         string
+		caller       *authz.Caller
+		view, manage bool
+	}{
+		{"coaching trainer", &authz.Caller{UserID: trainerID, Roles: []authz.Role{authz.RoleTrainer}}, true, true},
+		{"other trainer", &authz.Caller{UserID: otherTrainer, Roles: []authz.Role{authz.RoleTrainer}}, false, false},
+		{"the trainee", &authz.Caller{UserID: traineeID, Roles: []authz.Role{authz.RoleTrainee}}, true, false},
+		{"admin", &authz.Caller{UserID: otherTrainer, Roles: []authz.Role{authz.RoleAdmin}}, true, true},
+	}
+	for _, tt := range tests {
+		view, err := canViewTrainee(ctx, tt.caller, traineeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manage, err := canManageTrainee(ctx, tt.caller, traineeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if view != tt.view || manage != tt.manage {
+			t.Errorf("%s: got view %v and manage %v, want %v and %v", tt.name, view, manage, tt.view, tt.manage)
+		}
+	}
+}
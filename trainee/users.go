@@ -0,0 +1,89 @@
+package trainee
+
+import (
+	"context"
+	"time"
+
+	"encore.app/admin"
+	"encore.app/authz"
+	"encore.dev/pubsub"
+	"encore.dev/rlog"
+)
+
+// User is the trainee service's copy of a user owned by the admin service
+type User struct {
+	ID        int          `json:"id"`
+	Username  string       `json:"username"`
+	Fullname  string       `json:"fullname"`
+	Roles     []authz.Role `json:"roles"`
+	Status    string       `json:"status"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+var _ = pubsub.NewSubscription(admin.UserCreatedEvents, "trainee-user-created", pubsub.SubscriptionConfig[*admin.UserCreated]{
+	Handler: func(ctx context.Context, event *admin.UserCreated) error {
+		return projectUser(ctx, event.User)
+	},
+})
+
+var _ = pubsub.NewSubscription(admin.UserUpdatedEvents, "trainee-user-updated", pubsub.SubscriptionConfig[*admin.UserUpdated]{
+	Handler: func(ctx context.Context, event *admin.UserUpdated) error {
+		return projectUser(ctx, event.User)
+	},
+})
+
+var _ = pubsub.NewSubscription(admin.UserDeletedEvents, "trainee-user-deleted", pubsub.SubscriptionConfig[*admin.UserDeleted]{
+	Handler: func(ctx context.Context, event *admin.UserDeleted) error {
+		return projectUser(ctx, event.User)
+	},
+})
+
+// projectUser stores a user snapshot unless a later one is already stored.
+// Events may arrive out of order or more than once, so every event is handled
+// the same way; deleted users are kept with status DELETED.
+func projectUser(ctx context.Context, s *admin.UserSnapshot) error {
+	roles := make([]string, len(s.Roles))
+	for i, r := range s.Roles {
+		roles[i] = string(r)
+	}
+
+	res, err := db.Exec(ctx, `
+		INSERT INTO user_projections (user_id, username, fullname, roles, status, created_at, version, synced_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET username = EXCLUDED.username,
+			fullname = EXCLUDED.fullname,
+			roles = EXCLUDED.roles,
+			status = EXCLUDED.status,
+			created_at = EXCLUDED.created_at,
+			version = EXCLUDED.version,
+			synced_at = NOW()
+		WHERE user_projections.version < EXCLUDED.version
+	`, s.ID, s.Username, s.Fullname, roles, s.Status, s.CreatedAt, s.Version)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		rlog.Debug("ignored stale user snapshot", "user_id", s.ID, "version", s.Version)
+	}
+	return nil
+}
+
+// GetUser returns the trainee service's copy of a user
+func GetUser(ctx context.Context, userID int) (*User, error) {
+	var u User
+	var roles []string
+	err := db.QueryRow(ctx, `
+		SELECT user_id, username, fullname, roles, status, created_at
+		FROM user_projections
+		WHERE user_id = $1
+	`, userID).Scan(&u.ID, &u.Username, &u.Fullname, &roles, &u.Status, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	u.Roles = make([]authz.Role, len(roles))
+	for i, r := range roles {
+		u.Roles[i] = authz.Role(r)
+	}
+	return &u, nil
+}